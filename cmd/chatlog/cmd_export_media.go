@@ -0,0 +1,61 @@
+package chatlog
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sjzar/chatlog/internal/chatlog"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(exportMediaCmd)
+	exportMediaCmd.Flags().StringVarP(&exportMediaPlatform, "platform", "p", "", "platform")
+	exportMediaCmd.Flags().IntVarP(&exportMediaVer, "version", "v", 0, "version")
+	exportMediaCmd.Flags().StringVarP(&exportMediaDataDir, "data-dir", "d", "", "data dir")
+	exportMediaCmd.Flags().StringVarP(&exportMediaWorkDir, "work-dir", "w", "", "work dir")
+	exportMediaCmd.Flags().StringVar(&exportMediaTalker, "talker", "", "talkers to export, separated by comma, all sessions if empty")
+	exportMediaCmd.Flags().StringVar(&exportMediaTime, "time", "", "time range, e.g. 2024-01-01~2024-06-30")
+	exportMediaCmd.Flags().StringVarP(&exportMediaOut, "out", "o", "", "output dir, <work-dir>/export/media if empty")
+}
+
+var (
+	exportMediaPlatform string
+	exportMediaVer      int
+	exportMediaDataDir  string
+	exportMediaWorkDir  string
+	exportMediaTalker   string
+	exportMediaTime     string
+	exportMediaOut      string
+)
+
+var exportMediaCmd = &cobra.Command{
+	Use:   "export-media",
+	Short: "export decrypted images and videos",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmdConf := make(map[string]any)
+		if len(exportMediaDataDir) != 0 {
+			cmdConf["data_dir"] = exportMediaDataDir
+		}
+		if len(exportMediaWorkDir) != 0 {
+			cmdConf["work_dir"] = exportMediaWorkDir
+		}
+		if len(exportMediaPlatform) != 0 {
+			cmdConf["platform"] = exportMediaPlatform
+		}
+		if exportMediaVer != 0 {
+			cmdConf["version"] = exportMediaVer
+		}
+
+		m := chatlog.New()
+		report, err := m.CommandExportMedia("", cmdConf, exportMediaTalker, exportMediaTime, exportMediaOut)
+		if err != nil {
+			log.Err(err).Msg("failed to export media")
+			return
+		}
+		b, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(b))
+	},
+}
@@ -19,17 +19,23 @@ func init() {
 	serverCmd.Flags().StringVarP(&serverImgKey, "img-key", "i", "", "img key")
 	serverCmd.Flags().StringVarP(&serverWorkDir, "work-dir", "w", "", "work dir")
 	serverCmd.Flags().BoolVarP(&serverAutoDecrypt, "auto-decrypt", "", false, "auto decrypt")
+	serverCmd.Flags().StringVarP(&serverDecryptMode, "decrypt-mode", "", "", "decrypt mode: copy or vfs")
+	serverCmd.Flags().BoolVarP(&serverEncryptWorkDir, "encrypt-work-dir", "", false, "encrypt decrypted databases and indexes in work dir with a passphrase")
+	serverCmd.Flags().IntVarP(&serverDecryptWorkers, "decrypt-workers", "", 0, "number of database files decrypted in parallel")
 }
 
 var (
-	serverAddr        string
-	serverDataDir     string
-	serverDataKey     string
-	serverImgKey      string
-	serverWorkDir     string
-	serverPlatform    string
-	serverVer         int
-	serverAutoDecrypt bool
+	serverAddr           string
+	serverDataDir        string
+	serverDataKey        string
+	serverImgKey         string
+	serverWorkDir        string
+	serverPlatform       string
+	serverVer            int
+	serverAutoDecrypt    bool
+	serverDecryptMode    string
+	serverEncryptWorkDir bool
+	serverDecryptWorkers int
 )
 
 var serverCmd = &cobra.Command{
@@ -74,5 +80,14 @@ func getServerConfig() map[string]any {
 	if serverAutoDecrypt {
 		cmdConf["auto_decrypt"] = true
 	}
+	if len(serverDecryptMode) != 0 {
+		cmdConf["decrypt_mode"] = serverDecryptMode
+	}
+	if serverEncryptWorkDir {
+		cmdConf["encrypt_work_dir"] = true
+	}
+	if serverDecryptWorkers > 0 {
+		cmdConf["decrypt_workers"] = serverDecryptWorkers
+	}
 	return cmdConf
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/sjzar/chatlog/internal/chatlog/conf"
 	"github.com/sjzar/chatlog/internal/chatlog/ctx"
+	cwechat "github.com/sjzar/chatlog/internal/chatlog/wechat"
 	"github.com/sjzar/chatlog/internal/ui/footer"
 	"github.com/sjzar/chatlog/internal/ui/form"
 	"github.com/sjzar/chatlog/internal/ui/help"
@@ -44,6 +45,7 @@ const (
 	settingKeyOpenAITimeout   settingsKey = "openai_timeout"
 	settingKeyWhisperModel    settingsKey = "whisper_model"
 	settingKeyWhisperThreads  settingsKey = "whisper_threads"
+	settingKeyWebhook         settingsKey = "webhook"
 )
 
 type App struct {
@@ -233,12 +235,38 @@ func (a *App) refresh() {
 			} else {
 				a.infoBar.UpdateAutoDecrypt("[未开启]")
 			}
+			a.infoBar.UpdateDecrypt(formatDecryptProgress(a.m.DecryptProgress(), a.m.LastDecryptReport()))
 
 			a.Draw()
 		}
 	}
 }
 
+// formatDecryptProgress 批量解密进度，解密中显示已处理数与当前文件，结束后显示结果汇总
+func formatDecryptProgress(progress cwechat.DecryptProgress, report *cwechat.DecryptReport) string {
+	if progress.Running {
+		return fmt.Sprintf("[yellow][%d/%d][white] %s", progress.Done, progress.Total, progress.File)
+	}
+	if report == nil {
+		return ""
+	}
+	text := fmt.Sprintf("[green][%d/%d][white] 解密 %d，跳过 %d", report.Total-len(report.Failures), report.Total, report.Decrypted, report.Skipped)
+	if len(report.Failures) > 0 {
+		text += fmt.Sprintf("，[red]失败 %d[white] (%s: %s)", len(report.Failures), report.Failures[0].File, report.Failures[0].Error)
+	}
+	return text
+}
+
+// formatDecryptFailures 解密完成后的失败文件列表
+func formatDecryptFailures(report *cwechat.DecryptReport) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("解密完成，%d 个文件失败:\n", len(report.Failures)))
+	for _, failure := range report.Failures {
+		sb.WriteString(fmt.Sprintf("\n%s: %s", failure.File, failure.Error))
+	}
+	return sb.String()
+}
+
 func (a *App) inputCapture(event *tcell.EventKey) *tcell.EventKey {
 
 	// 如果当前页面不是主页面，ESC 键返回主页面
@@ -292,7 +320,13 @@ func (a *App) initMenu() {
 						modal.SetText("获取密钥失败: " + err.Error())
 					} else {
 						// 解密成功
-						modal.SetText("获取密钥成功")
+						text := "获取密钥成功"
+						if a.ctx.Current != nil && a.ctx.Current.KeyReport != nil {
+							if failed := a.ctx.Current.KeyReport.Failed(); len(failed) > 0 {
+								text += fmt.Sprintf("\n\n%d 个数据库无法以该密钥打开:\n%s", len(failed), a.ctx.Current.KeyReport.String())
+							}
+						}
+						modal.SetText(text)
 						a.refreshSettingsMenu()
 					}
 
@@ -329,6 +363,9 @@ func (a *App) initMenu() {
 					if err != nil {
 						// 解密失败
 						modal.SetText("解密失败: " + err.Error())
+					} else if report := a.m.LastDecryptReport(); report != nil && len(report.Failures) > 0 {
+						// 部分文件解密失败
+						modal.SetText(formatDecryptFailures(report))
 					} else {
 						// 解密成功
 						modal.SetText("解密数据成功")
@@ -552,6 +589,7 @@ func (a *App) initSettingsTab() {
 		a.newSettingsItem(12, "设置 OpenAI Base URL", settingKeyOpenAIBaseURL, a.settingOpenAIBaseURL),
 		a.newSettingsItem(13, "设置 OpenAI 代理", settingKeyOpenAIProxy, a.settingOpenAIProxy),
 		a.newSettingsItem(14, "设置 OpenAI 请求超时", settingKeyOpenAITimeout, a.settingOpenAITimeout),
+		a.newSettingsItem(15, "设置 Webhook", settingKeyWebhook, a.settingWebhooks),
 	}
 
 	a.settingsMenu.SetItems(a.settingsItems)
@@ -704,6 +742,10 @@ func (a *App) refreshSettingsMenu() {
 		item.Description = fmt.Sprintf("当前请求超时: %s", formatTimeoutSummary(timeoutValue))
 	}
 
+	if item := a.settingsItemMap[settingKeyWebhook]; item != nil {
+		item.Description = a.webhookSummary()
+	}
+
 	a.settingsMenu.SetItems(a.settingsItems)
 }
 
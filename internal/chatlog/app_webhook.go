@@ -0,0 +1,201 @@
+package chatlog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/chatlog/webhook"
+	"github.com/sjzar/chatlog/internal/ui/form"
+	"github.com/sjzar/chatlog/internal/ui/menu"
+)
+
+// webhookSummary 设置菜单中 webhook 的概况
+func (a *App) webhookSummary() string {
+	items := a.m.db.WebhookItems()
+	enabled := 0
+	for _, item := range items {
+		if !item.Disabled {
+			enabled++
+		}
+	}
+	return fmt.Sprintf("已配置 %d 个，启用 %d 个", len(items), enabled)
+}
+
+// settingWebhooks 列出配置的 webhook，选择后可编辑、停用、测试或删除，修改保存后立即生效
+func (a *App) settingWebhooks() {
+	subMenu := menu.NewSubMenu("Webhook")
+
+	subMenu.AddItem(&menu.Item{
+		Index:       0,
+		Name:        "添加 webhook",
+		Description: "推送新消息、撤回提示或联系人、群聊、会话的变更",
+		Selected: func(*menu.Item) {
+			a.editWebhook("", &conf.WebhookItem{Type: webhook.TypeMessage})
+		},
+	})
+
+	for idx, item := range a.m.db.WebhookItems() {
+		name := fmt.Sprintf("%s: %s", item.Type, item.URL)
+		if item.Disabled {
+			name = name + " (已停用)"
+		}
+		subMenu.AddItem(&menu.Item{
+			Index:       idx + 1,
+			Name:        name,
+			Description: fmt.Sprintf("会话: %s", formatPathWithFallback(item.Talker, "未设置")),
+			Selected: func(item *conf.WebhookItem) func(*menu.Item) {
+				return func(*menu.Item) {
+					a.webhookActions(item)
+				}
+			}(item),
+		})
+	}
+
+	a.mainPages.AddPage("submenu", subMenu, true, true)
+	a.SetFocus(subMenu)
+}
+
+// webhookActions 显示单个 webhook 的操作
+func (a *App) webhookActions(item *conf.WebhookItem) {
+	id := webhook.ItemID(item)
+	toggle := "停用"
+	if item.Disabled {
+		toggle = "启用"
+	}
+	buttons := []string{"编辑", toggle, "发送测试", "删除", "取消"}
+	a.showModal(fmt.Sprintf("%s\n%s", item.Type, item.URL), buttons, func(buttonIndex int, buttonLabel string) {
+		a.mainPages.RemovePage("modal")
+
+		switch buttonLabel {
+		case "编辑":
+			edited := *item
+			a.editWebhook(id, &edited)
+		case toggle:
+			updated := *item
+			updated.Disabled = !item.Disabled
+			if err := a.m.db.UpdateWebhook(id, &updated); err != nil {
+				a.showError(err)
+				return
+			}
+			a.reloadWebhookMenu()
+			a.showInfo(fmt.Sprintf("已%s webhook", toggle))
+		case "发送测试":
+			a.testWebhook(item)
+		case "删除":
+			a.showModal("删除后未完成的投递将被丢弃，确认删除？", []string{"删除", "取消"}, func(buttonIndex int, buttonLabel string) {
+				a.mainPages.RemovePage("modal")
+				if buttonLabel != "删除" {
+					return
+				}
+				if err := a.m.db.DeleteWebhook(id); err != nil {
+					a.showError(err)
+					return
+				}
+				a.reloadWebhookMenu()
+				a.showInfo("已删除 webhook")
+			})
+		}
+	})
+}
+
+// editWebhook 编辑 webhook，id 为空时添加
+// 表单只包含常用字段，模板、过滤条件等其余配置保持不变
+func (a *App) editWebhook(id string, item *conf.WebhookItem) {
+	// 表单打开期间关闭列表，避免 ESC 只关闭下层的列表
+	a.mainPages.RemovePage("submenu")
+
+	title := "编辑 Webhook"
+	if id == "" {
+		title = "添加 Webhook"
+	}
+	formView := form.NewForm(title)
+
+	formView.AddInputField("类型", item.Type, 0, nil, func(text string) {
+		item.Type = strings.TrimSpace(text)
+	})
+	formView.AddInputField("地址", item.URL, 0, nil, func(text string) {
+		item.URL = strings.TrimSpace(text)
+	})
+	formView.AddInputField("会话", item.Talker, 0, nil, func(text string) {
+		item.Talker = strings.TrimSpace(text)
+	})
+	formView.AddInputField("发送人", item.Sender, 0, nil, func(text string) {
+		item.Sender = strings.TrimSpace(text)
+	})
+	formView.AddInputField("关键词", item.Keyword, 0, nil, func(text string) {
+		item.Keyword = strings.TrimSpace(text)
+	})
+	formView.AddInputField("内置格式", item.Preset, 0, nil, func(text string) {
+		item.Preset = strings.TrimSpace(text)
+	})
+	formView.AddInputField("签名密钥", item.Secret, 0, nil, func(text string) {
+		item.Secret = strings.TrimSpace(text)
+	})
+	formView.AddCheckbox("停用", item.Disabled, func(checked bool) {
+		item.Disabled = checked
+	})
+
+	formView.AddButton("保存", func() {
+		var err error
+		if id == "" {
+			err = a.m.db.AddWebhook(item)
+		} else {
+			err = a.m.db.UpdateWebhook(id, item)
+		}
+		if err != nil {
+			a.showError(err)
+			return
+		}
+		a.mainPages.RemovePage("submenu2")
+		a.reloadWebhookMenu()
+		a.showInfo("Webhook 已保存并生效")
+	})
+
+	formView.AddButton("发送测试", func() {
+		tested := *item
+		a.testWebhook(&tested)
+	})
+
+	formView.AddButton("取消", func() {
+		a.mainPages.RemovePage("submenu2")
+		a.settingWebhooks()
+	})
+
+	a.mainPages.AddPage("submenu2", formView, true, true)
+	a.SetFocus(formView)
+}
+
+// testWebhook 以示例数据发送一次请求并显示结果
+func (a *App) testWebhook(item *conf.WebhookItem) {
+	modal := tview.NewModal().SetText("正在发送测试请求...")
+	a.mainPages.AddPage("modal", modal, true, true)
+	a.SetFocus(modal)
+
+	go func() {
+		err := a.m.db.TestWebhook(context.Background(), item)
+
+		a.QueueUpdateDraw(func() {
+			if err != nil {
+				modal.SetText("测试请求失败: " + err.Error())
+			} else {
+				modal.SetText("测试请求发送成功")
+			}
+			modal.AddButtons([]string{"OK"})
+			modal.SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				a.mainPages.RemovePage("modal")
+			})
+			a.SetFocus(modal)
+		})
+	}()
+}
+
+// reloadWebhookMenu 配置修改后刷新 webhook 列表与设置菜单
+func (a *App) reloadWebhookMenu() {
+	a.mainPages.RemovePage("submenu")
+	a.settingWebhooks()
+	a.refreshSettingsMenu()
+}
@@ -2,21 +2,36 @@ package conf
 
 const (
 	DefalutHTTPAddr = "0.0.0.0:5030"
+
+	// DecryptModeCopy 将数据库解密到工作目录后读取
+	DecryptModeCopy = "copy"
+	// DecryptModeVFS 通过只读 SQLite VFS 按需解密原始数据库，不在磁盘上留下明文
+	DecryptModeVFS = "vfs"
 )
 
 type ServerConfig struct {
-	Type        string        `mapstructure:"type"`
-	Platform    string        `mapstructure:"platform"`
-	Version     int           `mapstructure:"version"`
-	FullVersion string        `mapstructure:"full_version"`
-	DataDir     string        `mapstructure:"data_dir"`
-	DataKey     string        `mapstructure:"data_key"`
-	ImgKey      string        `mapstructure:"img_key"`
-	WorkDir     string        `mapstructure:"work_dir"`
-	HTTPAddr    string        `mapstructure:"http_addr"`
-	AutoDecrypt bool          `mapstructure:"auto_decrypt"`
-	Webhook     *Webhook      `mapstructure:"webhook"`
-	Speech      *SpeechConfig `mapstructure:"speech"`
+	Type           string        `mapstructure:"type"`
+	Platform       string        `mapstructure:"platform"`
+	Version        int           `mapstructure:"version"`
+	FullVersion    string        `mapstructure:"full_version"`
+	DataDir        string        `mapstructure:"data_dir"`
+	DataKey        string        `mapstructure:"data_key"`
+	ImgKey         string        `mapstructure:"img_key"`
+	WorkDir        string        `mapstructure:"work_dir"`
+	HTTPAddr       string        `mapstructure:"http_addr"`
+	AutoDecrypt    bool          `mapstructure:"auto_decrypt"`
+	DecryptMode    string        `mapstructure:"decrypt_mode"`
+	VFSCache       int           `mapstructure:"vfs_cache"`        // VFS 模式缓存的页面数
+	EncryptWorkDir bool          `mapstructure:"encrypt_work_dir"` // 以口令派生的密钥加密工作目录中的数据库与索引
+	Passphrase     string        `mapstructure:"passphrase"`       // 工作目录口令，为空时需通过 API 解锁
+	DecryptWorkers int           `mapstructure:"decrypt_workers"`  // 并发解密的文件数
+	Webhook        *Webhook      `mapstructure:"webhook"`
+	Speech         *SpeechConfig `mapstructure:"speech"`
+
+	// workKey 解锁后由口令派生的工作目录密钥，仅保存在内存中
+	workKey string
+	// files 上次成功解密时各数据库文件的状态，仅保存在内存中
+	files []File
 }
 
 var ServerDefaults = map[string]any{}
@@ -49,6 +64,45 @@ func (c *ServerConfig) GetAutoDecrypt() bool {
 	return c.AutoDecrypt
 }
 
+func (c *ServerConfig) GetDecryptMode() string {
+	if c.DecryptMode == "" {
+		return DecryptModeCopy
+	}
+	return c.DecryptMode
+}
+
+func (c *ServerConfig) GetVFSCache() int {
+	return c.VFSCache
+}
+
+func (c *ServerConfig) IsEncryptWorkDir() bool {
+	return c.EncryptWorkDir
+}
+
+func (c *ServerConfig) GetPassphrase() string {
+	return c.Passphrase
+}
+
+func (c *ServerConfig) GetWorkKey() string {
+	return c.workKey
+}
+
+func (c *ServerConfig) SetWorkKey(key string) {
+	c.workKey = key
+}
+
+func (c *ServerConfig) GetDecryptWorkers() int {
+	return c.DecryptWorkers
+}
+
+func (c *ServerConfig) GetFiles() []File {
+	return c.files
+}
+
+func (c *ServerConfig) SetFiles(files []File) {
+	c.files = files
+}
+
 func (c *ServerConfig) GetHTTPAddr() string {
 	if c.HTTPAddr == "" {
 		c.HTTPAddr = DefalutHTTPAddr
@@ -1,16 +1,69 @@
 package conf
 
+import "github.com/sjzar/chatlog/internal/model"
+
 type Webhook struct {
-	Host    string         `mapstructure:"host"`
-	DelayMs int64          `mapstructure:"delay_ms"`
-	Items   []*WebhookItem `mapstructure:"items"`
+	Host    string         `mapstructure:"host" json:"host,omitempty"`
+	DelayMs int64          `mapstructure:"delay_ms" json:"delay_ms,omitempty"`
+	Items   []*WebhookItem `mapstructure:"items" json:"items,omitempty"`
+	// MaxAttempts 投递失败后进入死信队列前的最大尝试次数，默认 10
+	MaxAttempts int `mapstructure:"max_attempts" json:"max_attempts,omitempty"`
+	// RetryBaseMs 首次重试的等待时间，之后每次翻倍，默认 5000
+	RetryBaseMs int64 `mapstructure:"retry_base_ms" json:"retry_base_ms,omitempty"`
+	// LookbackMs 在已投递进度之前回看的时间，补发迟到的消息，默认 1 小时
+	LookbackMs int64 `mapstructure:"lookback_ms" json:"lookback_ms,omitempty"`
 }
 
 type WebhookItem struct {
-	Type     string `mapstructure:"type"`
-	URL      string `mapstructure:"url"`
-	Talker   string `mapstructure:"talker"`
-	Sender   string `mapstructure:"sender"`
-	Keyword  string `mapstructure:"keyword"`
-	Disabled bool   `mapstructure:"disabled"`
+	Type     string `mapstructure:"type" json:"type,omitempty"`
+	URL      string `mapstructure:"url" json:"url,omitempty"`
+	Talker   string `mapstructure:"talker" json:"talker,omitempty"`
+	Sender   string `mapstructure:"sender" json:"sender,omitempty"`
+	Keyword  string `mapstructure:"keyword" json:"keyword,omitempty"`
+	Disabled bool   `mapstructure:"disabled" json:"disabled,omitempty"`
+	// Secret 非空时以 HMAC-SHA256 签名请求，签名放在 X-Chatlog-Signature 头中
+	Secret string `mapstructure:"secret" json:"secret,omitempty"`
+	// Headers 附加的固定请求头，如接收方要求的 Authorization
+	Headers map[string]string `mapstructure:"headers" json:"headers,omitempty"`
+	// StartFrom 首次运行（尚无投递进度）时的起点：now（默认）、beginning 或日期时间，如 2024-01-01
+	StartFrom string `mapstructure:"start_from" json:"start_from,omitempty"`
+	// Preset 内置的请求体格式：feishu、dingtalk、slack、ntfy，Template 非空时忽略
+	Preset string `mapstructure:"preset" json:"preset,omitempty"`
+	// Template 以 Go text/template 渲染的请求体
+	Template string `mapstructure:"template" json:"template,omitempty"`
+	// ContentType 覆盖请求的 Content-Type
+	ContentType string `mapstructure:"content_type" json:"content_type,omitempty"`
+	// BatchMax 单次投递的最大消息数，默认 500
+	BatchMax int `mapstructure:"batch_max" json:"batch_max,omitempty"`
+	// BatchWaitMs 收到新消息后最多等待的时间，期间的消息合并投递，消息数达到 BatchMax 时立即投递
+	BatchWaitMs int64 `mapstructure:"batch_wait_ms" json:"batch_wait_ms,omitempty"`
+	// RateLimit 每秒最多投递次数，为 0 时不限制
+	RateLimit float64 `mapstructure:"rate_limit" json:"rate_limit,omitempty"`
+	// RateBurst 允许的突发投递次数，默认 1
+	RateBurst int `mapstructure:"rate_burst" json:"rate_burst,omitempty"`
+	// SkipDead 投递进入死信后游标前移，继续推送之后的消息；默认暂停该 webhook，直到死信被重放或丢弃
+	SkipDead bool `mapstructure:"skip_dead" json:"skip_dead,omitempty"`
+	// MQTT url 为 mqtt:// 或 mqtts:// 时的发布选项
+	MQTT *WebhookMQTT `mapstructure:"mqtt" json:"mqtt,omitempty"`
+	// MessageFilter 附加的消息过滤条件：types、subtypes、regex、from_self、chatroom_only、private_only、
+	// mentions_me、exclude_talkers，以及用于组合的 all、any，与 talker、sender、keyword 同时生效
+	model.MessageFilter `mapstructure:",squash"`
+}
+
+// WebhookMQTT 发布到 MQTT broker 的选项，每条消息或变更发布一次
+type WebhookMQTT struct {
+	// Topic 主题模板，支持 {talker}、{sender}、{type}，默认 chatlog/{talker}/{type}
+	Topic string `mapstructure:"topic" json:"topic,omitempty"`
+	// QoS 0、1 或 2，默认 0
+	QoS    int  `mapstructure:"qos" json:"qos,omitempty"`
+	Retain bool `mapstructure:"retain" json:"retain,omitempty"`
+	// Username、Password 连接 broker 的账号
+	Username string `mapstructure:"username" json:"username,omitempty"`
+	Password string `mapstructure:"password" json:"password,omitempty"`
+	// ClientID 为空时随机生成
+	ClientID string `mapstructure:"client_id" json:"client_id,omitempty"`
+	// CAFile mqtts 使用的 CA 证书（PEM），为空时使用系统证书
+	CAFile string `mapstructure:"ca_file" json:"ca_file,omitempty"`
+	// InsecureSkipVerify mqtts 不校验服务端证书
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify" json:"insecure_skip_verify,omitempty"`
 }
@@ -52,6 +52,9 @@ type Context struct {
 	AutoDecrypt bool
 	LastSession time.Time
 
+	// 上次成功解密时各数据库文件的状态
+	Files []conf.File
+
 	// 当前选中的微信实例
 	Current *wechat.Account
 	PID     int
@@ -171,6 +174,7 @@ func (c *Context) SwitchHistory(account string) {
 		c.WorkDir = history.WorkDir
 		c.HTTPEnabled = history.HTTPEnabled
 		c.HTTPAddr = history.HTTPAddr
+		c.Files = history.Files
 	} else {
 		c.Account = ""
 		c.Platform = ""
@@ -182,6 +186,7 @@ func (c *Context) SwitchHistory(account string) {
 		c.WorkDir = ""
 		c.HTTPEnabled = false
 		c.HTTPAddr = ""
+		c.Files = nil
 	}
 }
 
@@ -224,6 +229,10 @@ func (c *Context) Refresh() {
 	}
 }
 
+func (c *Context) GetConfigDir() string {
+	return c.conf.ConfigDir
+}
+
 func (c *Context) GetDataDir() string {
 	return c.DataDir
 }
@@ -267,6 +276,20 @@ func (c *Context) GetWebhook() *conf.Webhook {
 	return c.conf.Webhook
 }
 
+// SaveWebhook 保存 webhook 配置到配置文件
+func (c *Context) SaveWebhook(cfg *conf.Webhook) error {
+	if c.cm == nil {
+		return errors.New("config manager unavailable")
+	}
+	if err := c.cm.SetConfig("webhook", cfg); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conf.Webhook = cfg
+	return nil
+}
+
 func (c *Context) GetSpeech() *conf.SpeechConfig {
 	return c.speech
 }
@@ -343,6 +366,19 @@ func (c *Context) SetAutoDecrypt(enabled bool) {
 	c.UpdateConfig()
 }
 
+func (c *Context) GetFiles() []conf.File {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Files
+}
+
+// SetFiles 更新文件状态，随下次 UpdateConfig 保存
+func (c *Context) SetFiles(files []conf.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Files = files
+}
+
 func (c *Context) SetWeChatInstances(instances []*wechat.Account) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -364,6 +400,7 @@ func (c *Context) UpdateConfig() {
 		WorkDir:     c.WorkDir,
 		HTTPEnabled: c.HTTPEnabled,
 		HTTPAddr:    c.HTTPAddr,
+		Files:       c.Files,
 	}
 
 	if c.conf.History == nil {
@@ -396,7 +433,10 @@ func (c *Context) UpdateConfig() {
 	}
 
 	if len(pconf.DataDir) != 0 {
-		if b, err := json.Marshal(pconf); err == nil {
+		// 文件状态只对本机有意义，不写入数据目录
+		dataDirConf := pconf
+		dataDirConf.Files = nil
+		if b, err := json.Marshal(dataDirConf); err == nil {
 			if err := os.WriteFile(filepath.Join(pconf.DataDir, "chatlog.json"), b, 0644); err != nil {
 				log.Error().Err(err).Msg("save chatlog.json failed")
 			}
@@ -0,0 +1,351 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/internal/wechatdb"
+	"github.com/sjzar/chatlog/pkg/util"
+	"github.com/sjzar/chatlog/pkg/util/dat2img"
+)
+
+// MediaManifestFile 导出目录中记录消息与文件对应关系的清单，每行一条 JSON
+const MediaManifestFile = "manifest.jsonl"
+
+// ExportMediaOptions 批量导出图片与视频的参数
+type ExportMediaOptions struct {
+	// Talkers 导出的会话，为空时导出所有会话
+	Talkers []string
+	Start   time.Time
+	End     time.Time
+	OutDir  string
+}
+
+// ParseExportMediaOptions 解析逗号分隔的会话列表与时间范围，时间为空时不限制
+func ParseExportMediaOptions(talker, timeRange, out string) (ExportMediaOptions, error) {
+	opts := ExportMediaOptions{OutDir: out}
+	for _, t := range strings.Split(talker, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opts.Talkers = append(opts.Talkers, t)
+		}
+	}
+	if timeRange == "" {
+		timeRange = "all"
+	}
+	start, end, ok := util.TimeRangeOf(timeRange)
+	if !ok {
+		return opts, errors.InvalidArg("time")
+	}
+	opts.Start, opts.End = start, end
+	return opts, nil
+}
+
+// MediaManifestEntry 清单中的一条记录，File 为相对导出目录的路径
+// 内容相同的文件只保存一份，重复的消息指向首次导出的文件
+type MediaManifestEntry struct {
+	Talker    string    `json:"talker"`
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Source    string    `json:"source"`
+	File      string    `json:"file"`
+	SHA256    string    `json:"sha256"`
+	Duplicate bool      `json:"duplicate,omitempty"`
+}
+
+// ExportMediaFailure 导出失败的消息
+type ExportMediaFailure struct {
+	Talker string `json:"talker"`
+	Seq    int64  `json:"seq"`
+	Source string `json:"source,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ExportMediaReport 批量导出结果
+type ExportMediaReport struct {
+	OutDir     string               `json:"out_dir"`
+	Total      int                  `json:"total"`
+	Exported   int                  `json:"exported"`
+	Duplicated int                  `json:"duplicated"`
+	Skipped    int                  `json:"skipped"`
+	Missing    int                  `json:"missing"`
+	Failures   []ExportMediaFailure `json:"failures"`
+}
+
+// mediaSource 导出所需的查询接口，由 Service 实现
+type mediaSource interface {
+	GetMessages(start, end time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error)
+	GetSessions(key string, limit, offset int) (*wechatdb.GetSessionsResp, error)
+	GetMedia(_type string, key string) (*model.Media, error)
+}
+
+// ExportMedia 将选定会话中的图片与视频解密为原始格式，按日期目录导出
+// 已在清单中的消息直接跳过，中断后可重复执行继续导出
+func (s *Service) ExportMedia(ctx context.Context, opts ExportMediaOptions) (*ExportMediaReport, error) {
+	if s.db == nil {
+		return nil, errors.InvalidArg("export media before db ready")
+	}
+	return exportMedia(ctx, s, s.conf.GetDataDir(), opts)
+}
+
+type mediaExporter struct {
+	src      mediaSource
+	dataDir  string
+	outDir   string
+	done     map[string]bool
+	hashes   map[string]string
+	manifest *os.File
+	report   *ExportMediaReport
+}
+
+func exportMedia(ctx context.Context, src mediaSource, dataDir string, opts ExportMediaOptions) (*ExportMediaReport, error) {
+	if opts.OutDir == "" {
+		return nil, errors.InvalidArg("out")
+	}
+	if dataDir == "" {
+		return nil, errors.InvalidArg("data_dir")
+	}
+
+	e := &mediaExporter{
+		src:     src,
+		dataDir: dataDir,
+		outDir:  opts.OutDir,
+		done:    make(map[string]bool),
+		hashes:  make(map[string]string),
+		report:  &ExportMediaReport{OutDir: opts.OutDir, Failures: []ExportMediaFailure{}},
+	}
+	if err := e.loadManifest(); err != nil {
+		return nil, err
+	}
+	defer e.manifest.Close()
+
+	talkers := opts.Talkers
+	if len(talkers) == 0 {
+		sessions, err := src.GetSessions("", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, sess := range sessions.Items {
+			talkers = append(talkers, sess.UserName)
+		}
+	}
+
+	for _, talker := range talkers {
+		msgs, err := src.GetMessages(opts.Start, opts.End, talker, "", "", 0, 0)
+		if err != nil {
+			log.Debug().Err(err).Msgf("get messages of %s failed", talker)
+			continue
+		}
+		for _, msg := range msgs {
+			if err := ctx.Err(); err != nil {
+				return e.report, err
+			}
+			if msg.Type != model.MessageTypeImage && msg.Type != model.MessageTypeVideo {
+				continue
+			}
+			e.report.Total++
+			if err := e.export(msg); err != nil {
+				return e.report, err
+			}
+		}
+	}
+
+	log.Info().Msgf("export media to %s, total %d, exported %d, duplicated %d, skipped %d, missing %d, failed %d",
+		e.outDir, e.report.Total, e.report.Exported, e.report.Duplicated, e.report.Skipped, e.report.Missing, len(e.report.Failures))
+	return e.report, nil
+}
+
+// loadManifest 读取已有清单，记录已导出的消息与文件内容哈希
+func (e *mediaExporter) loadManifest() error {
+	if err := os.MkdirAll(e.outDir, 0755); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	path := filepath.Join(e.outDir, MediaManifestFile)
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry MediaManifestEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			// 文件被删除时重新导出
+			if _, err := os.Stat(filepath.Join(e.outDir, entry.File)); err != nil {
+				continue
+			}
+			e.done[manifestKey(entry.Talker, entry.Seq)] = true
+			if _, ok := e.hashes[entry.SHA256]; !ok {
+				e.hashes[entry.SHA256] = entry.File
+			}
+		}
+		f.Close()
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	e.manifest = f
+	return nil
+}
+
+func manifestKey(talker string, seq int64) string {
+	return fmt.Sprintf("%s:%d", talker, seq)
+}
+
+func (e *mediaExporter) export(msg *model.Message) error {
+	if e.done[manifestKey(msg.Talker, msg.Seq)] {
+		e.report.Skipped++
+		return nil
+	}
+
+	_type := "image"
+	if msg.Type == model.MessageTypeVideo {
+		_type = "video"
+	}
+	source := e.resolve(_type, msg)
+	if source == "" {
+		e.report.Missing++
+		return nil
+	}
+
+	data, ext, err := e.decode(source)
+	if err != nil {
+		e.report.Failures = append(e.report.Failures, ExportMediaFailure{Talker: msg.Talker, Seq: msg.Seq, Source: source, Error: err.Error()})
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	entry := MediaManifestEntry{
+		Talker: msg.Talker,
+		Seq:    msg.Seq,
+		Time:   msg.Time,
+		Type:   _type,
+		Source: filepath.ToSlash(source),
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	if file, ok := e.hashes[entry.SHA256]; ok {
+		entry.File = file
+		entry.Duplicate = true
+		e.report.Duplicated++
+	} else {
+		entry.File = filepath.ToSlash(filepath.Join(
+			sanitizeFileName(msg.Talker),
+			msg.Time.Format("2006"),
+			msg.Time.Format("2006-01-02"),
+			fmt.Sprintf("%d.%s", msg.Seq, ext),
+		))
+		if err := writeFileAtomic(filepath.Join(e.outDir, filepath.FromSlash(entry.File)), data); err != nil {
+			return err
+		}
+		e.hashes[entry.SHA256] = entry.File
+		e.report.Exported++
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := e.manifest.Write(append(line, '\n')); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	e.done[manifestKey(msg.Talker, msg.Seq)] = true
+	return nil
+}
+
+// resolve 查找消息对应的数据目录中的文件，返回相对数据目录的路径
+// 优先使用消息中记录的路径，其次按 md5 查询媒体库；图片优先高清图，缩略图兜底
+func (e *mediaExporter) resolve(_type string, msg *model.Message) string {
+	suffixes := []string{"_h.dat", ".dat", "_t.dat"}
+	if _type == "video" {
+		suffixes = []string{".mp4"}
+	}
+
+	candidates := make([]string, 0, 3)
+	if path, ok := msg.Contents["path"].(string); ok && path != "" {
+		candidates = append(candidates, path)
+	}
+	for _, k := range []string{"md5", "rawmd5"} {
+		key, ok := msg.Contents[k].(string)
+		if !ok || key == "" {
+			continue
+		}
+		if media, err := e.src.GetMedia(_type, key); err == nil && media != nil && media.Path != "" {
+			candidates = append(candidates, media.Path)
+		}
+	}
+
+	for _, c := range candidates {
+		rel := filepath.FromSlash(strings.ReplaceAll(c, "\\", "/"))
+		abs := filepath.Join(e.dataDir, rel)
+		if stat, err := os.Stat(abs); err == nil && !stat.IsDir() {
+			return rel
+		}
+		for _, suffix := range suffixes {
+			if stat, err := os.Stat(abs + suffix); err == nil && !stat.IsDir() {
+				return rel + suffix
+			}
+		}
+	}
+	return ""
+}
+
+// decode 读取文件，.dat 解密为真实格式（wxgf 转为 JPG/GIF/MP4），其他文件原样导出
+func (e *mediaExporter) decode(source string) ([]byte, string, error) {
+	data, err := os.ReadFile(filepath.Join(e.dataDir, source))
+	if err != nil {
+		return nil, "", errors.ReadFileFailed(source, err)
+	}
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(source)), ".")
+	if ext != "dat" {
+		if ext == "" {
+			ext = "bin"
+		}
+		return data, ext, nil
+	}
+	out, ext, err := dat2img.Dat2Image(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	return out, ext, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.WriteOutputFailed(err)
+	}
+	return nil
+}
+
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/internal/wechatdb"
+)
+
+type fakeMediaSource struct {
+	msgs  []*model.Message
+	media map[string]*model.Media
+}
+
+func (f *fakeMediaSource) GetMessages(start, end time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
+	msgs := make([]*model.Message, 0)
+	for _, m := range f.msgs {
+		if m.Talker == talker {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+func (f *fakeMediaSource) GetSessions(key string, limit, offset int) (*wechatdb.GetSessionsResp, error) {
+	return &wechatdb.GetSessionsResp{Items: []*model.Session{{UserName: "wxid_a"}, {UserName: "123@chatroom"}}}, nil
+}
+
+func (f *fakeMediaSource) GetMedia(_type string, key string) (*model.Media, error) {
+	if m, ok := f.media[_type+":"+key]; ok {
+		return m, nil
+	}
+	return nil, errors.ErrMediaNotFound
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportMedia(t *testing.T) {
+	dataDir := t.TempDir()
+	outDir := t.TempDir()
+
+	// 旧版 .dat 为整体异或的图片
+	jpg := []byte{0xFF, 0xD8, 0xFF, 0xE0, 1, 2, 3, 4, 0xFF, 0xD9}
+	dat := make([]byte, len(jpg))
+	for i := range jpg {
+		dat[i] = jpg[i] ^ 0x5A
+	}
+	writeTestFile(t, filepath.Join(dataDir, "msg", "attach", "a", "2024-01", "Img", "img1_h.dat"), dat)
+	writeTestFile(t, filepath.Join(dataDir, "msg", "attach", "b", "2024-01", "Img", "img2.dat"), dat)
+	writeTestFile(t, filepath.Join(dataDir, "FileStorage", "Video", "2024-01", "v1.mp4"), []byte("mp4 data"))
+
+	at := time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+	src := &fakeMediaSource{
+		msgs: []*model.Message{
+			{Talker: "wxid_a", Seq: 1, Time: at, Type: model.MessageTypeImage, Contents: map[string]interface{}{"path": "msg/attach/a/2024-01/Img/img1"}},
+			{Talker: "wxid_a", Seq: 2, Time: at, Type: model.MessageTypeText, Content: "hi"},
+			{Talker: "123@chatroom", Seq: 3, Time: at, Type: model.MessageTypeImage, Contents: map[string]interface{}{"path": "msg/attach/b/2024-01/Img/img2"}},
+			{Talker: "123@chatroom", Seq: 4, Time: at, Type: model.MessageTypeVideo, Contents: map[string]interface{}{"md5": "v1"}},
+			{Talker: "123@chatroom", Seq: 5, Time: at, Type: model.MessageTypeImage, Contents: map[string]interface{}{"md5": "missing"}},
+		},
+		media: map[string]*model.Media{
+			"video:v1": {Type: "video", Key: "v1", Path: filepath.Join("FileStorage", "Video", "2024-01", "v1")},
+		},
+	}
+
+	opts, err := ParseExportMediaOptions("", "", outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := exportMedia(context.Background(), src, dataDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 4 || report.Exported != 2 || report.Duplicated != 1 || report.Missing != 1 || len(report.Failures) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	b, err := os.ReadFile(filepath.Join(outDir, "wxid_a", "2024", "2024-01-02", "1.jpg"))
+	if err != nil || string(b) != string(jpg) {
+		t.Fatalf("image not decoded: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "123@chatroom", "2024", "2024-01-02", "4.mp4")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重复执行时跳过已导出的消息
+	report, err = exportMedia(context.Background(), src, dataDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != 3 || report.Exported != 0 || report.Missing != 1 {
+		t.Fatalf("unexpected report on resume %+v", report)
+	}
+
+	f, err := os.Open(filepath.Join(outDir, MediaManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+		if lines == 1 && !strings.Contains(scanner.Text(), `"file":"wxid_a/2024/2024-01-02/1.jpg"`) {
+			t.Fatalf("duplicate should reference the first file: %s", scanner.Text())
+		}
+	}
+	if lines != 3 {
+		t.Fatalf("expected 3 manifest entries, got %d", lines)
+	}
+}
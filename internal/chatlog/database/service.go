@@ -10,7 +10,10 @@ import (
 	"github.com/sjzar/chatlog/internal/chatlog/webhook"
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/vfs"
 	"github.com/sjzar/chatlog/internal/wechatdb"
+	"github.com/sjzar/chatlog/pkg/util"
 )
 
 const (
@@ -25,17 +28,42 @@ type Service struct {
 	StateMsg      string
 	conf          Config
 	db            *wechatdb.DB
+	vfs           bool
 	webhook       *webhook.Service
 	webhookCancel context.CancelFunc
 }
 
 type Config interface {
+	GetDataDir() string
+	GetDataKey() string
 	GetWorkDir() string
 	GetPlatform() string
 	GetVersion() int
 	GetWebhook() *conf.Webhook
 }
 
+// VFSConfig 可选的解密模式配置，由 ServerConfig 实现
+type VFSConfig interface {
+	GetDecryptMode() string
+	GetVFSCache() int
+}
+
+// AtRestConfig 可选的工作目录加密配置，由 ServerConfig 实现
+type AtRestConfig interface {
+	IsEncryptWorkDir() bool
+	GetWorkKey() string
+}
+
+// 注册的 SQLite VFS 名称
+const (
+	// vfsName 读取数据目录中的加密数据库
+	vfsName = "chatlog"
+	// atRestVFSName 读取工作目录中以工作目录密钥加密的数据库
+	atRestVFSName = "chatlog-rest"
+	// indexVFSName 以工作目录密钥加密存储全文索引
+	indexVFSName = "chatlog-index"
+)
+
 func NewService(conf Config) *Service {
 	return &Service{
 		conf:    conf,
@@ -44,7 +72,7 @@ func NewService(conf Config) *Service {
 }
 
 func (s *Service) Start() error {
-	db, err := wechatdb.New(s.conf.GetWorkDir(), s.conf.GetPlatform(), s.conf.GetVersion())
+	db, err := s.open()
 	if err != nil {
 		return err
 	}
@@ -54,6 +82,96 @@ func (s *Service) Start() error {
 	return nil
 }
 
+// open 按配置的解密模式打开数据库，VFS 模式不可用时回退到工作目录中的解密副本
+// 启用工作目录加密时，解密副本与全文索引均通过 VFS 以工作目录密钥加解密
+func (s *Service) open() (*wechatdb.DB, error) {
+	s.vfs = false
+	decryptor, workKey, err := s.workDirKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []wechatdb.Option
+	if workKey != "" {
+		if err := vfs.RegisterWritable(indexVFSName, decryptor, workKey, s.vfsCache()); err != nil {
+			return nil, err
+		}
+		opts = append(opts, wechatdb.WithIndexVFS(indexVFSName, decryptor.GetPageSize(), decryptor.GetReserve()))
+	}
+
+	if c, ok := s.conf.(VFSConfig); ok && c.GetDecryptMode() == conf.DecryptModeVFS {
+		db, err := s.openVFS(c, opts...)
+		if err == nil {
+			s.vfs = true
+			return db, nil
+		}
+		log.Warn().Err(err).Msg("VFS 模式不可用，回退到解密副本")
+	}
+
+	if workKey != "" {
+		if err := vfs.Register(atRestVFSName, decryptor, workKey, s.vfsCache()); err != nil {
+			return nil, err
+		}
+		opts = append(opts, wechatdb.WithVFS(atRestVFSName, s.conf.GetWorkDir()))
+	}
+	return wechatdb.New(s.conf.GetWorkDir(), s.conf.GetPlatform(), s.conf.GetVersion(), opts...)
+}
+
+// workDirKey 返回工作目录密钥及对应平台的解密器，未启用工作目录加密时返回空密钥
+// 已启用但尚未以口令解锁时返回 ErrWorkDirLocked
+func (s *Service) workDirKey() (decrypt.Decryptor, string, error) {
+	c, ok := s.conf.(AtRestConfig)
+	if !ok || !c.IsEncryptWorkDir() {
+		return nil, "", nil
+	}
+	if !vfs.Supported {
+		return nil, "", errors.ErrVFSUnsupported
+	}
+	if c.GetWorkKey() == "" {
+		return nil, "", errors.ErrWorkDirLocked
+	}
+	decryptor, err := decrypt.NewDecryptor(s.conf.GetPlatform(), s.conf.GetVersion())
+	if err != nil {
+		return nil, "", err
+	}
+	return decryptor, c.GetWorkKey(), nil
+}
+
+func (s *Service) vfsCache() int {
+	if c, ok := s.conf.(VFSConfig); ok {
+		return c.GetVFSCache()
+	}
+	return 0
+}
+
+// openVFS 通过只读 VFS 直接读取数据目录中的加密数据库，工作目录仅用于存放索引
+func (s *Service) openVFS(c VFSConfig, opts ...wechatdb.Option) (*wechatdb.DB, error) {
+	if !vfs.Supported {
+		return nil, errors.ErrVFSUnsupported
+	}
+	dataDir, dataKey, workDir := s.conf.GetDataDir(), s.conf.GetDataKey(), s.conf.GetWorkDir()
+	if dataDir == "" || dataKey == "" || workDir == "" {
+		return nil, errors.InvalidArg("data_dir, data_key and work_dir are required in vfs mode")
+	}
+	decryptor, err := decrypt.NewDecryptor(s.conf.GetPlatform(), s.conf.GetVersion())
+	if err != nil {
+		return nil, err
+	}
+	if err := vfs.Register(vfsName, decryptor, dataKey, c.GetVFSCache()); err != nil {
+		return nil, err
+	}
+	if err := util.PrepareDir(workDir); err != nil {
+		return nil, err
+	}
+	opts = append(opts, wechatdb.WithVFS(vfsName, workDir))
+	return wechatdb.New(dataDir, s.conf.GetPlatform(), s.conf.GetVersion(), opts...)
+}
+
+// IsVFS 当前是否以 VFS 模式读取加密数据库
+func (s *Service) IsVFS() bool {
+	return s.vfs
+}
+
 func (s *Service) Stop() error {
 	if s.db != nil {
 		s.db.Close()
@@ -108,6 +226,11 @@ func (s *Service) SearchMessages(req *model.SearchRequest) (*model.SearchRespons
 	return s.db.SearchMessages(req)
 }
 
+// GetIdentity 返回当前账号，账号的微信 ID 由数据目录推断，无法确定时 UserName 为空
+func (s *Service) GetIdentity() *model.Identity {
+	return s.db.GetIdentity(s.db.AccountUserName(s.conf.GetDataDir()))
+}
+
 func (s *Service) GetContacts(key string, limit, offset int) (*wechatdb.GetContactsResp, error) {
 	return s.db.GetContacts(key, limit, offset)
 }
@@ -116,6 +239,40 @@ func (s *Service) GetChatRooms(key string, limit, offset int) (*wechatdb.GetChat
 	return s.db.GetChatRooms(key, limit, offset)
 }
 
+func (s *Service) GetChatRoomHistory(key string, at time.Time) (*model.ChatRoomHistory, error) {
+	return s.db.GetChatRoomHistory(key, s.db.AccountUserName(s.conf.GetDataDir()), at)
+}
+
+// GetEmoticon 查询动画表情信息
+func (s *Service) GetEmoticon(md5 string) (*model.Emoticon, error) {
+	return s.db.GetEmoticon(md5)
+}
+
+// StickerUsage 返回使用次数最多的表情
+func (s *Service) StickerUsage(limit int) ([]*model.StickerUsage, error) {
+	return s.db.StickerUsage(limit)
+}
+
+// GetFavorites 查询收藏
+func (s *Service) GetFavorites(_type, keyword string, limit, offset int) (*wechatdb.GetFavoritesResp, error) {
+	return s.db.GetFavorites(_type, keyword, limit, offset)
+}
+
+// GetSnsPosts 查询朋友圈动态
+func (s *Service) GetSnsPosts(startTime, endTime time.Time, user string, limit, offset int) (*wechatdb.GetSnsPostsResp, error) {
+	return s.db.GetSnsPosts(startTime, endTime, user, limit, offset)
+}
+
+// GetSnsPost 查询单条朋友圈动态
+func (s *Service) GetSnsPost(id string) (*model.SnsPost, error) {
+	return s.db.GetSnsPost(id)
+}
+
+// GetArticles 查询公众号文章
+func (s *Service) GetArticles(account string, startTime, endTime time.Time, limit, offset int) (*wechatdb.GetArticlesResp, error) {
+	return s.db.GetArticles(account, startTime, endTime, limit, offset)
+}
+
 // GetSession retrieves session information
 func (s *Service) GetSessions(key string, limit, offset int) (*wechatdb.GetSessionsResp, error) {
 	return s.db.GetSessions(key, limit, offset)
@@ -129,6 +286,61 @@ func (s *Service) GetAvatar(username string, size string) (*model.Avatar, error)
 	return s.db.GetAvatar(username, size)
 }
 
+// WebhookDeliveries 返回未完成的 webhook 投递，status 为 pending 或 dead，为空时返回全部
+func (s *Service) WebhookDeliveries(status string) []*webhook.Delivery {
+	return s.webhook.Dispatcher().Deliveries(status)
+}
+
+// SubscribeMessages 订阅消息数据库的变化，使用完毕后调用 cancel
+func (s *Service) SubscribeMessages() (<-chan struct{}, func()) {
+	return s.webhook.Stream().Subscribe()
+}
+
+// WebhookMetrics 返回各 webhook 的投递统计
+func (s *Service) WebhookMetrics() []*webhook.Metrics {
+	return s.webhook.Dispatcher().Metrics()
+}
+
+// ReplayWebhookDeliveries 重新投递死信，ids 为空时重放全部
+func (s *Service) ReplayWebhookDeliveries(ids []string) ([]*webhook.Delivery, error) {
+	return s.webhook.Dispatcher().Replay(ids)
+}
+
+// DiscardWebhookDeliveries 丢弃死信，ids 为空时丢弃全部
+func (s *Service) DiscardWebhookDeliveries(ids []string) ([]*webhook.Delivery, error) {
+	return s.webhook.Dispatcher().Discard(ids)
+}
+
+// WebhookItems 返回配置的 webhook，包括已禁用的
+func (s *Service) WebhookItems() []*conf.WebhookItem {
+	return s.webhook.Items()
+}
+
+// WebhookItem 返回 id 对应的 webhook
+func (s *Service) WebhookItem(id string) (*conf.WebhookItem, error) {
+	return s.webhook.Item(id)
+}
+
+// AddWebhook 添加 webhook，服务运行中时立即生效
+func (s *Service) AddWebhook(item *conf.WebhookItem) error {
+	return s.webhook.AddItem(item)
+}
+
+// UpdateWebhook 修改 id 对应的 webhook，服务运行中时立即生效
+func (s *Service) UpdateWebhook(id string, item *conf.WebhookItem) error {
+	return s.webhook.UpdateItem(id, item)
+}
+
+// DeleteWebhook 删除 id 对应的 webhook
+func (s *Service) DeleteWebhook(id string) error {
+	return s.webhook.DeleteItem(id)
+}
+
+// TestWebhook 以示例数据向 webhook 发送一次请求
+func (s *Service) TestWebhook(ctx context.Context, item *conf.WebhookItem) error {
+	return s.webhook.Test(ctx, item)
+}
+
 func (s *Service) initWebhook() error {
 	if s.webhook == nil {
 		return nil
@@ -139,8 +351,9 @@ func (s *Service) initWebhook() error {
 	for _, hook := range hooks {
 		log.Info().Msgf("set callback %#v", hook)
 		if err := s.db.SetCallback(hook.Group(), hook.Callback); err != nil {
+			// 当前版本没有对应的数据库时跳过该组，不影响其他 webhook
 			log.Error().Err(err).Msgf("set callback %#v failed", hook)
-			return err
+			continue
 		}
 	}
 	return nil
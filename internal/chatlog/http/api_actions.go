@@ -1,10 +1,19 @@
 package http
 
 import (
+	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/chatlog/database"
+	"github.com/sjzar/chatlog/internal/chatlog/wechat"
+	"github.com/sjzar/chatlog/internal/errors"
 )
 
 func (s *Service) handleActionGetDataKey(c *gin.Context) {
@@ -19,16 +28,69 @@ func (s *Service) handleActionGetDataKey(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// handleActionDecrypt 批量解密，返回包含失败文件与原因的结果
+// async=1 时立即返回，进度与结果通过 /decrypt/events 推送
 func (s *Service) handleActionDecrypt(c *gin.Context) {
 	if s.control == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "control service unavailable"})
 		return
 	}
+	if async, _ := strconv.ParseBool(c.Query("async")); async {
+		go func() {
+			if err := s.control.DecryptDBFiles(); err != nil {
+				log.Err(err).Msg("failed to decrypt via api")
+			}
+		}()
+		c.JSON(http.StatusAccepted, gin.H{"status": "decrypting"})
+		return
+	}
 	if err := s.control.DecryptDBFiles(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "report": s.control.LastDecryptReport()})
+}
+
+// handleActionDecryptEvents 以 SSE 推送批量解密的进度（progress）与结果（report）
+// 连接建立时先推送当前进度与最近一次结果
+func (s *Service) handleActionDecryptEvents(c *gin.Context) {
+	if s.control == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "control service unavailable"})
+		return
+	}
+	events, cancel := s.control.SubscribeDecryptEvents()
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	progress := s.control.DecryptProgress()
+	c.SSEvent(wechat.DecryptEventProgress, progress)
+	if report := s.control.LastDecryptReport(); report != nil && !progress.Running {
+		c.SSEvent(wechat.DecryptEventReport, report)
+	}
+	c.Writer.Flush()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if event.Progress != nil {
+				c.SSEvent(event.Type, event.Progress)
+			} else {
+				c.SSEvent(event.Type, event.Report)
+			}
+			return true
+		case <-ping.C:
+			fmt.Fprintf(w, ": ping\n\n")
+			return true
+		}
+	})
 }
 
 func (s *Service) handleActionStartHTTP(c *gin.Context) {
@@ -88,3 +150,59 @@ func (s *Service) handleActionStopAutoDecrypt(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
+
+type unlockRequest struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// handleActionUnlock 以口令解锁加密的工作目录
+func (s *Service) handleActionUnlock(c *gin.Context) {
+	if s.control == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "control service unavailable"})
+		return
+	}
+	var req unlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "detail": err.Error()})
+		return
+	}
+	if err := s.control.UnlockWorkDir(req.Passphrase); err != nil {
+		if errors.Is(err, errors.ErrIncorrectPassphrase) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+type exportMediaRequest struct {
+	Talker string `json:"talker"`
+	Time   string `json:"time"`
+	Out    string `json:"out"`
+}
+
+// handleActionExportMedia 批量导出会话中的图片与视频，out 为空时导出到工作目录的 export/media
+func (s *Service) handleActionExportMedia(c *gin.Context) {
+	var req exportMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "detail": err.Error()})
+		return
+	}
+	opts, err := database.ParseExportMediaOptions(req.Talker, req.Time, req.Out)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+	if opts.OutDir == "" {
+		opts.OutDir = filepath.Join(s.db.GetWorkDir(), "export", "media")
+	}
+
+	report, err := s.db.ExportMedia(c.Request.Context(), opts)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "report": report})
+}
@@ -0,0 +1,231 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/chatlog/webhook"
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// handleWebhookDeliveries 返回未完成的 webhook 投递，status=pending|dead 过滤
+// GET /api/v1/webhook/deliveries?status=dead
+func (s *Service) handleWebhookDeliveries(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != webhook.DeliveryPending && status != webhook.DeliveryDead {
+		errors.Err(c, errors.InvalidArg("status"))
+		return
+	}
+	deliveries := s.db.WebhookDeliveries(status)
+	c.JSON(http.StatusOK, gin.H{"total": len(deliveries), "items": deliveries})
+}
+
+type webhookDeliveriesRequest struct {
+	// Action replay 重新投递，discard 丢弃并推进游标
+	Action string   `json:"action"`
+	IDs    []string `json:"ids"`
+}
+
+// handleWebhookDeliveriesAction 重放或丢弃死信，ids 为空时处理全部死信
+// POST /api/v1/webhook/deliveries {"action":"replay","ids":[...]}
+func (s *Service) handleWebhookDeliveriesAction(c *gin.Context) {
+	var req webhookDeliveriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "detail": err.Error()})
+		return
+	}
+
+	var deliveries []*webhook.Delivery
+	var err error
+	switch req.Action {
+	case "", "replay":
+		deliveries, err = s.db.ReplayWebhookDeliveries(req.IDs)
+	case "discard":
+		deliveries, err = s.db.DiscardWebhookDeliveries(req.IDs)
+	default:
+		err = errors.InvalidArg("action")
+	}
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "total": len(deliveries), "items": deliveries})
+}
+
+// handleWebhookMetrics 返回各 webhook 的成功、失败次数、延迟与队列深度
+// GET /api/v1/webhook/metrics
+func (s *Service) handleWebhookMetrics(c *gin.Context) {
+	metrics := s.db.WebhookMetrics()
+	c.JSON(http.StatusOK, gin.H{"total": len(metrics), "items": metrics})
+}
+
+// webhookItem webhook 配置及其标识，标识用于修改、删除与测试
+type webhookItem struct {
+	ID string `json:"id"`
+	*conf.WebhookItem
+}
+
+// redacted 返回 webhook 配置时替换 secret、请求头与 MQTT 密码，修改时传回该值表示保持不变
+const redacted = "******"
+
+func newWebhookItem(item *conf.WebhookItem) *webhookItem {
+	ret := *item
+	if ret.Secret != "" {
+		ret.Secret = redacted
+	}
+	if len(ret.Headers) > 0 {
+		ret.Headers = make(map[string]string, len(item.Headers))
+		for k := range item.Headers {
+			ret.Headers[k] = redacted
+		}
+	}
+	if ret.MQTT != nil && ret.MQTT.Password != "" {
+		mqtt := *ret.MQTT
+		mqtt.Password = redacted
+		ret.MQTT = &mqtt
+	}
+	return &webhookItem{ID: webhook.ItemID(item), WebhookItem: &ret}
+}
+
+// restoreRedacted 将请求体中未修改的 secret、请求头与 MQTT 密码恢复为已保存的值
+// 投递地址改变时不恢复，避免把已保存的凭据发往新的地址，需在请求体中重新提供
+func restoreRedacted(item, saved *conf.WebhookItem) error {
+	restore := func(name string) error {
+		if item.URL != saved.URL {
+			return errors.Newf(nil, http.StatusBadRequest, "url changed, %s must be provided again", name)
+		}
+		return nil
+	}
+	if item.Secret == redacted {
+		if err := restore("secret"); err != nil {
+			return err
+		}
+		item.Secret = saved.Secret
+	}
+	for k, v := range item.Headers {
+		if v == redacted {
+			if err := restore("header " + k); err != nil {
+				return err
+			}
+			item.Headers[k] = saved.Headers[k]
+		}
+	}
+	if item.MQTT != nil && item.MQTT.Password == redacted {
+		if err := restore("mqtt password"); err != nil {
+			return err
+		}
+		if saved.MQTT != nil {
+			item.MQTT.Password = saved.MQTT.Password
+		}
+	}
+	return nil
+}
+
+// bindWebhookItem 解析请求体中的 webhook 配置，saved 为修改前的配置，添加或测试时为 nil
+// 接口只允许投递到 http、https 与 mqtt，写入本地文件、socket 或标准输出的 webhook 只能在配置文件中配置；
+// mqtt.ca_file 会读取本地文件，同样只能在配置文件中设置，修改时只允许保持原值
+func bindWebhookItem(c *gin.Context, saved *conf.WebhookItem) (*conf.WebhookItem, bool) {
+	var item conf.WebhookItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload", "detail": err.Error()})
+		return nil, false
+	}
+	if err := webhook.CheckRemoteTarget(item.URL); err != nil {
+		errors.Err(c, err)
+		return nil, false
+	}
+	if item.MQTT != nil && item.MQTT.CAFile != "" && (saved == nil || saved.MQTT == nil || saved.MQTT.CAFile != item.MQTT.CAFile) {
+		errors.Err(c, errors.WebhookLocalFile("mqtt.ca_file"))
+		return nil, false
+	}
+	return &item, true
+}
+
+// handleListWebhooks 返回配置的 webhook，包括已禁用的，secret、请求头与 MQTT 密码以 ****** 代替
+// GET /api/v1/webhook/items
+func (s *Service) handleListWebhooks(c *gin.Context) {
+	items := s.db.WebhookItems()
+	ret := make([]*webhookItem, 0, len(items))
+	for _, item := range items {
+		ret = append(ret, newWebhookItem(item))
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(ret), "items": ret})
+}
+
+// handleAddWebhook 添加 webhook，保存到配置文件并立即生效
+// POST /api/v1/webhook/items {"type":"message","url":"http://...","talker":"..."}
+func (s *Service) handleAddWebhook(c *gin.Context) {
+	item, ok := bindWebhookItem(c, nil)
+	if !ok {
+		return
+	}
+	if err := s.db.AddWebhook(item); err != nil {
+		errors.Err(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newWebhookItem(item))
+}
+
+// handleUpdateWebhook 以请求体替换 webhook 配置，disabled 为 true 时停用，地址不变时值为 ****** 的 secret、请求头与 MQTT 密码保持不变
+// PUT /api/v1/webhook/items/:id
+func (s *Service) handleUpdateWebhook(c *gin.Context) {
+	saved, err := s.db.WebhookItem(c.Param("id"))
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+	item, ok := bindWebhookItem(c, saved)
+	if !ok {
+		return
+	}
+	if err := restoreRedacted(item, saved); err != nil {
+		errors.Err(c, err)
+		return
+	}
+	if err := s.db.UpdateWebhook(c.Param("id"), item); err != nil {
+		errors.Err(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newWebhookItem(item))
+}
+
+// handleDeleteWebhook 删除 webhook 及其未完成的投递
+// DELETE /api/v1/webhook/items/:id
+func (s *Service) handleDeleteWebhook(c *gin.Context) {
+	if err := s.db.DeleteWebhook(c.Param("id")); err != nil {
+		errors.Err(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// handleTestWebhook 以示例数据向已配置的 webhook 发送一次请求
+// POST /api/v1/webhook/items/:id/test
+func (s *Service) handleTestWebhook(c *gin.Context) {
+	item, err := s.db.WebhookItem(c.Param("id"))
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+	s.testWebhook(c, item)
+}
+
+// handleTestWebhookConfig 以示例数据向请求体中尚未保存的 webhook 发送一次请求
+// POST /api/v1/webhook/test {"url":"http://...","preset":"feishu"}
+func (s *Service) handleTestWebhookConfig(c *gin.Context) {
+	item, ok := bindWebhookItem(c, nil)
+	if !ok {
+		return
+	}
+	s.testWebhook(c, item)
+}
+
+func (s *Service) testWebhook(c *gin.Context, item *conf.WebhookItem) {
+	if err := s.db.TestWebhook(c.Request.Context(), item); err != nil {
+		c.JSON(http.StatusOK, gin.H{"status": "failed", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+func TestRestoreRedacted(t *testing.T) {
+	saved := &conf.WebhookItem{
+		URL:     "https://example.com/hook",
+		Secret:  "secret",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}
+	shown := newWebhookItem(saved).WebhookItem
+
+	item := *shown
+	item.Headers = map[string]string{"Authorization": redacted}
+	if err := restoreRedacted(&item, saved); err != nil {
+		t.Fatal(err)
+	}
+	if item.Secret != "secret" || item.Headers["Authorization"] != "Bearer token" {
+		t.Fatalf("redacted values not restored: %+v", item)
+	}
+
+	// 修改地址时不恢复已保存的凭据
+	moved := *shown
+	moved.URL = "https://attacker.example/hook"
+	if err := restoreRedacted(&moved, saved); errors.GetCode(err) != http.StatusBadRequest {
+		t.Fatalf("changing url with redacted secret should be rejected, got %v", err)
+	}
+	moved.Secret, moved.Headers = "new", map[string]string{"Authorization": "Bearer new"}
+	if err := restoreRedacted(&moved, saved); err != nil {
+		t.Fatalf("changing url with new secrets should be accepted, got %v", err)
+	}
+}
+
+func TestBindWebhookItemCAFile(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	bind := func(body string, saved *conf.WebhookItem) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		if _, ok := bindWebhookItem(c, saved); ok {
+			return http.StatusOK
+		}
+		return w.Code
+	}
+
+	body := `{"url":"mqtts://broker:8883","mqtt":{"ca_file":"/etc/shadow"}}`
+	if code := bind(body, nil); code != http.StatusForbidden {
+		t.Fatalf("ca_file from api: status %d, want 403", code)
+	}
+	saved := &conf.WebhookItem{URL: "mqtts://broker:8883", MQTT: &conf.WebhookMQTT{CAFile: "/etc/shadow"}}
+	if code := bind(body, saved); code != http.StatusOK {
+		t.Fatalf("unchanged ca_file: status %d, want 200", code)
+	}
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// RSS 2.0
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description,omitempty"`
+	Author      string        `xml:"author,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// Atom 1.0
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Link    atomLink   `xml:"link"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Summary string     `xml:"summary,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// writeArticlesRSS 将公众号文章输出为 RSS 2.0
+func writeArticlesRSS(w io.Writer, title, link string, articles []*model.Article) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          link,
+			Description:   title,
+			LastBuildDate: articlesUpdated(articles).Format(time.RFC1123Z),
+			Items:         make([]rssItem, 0, len(articles)),
+		},
+	}
+	for _, a := range articles {
+		item := rssItem{
+			Title:       a.Title,
+			Link:        a.URL,
+			Description: a.Digest,
+			Author:      a.AccountName,
+			GUID:        rssGUID{IsPermaLink: false, Value: articleID(a)},
+			PubDate:     a.PublishTime.Format(time.RFC1123Z),
+		}
+		if a.Cover != "" {
+			item.Enclosure = &rssEnclosure{URL: a.Cover, Type: "image/jpeg"}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return writeXML(w, feed)
+}
+
+// writeArticlesAtom 将公众号文章输出为 Atom 1.0
+func writeArticlesAtom(w io.Writer, title, link string, articles []*model.Article) error {
+	feed := atomFeed{
+		Title:   title,
+		ID:      link,
+		Link:    atomLink{Href: link, Rel: "self"},
+		Updated: articlesUpdated(articles).Format(time.RFC3339),
+		Entries: make([]atomEntry, 0, len(articles)),
+	}
+	for _, a := range articles {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   a.Title,
+			ID:      articleID(a),
+			Link:    atomLink{Href: a.URL},
+			Updated: a.PublishTime.Format(time.RFC3339),
+			Author:  atomAuthor{Name: a.AccountName},
+			Summary: a.Digest,
+		})
+	}
+	return writeXML(w, feed)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(v)
+}
+
+// articleID 文章 URL 可能缺失，使用 公众号+推送 seq+标题 作为兜底标识
+func articleID(a *model.Article) string {
+	if a.URL != "" {
+		return a.URL
+	}
+	return fmt.Sprintf("urn:chatlog:%s:%d:%s", a.Account, a.Seq, a.Title)
+}
+
+func articlesUpdated(articles []*model.Article) time.Time {
+	if len(articles) == 0 {
+		return time.Now()
+	}
+	return articles[0].PublishTime
+}
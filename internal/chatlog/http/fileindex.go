@@ -0,0 +1,84 @@
+package http
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileIndexRefresh 未找到文件时重新遍历目录的最短间隔
+const fileIndexRefresh = time.Minute
+
+// md5Len 缓存文件名开头 md5 的长度
+const md5Len = 32
+
+// fileIndex 按文件名开头的 md5 索引本地缓存目录（如表情、朋友圈媒体）中的文件
+// 首次查找时遍历目录建立索引，之后未找到的查找最多每 fileIndexRefresh 重新遍历一次，避免每个请求都遍历磁盘
+type fileIndex struct {
+	// dirs 相对 DataDir 的缓存目录，按顺序优先
+	dirs []string
+
+	mutex   sync.Mutex
+	dataDir string
+	paths   map[string]string
+	builtAt time.Time
+}
+
+func newFileIndex(dirs ...string) *fileIndex {
+	return &fileIndex{dirs: dirs}
+}
+
+// find 返回以任一 name 开头命名的文件，未找到时返回空字符串
+func (x *fileIndex) find(dataDir string, names ...string) string {
+	if dataDir == "" {
+		return ""
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	// 切换账号后重新建立索引
+	if x.dataDir != dataDir {
+		x.dataDir, x.paths = dataDir, nil
+	}
+	if path := x.lookup(names); path != "" {
+		return path
+	}
+	if x.paths != nil && time.Since(x.builtAt) < fileIndexRefresh {
+		return ""
+	}
+	x.build()
+	return x.lookup(names)
+}
+
+func (x *fileIndex) lookup(names []string) string {
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) < md5Len {
+			continue
+		}
+		if path, ok := x.paths[name[:md5Len]]; ok {
+			return path
+		}
+	}
+	return ""
+}
+
+func (x *fileIndex) build() {
+	paths := make(map[string]string)
+	for _, dir := range x.dirs {
+		_ = filepath.WalkDir(filepath.Join(x.dataDir, dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || len(d.Name()) < md5Len {
+				return nil
+			}
+			key := strings.ToLower(d.Name()[:md5Len])
+			if _, ok := paths[key]; !ok {
+				paths[key] = path
+			}
+			return nil
+		})
+	}
+	x.paths = paths
+	x.builtAt = time.Now()
+}
@@ -0,0 +1,35 @@
+package http
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileIndex(t *testing.T) {
+	dataDir := t.TempDir()
+	dir := filepath.Join(dataDir, "cache", "emoji")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	md5 := "0123456789abcdef0123456789abcdef"
+	path := filepath.Join(dir, md5+"_t")
+	os.WriteFile(path, []byte("x"), 0644)
+
+	x := newFileIndex("FileStorage/CustomEmotion", "cache")
+	if got := x.find(dataDir, md5); got != path {
+		t.Fatalf("find = %q, want %q", got, path)
+	}
+
+	// 未找到时不会立即重新遍历目录
+	other := "fedcba9876543210fedcba9876543210"
+	os.WriteFile(filepath.Join(dir, other), []byte("x"), 0644)
+	if got := x.find(dataDir, other); got != "" {
+		t.Fatalf("new file should not be found before refresh, got %q", got)
+	}
+	x.builtAt = time.Now().Add(-fileIndexRefresh)
+	if got := x.find(dataDir, other); got == "" {
+		t.Fatal("new file should be found after refresh")
+	}
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+// MessageFilterParams 消息过滤参数，用于 HTTP 查询与 MCP 工具，多个值用逗号分隔
+type MessageFilterParams struct {
+	Types          string `form:"types" json:"types"`
+	SubTypes       string `form:"subtypes" json:"subtypes"`
+	Regex          string `form:"regex" json:"regex"`
+	FromSelf       string `form:"from_self" json:"from_self"`
+	ChatRoomOnly   bool   `form:"chatroom_only" json:"chatroom_only"`
+	PrivateOnly    bool   `form:"private_only" json:"private_only"`
+	MentionsMe     bool   `form:"mentions_me" json:"mentions_me"`
+	ExcludeTalkers string `form:"exclude_talkers" json:"exclude_talkers"`
+}
+
+// withMessageFilter 为 MCP 工具添加过滤参数，keyword 已支持正则，不再单独提供 regex
+func withMessageFilter() mcp.ToolOption {
+	return func(t *mcp.Tool) {
+		for _, opt := range messageFilterToolOptions {
+			opt(t)
+		}
+	}
+}
+
+var messageFilterToolOptions = []mcp.ToolOption{
+	mcp.WithString("types", mcp.Description("可选，消息类型，多个用\",\"分隔：1 文本、3 图片、34 语音、43 视频、47 表情、49 分享类（文件、链接、转账等）、10000 系统消息")),
+	mcp.WithString("subtypes", mcp.Description("可选，分享类消息的子类型，多个用\",\"分隔：6 文件、5 链接、57 引用、2000 转账、2001 红包")),
+	mcp.WithString("from_self", mcp.Description("可选，true 只返回我发送的消息，false 排除我发送的消息")),
+	mcp.WithBoolean("chatroom_only", mcp.Description("可选，只返回群聊消息")),
+	mcp.WithBoolean("private_only", mcp.Description("可选，只返回私聊消息")),
+	mcp.WithBoolean("mentions_me", mcp.Description("可选，只返回群聊中 @ 我（包括 @所有人）的消息")),
+	mcp.WithString("exclude_talkers", mcp.Description("可选，排除的会话，多个用\",\"分隔")),
+}
+
+// messageFilter 由请求参数生成过滤条件，没有条件时返回 nil
+func (s *Service) messageFilter(p MessageFilterParams) (*model.MessageFilter, error) {
+	f := &model.MessageFilter{
+		Regex:          strings.TrimSpace(p.Regex),
+		ChatRoomOnly:   p.ChatRoomOnly,
+		PrivateOnly:    p.PrivateOnly,
+		MentionsMe:     p.MentionsMe,
+		ExcludeTalkers: util.Str2List(p.ExcludeTalkers, ","),
+	}
+	var err error
+	if f.Types, err = model.ParseInt64List(p.Types); err != nil {
+		return nil, errors.InvalidArg("types")
+	}
+	if f.SubTypes, err = model.ParseInt64List(p.SubTypes); err != nil {
+		return nil, errors.InvalidArg("subtypes")
+	}
+	if p.FromSelf != "" {
+		v, err := strconv.ParseBool(p.FromSelf)
+		if err != nil {
+			return nil, errors.InvalidArg("from_self")
+		}
+		f.FromSelf = &v
+	}
+	if f.IsEmpty() {
+		return nil, nil
+	}
+
+	var self *model.Identity
+	if f.MentionsMe {
+		// 无法确定当前账号（如 macOS 微信 3.x 的 md5 账号目录）时拒绝，而不是静默地不匹配任何消息
+		if self = s.db.GetIdentity(); self.UserName == "" {
+			return nil, errors.Newf(nil, http.StatusBadRequest, "mentions_me unsupported: account wechat id unknown")
+		}
+	}
+	if err := f.Compile(self); err != nil {
+		return nil, errors.InvalidArg("regex")
+	}
+	return f, nil
+}
+
+// pageOf 返回 offset 之后最多 limit 项，limit 为 0 时不限制
+func pageOf[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
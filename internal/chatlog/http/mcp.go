@@ -27,6 +27,8 @@ func (s *Service) initMCPServer() {
 	s.mcpServer.AddTool(ChatLogTool, s.handleMCPChatLog)
 	s.mcpServer.AddTool(CurrentTimeTool, s.handleMCPCurrentTime)
 	s.mcpServer.AddTool(DiaryTool, s.handleMCPDiary)
+	s.mcpServer.AddTool(FavoriteTool, s.handleMCPFavorite)
+	s.mcpServer.AddTool(SnsTool, s.handleMCPSns)
 	s.mcpSSEServer = server.NewSSEServer(s.mcpServer)
 	s.mcpStreamableServer = server.NewStreamableHTTPServer(s.mcpServer)
 }
@@ -144,6 +146,7 @@ var ChatLogTool = mcp.NewTool(
 2. 后续步骤：必须移除keyword参数，分别查询每个时间点前后的完整对话
 3. 错误示例：对所有找到的关键词消息一次性查询大范围上下文
 4. 正确示例：对每个时间点T分别执行查询"T前后15-30分钟"（不带keyword）`)),
+	withMessageFilter(),
 )
 
 var CurrentTimeTool = mcp.NewTool(
@@ -182,6 +185,20 @@ var DiaryTool = mcp.NewTool(
 	mcp.WithString("talker", mcp.Description("可选，会话筛选（多个用','分隔）")),
 )
 
+var FavoriteTool = mcp.NewTool(
+	"query_favorite",
+	mcp.WithDescription(`查询用户的微信收藏，包括笔记、链接、图片、文件等。当用户询问收藏过的文章、笔记或想查找之前保存的内容时使用此工具。参数为空时，返回最近的收藏列表。`),
+	mcp.WithString("type", mcp.Description("收藏类型，可选：note、link、image、file、video、voice、location、chat，为空时不限制")),
+	mcp.WithString("keyword", mcp.Description("搜索关键词，匹配标题、描述、正文与链接")),
+)
+
+var SnsTool = mcp.NewTool(
+	"query_sns",
+	mcp.WithDescription(`查询朋友圈动态，返回发布时间、作者、正文、图片/视频链接、点赞数与评论。当用户询问某人最近发了什么朋友圈、某段时间的朋友圈内容时使用此工具。`),
+	mcp.WithString("time", mcp.Description(`时间范围，格式同 query_chat_log 的 time 参数，如 "2024-01-01~2024-01-31"、"last-7d"；为空时不限制`)),
+	mcp.WithString("user", mcp.Description("发布者，可以是 ID、备注或昵称；为空时返回所有人的动态")),
+)
+
 type ContactRequest struct {
 	Keyword string `json:"keyword"`
 	Limit   int    `json:"limit"`
@@ -294,6 +311,7 @@ type ChatLogRequest struct {
 	Limit   int    `form:"limit"`
 	Offset  int    `form:"offset"`
 	Format  string `form:"format"`
+	MessageFilterParams
 }
 
 func (s *Service) handleMCPChatLog(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -319,11 +337,24 @@ func (s *Service) handleMCPChatLog(ctx context.Context, request mcp.CallToolRequ
 		req.Offset = 0
 	}
 
-	messages, err := s.db.GetMessages(start, end, req.Talker, req.Sender, req.Keyword, req.Limit, req.Offset)
+	filter, err := s.messageFilter(req.MessageFilterParams)
+	if err != nil {
+		return errors.ErrMCPTool(err), nil
+	}
+
+	// 有过滤条件时查询全部消息，过滤后再分页
+	limit, offset := req.Limit, req.Offset
+	if !filter.IsEmpty() {
+		limit, offset = 0, 0
+	}
+	messages, err := s.db.GetMessages(start, end, req.Talker, req.Sender, req.Keyword, limit, offset)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get messages")
 		return errors.ErrMCPTool(err), nil
 	}
+	if !filter.IsEmpty() {
+		messages = pageOf(filter.FilterMessages(messages), req.Limit, req.Offset)
+	}
 
 	buf := &bytes.Buffer{}
 	if len(messages) == 0 {
@@ -435,3 +466,98 @@ func (s *Service) handleMCPDiary(ctx context.Context, request mcp.CallToolReques
 	}
 	return &mcp.CallToolResult{Content: []mcp.Content{mcp.TextContent{Type: "text", Text: buf.String()}}}, nil
 }
+
+type FavoriteRequest struct {
+	Type    string `json:"type"`
+	Keyword string `json:"keyword"`
+	Limit   int    `json:"limit"`
+	Offset  int    `json:"offset"`
+}
+
+func (s *Service) handleMCPFavorite(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var req FavoriteRequest
+	if err := request.BindArguments(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind arguments")
+		log.Error().Interface("request", request.GetRawArguments()).Msg("Failed to bind arguments")
+		return errors.ErrMCPTool(err), nil
+	}
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+
+	list, err := s.db.GetFavorites(req.Type, req.Keyword, req.Limit, req.Offset)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get favorites")
+		return errors.ErrMCPTool(err), nil
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("Time,Type,From,Content\n")
+	for _, f := range list.Items {
+		buf.WriteString(fmt.Sprintf("%s,%s,%s,%s\n", f.Time.Format("2006-01-02 15:04:05"), f.Type, f.From, f.PlainText()))
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: buf.String(),
+			},
+		},
+	}, nil
+}
+
+type SnsRequest struct {
+	Time   string `json:"time"`
+	User   string `json:"user"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+func (s *Service) handleMCPSns(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var req SnsRequest
+	if err := request.BindArguments(&req); err != nil {
+		log.Error().Err(err).Msg("Failed to bind arguments")
+		log.Error().Interface("request", request.GetRawArguments()).Msg("Failed to bind arguments")
+		return errors.ErrMCPTool(err), nil
+	}
+	if req.Time == "" {
+		req.Time = "all"
+	}
+	start, end, ok := util.TimeRangeOf(req.Time)
+	if !ok {
+		return errors.ErrMCPTool(errors.InvalidArg("time")), nil
+	}
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+
+	list, err := s.db.GetSnsPosts(start, end, req.User, req.Limit, req.Offset)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get sns posts")
+		return errors.ErrMCPTool(err), nil
+	}
+	buf := &bytes.Buffer{}
+	for _, post := range list.Items {
+		buf.WriteString(fmt.Sprintf("%s %s(%s) [%d赞]\n", post.Time.Format("2006-01-02 15:04:05"), post.NickName, post.UserName, len(post.Likes)))
+		buf.WriteString(post.PlainText(""))
+		buf.WriteString("\n")
+		for _, cm := range post.Comments {
+			if cm.ReplyTo != "" {
+				buf.WriteString(fmt.Sprintf("  %s 回复 %s: %s\n", cm.NickName, cm.ReplyTo, cm.Content))
+			} else {
+				buf.WriteString(fmt.Sprintf("  %s: %s\n", cm.NickName, cm.Content))
+			}
+		}
+		buf.WriteString("\n")
+	}
+	if buf.Len() == 0 {
+		buf.WriteString("未找到朋友圈动态\n")
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: buf.String(),
+			},
+		},
+	}, nil
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"crypto/md5"
 	"embed"
 	"encoding/csv"
 	"encoding/json"
@@ -14,10 +15,12 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
@@ -179,7 +182,10 @@ func (s *Service) initBaseRouter() {
 
 func (s *Service) initMediaRouter() {
 	s.router.GET("/data/*path", s.handleMediaData)
+	s.router.GET("/image/*key", s.checkDBStateMiddleware(), s.handleImage)
 	s.router.GET("/avatar/:username", s.handleAvatar)
+	s.router.GET("/emoji/:md5", s.handleEmoji)
+	s.router.GET("/sns/:id/:index", s.checkDBStateMiddleware(), s.handleSnsMedia)
 }
 
 func (s *Service) initAPIRouter() {
@@ -191,16 +197,36 @@ func (s *Service) initAPIRouter() {
 		actions := api.Group("/actions")
 		actions.POST("/get-data-key", s.handleActionGetDataKey)
 		actions.POST("/decrypt", s.handleActionDecrypt)
+		actions.GET("/decrypt/events", s.handleActionDecryptEvents)
 		actions.POST("/http/start", s.handleActionStartHTTP)
 		actions.POST("/http/stop", s.handleActionStopHTTP)
 		actions.POST("/auto-decrypt/start", s.handleActionStartAutoDecrypt)
 		actions.POST("/auto-decrypt/stop", s.handleActionStopAutoDecrypt)
+		actions.POST("/unlock", s.handleActionUnlock)
+		actions.POST("/export-media", s.checkDBStateMiddleware(), s.handleActionExportMedia)
+
+		// webhook 配置在数据库未就绪时也可修改，服务启动后生效
+		webhookAPI := api.Group("/webhook")
+		webhookAPI.GET("/items", s.handleListWebhooks)
+		webhookAPI.POST("/items", s.handleAddWebhook)
+		webhookAPI.PUT("/items/:id", s.handleUpdateWebhook)
+		webhookAPI.DELETE("/items/:id", s.handleDeleteWebhook)
+		webhookAPI.POST("/items/:id/test", s.handleTestWebhook)
+		webhookAPI.POST("/test", s.handleTestWebhookConfig)
+		webhookAPI.GET("/deliveries", s.checkDBStateMiddleware(), s.handleWebhookDeliveries)
+		webhookAPI.POST("/deliveries", s.checkDBStateMiddleware(), s.handleWebhookDeliveriesAction)
+		webhookAPI.GET("/metrics", s.checkDBStateMiddleware(), s.handleWebhookMetrics)
 
 		dataAPI := api.Group("", s.checkDBStateMiddleware())
 		dataAPI.GET("/chatlog", s.handleChatlog)
+		dataAPI.GET("/stream", s.handleStream)
 		dataAPI.GET("/contact", s.handleContacts)
 		dataAPI.GET("/chatroom", s.handleChatRooms)
+		dataAPI.GET("/chatroom/:name/history", s.handleChatRoomHistory)
 		dataAPI.GET("/session", s.handleSessions)
+		dataAPI.GET("/favorite", s.handleFavorites)
+		dataAPI.GET("/sns", s.handleSns)
+		dataAPI.GET("/articles", s.handleArticles)
 		dataAPI.GET("/diary", s.handleDiary)
 		dataAPI.GET("/dashboard", s.handleDashboard)
 		dataAPI.GET("/search", s.handleSearch)
@@ -399,11 +425,23 @@ func (s *Service) handleDashboard(c *gin.Context) {
 	type RelationshipNetwork struct {
 		Nodes []RelationshipNode `json:"nodes"`
 	}
+	type StickerItem struct {
+		MD5         string `json:"md5"`
+		Count       int64  `json:"count"`
+		PackageName string `json:"packageName,omitempty"`
+		URL         string `json:"url"`
+	}
+	type StickerUsage struct {
+		Total    int64         `json:"total"`
+		Distinct int           `json:"distinct"`
+		Top      []StickerItem `json:"top"`
+	}
 	type Visualization struct {
 		Defaults            VisualizationDefaults `json:"defaults"`
 		GroupAnalysis       GroupAnalysis         `json:"groupAnalysis"`
 		DataTypeAnalysis    DataTypeAnalysis      `json:"dataTypeAnalysis"`
 		RelationshipNetwork RelationshipNetwork   `json:"relationshipNetwork"`
+		StickerUsage        StickerUsage          `json:"stickerUsage"`
 	}
 	type Dashboard struct {
 		Overview      Overview      `json:"overview"`
@@ -684,6 +722,26 @@ func (s *Service) handleDashboard(c *gin.Context) {
 	if totalMsgs > 0 {
 		processingStatus.Processed = 100
 	}
+	// 表情使用统计：总量与去重数基于全部表情，榜单仅取前 20
+	stickerUsage := StickerUsage{Top: []StickerItem{}}
+	if s.db != nil && s.db.GetDB() != nil {
+		if all, err := s.db.StickerUsage(0); err == nil {
+			stickerUsage.Distinct = len(all)
+			for i, u := range all {
+				stickerUsage.Total += u.Count
+				if i >= 20 {
+					continue
+				}
+				stickerUsage.Top = append(stickerUsage.Top, StickerItem{
+					MD5:         u.MD5,
+					Count:       u.Count,
+					PackageName: u.PackageName,
+					URL:         "/emoji/" + u.MD5,
+				})
+			}
+		}
+	}
+
 	qualityMetrics := QualityMetrics{}
 	floatPtr := func(v float64) *float64 { return &v }
 	stringPtr := func(v string) *string { return &v }
@@ -735,6 +793,7 @@ func (s *Service) handleDashboard(c *gin.Context) {
 			PieGradient:      "#3b82f6 0deg 180deg, #10b981 180deg 270deg, #f59e0b 270deg 315deg, #ef4444 315deg 360deg",
 		},
 		RelationshipNetwork: RelationshipNetwork{Nodes: relationshipNodes},
+		StickerUsage:        stickerUsage,
 	}
 
 	resp := Dashboard{
@@ -850,6 +909,7 @@ func (s *Service) handleSearch(c *gin.Context) {
 		Limit  int    `form:"limit"`
 		Offset int    `form:"offset"`
 		Format string `form:"format"`
+		MessageFilterParams
 	}{}
 
 	if err := c.BindQuery(&params); err != nil {
@@ -921,6 +981,13 @@ func (s *Service) handleSearch(c *gin.Context) {
 		req.Start, req.End = req.End, req.Start
 	}
 
+	filter, err := s.messageFilter(params.MessageFilterParams)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+	req.Filter = filter
+
 	resp, err := s.db.SearchMessages(req)
 	if err != nil {
 		errors.Err(c, err)
@@ -1397,6 +1464,151 @@ func (s *Service) handleAvatar(c *gin.Context) {
 	c.Data(http.StatusOK, ct, avatar.Data)
 }
 
+// emojiDirs 各版本微信本地表情缓存目录（相对 DataDir）
+var emojiDirs = []string{
+	"FileStorage/CustomEmotion",
+	"business/emoticon",
+	"cache",
+	"Stickers",
+}
+
+var emojiMD5Pattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// handleEmoji 按 md5 返回动画表情
+// 依次尝试：数据库内联数据 -> 本地缓存文件 -> 下载 encrypt_url 并解密 -> 跳转 cdn_url
+func (s *Service) handleEmoji(c *gin.Context) {
+	md5 := strings.ToLower(strings.TrimSuffix(c.Param("md5"), filepath.Ext(c.Param("md5"))))
+	if !emojiMD5Pattern.MatchString(md5) {
+		errors.Err(c, errors.InvalidArg("md5"))
+		return
+	}
+
+	emoticon, err := s.db.GetEmoticon(md5)
+	if err != nil && err != errors.ErrMediaNotFound {
+		log.Debug().Err(err).Str("md5", md5).Msg("get emoticon failed")
+	}
+
+	if emoticon != nil && len(emoticon.Data) > 0 {
+		if out, _, err := dat2img.Emoticon2Image(emoticon.Data); err == nil {
+			s.writeEmoji(c, out)
+			return
+		}
+	}
+
+	if path := s.emojiFiles.find(s.conf.GetDataDir(), md5); path != "" {
+		if b, err := os.ReadFile(path); err == nil {
+			if out, _, err := dat2img.Emoticon2Image(b); err == nil {
+				s.writeEmoji(c, out)
+				return
+			}
+		}
+	}
+
+	if emoticon != nil && emoticon.EncryptURL != "" && emoticon.AesKey != "" {
+		out, err := fetchEmoticon(emoticon.EncryptURL, emoticon.AesKey)
+		if err == nil {
+			s.writeEmoji(c, out)
+			return
+		}
+		log.Debug().Err(err).Str("md5", md5).Msg("fetch emoticon failed")
+	}
+
+	if emoticon != nil && emoticon.CdnURL != "" {
+		c.Redirect(http.StatusFound, emoticon.CdnURL)
+		return
+	}
+
+	errors.Err(c, errors.ErrMediaNotFound)
+}
+
+func (s *Service) writeEmoji(c *gin.Context, data []byte) {
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, http.DetectContentType(data), data)
+}
+
+// snsDirs 各版本微信朋友圈媒体缓存目录（相对 DataDir）
+var snsDirs = []string{
+	"FileStorage/Sns/Cache",
+	"cache",
+}
+
+// handleSnsMedia 返回朋友圈图片 / 视频，index 为媒体在动态中的序号
+// 优先读取本地缓存并经 dat2img 解码，未缓存时跳转 CDN
+// GET /sns/:id/:index?thumb=1
+func (s *Service) handleSnsMedia(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		errors.Err(c, errors.InvalidArg("index"))
+		return
+	}
+	post, err := s.db.GetSnsPost(c.Param("id"))
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+	if index >= len(post.Media) {
+		errors.Err(c, errors.ErrMediaNotFound)
+		return
+	}
+	media := post.Media[index]
+	thumb := c.Query("thumb") != ""
+
+	url := media.URL
+	if thumb && media.Thumb != "" {
+		url = media.Thumb
+	}
+
+	names := []string{fmt.Sprintf("%x", md5.Sum([]byte(url)))}
+	if !thumb {
+		names = append(names, media.MD5)
+	}
+	if path := s.snsFiles.find(s.conf.GetDataDir(), names...); path != "" {
+		if b, err := os.ReadFile(path); err == nil {
+			if out, _, err := dat2img.Dat2Image(b); err == nil {
+				c.Header("Cache-Control", "public, max-age=86400")
+				c.Data(http.StatusOK, http.DetectContentType(out), out)
+				return
+			}
+			if media.Type == model.SnsMediaVideo && !thumb {
+				c.Data(http.StatusOK, "video/mp4", b)
+				return
+			}
+		}
+	}
+
+	if url == "" {
+		errors.Err(c, errors.ErrMediaNotFound)
+		return
+	}
+	if media.Token != "" && !strings.Contains(url, "?") {
+		url += "?idx=1&token=" + media.Token
+	}
+	c.Redirect(http.StatusFound, url)
+}
+
+// fetchEmoticon 下载加密的表情数据并解密
+func fetchEmoticon(url, aesKey string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := dat2img.DecryptEmoticon(b, aesKey)
+	if err != nil {
+		return nil, err
+	}
+	out, _, err := dat2img.Emoticon2Image(plain)
+	return out, err
+}
+
 func (s *Service) handleChatRooms(c *gin.Context) {
 
 	q := struct {
@@ -1446,6 +1658,302 @@ func (s *Service) handleChatRooms(c *gin.Context) {
 	}
 }
 
+// handleFavorites 查询收藏
+// GET /api/v1/favorite?type=(note|link|image|file|...)&keyword=xxx&limit=&offset=&format=(json|csv|text)
+func (s *Service) handleFavorites(c *gin.Context) {
+	q := struct {
+		Type    string `form:"type"`
+		Keyword string `form:"keyword"`
+		Limit   int    `form:"limit"`
+		Offset  int    `form:"offset"`
+		Format  string `form:"format"`
+	}{}
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	list, err := s.db.GetFavorites(q.Type, q.Keyword, q.Limit, q.Offset)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(q.Format))
+	if format == "" {
+		format = "json"
+	}
+	switch format {
+	case "json":
+		c.JSON(http.StatusOK, list)
+	default:
+		if format == "csv" {
+			c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.Flush()
+
+		csvWriter := csv.NewWriter(c.Writer)
+		csvWriter.Write([]string{"ID", "Time", "Type", "From", "Talker", "Title", "Content", "URL"})
+		for _, f := range list.Items {
+			csvWriter.Write([]string{fmt.Sprint(f.ID), f.Time.Format("2006-01-02 15:04:05"), f.Type, f.From, f.Talker, f.Title, f.Content, f.URL})
+		}
+		csvWriter.Flush()
+	}
+}
+
+// handleSns 查询朋友圈动态
+// GET /api/v1/sns?time=2024-01-01~2024-01-31&user=xxx&limit=&offset=&format=(json|csv|text)
+func (s *Service) handleSns(c *gin.Context) {
+	q := struct {
+		Time   string `form:"time"`
+		User   string `form:"user"`
+		Limit  int    `form:"limit"`
+		Offset int    `form:"offset"`
+		Format string `form:"format"`
+	}{}
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	if q.Time == "" {
+		q.Time = "all"
+	}
+	start, end, ok := util.TimeRangeOf(q.Time)
+	if !ok {
+		errors.Err(c, errors.InvalidArg("time"))
+		return
+	}
+
+	list, err := s.db.GetSnsPosts(start, end, strings.TrimSpace(q.User), q.Limit, q.Offset)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(q.Format))
+	if format == "" {
+		format = "json"
+	}
+	switch format {
+	case "json":
+		c.JSON(http.StatusOK, list)
+	default:
+		if format == "csv" {
+			c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.Flush()
+
+		csvWriter := csv.NewWriter(c.Writer)
+		csvWriter.Write([]string{"ID", "Time", "UserName", "NickName", "Content", "Location", "Likes", "Comments"})
+		for _, post := range list.Items {
+			comments := make([]string, 0, len(post.Comments))
+			for _, cm := range post.Comments {
+				comments = append(comments, fmt.Sprintf("%s: %s", cm.NickName, cm.Content))
+			}
+			csvWriter.Write([]string{
+				post.ID,
+				post.Time.Format("2006-01-02 15:04:05"),
+				post.UserName,
+				post.NickName,
+				post.PlainText(c.Request.Host),
+				post.Location,
+				fmt.Sprint(len(post.Likes)),
+				strings.Join(comments, "\n"),
+			})
+		}
+		csvWriter.Flush()
+	}
+}
+
+// handleArticles 公众号文章归档，支持 RSS / Atom 订阅
+// GET /api/v1/articles?account=gh_xxx&time=last-30d&limit=&offset=&format=(json|csv|text|rss|atom)
+func (s *Service) handleArticles(c *gin.Context) {
+	q := struct {
+		Account string `form:"account"`
+		Time    string `form:"time"`
+		Limit   int    `form:"limit"`
+		Offset  int    `form:"offset"`
+		Format  string `form:"format"`
+	}{}
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	if q.Time == "" {
+		q.Time = "last-30d"
+	}
+	start, end, ok := util.TimeRangeOf(q.Time)
+	if !ok {
+		errors.Err(c, errors.InvalidArg("time"))
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(q.Format))
+	if format == "" {
+		format = "json"
+	}
+	// 订阅源默认只返回最近 50 篇
+	if q.Limit <= 0 && (format == "rss" || format == "atom") {
+		q.Limit = 50
+	}
+
+	list, err := s.db.GetArticles(q.Account, start, end, q.Limit, q.Offset)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	title := "公众号文章"
+	if q.Account != "" && len(list.Items) > 0 && list.Items[0].AccountName != "" {
+		title = list.Items[0].AccountName
+	}
+	link := "http://" + c.Request.Host + c.Request.URL.RequestURI()
+
+	switch format {
+	case "json":
+		c.JSON(http.StatusOK, list)
+	case "rss":
+		c.Writer.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		if err := writeArticlesRSS(c.Writer, title, link, list.Items); err != nil {
+			log.Debug().Err(err).Msg("write rss failed")
+		}
+	case "atom":
+		c.Writer.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		if err := writeArticlesAtom(c.Writer, title, link, list.Items); err != nil {
+			log.Debug().Err(err).Msg("write atom failed")
+		}
+	default:
+		if format == "csv" {
+			c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.Flush()
+
+		csvWriter := csv.NewWriter(c.Writer)
+		csvWriter.Write([]string{"PublishTime", "Account", "AccountName", "Title", "Digest", "URL"})
+		for _, a := range list.Items {
+			csvWriter.Write([]string{a.PublishTime.Format("2006-01-02 15:04:05"), a.Account, a.AccountName, a.Title, a.Digest, a.URL})
+		}
+		csvWriter.Flush()
+	}
+}
+
+// handleChatRoomHistory 返回群聊成员变动与改名时间线；指定 at 时附带该时刻的成员列表
+// GET /api/v1/chatroom/:name/history?at=YYYY-MM-DD&format=(json|csv|text)
+func (s *Service) handleChatRoomHistory(c *gin.Context) {
+	q := struct {
+		At     string `form:"at"`
+		Format string `form:"format"`
+	}{}
+	if err := c.BindQuery(&q); err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	// at 取所在时间范围的结束时刻，如 2024-01-01 表示当天结束时的成员
+	var at time.Time
+	if q.At = strings.TrimSpace(q.At); q.At != "" {
+		_, end, ok := util.TimeRangeOf(q.At)
+		if !ok {
+			errors.Err(c, errors.InvalidArg("at"))
+			return
+		}
+		at = end
+	}
+
+	format := strings.ToLower(strings.TrimSpace(q.Format))
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv", "text", "plain":
+	default:
+		errors.Err(c, errors.InvalidArg("format"))
+		return
+	}
+
+	history, err := s.db.GetChatRoomHistory(c.Param("name"), at)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	switch format {
+	case "json":
+		c.JSON(http.StatusOK, history)
+	case "csv":
+		c.Writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.Flush()
+
+		csvWriter := csv.NewWriter(c.Writer)
+		csvWriter.Write([]string{"Time", "Type", "Operator", "Members", "Name", "Content"})
+		for _, ev := range history.Events {
+			operator := ""
+			if ev.Operator != nil {
+				operator = ev.Operator.UserName
+				if operator == "" {
+					operator = ev.Operator.DisplayName
+				}
+			}
+			members := make([]string, 0, len(ev.Members))
+			for _, m := range ev.Members {
+				if m.UserName != "" {
+					members = append(members, m.UserName)
+				} else {
+					members = append(members, m.DisplayName)
+				}
+			}
+			csvWriter.Write([]string{ev.Time.Format("2006-01-02 15:04:05"), ev.Type, operator, strings.Join(members, ","), ev.Name, ev.Content})
+		}
+		if !history.At.IsZero() {
+			csvWriter.Write(nil)
+			csvWriter.Write([]string{"Members at", history.At.Format("2006-01-02 15:04:05"), strconv.Itoa(len(history.Members))})
+			csvWriter.Write([]string{"UserName", "DisplayName"})
+			for _, m := range history.Members {
+				csvWriter.Write([]string{m.UserName, m.DisplayName})
+			}
+		}
+		csvWriter.Flush()
+	case "text", "plain":
+		c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		c.Writer.Flush()
+
+		for _, ev := range history.Events {
+			c.Writer.WriteString(fmt.Sprintf("%s [%s] %s\n", ev.Time.Format("2006-01-02 15:04:05"), ev.Type, ev.Content))
+		}
+		if !history.At.IsZero() {
+			c.Writer.WriteString(fmt.Sprintf("\nMembers at %s (%d):\n", history.At.Format("2006-01-02 15:04:05"), len(history.Members)))
+			for _, m := range history.Members {
+				switch {
+				case m.DisplayName == "":
+					c.Writer.WriteString(m.UserName + "\n")
+				case m.UserName == "":
+					c.Writer.WriteString(m.DisplayName + "\n")
+				default:
+					c.Writer.WriteString(fmt.Sprintf("%s(%s)\n", m.DisplayName, m.UserName))
+				}
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
 func (s *Service) handleSessions(c *gin.Context) {
 
 	q := struct {
@@ -1687,27 +2195,15 @@ func (s *Service) findPath(_type string, key string) (string, error) {
 	return "", errors.ErrMediaNotFound
 }
 
+// handleMediaData 返回数据目录中的文件，.dat 图片解密后返回，w 参数指定缩略图宽度
+// GET /data/*path?w=320
 func (s *Service) handleMediaData(c *gin.Context) {
-	relativePath := filepath.Clean(c.Param("path"))
-
-	absolutePath := filepath.Join(s.conf.GetDataDir(), relativePath)
-
-	if _, err := os.Stat(absolutePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "File not found",
-		})
+	width, err := parseThumbnailWidth(c.Query("w"))
+	if err != nil {
+		errors.Err(c, err)
 		return
 	}
-
-	ext := strings.ToLower(filepath.Ext(absolutePath))
-	switch {
-	case ext == ".dat":
-		s.HandleDatFile(c, absolutePath)
-	default:
-		// 直接返回文件
-		c.File(absolutePath)
-	}
-
+	s.serveMedia(c, filepath.Clean(c.Param("path")), width)
 }
 
 func (s *Service) HandleDatFile(c *gin.Context, path string) {
@@ -12,6 +12,7 @@ import (
 
 	"github.com/sjzar/chatlog/internal/chatlog/conf"
 	"github.com/sjzar/chatlog/internal/chatlog/database"
+	"github.com/sjzar/chatlog/internal/chatlog/wechat"
 	"github.com/sjzar/chatlog/internal/errors"
 )
 
@@ -27,6 +28,9 @@ type Service struct {
 	mcpSSEServer        *server.SSEServer
 	mcpStreamableServer *server.StreamableHTTPServer
 
+	// emojiFiles、snsFiles 本地表情与朋友圈媒体缓存文件的索引
+	emojiFiles *fileIndex
+	snsFiles   *fileIndex
 }
 
 type Config interface {
@@ -54,6 +58,10 @@ type Control interface {
 	StopAutoDecrypt() error
 	SaveSpeechConfig(cfg *conf.SpeechConfig) error
 	SetHTTPAddr(addr string) error
+	UnlockWorkDir(passphrase string) error
+	SubscribeDecryptEvents() (<-chan wechat.DecryptEvent, func())
+	DecryptProgress() wechat.DecryptProgress
+	LastDecryptReport() *wechat.DecryptReport
 }
 
 func NewService(conf Config, db *database.Service, control Control) *Service {
@@ -74,10 +82,12 @@ func NewService(conf Config, db *database.Service, control Control) *Service {
 	)
 
 	s := &Service{
-		conf:    conf,
-		db:      db,
-		control: control,
-		router:  router,
+		conf:       conf,
+		db:         db,
+		control:    control,
+		router:     router,
+		emojiFiles: newFileIndex(emojiDirs...),
+		snsFiles:   newFileIndex(snsDirs...),
 	}
 
 	s.initMCPServer()
@@ -0,0 +1,268 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/websocket"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/internal/wechatdb"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+// streamPingInterval 无新消息时的保活间隔
+const streamPingInterval = 30 * time.Second
+
+// streamMinInterval 两次查询新消息的最短间隔，间隔内的数据库变化合并为一次查询
+const streamMinInterval = time.Second
+
+// streamSource 实时消息流的数据来源，由 database.Service 实现
+type streamSource interface {
+	SubscribeMessages() (<-chan struct{}, func())
+	GetMessages(start, end time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error)
+	GetSessions(key string, limit, offset int) (*wechatdb.GetSessionsResp, error)
+}
+
+// streamRequest 实时消息流的订阅条件
+type streamRequest struct {
+	Talker  string `form:"talker"`
+	Sender  string `form:"sender"`
+	Keyword string `form:"keyword"`
+	// LastEventID 从该 seq 之后继续推送，EventSource 重连时以 Last-Event-ID 头提供
+	LastEventID string `form:"last_event_id"`
+	MessageFilterParams
+}
+
+// messageStream 按订阅条件查询新消息
+// 不同会话的消息时间可能交错（如手机同步的迟到消息），已推送的进度按会话分别记录在 cursors 中；
+// 尚未推送过消息的会话从 since 与 lastSeq（订阅时刻或 Last-Event-ID）开始
+type messageStream struct {
+	src     streamSource
+	req     streamRequest
+	filter  *model.MessageFilter
+	host    string
+	lastSeq int64
+	since   time.Time
+	cursors map[string]int64
+}
+
+// streamMessage 待推送的消息及其所属的订阅会话
+type streamMessage struct {
+	talker  string
+	message *model.Message
+}
+
+// handleStream 以 SSE 推送新消息，请求带 Upgrade: websocket 时改用 WebSocket
+// GET /api/v1/stream?talker=&sender=&types=
+func (s *Service) handleStream(c *gin.Context) {
+	s.serveStream(c, s.db)
+}
+
+func (s *Service) serveStream(c *gin.Context, src streamSource) {
+	var req streamRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		errors.Err(c, errors.InvalidArg("query"))
+		return
+	}
+	if id := c.GetHeader("Last-Event-ID"); id != "" {
+		req.LastEventID = id
+	}
+	filter, err := s.messageFilter(req.MessageFilterParams)
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	ms := &messageStream{src: src, req: req, filter: filter, host: c.Request.Host, since: time.Now(), cursors: make(map[string]int64)}
+	if req.LastEventID != "" {
+		seq, err := strconv.ParseInt(req.LastEventID, 10, 64)
+		if err != nil || seq <= 0 {
+			errors.Err(c, errors.InvalidArg("last_event_id"))
+			return
+		}
+		ms.lastSeq = seq
+		ms.since = time.Unix(seq/1000, 0)
+	}
+
+	if c.IsWebsocket() {
+		s.serveWebSocketStream(c, ms)
+		return
+	}
+	s.serveSSEStream(c, ms)
+}
+
+func (s *Service) serveSSEStream(c *gin.Context, ms *messageStream) {
+	notify, cancel := ms.src.SubscribeMessages()
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	send := func(m *model.Message) error {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: message\ndata: %s\n\n", m.CursorSeq(), data)
+		return err
+	}
+	ping := func() error {
+		_, err := fmt.Fprint(c.Writer, ": ping\n\n")
+		return err
+	}
+	ms.run(c.Request.Context().Done(), notify, send, ping, c.Writer.Flush)
+}
+
+// streamFrame WebSocket 推送的消息帧，ID 与 SSE 的事件 ID 相同，可用于 last_event_id 续传
+type streamFrame struct {
+	ID      int64          `json:"id,omitempty"`
+	Type    string         `json:"type"`
+	Message *model.Message `json:"message,omitempty"`
+}
+
+func (s *Service) serveWebSocketStream(c *gin.Context, ms *messageStream) {
+	server := websocket.Server{
+		// 与其他 API 一致，不校验 Origin
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			notify, cancel := ms.src.SubscribeMessages()
+			defer cancel()
+
+			// 客户端关闭或断开时结束推送，客户端发送的内容忽略
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				var discard string
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+			}()
+
+			send := func(m *model.Message) error {
+				return websocket.JSON.Send(ws, &streamFrame{ID: m.CursorSeq(), Type: "message", Message: m})
+			}
+			ping := func() error {
+				return websocket.JSON.Send(ws, &streamFrame{Type: "ping"})
+			}
+			ms.run(done, notify, send, ping, func() {})
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// run 先推送 Last-Event-ID 之后的消息，然后在消息数据库变化时推送新消息
+func (ms *messageStream) run(done <-chan struct{}, notify <-chan struct{}, send func(*model.Message) error, ping func() error, flush func()) {
+	if err := ms.push(send); err != nil {
+		return
+	}
+	flush()
+	pushedAt := time.Now()
+
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	var delayed <-chan time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-notify:
+			// 距上次查询不足 streamMinInterval 时推迟到间隔结束，期间的变化合并为一次查询
+			if wait := streamMinInterval - time.Since(pushedAt); wait > 0 {
+				if delayed == nil {
+					delayed = time.After(wait)
+				}
+				continue
+			}
+			if err := ms.push(send); err != nil {
+				return
+			}
+			pushedAt = time.Now()
+		case <-delayed:
+			delayed = nil
+			if err := ms.push(send); err != nil {
+				return
+			}
+			pushedAt = time.Now()
+		case <-ticker.C:
+			if err := ping(); err != nil {
+				return
+			}
+		}
+		flush()
+	}
+}
+
+// cursor 返回会话已推送的最后一条消息的 seq 与查询起点
+func (ms *messageStream) cursor(talker string) (int64, time.Time) {
+	if seq, ok := ms.cursors[talker]; ok {
+		return seq, time.Unix(seq/1000, 0)
+	}
+	return ms.lastSeq, ms.since
+}
+
+// push 查询并推送各会话游标之后的新消息
+func (ms *messageStream) push(send func(*model.Message) error) error {
+	for _, item := range ms.fetch() {
+		item.message.SetContent("host", ms.host)
+		if err := send(item.message); err != nil {
+			return err
+		}
+		ms.cursors[item.talker] = item.message.CursorSeq()
+	}
+	return nil
+}
+
+func (ms *messageStream) fetch() []streamMessage {
+	talkers := util.Str2List(ms.req.Talker, ",")
+	if len(talkers) == 0 {
+		talkers = ms.activeTalkers()
+	}
+
+	end := time.Now().Add(10 * time.Minute)
+	messages := make([]streamMessage, 0)
+	for _, talker := range talkers {
+		lastSeq, since := ms.cursor(talker)
+		list, err := ms.src.GetMessages(since, end, talker, ms.req.Sender, ms.req.Keyword, 0, 0)
+		if err != nil {
+			log.Debug().Err(err).Msgf("get stream messages of %s failed", talker)
+			continue
+		}
+		for _, m := range list {
+			if m.CursorSeq() <= lastSeq || !ms.filter.Match(m) {
+				continue
+			}
+			messages = append(messages, streamMessage{talker: talker, message: m})
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].message.CursorSeq() < messages[j].message.CursorSeq()
+	})
+	return messages
+}
+
+// activeTalkers 未指定 talker 时，返回最后一条消息晚于该会话游标的会话
+func (ms *messageStream) activeTalkers() []string {
+	resp, err := ms.src.GetSessions("", 0, 0)
+	if err != nil {
+		return nil
+	}
+	talkers := make([]string, 0)
+	for _, sess := range resp.Items {
+		_, since := ms.cursor(sess.UserName)
+		if !sess.NTime.Before(since.Add(-time.Second)) {
+			talkers = append(talkers, sess.UserName)
+		}
+	}
+	return talkers
+}
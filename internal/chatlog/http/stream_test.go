@@ -0,0 +1,227 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/internal/wechatdb"
+)
+
+type testStreamSource struct {
+	mutex    sync.Mutex
+	messages []*model.Message
+	notify   chan struct{}
+}
+
+func newTestStreamSource(messages ...*model.Message) *testStreamSource {
+	return &testStreamSource{messages: messages, notify: make(chan struct{}, 1)}
+}
+
+func (src *testStreamSource) SubscribeMessages() (<-chan struct{}, func()) {
+	return src.notify, func() {}
+}
+
+func (src *testStreamSource) GetMessages(start, end time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+	ret := make([]*model.Message, 0)
+	for _, m := range src.messages {
+		if m.Talker == talker && !m.Time.Before(start) && !m.Time.After(end) {
+			copied := *m
+			ret = append(ret, &copied)
+		}
+	}
+	return ret, nil
+}
+
+func (src *testStreamSource) GetSessions(key string, limit, offset int) (*wechatdb.GetSessionsResp, error) {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+	sessions := make(map[string]*model.Session)
+	resp := &wechatdb.GetSessionsResp{}
+	for _, m := range src.messages {
+		sess, ok := sessions[m.Talker]
+		if !ok {
+			sess = &model.Session{UserName: m.Talker}
+			sessions[m.Talker] = sess
+			resp.Items = append(resp.Items, sess)
+		}
+		if m.Time.After(sess.NTime) {
+			sess.NTime = m.Time
+		}
+	}
+	return resp, nil
+}
+
+// add 写入新消息并通知订阅者
+func (src *testStreamSource) add(m *model.Message) {
+	src.mutex.Lock()
+	src.messages = append(src.messages, m)
+	src.mutex.Unlock()
+	src.notify <- struct{}{}
+}
+
+func testStreamMessage(talker string, t time.Time, n int64, content string) *model.Message {
+	return &model.Message{Seq: t.Unix()*1000 + n, Time: t, Talker: talker, Type: model.MessageTypeText, Content: content}
+}
+
+func newTestStreamServer(t *testing.T, src streamSource) *httptest.Server {
+	gin.SetMode(gin.ReleaseMode)
+	s := &Service{}
+	router := gin.New()
+	router.GET("/stream", func(c *gin.Context) { s.serveStream(c, src) })
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// readSSEEvent 读取一个 SSE 事件，跳过保活注释
+func readSSEEvent(t *testing.T, r *bufio.Reader) (string, *model.Message) {
+	t.Helper()
+	var id string
+	var msg model.Message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read sse: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && id != "":
+			return id, &msg
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			if event := strings.TrimPrefix(line, "event: "); event != "message" {
+				t.Fatalf("unexpected event %q", event)
+			}
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg); err != nil {
+				t.Fatalf("decode data: %v", err)
+			}
+		}
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	old := testStreamMessage("wxid_a", now.Add(-time.Hour), 0, "old")
+	resumed := testStreamMessage("wxid_a", now.Add(-time.Minute), 0, "resumed")
+	other := testStreamMessage("wxid_b", now.Add(-time.Minute), 5, "other")
+	src := newTestStreamSource(old, resumed, other)
+	server := newTestStreamServer(t, src)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/stream", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(old.Seq, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+
+	// Last-Event-ID 之后的消息按 seq 顺序推送
+	for _, want := range []*model.Message{resumed, other} {
+		id, msg := readSSEEvent(t, r)
+		if id != strconv.FormatInt(want.Seq, 10) || msg.Content != want.Content {
+			t.Fatalf("got event %s %q, want %d %q", id, msg.Content, want.Seq, want.Content)
+		}
+	}
+
+	// wxid_a 迟到的消息早于 wxid_b 已推送的消息，仍按会话的进度推送
+	late := testStreamMessage("wxid_a", now.Add(-time.Minute), 0, "late")
+	late.Seq = resumed.Seq + 1
+	src.add(late)
+	id, msg := readSSEEvent(t, r)
+	if id != strconv.FormatInt(late.Seq, 10) || msg.Content != "late" {
+		t.Fatalf("got event %s %q, want late message", id, msg.Content)
+	}
+}
+
+func TestStreamInvalidLastEventID(t *testing.T) {
+	server := newTestStreamServer(t, newTestStreamSource())
+	resp, err := http.Get(server.URL + "/stream?last_event_id=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	first := testStreamMessage("wxid_a", now.Add(-time.Minute), 0, "first")
+	second := testStreamMessage("wxid_a", now.Add(-time.Minute), 1, "second")
+	src := newTestStreamSource(first, second, testStreamMessage("wxid_b", now, 0, "filtered"))
+	server := newTestStreamServer(t, src)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/stream?talker=wxid_a&last_event_id=" + strconv.FormatInt(first.Seq, 10)
+	ws, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var frame streamFrame
+	if err := websocket.JSON.Receive(ws, &frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Type != "message" || frame.ID != second.Seq || frame.Message == nil || frame.Message.Content != "second" {
+		t.Fatalf("unexpected frame %+v", frame)
+	}
+
+	third := testStreamMessage("wxid_a", now, 2, "third")
+	src.add(third)
+	if err := websocket.JSON.Receive(ws, &frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.ID != third.Seq || frame.Message.Content != "third" {
+		t.Fatalf("unexpected frame %+v", frame)
+	}
+}
+
+func TestStreamWithoutSeq(t *testing.T) {
+	// 数据源未提供 seq 时，以消息时间作为事件 ID 与进度
+	now := time.Now().Truncate(time.Second)
+	old := &model.Message{Time: now.Add(-time.Hour), Talker: "wxid_a", Type: model.MessageTypeText, Content: "old"}
+	resumed := &model.Message{Time: now.Add(-time.Minute), Talker: "wxid_a", Type: model.MessageTypeText, Content: "resumed"}
+	src := newTestStreamSource(old, resumed)
+	server := newTestStreamServer(t, src)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/stream?talker=wxid_a", nil)
+	req.Header.Set("Last-Event-ID", strconv.FormatInt(old.CursorSeq(), 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+
+	id, msg := readSSEEvent(t, r)
+	if id != strconv.FormatInt(resumed.CursorSeq(), 10) || msg.Content != "resumed" {
+		t.Fatalf("got event %s %q, want resumed message", id, msg.Content)
+	}
+
+	src.add(&model.Message{Time: now, Talker: "wxid_a", Type: model.MessageTypeText, Content: "new"})
+	id, msg = readSSEEvent(t, r)
+	if id != strconv.FormatInt(now.Unix()*1000, 10) || msg.Content != "new" {
+		t.Fatalf("got event %s %q, want new message", id, msg.Content)
+	}
+}
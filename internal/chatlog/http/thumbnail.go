@@ -0,0 +1,203 @@
+package http
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/pkg/util"
+	"github.com/sjzar/chatlog/pkg/util/dat2img"
+)
+
+// ThumbnailDir 缩略图缓存目录，位于工作目录下
+const ThumbnailDir = "thumbnails"
+
+// thumbnailWidths 可选的缩略图宽度，请求的宽度向上取整到其中一档，避免缓存过多尺寸
+var thumbnailWidths = []int{120, 240, 320, 480, 640, 960, 1280, 1920}
+
+// AtRestConfig 可选的工作目录加密配置，启用时不在工作目录缓存明文缩略图
+type AtRestConfig interface {
+	IsEncryptWorkDir() bool
+}
+
+// parseThumbnailWidth 解析 w 参数，为空或超过最大档位时返回 0，表示返回原图
+func parseThumbnailWidth(w string) (int, error) {
+	if w == "" {
+		return 0, nil
+	}
+	width, err := strconv.Atoi(w)
+	if err != nil || width <= 0 {
+		return 0, errors.InvalidArg("w")
+	}
+	for _, tw := range thumbnailWidths {
+		if width <= tw {
+			return tw, nil
+		}
+	}
+	return 0, nil
+}
+
+// handleImage 按 md5 或数据目录中的路径返回图片，key 可为逗号分隔的多个候选
+// GET /image/*key?w=320
+func (s *Service) handleImage(c *gin.Context) {
+	width, err := parseThumbnailWidth(c.Query("w"))
+	if err != nil {
+		errors.Err(c, err)
+		return
+	}
+
+	for _, k := range util.Str2List(strings.TrimPrefix(c.Param("key"), "/"), ",") {
+		if strings.Contains(k, "..") {
+			continue
+		}
+		if strings.Contains(k, "/") {
+			if path, err := s.findPath("image", k); err == nil {
+				s.serveMedia(c, path, width)
+				return
+			}
+			continue
+		}
+		media, err := s.db.GetMedia("image", k)
+		if err != nil || media == nil || media.Path == "" {
+			continue
+		}
+		if path, err := s.findPath("image", media.Path); err == nil {
+			s.serveMedia(c, path, width)
+			return
+		}
+	}
+	errors.Err(c, errors.ErrMediaNotFound)
+}
+
+// serveMedia 返回数据目录中的文件，width 大于 0 时返回缩略图
+// ETag 由路径、文件大小、修改时间与宽度生成，客户端缓存未变化时返回 304
+func (s *Service) serveMedia(c *gin.Context, relativePath string, width int) {
+	absolutePath := filepath.Join(s.conf.GetDataDir(), relativePath)
+	stat, err := os.Stat(absolutePath)
+	if err != nil || stat.IsDir() {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "File not found",
+		})
+		return
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%d|%d|%d", filepath.ToSlash(relativePath), stat.Size(), stat.ModTime().UnixNano(), width)))
+	hash := hex.EncodeToString(sum[:])
+	etag := `"` + hash + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=86400")
+	if match := c.GetHeader("If-None-Match"); match != "" && (match == "*" || strings.Contains(match, etag)) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if width > 0 {
+		out, err := s.thumbnail(absolutePath, width, hash)
+		if err == nil {
+			c.Data(http.StatusOK, "image/jpeg", out)
+			return
+		}
+		log.Debug().Err(err).Str("path", relativePath).Msg("generate thumbnail failed, fallback to original")
+	}
+
+	if strings.ToLower(filepath.Ext(absolutePath)) == ".dat" {
+		s.HandleDatFile(c, absolutePath)
+		return
+	}
+	c.File(absolutePath)
+}
+
+// thumbnail 生成或读取缓存的缩略图
+func (s *Service) thumbnail(path string, width int, hash string) ([]byte, error) {
+	cacheFile := ""
+	if s.thumbnailCacheEnabled() {
+		cacheFile = filepath.Join(s.conf.GetWorkDir(), ThumbnailDir, hash[:2], hash+".jpg")
+		if out, err := os.ReadFile(cacheFile); err == nil {
+			return out, nil
+		}
+	}
+
+	data, err := thumbnailSource(path, width)
+	if err != nil {
+		return nil, err
+	}
+	out, err := dat2img.Thumbnail(data, width)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheFile != "" {
+		if err := writeThumbnail(cacheFile, out); err != nil {
+			log.Debug().Err(err).Str("file", cacheFile).Msg("write thumbnail cache failed")
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) thumbnailCacheEnabled() bool {
+	if s.conf.GetWorkDir() == "" {
+		return false
+	}
+	c, ok := s.conf.(AtRestConfig)
+	return !ok || !c.IsEncryptWorkDir()
+}
+
+// thumbnailSource 读取并解密缩小前的图片
+// 同目录下存在微信生成的 _t.dat 缩略图且不窄于目标宽度时优先使用，免去解码原图
+func thumbnailSource(path string, width int) ([]byte, error) {
+	candidates := []string{path}
+	lower := strings.ToLower(path)
+	if strings.HasSuffix(lower, ".dat") && !strings.HasSuffix(lower, "_t.dat") {
+		base := path[:len(path)-len(".dat")]
+		if strings.HasSuffix(lower, "_h.dat") {
+			base = path[:len(path)-len("_h.dat")]
+		}
+		candidates = []string{base + "_t.dat", path}
+	}
+
+	var lastErr error = errors.ErrMediaNotFound
+	for i, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(candidate), ".dat") {
+			if data, _, err = dat2img.Dat2Image(data); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+		if i < len(candidates)-1 {
+			if w, err := dat2img.ImageWidth(data); err != nil || w < width {
+				continue
+			}
+		}
+		return data, nil
+	}
+	return nil, lastErr
+}
+
+func writeThumbnail(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
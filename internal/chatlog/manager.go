@@ -2,9 +2,11 @@ package chatlog
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
@@ -19,6 +21,8 @@ import (
 	"github.com/sjzar/chatlog/internal/chatlog/wechat"
 	"github.com/sjzar/chatlog/internal/tray"
 	iwechat "github.com/sjzar/chatlog/internal/wechat"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	wechatkey "github.com/sjzar/chatlog/internal/wechat/key"
 	"github.com/sjzar/chatlog/pkg/config"
 	"github.com/sjzar/chatlog/pkg/util"
 	"github.com/sjzar/chatlog/pkg/util/dat2img"
@@ -60,6 +64,10 @@ type Manager struct {
 	initialDecryptMu      sync.Mutex
 	initialDecryptLastErr string
 
+	// 工作目录加密且启动时未提供口令时，解锁后再启动服务
+	unlockMu      sync.Mutex
+	startOnUnlock func()
+
 	shutdownCh     chan struct{}
 	shutdownOnce   sync.Once
 	shutdownReason string
@@ -94,6 +102,7 @@ func (m *Manager) Run(configPath string) error {
 	if err != nil {
 		return err
 	}
+	m.loadKeyring()
 
 	m.wechat = wechat.NewService(m.ctx)
 
@@ -449,6 +458,21 @@ func (m *Manager) DecryptDBFiles() error {
 	return nil
 }
 
+// SubscribeDecryptEvents 订阅批量解密的进度与结果
+func (m *Manager) SubscribeDecryptEvents() (<-chan wechat.DecryptEvent, func()) {
+	return m.wechat.SubscribeDecryptEvents()
+}
+
+// DecryptProgress 返回最近一次批量解密的进度
+func (m *Manager) DecryptProgress() wechat.DecryptProgress {
+	return m.wechat.DecryptProgress()
+}
+
+// LastDecryptReport 返回最近一次批量解密的结果
+func (m *Manager) LastDecryptReport() *wechat.DecryptReport {
+	return m.wechat.LastDecryptReport()
+}
+
 func (m *Manager) StartAutoDecrypt() error {
 	if m.ctx.DataKey == "" || m.ctx.DataDir == "" {
 		return fmt.Errorf("请先获取密钥")
@@ -511,6 +535,7 @@ func (m *Manager) CommandKey(configPath string, pid int, force bool, showXorKey
 	if err != nil {
 		return "", err
 	}
+	m.loadKeyring()
 
 	m.wechat = wechat.NewService(m.ctx)
 
@@ -531,6 +556,7 @@ func (m *Manager) CommandKey(configPath string, pid int, force bool, showXorKey
 		}
 
 		result := fmt.Sprintf("Data Key: [%s]\nImage Key: [%s]", key, imgKey)
+		result += formatKeyReport(m.ctx.WeChatInstances[0].KeyReport)
 		if m.ctx.Version == 4 && showXorKey {
 			if b, err := dat2img.ScanAndSetXorKey(m.ctx.DataDir); err == nil {
 				result += fmt.Sprintf("\nXor Key: [0x%X]", b)
@@ -558,6 +584,7 @@ func (m *Manager) CommandKey(configPath string, pid int, force bool, showXorKey
 				m.ctx.UpdateConfig()
 			}
 			result := fmt.Sprintf("Data Key: [%s]\nImage Key: [%s]", key, imgKey)
+			result += formatKeyReport(ins.KeyReport)
 			if m.ctx.Version == 4 && showXorKey {
 				if b, err := dat2img.ScanAndSetXorKey(m.ctx.DataDir); err == nil {
 					result += fmt.Sprintf("\nXor Key: [0x%X]", b)
@@ -569,6 +596,56 @@ func (m *Manager) CommandKey(configPath string, pid int, force bool, showXorKey
 	return "", fmt.Errorf("wechat process not found")
 }
 
+// loadKeyring 加载配置目录下的密钥环，获取密钥时优先尝试其中的密钥
+func (m *Manager) loadKeyring() {
+	k, err := wechatkey.NewKeyring(filepath.Join(m.ctx.GetConfigDir(), wechatkey.KeyringFile))
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load keyring")
+		return
+	}
+	iwechat.SetKeyring(k)
+}
+
+// formatKeyReport 密钥对各分组数据库的校验结果
+func formatKeyReport(report *decrypt.KeyReport) string {
+	if report == nil || len(report.Files) == 0 {
+		return ""
+	}
+	return "\nValidated: " + report.String()
+}
+
+// CommandKeyFromDump 从内存镜像文件中离线提取密钥，以 dataDir 中的数据校验
+// version 为 0 时根据数据目录结构判断微信版本
+func (m *Manager) CommandKeyFromDump(dumpFile string, dataDir string, platform string, version int, showXorKey bool) (string, error) {
+	if dataDir == "" {
+		return "", fmt.Errorf("data dir is required")
+	}
+	if version == 0 {
+		version = 3
+		if _, err := os.Stat(filepath.Join(dataDir, "db_storage")); err == nil {
+			version = 4
+		}
+	}
+
+	key, imgKey, err := wechatkey.SearchDumpFile(context.Background(), platform, version, dataDir, dumpFile)
+	if err != nil {
+		return "", err
+	}
+
+	result := fmt.Sprintf("Data Key: [%s]\nImage Key: [%s]", key, imgKey)
+	if b, err := hex.DecodeString(key); err == nil && key != "" {
+		if validator, err := decrypt.NewValidator(platform, version, dataDir); err == nil {
+			result += formatKeyReport(validator.ValidateAll(b))
+		}
+	}
+	if version == 4 && showXorKey {
+		if b, err := dat2img.ScanAndSetXorKey(dataDir); err == nil {
+			result += fmt.Sprintf("\nXor Key: [0x%X]", b)
+		}
+	}
+	return result, nil
+}
+
 func (m *Manager) CommandDecrypt(configPath string, cmdConf map[string]any) error {
 
 	var err error
@@ -596,6 +673,36 @@ func (m *Manager) CommandDecrypt(configPath string, cmdConf map[string]any) erro
 	return nil
 }
 
+// CommandExportMedia 从工作目录中的数据库批量导出图片与视频
+func (m *Manager) CommandExportMedia(configPath string, cmdConf map[string]any, talker, timeRange, out string) (*database.ExportMediaReport, error) {
+
+	var err error
+	m.sc, m.scm, err = conf.LoadServiceConfig(configPath, cmdConf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(m.sc.GetDataDir()) == 0 || len(m.sc.GetWorkDir()) == 0 {
+		return nil, fmt.Errorf("dataDir and workDir are required")
+	}
+
+	opts, err := database.ParseExportMediaOptions(talker, timeRange, out)
+	if err != nil {
+		return nil, err
+	}
+	if opts.OutDir == "" {
+		opts.OutDir = filepath.Join(m.sc.GetWorkDir(), "export", "media")
+	}
+
+	m.db = database.NewService(m.sc)
+	if err := m.db.Start(); err != nil {
+		return nil, err
+	}
+	defer m.db.Stop()
+
+	return m.db.ExportMedia(context.Background(), opts)
+}
+
 func (m *Manager) CommandHTTPServer(configPath string, cmdConf map[string]any) error {
 
 	var err error
@@ -622,7 +729,11 @@ func (m *Manager) CommandHTTPServer(configPath string, cmdConf map[string]any) e
 		go dat2img.ScanAndSetXorKey(dataDir)
 	}
 
-	log.Info().Msgf("server config: %+v", m.sc)
+	logConf := *m.sc
+	if logConf.Passphrase != "" {
+		logConf.Passphrase = "***"
+	}
+	log.Info().Msgf("server config: %+v", &logConf)
 
 	m.wechat = wechat.NewService(m.sc)
 
@@ -630,42 +741,119 @@ func (m *Manager) CommandHTTPServer(configPath string, cmdConf map[string]any) e
 
 	m.http = http.NewService(m.sc, m.db, m)
 
-	if m.sc.GetAutoDecrypt() {
-		if err := m.wechat.StartAutoDecrypt(); err != nil {
-			return err
+	// VFS 模式直接读取加密的原始数据库，无需预先解密与自动解密
+	vfsMode := m.sc.GetDecryptMode() == conf.DecryptModeVFS
+
+	// 工作目录加密时需先以口令解锁，未提供口令则等待通过 API 解锁
+	if m.sc.IsEncryptWorkDir() {
+		if passphrase := m.sc.GetPassphrase(); passphrase != "" {
+			if err := m.UnlockWorkDir(passphrase); err != nil {
+				return err
+			}
+		} else {
+			m.unlockMu.Lock()
+			m.startOnUnlock = func() { m.startServerDB(vfsMode) }
+			m.unlockMu.Unlock()
+			log.Warn().Msg("work dir is encrypted, waiting for unlock via /api/v1/actions/unlock")
 		}
-		log.Info().Msg("auto decrypt is enabled")
 	}
 
-	// init db
-	go func() {
-		// 如果工作目录为空，则解密数据
-		if entries, err := os.ReadDir(workDir); err == nil && len(entries) == 0 {
-			log.Info().Msgf("work dir is empty, decrypt data.")
-			m.db.SetDecrypting()
-			if err := m.wechat.DecryptDBFiles(); err != nil {
-				log.Info().Msgf("decrypt data failed: %v", err)
-				return
+	if m.startOnUnlock == nil {
+		if m.sc.GetAutoDecrypt() && !vfsMode {
+			if err := m.wechat.StartAutoDecrypt(); err != nil {
+				return err
 			}
-			log.Info().Msg("decrypt data success")
+			log.Info().Msg("auto decrypt is enabled")
 		}
+		go m.startServerDB(vfsMode)
+	}
 
-		// 按依赖顺序启动服务
-		if err := m.db.Start(); err != nil {
-			log.Info().Msgf("start db failed, try to decrypt data.")
-			m.db.SetDecrypting()
-			if err := m.wechat.DecryptDBFiles(); err != nil {
-				log.Info().Msgf("decrypt data failed: %v", err)
-				return
-			}
-			log.Info().Msg("decrypt data success")
-			if err := m.db.Start(); err != nil {
-				log.Info().Msgf("start db failed: %v", err)
-				m.db.SetError(err.Error())
-				return
+	return m.http.ListenAndServe()
+}
+
+// UnlockWorkDir 以口令派生工作目录密钥，启动时未提供口令的服务在解锁后开始解密与加载数据库
+func (m *Manager) UnlockWorkDir(passphrase string) error {
+	if m.sc == nil || !m.sc.IsEncryptWorkDir() {
+		return fmt.Errorf("work dir encryption is not enabled")
+	}
+	key, err := decrypt.WorkDirKey(m.sc.GetWorkDir(), passphrase)
+	if err != nil {
+		return err
+	}
+
+	m.unlockMu.Lock()
+	defer m.unlockMu.Unlock()
+	if m.sc.GetWorkKey() != "" {
+		return nil
+	}
+	m.sc.SetWorkKey(key)
+	log.Info().Msg("work dir unlocked")
+
+	if start := m.startOnUnlock; start != nil {
+		m.startOnUnlock = nil
+		vfsMode := m.sc.GetDecryptMode() == conf.DecryptModeVFS
+		if m.sc.GetAutoDecrypt() && !vfsMode {
+			if err := m.wechat.StartAutoDecrypt(); err != nil {
+				log.Err(err).Msg("failed to start auto decrypt")
+			} else {
+				log.Info().Msg("auto decrypt is enabled")
 			}
 		}
-	}()
+		go start()
+	}
+	return nil
+}
 
-	return m.http.ListenAndServe()
+// startServerDB 服务模式下按需解密并启动数据库
+func (m *Manager) startServerDB(vfsMode bool) {
+	// 如果工作目录为空，则解密数据
+	// 工作目录加密时总是先增量解密一次，已有的明文副本会被重新加密
+	if !vfsMode && (isEmptyWorkDir(m.sc.GetWorkDir()) || m.sc.IsEncryptWorkDir()) {
+		log.Info().Msgf("decrypt data to work dir.")
+		m.db.SetDecrypting()
+		if err := m.wechat.DecryptDBFiles(); err != nil {
+			log.Info().Msgf("decrypt data failed: %v", err)
+			return
+		}
+		log.Info().Msg("decrypt data success")
+	}
+
+	// 按依赖顺序启动服务
+	if err := m.db.Start(); err != nil {
+		log.Info().Msgf("start db failed, try to decrypt data.")
+		m.db.SetDecrypting()
+		if err := m.wechat.DecryptDBFiles(); err != nil {
+			log.Info().Msgf("decrypt data failed: %v", err)
+			return
+		}
+		log.Info().Msg("decrypt data success")
+		if err := m.db.Start(); err != nil {
+			log.Info().Msgf("start db failed: %v", err)
+			m.db.SetError(err.Error())
+			return
+		}
+	}
+
+	// VFS 模式不可用时已回退到解密副本，按配置启用自动解密
+	if vfsMode && !m.db.IsVFS() && m.sc.GetAutoDecrypt() {
+		if err := m.wechat.StartAutoDecrypt(); err != nil {
+			log.Err(err).Msg("failed to start auto decrypt")
+			return
+		}
+		log.Info().Msg("auto decrypt is enabled")
+	}
+}
+
+// isEmptyWorkDir 工作目录中除加密密钥文件外没有其他文件
+func isEmptyWorkDir(workDir string) bool {
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.Name() != decrypt.WorkDirKeyFile {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// CursorFile 已投递消息游标的保存文件，位于工作目录下
+const CursorFile = "webhook/cursors.json"
+
+// 首次运行时的起点
+const (
+	// StartFromNow 只推送启动之后的消息，默认
+	StartFromNow = "now"
+	// StartFromBeginning 推送全部历史消息
+	StartFromBeginning = "beginning"
+)
+
+// DefaultLookback 在游标之前回看的时间窗口，用于补发手机同步等原因迟到的消息
+const DefaultLookback = time.Hour
+
+// TalkerCursor 单个会话的投递进度
+// 消息 seq 为 10 位时间戳 + 3 位序号；游标之前 Lookback 窗口内已投递的 seq 记录在 Recent 中，
+// 窗口内出现的其他消息视为迟到的消息补发
+type TalkerCursor struct {
+	// Since 首次运行的起点（Unix 秒），早于该时间的消息不推送
+	Since   int64   `json:"since"`
+	LastSeq int64   `json:"last_seq"`
+	Recent  []int64 `json:"recent,omitempty"`
+}
+
+// seqTime 由 seq 得到消息时间
+func seqTime(seq int64) time.Time {
+	return time.Unix(seq/1000, 0)
+}
+
+// IsNew 消息是否尚未投递
+func (c *TalkerCursor) IsNew(seq int64, t time.Time) bool {
+	if t.Unix() < c.Since {
+		return false
+	}
+	if seq > c.LastSeq {
+		return true
+	}
+	_, found := slices.BinarySearch(c.Recent, seq)
+	return !found
+}
+
+// advance 记录已投递的 seq，并丢弃回看窗口之外的记录
+func (c *TalkerCursor) advance(seqs []int64, lookback time.Duration) {
+	for _, seq := range seqs {
+		if seq > c.LastSeq {
+			c.LastSeq = seq
+		}
+		if i, found := slices.BinarySearch(c.Recent, seq); !found {
+			c.Recent = slices.Insert(c.Recent, i, seq)
+		}
+	}
+	floor := seqTime(c.LastSeq).Add(-lookback).Unix() * 1000
+	i, _ := slices.BinarySearch(c.Recent, floor)
+	c.Recent = c.Recent[i:]
+}
+
+// CursorStore 按 webhook 与会话保存投递进度，path 为空时只保存在内存中
+type CursorStore struct {
+	path     string
+	lookback time.Duration
+	mutex    sync.Mutex
+	cursors  map[string]map[string]*TalkerCursor
+}
+
+// NewCursorStore 加载 path 处保存的游标，文件不存在时为空
+func NewCursorStore(path string, lookback time.Duration) (*CursorStore, error) {
+	if lookback <= 0 {
+		lookback = DefaultLookback
+	}
+	s := &CursorStore{path: path, lookback: lookback, cursors: make(map[string]map[string]*TalkerCursor)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, errors.ReadFileFailed(path, err)
+	}
+	if err := json.Unmarshal(data, &s.cursors); err != nil {
+		return nil, errors.ReadFileFailed(path, err)
+	}
+	return s, nil
+}
+
+// Lookback 回看窗口
+func (s *CursorStore) Lookback() time.Duration {
+	return s.lookback
+}
+
+// Get 返回会话游标的副本，尚未投递过时返回 nil
+func (s *CursorStore) Get(webhook, talker string) *TalkerCursor {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	c, ok := s.cursors[webhook][talker]
+	if !ok {
+		return nil
+	}
+	cp := *c
+	cp.Recent = slices.Clone(c.Recent)
+	return &cp
+}
+
+// Advance 记录投递成功的消息并保存，since 为会话首次投递时的起点
+func (s *CursorStore) Advance(webhook string, since int64, seqs map[string][]int64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	talkers, ok := s.cursors[webhook]
+	if !ok {
+		talkers = make(map[string]*TalkerCursor)
+		s.cursors[webhook] = talkers
+	}
+	for talker, list := range seqs {
+		c, ok := talkers[talker]
+		if !ok {
+			c = &TalkerCursor{Since: since}
+			talkers[talker] = c
+		}
+		c.advance(list, s.lookback)
+	}
+	return s.saveLocked()
+}
+
+func (s *CursorStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.cursors)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return errors.WriteOutputFailed(err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+func TestCursorStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursors.json")
+	store, err := NewCursorStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Get("hook", "wxid_a") != nil {
+		t.Fatal("unexpected cursor before first delivery")
+	}
+
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local)
+	seq := func(t time.Time, n int64) int64 { return t.Unix()*1000 + n }
+	since := base.Add(-time.Minute).Unix()
+
+	delivered := []int64{seq(base, 0), seq(base.Add(time.Minute), 0)}
+	if err := store.Advance("hook", since, map[string][]int64{"wxid_a": delivered}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后进度仍在
+	store, err = NewCursorStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := store.Get("hook", "wxid_a")
+	if c == nil || c.LastSeq != delivered[1] {
+		t.Fatalf("cursor = %+v", c)
+	}
+
+	cases := []struct {
+		name string
+		t    time.Time
+		n    int64
+		want bool
+	}{
+		{"delivered", base, 0, false},
+		{"newer", base.Add(2 * time.Minute), 0, true},
+		{"late arrival in window", base.Add(30 * time.Second), 1, true},
+		{"before since", base.Add(-2 * time.Minute), 0, false},
+	}
+	for _, tc := range cases {
+		if got := c.IsNew(seq(tc.t, tc.n), tc.t); got != tc.want {
+			t.Errorf("%s: IsNew = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// 超出回看窗口的记录被丢弃
+	later := base.Add(2 * time.Hour)
+	if err := store.Advance("hook", since, map[string][]int64{"wxid_a": {seq(later, 0)}}); err != nil {
+		t.Fatal(err)
+	}
+	if c := store.Get("hook", "wxid_a"); len(c.Recent) != 1 {
+		t.Errorf("recent = %v, want only the latest seq", c.Recent)
+	}
+}
+
+func TestCursorZeroSeq(t *testing.T) {
+	store, err := NewCursorStore("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据源未提供 seq 的消息以时间记录进度
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.Local)
+	delivered := &model.Message{Time: base}
+	if err := store.Advance("hook", 0, map[string][]int64{"wxid_a": {delivered.CursorSeq()}}); err != nil {
+		t.Fatal(err)
+	}
+	c := store.Get("hook", "wxid_a")
+	if c.LastSeq == 0 || !seqTime(c.LastSeq).Equal(base) {
+		t.Fatalf("cursor = %+v", c)
+	}
+	if c.IsNew(delivered.CursorSeq(), delivered.Time) {
+		t.Error("delivered message should not be new")
+	}
+	newer := &model.Message{Time: base.Add(time.Second)}
+	if !c.IsNew(newer.CursorSeq(), newer.Time) {
+		t.Error("newer message without seq should be new")
+	}
+}
@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// 投递状态
+const (
+	// DeliveryPending 等待投递或重试
+	DeliveryPending = "pending"
+	// DeliveryDead 重试次数用尽，进入死信队列，需手动重放或丢弃
+	DeliveryDead = "dead"
+)
+
+// Delivery 一次 webhook 投递，投递成功前保存在 outbox 中
+type Delivery struct {
+	ID          string          `json:"id"`
+	Webhook     string          `json:"webhook"`
+	URL         string          `json:"url"`
+	ContentType string          `json:"content_type"`
+	Body        json.RawMessage `json:"body"`
+	// Topic 发布到 MQTT 时的主题
+	Topic string `json:"topic,omitempty"`
+	// Since 会话首次投递时的起点（Unix 秒）
+	Since int64 `json:"since"`
+	// Seqs 本次投递的消息 seq，按配置中的会话分组，投递成功后记入游标
+	Seqs      map[string][]int64 `json:"seqs"`
+	Status    string             `json:"status"`
+	Attempts  int                `json:"attempts"`
+	NextRetry time.Time          `json:"next_retry"`
+	LastError string             `json:"last_error,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// MarshalJSON 请求体不是 JSON 时（如 ntfy 的纯文本）保存为 body_text
+func (d Delivery) MarshalJSON() ([]byte, error) {
+	type delivery Delivery
+	v := struct {
+		delivery
+		Body     json.RawMessage `json:"body,omitempty"`
+		BodyText string          `json:"body_text,omitempty"`
+	}{delivery: delivery(d)}
+	if json.Valid(d.Body) {
+		v.Body = d.Body
+	} else {
+		v.BodyText = string(d.Body)
+	}
+	return json.Marshal(v)
+}
+
+func (d *Delivery) UnmarshalJSON(data []byte) error {
+	type delivery Delivery
+	v := struct {
+		*delivery
+		BodyText string `json:"body_text"`
+	}{delivery: (*delivery)(d)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.BodyText != "" {
+		d.Body = json.RawMessage(v.BodyText)
+	}
+	return nil
+}
+
+// Outbox 未完成的投递，每个投递保存为 dir 下的一个 JSON 文件
+// dir 为空时只保存在内存中
+type Outbox struct {
+	dir        string
+	mutex      sync.Mutex
+	deliveries map[string]*Delivery
+}
+
+// NewOutbox 加载 dir 中上次未完成的投递
+func NewOutbox(dir string) (*Outbox, error) {
+	o := &Outbox{dir: dir, deliveries: make(map[string]*Delivery)}
+	if dir == "" {
+		return o, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.WriteOutputFailed(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.ReadFileFailed(dir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		d := &Delivery{}
+		if err := json.Unmarshal(data, d); err != nil || d.ID == "" {
+			log.Warn().Err(err).Msgf("invalid webhook delivery %s", e.Name())
+			continue
+		}
+		o.deliveries[d.ID] = d
+	}
+	return o, nil
+}
+
+// Put 保存投递，已存在时覆盖
+func (o *Outbox) Put(d *Delivery) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	d.UpdatedAt = time.Now()
+	o.deliveries[d.ID] = d
+	if o.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(o.dir, d.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.WriteOutputFailed(err)
+	}
+	return nil
+}
+
+// Remove 删除已完成的投递
+func (o *Outbox) Remove(id string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	delete(o.deliveries, id)
+	if o.dir != "" {
+		os.Remove(filepath.Join(o.dir, id+".json"))
+	}
+}
+
+// Get 返回投递的副本
+func (o *Outbox) Get(id string) (*Delivery, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	d, ok := o.deliveries[id]
+	if !ok {
+		return nil, false
+	}
+	cp := *d
+	return &cp, true
+}
+
+// List 返回指定状态的投递副本，status 为空时返回全部，按创建时间排序
+func (o *Outbox) List(status string) []*Delivery {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	list := make([]*Delivery, 0, len(o.deliveries))
+	for _, d := range o.deliveries {
+		if status == "" || d.Status == status {
+			cp := *d
+			list = append(list, &cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
@@ -0,0 +1,447 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+const (
+	// DefaultMaxAttempts 进入死信队列前的最大投递次数
+	DefaultMaxAttempts = 10
+	// DefaultRetryBase 首次重试的等待时间，之后每次翻倍
+	DefaultRetryBase = 5 * time.Second
+	// MaxRetryInterval 重试间隔上限
+	MaxRetryInterval = 30 * time.Minute
+	// retryScanInterval 扫描到期重试的间隔
+	retryScanInterval = time.Second
+)
+
+// 投递请求头
+const (
+	HeaderSignature = "X-Chatlog-Signature"
+	HeaderDelivery  = "X-Chatlog-Delivery"
+	HeaderTimestamp = "X-Chatlog-Timestamp"
+	// SignaturePrefix 签名的算法前缀
+	SignaturePrefix = "sha256="
+)
+
+// AckFunc 投递成功后回调，用于推进 webhook 的消息游标
+type AckFunc func(d *Delivery)
+
+// Dispatcher 通过 outbox 投递 webhook，失败后按指数退避重试，重试用尽后进入死信队列
+type Dispatcher struct {
+	outbox      *Outbox
+	client      *http.Client
+	lines       lineWriter
+	mqtt        mqttPublisher
+	maxAttempts int
+	retryBase   time.Duration
+
+	mutex    sync.Mutex
+	inflight map[string]bool
+	// sending 正在投递的 webhook，同一 webhook 的投递按创建顺序逐个进行
+	sending map[string]bool
+	targets map[string]*target
+	metrics metricsRecorder
+}
+
+// target 已注册的 webhook，签名密钥与请求头不写入 outbox，投递时按 webhook 标识查找
+type target struct {
+	item *conf.WebhookItem
+	ack  AckFunc
+	// bucket 配置了 rate_limit 时的限流器
+	bucket *tokenBucket
+}
+
+func NewDispatcher(outbox *Outbox, maxAttempts int, retryBase time.Duration) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	if retryBase <= 0 {
+		retryBase = DefaultRetryBase
+	}
+	return &Dispatcher{
+		outbox:      outbox,
+		client:      &http.Client{Timeout: time.Second * 10},
+		maxAttempts: maxAttempts,
+		retryBase:   retryBase,
+		inflight:    make(map[string]bool),
+		sending:     make(map[string]bool),
+		targets:     make(map[string]*target),
+	}
+}
+
+// Register 注册 webhook 的配置与投递成功的回调
+func (d *Dispatcher) Register(webhook string, item *conf.WebhookItem, fn AckFunc) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	t := &target{item: item, ack: fn}
+	if item.RateLimit > 0 {
+		t.bucket = newTokenBucket(item.RateLimit, item.RateBurst)
+	}
+	d.targets[webhook] = t
+}
+
+// Unregister 注销 webhook 并丢弃其未完成的投递，用于删除或修改 webhook 配置
+func (d *Dispatcher) Unregister(webhook string) {
+	d.Pause(webhook)
+	for _, del := range d.outbox.List("") {
+		if del.Webhook == webhook {
+			d.outbox.Remove(del.ID)
+		}
+	}
+}
+
+// Pause 注销 webhook 但保留其未完成的投递，用于停用 webhook，重新注册后继续投递
+func (d *Dispatcher) Pause(webhook string) {
+	d.mutex.Lock()
+	delete(d.targets, webhook)
+	d.mutex.Unlock()
+	d.mqtt.close(webhook)
+}
+
+func (d *Dispatcher) target(webhook string) *target {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.targets[webhook]
+}
+
+// Busy webhook 是否有等待投递的投递，包括死信（配置 skip_dead 时除外）
+// 有未完成的投递时不再拉取新消息，保证游标只在投递成功后前移
+func (d *Dispatcher) Busy(webhook string) bool {
+	skipDead := false
+	if t := d.target(webhook); t != nil && t.item != nil {
+		skipDead = t.item.SkipDead
+	}
+	for _, del := range d.outbox.List("") {
+		if del.Webhook == webhook && (del.Status != DeliveryDead || !skipDead) {
+			return true
+		}
+	}
+	return false
+}
+
+// Submit 保存投递并立即尝试一次，失败、限流或同一 webhook 有更早的投递时由 Run 按计划投递
+func (d *Dispatcher) Submit(ctx context.Context, del *Delivery) error {
+	now := time.Now()
+	if del.ID == "" {
+		del.ID = uuid.New().String()
+	}
+	del.Status = DeliveryPending
+	del.CreatedAt = now
+	del.NextRetry = now
+	if err := d.outbox.Put(del); err != nil {
+		return err
+	}
+	d.attempt(ctx, del)
+	return nil
+}
+
+// Run 定期重试到期的投递，直到 ctx 结束
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(retryScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// 每个 webhook 只投递最早的一个，保证投递顺序
+			now := time.Now()
+			seen := make(map[string]bool)
+			for _, del := range d.outbox.List(DeliveryPending) {
+				if seen[del.Webhook] {
+					continue
+				}
+				seen[del.Webhook] = true
+				if del.NextRetry.After(now) {
+					continue
+				}
+				d.attempt(ctx, del)
+			}
+		}
+	}
+}
+
+// Deliveries 返回指定状态的投递，status 为空时返回全部
+func (d *Dispatcher) Deliveries(status string) []*Delivery {
+	return d.outbox.List(status)
+}
+
+// Metrics 返回已注册 webhook 及 outbox 中仍有投递的 webhook 的统计
+func (d *Dispatcher) Metrics() []*Metrics {
+	d.mutex.Lock()
+	webhooks := make([]string, 0, len(d.targets))
+	items := make(map[string]*conf.WebhookItem, len(d.targets))
+	for id, t := range d.targets {
+		webhooks = append(webhooks, id)
+		items[id] = t.item
+	}
+	d.mutex.Unlock()
+
+	deliveries := d.outbox.List("")
+	for _, del := range deliveries {
+		if _, ok := items[del.Webhook]; !ok {
+			webhooks = append(webhooks, del.Webhook)
+			items[del.Webhook] = nil
+		}
+	}
+	sort.Strings(webhooks)
+
+	ret := make([]*Metrics, 0, len(webhooks))
+	for _, id := range webhooks {
+		m := d.metrics.snapshot(id)
+		if item := items[id]; item != nil {
+			m.URL = item.URL
+			m.Type = item.Type
+		}
+		for _, del := range deliveries {
+			if del.Webhook != id {
+				continue
+			}
+			if m.URL == "" {
+				m.URL = del.URL
+			}
+			switch del.Status {
+			case DeliveryPending:
+				m.Pending++
+			case DeliveryDead:
+				m.Dead++
+			}
+		}
+		ret = append(ret, &m)
+	}
+	return ret
+}
+
+// Replay 将死信重新加入投递队列，由 Run 立即重试，ids 为空时重放全部死信
+func (d *Dispatcher) Replay(ids []string) ([]*Delivery, error) {
+	dels, err := d.deadLetters(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, del := range dels {
+		del.Status = DeliveryPending
+		del.Attempts = 0
+		del.NextRetry = time.Now()
+		del.LastError = ""
+		if err := d.outbox.Put(del); err != nil {
+			return nil, err
+		}
+	}
+	return dels, nil
+}
+
+// Discard 丢弃死信，并视为已确认以推进 webhook 的消息游标，ids 为空时丢弃全部死信
+func (d *Dispatcher) Discard(ids []string) ([]*Delivery, error) {
+	dels, err := d.deadLetters(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, del := range dels {
+		d.outbox.Remove(del.ID)
+		d.ack(del)
+	}
+	return dels, nil
+}
+
+func (d *Dispatcher) deadLetters(ids []string) ([]*Delivery, error) {
+	if len(ids) == 0 {
+		return d.outbox.List(DeliveryDead), nil
+	}
+	dels := make([]*Delivery, 0, len(ids))
+	for _, id := range ids {
+		del, ok := d.outbox.Get(id)
+		if !ok {
+			return nil, errors.InvalidArg(id)
+		}
+		if del.Status != DeliveryDead {
+			return nil, errors.InvalidArg(id)
+		}
+		dels = append(dels, del)
+	}
+	return dels, nil
+}
+
+// head 返回 webhook 最早的等待投递
+func (d *Dispatcher) head(webhook string) *Delivery {
+	for _, del := range d.outbox.List(DeliveryPending) {
+		if del.Webhook == webhook {
+			return del
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, del *Delivery) {
+	if h := d.head(del.Webhook); h == nil || h.ID != del.ID {
+		return
+	}
+
+	// 未注册的 webhook（已停用，或启动后尚未创建）暂不投递
+	d.mutex.Lock()
+	t := d.targets[del.Webhook]
+	if t == nil || d.inflight[del.ID] || d.sending[del.Webhook] {
+		d.mutex.Unlock()
+		return
+	}
+	if t.bucket != nil {
+		if wait := t.bucket.take(time.Now()); wait > 0 {
+			d.mutex.Unlock()
+			d.metrics.throttled(del.Webhook)
+			del.NextRetry = time.Now().Add(wait)
+			if err := d.outbox.Put(del); err != nil {
+				log.Error().Err(err).Msgf("save webhook delivery %s failed", del.ID)
+			}
+			return
+		}
+	}
+	d.inflight[del.ID] = true
+	d.sending[del.Webhook] = true
+	d.mutex.Unlock()
+	defer func() {
+		d.mutex.Lock()
+		delete(d.inflight, del.ID)
+		delete(d.sending, del.Webhook)
+		d.mutex.Unlock()
+	}()
+
+	del.Attempts++
+	start := time.Now()
+	err := d.post(ctx, del)
+	d.metrics.record(del.Webhook, time.Since(start), err)
+	if err == nil {
+		log.Info().Msgf("webhook delivery %s to %s succeeded, attempts %d", del.ID, del.URL, del.Attempts)
+		d.outbox.Remove(del.ID)
+		d.ack(del)
+		return
+	}
+
+	del.LastError = err.Error()
+	if del.Attempts >= d.maxAttempts {
+		del.Status = DeliveryDead
+		log.Error().Err(err).Msgf("webhook delivery %s to %s failed after %d attempts, moved to dead letter", del.ID, del.URL, del.Attempts)
+	} else {
+		del.NextRetry = time.Now().Add(d.backoff(del.Attempts))
+		log.Warn().Err(err).Msgf("webhook delivery %s to %s failed, attempt %d, retry at %s", del.ID, del.URL, del.Attempts, del.NextRetry.Format(time.DateTime))
+	}
+	if err := d.outbox.Put(del); err != nil {
+		log.Error().Err(err).Msgf("save webhook delivery %s failed", del.ID)
+	}
+	// 配置 skip_dead 时消息保存在死信队列中以便重放，游标前移以继续推送之后的消息
+	if del.Status == DeliveryDead && t.item != nil && t.item.SkipDead {
+		d.ack(del)
+	}
+}
+
+// backoff 第 attempts 次失败后的等待时间
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.retryBase
+	for i := 1; i < attempts && wait < MaxRetryInterval; i++ {
+		wait *= 2
+	}
+	return min(wait, MaxRetryInterval)
+}
+
+func (d *Dispatcher) ack(del *Delivery) {
+	if t := d.target(del.Webhook); t != nil && t.ack != nil {
+		t.ack(del)
+	}
+}
+
+// Sign 计算请求签名：以 secret 为密钥，对 "<timestamp>.<body>" 做 HMAC-SHA256
+// 接收方以相同方式计算并比较 X-Chatlog-Signature，同时检查 X-Chatlog-Timestamp 是否过旧以防重放
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return SignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Test 按 webhook 配置立即发送一次请求，不保存、不重试，也不计入统计；MQTT 使用临时连接
+func (d *Dispatcher) Test(ctx context.Context, item *conf.WebhookItem, del *Delivery) error {
+	if del.ID == "" {
+		del.ID = uuid.New().String()
+	}
+	if isMQTT(del.URL) {
+		return d.mqtt.publishOnce(ctx, item, del)
+	}
+	return d.send(ctx, item, del)
+}
+
+func (d *Dispatcher) post(ctx context.Context, del *Delivery) error {
+	var item *conf.WebhookItem
+	if t := d.target(del.Webhook); t != nil {
+		item = t.item
+	}
+	return d.send(ctx, item, del)
+}
+
+// send 发送请求，item 提供签名密钥与附加的请求头，为 nil 时不签名
+func (d *Dispatcher) send(ctx context.Context, item *conf.WebhookItem, del *Delivery) error {
+	scheme, path, err := ParseTarget(del.URL)
+	if err != nil {
+		return err
+	}
+	switch scheme {
+	case SchemeMQTT, SchemeMQTTS:
+		if item == nil {
+			item = &conf.WebhookItem{}
+		}
+		return d.mqtt.publish(ctx, item, del)
+	case SchemeUnix, SchemeFile, SchemeStdout:
+		return d.lines.write(ctx, scheme, path, del.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Body))
+	if err != nil {
+		return err
+	}
+	contentType := del.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	// 投递 ID 在重试间保持不变，接收方可据此去重；时间戳与签名每次请求重新生成
+	timestamp := time.Now().Unix()
+	if item != nil {
+		for k, v := range item.Headers {
+			req.Header.Set(k, v)
+		}
+		if item.Secret != "" {
+			req.Header.Set(HeaderSignature, Sign(item.Secret, timestamp, del.Body))
+		}
+	}
+	req.Header.Set(HeaderDelivery, del.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return nil
+}
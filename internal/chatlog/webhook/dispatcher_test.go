@@ -0,0 +1,328 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/pkg/mqtt/mqtttest"
+)
+
+func TestDispatcherRetryDeadLetterReplay(t *testing.T) {
+	var healthy atomic.Bool
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	outbox, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDispatcher(outbox, 2, time.Millisecond)
+
+	acked := make(chan *Delivery, 1)
+	d.Register("hook", &conf.WebhookItem{SkipDead: true}, func(del *Delivery) { acked <- del })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	seqs := map[string][]int64{"wxid_a": {1700000000001}}
+	if err := d.Submit(ctx, &Delivery{Webhook: "hook", URL: server.URL, Body: []byte(`{}`), Seqs: seqs}); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Busy("hook") {
+		t.Fatal("failed delivery should keep the webhook busy")
+	}
+
+	// 配置 skip_dead 时进入死信后游标前移，不再阻塞之后的投递
+	select {
+	case <-acked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery not moved to dead letter")
+	}
+	if len(d.Deliveries(DeliveryDead)) != 1 || d.Busy("hook") {
+		t.Fatalf("dead letters %d, busy %v", len(d.Deliveries(DeliveryDead)), d.Busy("hook"))
+	}
+
+	// 死信在重启后仍然存在
+	reloaded, err := NewOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := reloaded.List(DeliveryDead)
+	if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastError == "" {
+		t.Fatalf("reloaded dead letters = %+v", dead)
+	}
+
+	healthy.Store(true)
+	if _, err := d.Replay(nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case del := <-acked:
+		if len(del.Seqs["wxid_a"]) != 1 {
+			t.Errorf("ack seqs = %v, want %v", del.Seqs, seqs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replayed delivery not acknowledged")
+	}
+	if received.Load() != 1 || d.Busy("hook") {
+		t.Errorf("received = %d, busy = %v", received.Load(), d.Busy("hook"))
+	}
+}
+
+func TestDispatcherPause(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	outbox, _ := NewOutbox("")
+	d := NewDispatcher(outbox, 1, time.Millisecond)
+	item := &conf.WebhookItem{URL: server.URL}
+	d.Register("hook", item, nil)
+	d.Pause("hook")
+
+	// 停用的 webhook 保留投递但不发送
+	ctx := context.Background()
+	if err := d.Submit(ctx, &Delivery{Webhook: "hook", URL: server.URL, Body: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if received.Load() != 0 || len(d.Deliveries(DeliveryPending)) != 1 {
+		t.Fatalf("paused webhook: received %d, pending %d", received.Load(), len(d.Deliveries(DeliveryPending)))
+	}
+
+	d.Register("hook", item, nil)
+	d.attempt(ctx, d.head("hook"))
+	if received.Load() != 1 || d.Busy("hook") {
+		t.Fatalf("resumed webhook: received %d, busy %v", received.Load(), d.Busy("hook"))
+	}
+}
+
+func TestDispatcherBlockOnDeadByDefault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	outbox, _ := NewOutbox("")
+	d := NewDispatcher(outbox, 1, time.Millisecond)
+	var acked atomic.Int32
+	d.Register("hook", &conf.WebhookItem{URL: server.URL}, func(*Delivery) { acked.Add(1) })
+
+	if err := d.Submit(context.Background(), &Delivery{Webhook: "hook", URL: server.URL, Body: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Deliveries(DeliveryDead)) != 1 || !d.Busy("hook") || acked.Load() != 0 {
+		t.Fatalf("dead letter: dead %d, busy %v, acked %d", len(d.Deliveries(DeliveryDead)), d.Busy("hook"), acked.Load())
+	}
+	if _, err := d.Discard(nil); err != nil {
+		t.Fatal(err)
+	}
+	if d.Busy("hook") || acked.Load() != 1 {
+		t.Fatalf("discard: busy %v, acked %d", d.Busy("hook"), acked.Load())
+	}
+}
+
+func TestDispatcherSignsRequest(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{header: r.Header.Clone(), body: body}
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(&Outbox{deliveries: make(map[string]*Delivery)}, 0, 0)
+	d.Register("hook", &conf.WebhookItem{
+		Secret:  "s3cret",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}, nil)
+
+	body := []byte(`{"length":1}`)
+	if err := d.Submit(context.Background(), &Delivery{Webhook: "hook", URL: server.URL, Body: body}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+	timestamp, err := strconv.ParseInt(req.header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := req.header.Get(HeaderSignature), Sign("s3cret", timestamp, req.body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+	if req.header.Get(HeaderDelivery) == "" {
+		t.Error("missing delivery id")
+	}
+	if req.header.Get("Authorization") != "Bearer token" {
+		t.Errorf("authorization = %q", req.header.Get("Authorization"))
+	}
+}
+
+func TestDispatcherFileTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "hooks.jsonl")
+	outbox, _ := NewOutbox("")
+	d := NewDispatcher(outbox, 1, time.Millisecond)
+	d.Register("hook", &conf.WebhookItem{}, nil)
+
+	url := "file://" + filepath.ToSlash(path)
+	if runtime.GOOS == "windows" {
+		url = "file:///" + filepath.ToSlash(path)
+	}
+	for _, body := range []string{"{\n  \"a\": 1\n}", "line1\nline2"} {
+		if err := d.Submit(context.Background(), &Delivery{Webhook: "hook", URL: url, Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d.Busy("hook") {
+		t.Fatal("file delivery should succeed")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"a\":1}\nline1\\nline2\n"; string(data) != want {
+		t.Fatalf("got %q, want %q", data, want)
+	}
+}
+
+func TestDispatcherRateLimitOrderMetrics(t *testing.T) {
+	var mutex sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(body))
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	outbox, _ := NewOutbox("")
+	d := NewDispatcher(outbox, 3, time.Millisecond)
+	d.Register("hook", &conf.WebhookItem{URL: server.URL, RateLimit: 20, RateBurst: 1}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	for i := 1; i <= 3; i++ {
+		if err := d.Submit(ctx, &Delivery{Webhook: "hook", URL: server.URL, Body: []byte(strconv.Itoa(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Busy("hook") {
+		if time.Now().After(deadline) {
+			t.Fatal("deliveries not finished")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	got := strings.Join(bodies, ",")
+	mutex.Unlock()
+	if got != "1,2,3" {
+		t.Fatalf("deliveries out of order: %s", got)
+	}
+
+	metrics := d.Metrics()
+	if len(metrics) != 1 {
+		t.Fatalf("got %d metrics", len(metrics))
+	}
+	m := metrics[0]
+	if m.Succeeded != 3 || m.Failed != 0 || m.Throttled == 0 || m.Pending != 0 || m.URL != server.URL {
+		t.Fatalf("unexpected metrics: %+v", m)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(2, 2)
+	now := time.Now()
+	if b.take(now) != 0 || b.take(now) != 0 {
+		t.Fatal("burst tokens should be available")
+	}
+	if wait := b.take(now); wait != 500*time.Millisecond {
+		t.Fatalf("got wait %s", wait)
+	}
+	if b.take(now.Add(500*time.Millisecond)) != 0 {
+		t.Fatal("token should be refilled")
+	}
+}
+
+func TestDispatcherMQTTTransport(t *testing.T) {
+	s := mqtttest.NewServer()
+	defer s.Close()
+	s.SetAuth("user", "pass")
+
+	item := &conf.WebhookItem{
+		Type: TypeChatRoom,
+		URL:  "mqtt://" + s.Addr,
+		MQTT: &conf.WebhookMQTT{Topic: "chatlog/{type}/{talker}", QoS: 1, Retain: true, Username: "user", Password: "pass", ClientID: "chatlog"},
+	}
+	outbox, _ := NewOutbox("")
+	d := NewDispatcher(outbox, 1, time.Millisecond)
+	d.Register(ItemID(item), item, nil)
+	w := &SnapshotWebhook{id: ItemID(item), typ: item.Type, conf: item, renderer: rendererOf(item), dispatcher: d}
+
+	// 每项变更单独发布，主题中的分隔符被替换
+	if err := w.submit([]*Change{
+		{Event: EventRename, Target: "123@chatroom", Before: "old", After: "new"},
+		{Event: EventMemberJoin, Target: "a/b"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	published := s.Wait(2, time.Second)
+	if len(published) != 2 {
+		t.Fatalf("got %d messages, want 2", len(published))
+	}
+	if m := published[0]; m.Topic != "chatlog/rename/123@chatroom" || m.QoS != 1 || !m.Retain || !strings.Contains(string(m.Payload), `"after":"new"`) {
+		t.Errorf("rename: %s %+v", m.Payload, m)
+	}
+	if m := published[1]; m.Topic != "chatlog/member_join/a_b" {
+		t.Errorf("member_join: %+v", m)
+	}
+	if len(s.Connects()) != 1 {
+		t.Errorf("the connection should be reused, got %d connects", len(s.Connects()))
+	}
+
+	// 测试请求使用单独的临时连接，不替换正在使用的连接
+	if err := d.Test(context.Background(), item, &Delivery{Webhook: ItemID(item), URL: item.URL, Topic: "chatlog/test", Body: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.submit([]*Change{{Event: EventRename, Target: "456@chatroom"}}); err != nil {
+		t.Fatal(err)
+	}
+	if published := s.Wait(4, time.Second); len(published) != 4 {
+		t.Fatalf("got %d messages, want 4", len(published))
+	}
+	connects := s.Connects()
+	if len(connects) != 2 || connects[1].ClientID != "chatlog-test" {
+		t.Errorf("test send should use its own client, got %+v", connects)
+	}
+}
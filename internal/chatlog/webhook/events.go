@@ -0,0 +1,378 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/internal/wechatdb"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+// webhook 类型
+const (
+	TypeMessage  = "message"
+	TypeContact  = "contact"
+	TypeChatRoom = "chatroom"
+	TypeSession  = "session"
+	TypeRecall   = "recall"
+)
+
+// 变更事件
+const (
+	EventNewFriend   = "new_friend"
+	EventRemark      = "remark"
+	EventMemberJoin  = "member_join"
+	EventMemberLeave = "member_leave"
+	EventRename      = "rename"
+	EventUnread      = "unread"
+	EventRecall      = "recall"
+)
+
+// typeGroups webhook 类型对应监听的数据库分组
+var typeGroups = map[string]string{
+	TypeMessage:  "message",
+	TypeRecall:   "message",
+	TypeContact:  "contact",
+	TypeChatRoom: "chatroom",
+	TypeSession:  "session",
+}
+
+// Change 联系人、群聊、会话或消息的一项变更
+type Change struct {
+	Event string `json:"event"`
+	// Target 变更对象的用户名、群聊 ID 或会话 ID
+	Target  string               `json:"target"`
+	Name    string               `json:"name,omitempty"`
+	Before  any                  `json:"before,omitempty"`
+	After   any                  `json:"after,omitempty"`
+	Members []model.ChatRoomUser `json:"members,omitempty"`
+	Message *model.Message       `json:"message,omitempty"`
+	Time    time.Time            `json:"time"`
+}
+
+// snapshot 按数据库当前状态计算变更
+type snapshot interface {
+	// reset 读取当前状态作为比较基准
+	reset() error
+	// diff 读取当前状态并与基准比较，返回变更及以当前状态更新基准的函数
+	diff() ([]*Change, func(), error)
+}
+
+// SnapshotWebhook 在数据库变化时比较前后状态，推送联系人、群聊与会话的变更
+// 基准在创建时读取，停止期间发生的变更不会推送
+type SnapshotWebhook struct {
+	id         string
+	typ        string
+	conf       *conf.WebhookItem
+	snapshot   snapshot
+	renderer   *Renderer
+	dispatcher *Dispatcher
+	talkers    []string
+
+	running sync.Mutex
+	// closed 配置重新加载后不再推送
+	closed bool
+}
+
+func NewSnapshotWebhook(item *conf.WebhookItem, db *wechatdb.DB, dispatcher *Dispatcher) *SnapshotWebhook {
+	w := &SnapshotWebhook{
+		id:         ItemID(item),
+		typ:        item.Type,
+		conf:       item,
+		renderer:   rendererOf(item),
+		dispatcher: dispatcher,
+		talkers:    util.Str2List(item.Talker, ","),
+	}
+	switch item.Type {
+	case TypeContact:
+		w.snapshot = &contactSnapshot{db: db}
+	case TypeChatRoom:
+		w.snapshot = &chatRoomSnapshot{db: db}
+	case TypeSession:
+		w.snapshot = &sessionSnapshot{db: db}
+	}
+	dispatcher.Register(w.id, item, nil)
+
+	go func() {
+		w.running.Lock()
+		defer w.running.Unlock()
+		if err := w.snapshot.reset(); err != nil {
+			log.Error().Err(err).Msgf("load %s snapshot failed", w.typ)
+		}
+	}()
+	return w
+}
+
+// Close 等待进行中的推送完成后停止
+func (w *SnapshotWebhook) Close() {
+	w.running.Lock()
+	defer w.running.Unlock()
+	w.closed = true
+}
+
+func (w *SnapshotWebhook) Do(event fsnotify.Event) {
+	w.running.Lock()
+	defer w.running.Unlock()
+	if w.closed {
+		return
+	}
+
+	// 上一次投递尚未确认时不更新基准，确认后再推送期间的变更
+	if w.dispatcher.Busy(w.id) {
+		return
+	}
+
+	changes, commit, err := w.snapshot.diff()
+	if err != nil {
+		log.Error().Err(err).Msgf("diff %s snapshot failed", w.typ)
+		return
+	}
+	changes = w.filter(changes)
+	if len(changes) > 0 {
+		if err := w.submit(changes); err != nil {
+			log.Error().Err(err).Msgf("save webhook delivery failed")
+			return
+		}
+	}
+	commit()
+}
+
+func (w *SnapshotWebhook) submit(changes []*Change) error {
+	// MQTT 每项变更发布一次
+	if isMQTT(w.conf.URL) {
+		for _, c := range changes {
+			if err := w.submitPayload(&Payload{Type: w.typ, Changes: []*Change{c}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return w.submitPayload(&Payload{Type: w.typ, Changes: changes})
+}
+
+func (w *SnapshotWebhook) submitPayload(payload *Payload) error {
+	body, err := w.renderer.Render(payload)
+	if err != nil {
+		return err
+	}
+	del := &Delivery{
+		Webhook:     w.id,
+		URL:         w.conf.URL,
+		ContentType: w.renderer.ContentType(),
+		Body:        body,
+	}
+	if isMQTT(w.conf.URL) {
+		del.Topic = mqttTopic(w.conf, payload)
+	}
+	log.Info().Msgf("post %s changes to %s, body: %s", w.typ, w.conf.URL, string(body))
+	return w.dispatcher.Submit(context.Background(), del)
+}
+
+// filter 配置了 talker 时只推送相关对象的变更
+func (w *SnapshotWebhook) filter(changes []*Change) []*Change {
+	if len(w.talkers) == 0 {
+		return changes
+	}
+	ret := make([]*Change, 0, len(changes))
+	for _, c := range changes {
+		for _, t := range w.talkers {
+			if t == c.Target || (c.Name != "" && t == c.Name) {
+				ret = append(ret, c)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+type contactSnapshot struct {
+	db       *wechatdb.DB
+	contacts map[string]*model.Contact
+}
+
+func (s *contactSnapshot) load() (map[string]*model.Contact, error) {
+	resp, err := s.db.GetContacts("", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	contacts := make(map[string]*model.Contact, len(resp.Items))
+	for _, c := range resp.Items {
+		contacts[c.UserName] = c
+	}
+	return contacts, nil
+}
+
+func (s *contactSnapshot) reset() (err error) {
+	s.contacts, err = s.load()
+	return err
+}
+
+func (s *contactSnapshot) diff() ([]*Change, func(), error) {
+	current, err := s.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	changes := diffContacts(s.contacts, current, time.Now())
+	return changes, func() { s.contacts = current }, nil
+}
+
+// diffContacts 新增好友与备注变更
+func diffContacts(before, after map[string]*model.Contact, now time.Time) []*Change {
+	changes := make([]*Change, 0)
+	if before == nil {
+		return changes
+	}
+	for name, c := range after {
+		old, ok := before[name]
+		switch {
+		case c.IsFriend && (!ok || !old.IsFriend):
+			changes = append(changes, &Change{Event: EventNewFriend, Target: name, Name: c.NickName, After: c, Time: now})
+		case ok && old.Remark != c.Remark:
+			changes = append(changes, &Change{Event: EventRemark, Target: name, Name: c.NickName, Before: old.Remark, After: c.Remark, Time: now})
+		}
+	}
+	return changes
+}
+
+type chatRoomSnapshot struct {
+	db        *wechatdb.DB
+	chatRooms map[string]*model.ChatRoom
+}
+
+func (s *chatRoomSnapshot) load() (map[string]*model.ChatRoom, error) {
+	resp, err := s.db.GetChatRooms("", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	chatRooms := make(map[string]*model.ChatRoom, len(resp.Items))
+	for _, c := range resp.Items {
+		chatRooms[c.Name] = c
+	}
+	return chatRooms, nil
+}
+
+func (s *chatRoomSnapshot) reset() (err error) {
+	s.chatRooms, err = s.load()
+	return err
+}
+
+func (s *chatRoomSnapshot) diff() ([]*Change, func(), error) {
+	current, err := s.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	changes := diffChatRooms(s.chatRooms, current, time.Now())
+	return changes, func() { s.chatRooms = current }, nil
+}
+
+// diffChatRooms 群成员加入、退出与群名变更，只比较前后都存在的群聊
+func diffChatRooms(before, after map[string]*model.ChatRoom, now time.Time) []*Change {
+	changes := make([]*Change, 0)
+	if before == nil {
+		return changes
+	}
+	for name, room := range after {
+		old, ok := before[name]
+		if !ok {
+			continue
+		}
+		if old.NickName != room.NickName {
+			changes = append(changes, &Change{Event: EventRename, Target: name, Name: room.NickName, Before: old.NickName, After: room.NickName, Time: now})
+		}
+		if joined := memberDiff(room.Users, old.Users); len(joined) > 0 {
+			changes = append(changes, &Change{Event: EventMemberJoin, Target: name, Name: room.NickName, Members: joined, Time: now})
+		}
+		if left := memberDiff(old.Users, room.Users); len(left) > 0 {
+			changes = append(changes, &Change{Event: EventMemberLeave, Target: name, Name: room.NickName, Members: left, Time: now})
+		}
+	}
+	return changes
+}
+
+// memberDiff 在 a 中而不在 b 中的成员
+func memberDiff(a, b []model.ChatRoomUser) []model.ChatRoomUser {
+	set := make(map[string]bool, len(b))
+	for _, u := range b {
+		set[u.UserName] = true
+	}
+	ret := make([]model.ChatRoomUser, 0)
+	for _, u := range a {
+		if !set[u.UserName] {
+			ret = append(ret, u)
+		}
+	}
+	return ret
+}
+
+type sessionSnapshot struct {
+	db       *wechatdb.DB
+	sessions map[string]*model.Session
+}
+
+func (s *sessionSnapshot) load() (map[string]*model.Session, error) {
+	resp, err := s.db.GetSessions("", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make(map[string]*model.Session, len(resp.Items))
+	for _, c := range resp.Items {
+		sessions[c.UserName] = c
+	}
+	return sessions, nil
+}
+
+func (s *sessionSnapshot) reset() (err error) {
+	s.sessions, err = s.load()
+	return err
+}
+
+func (s *sessionSnapshot) diff() ([]*Change, func(), error) {
+	current, err := s.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	changes := diffSessions(s.sessions, current, time.Now())
+	return changes, func() { s.sessions = current }, nil
+}
+
+// diffSessions 会话未读数变化
+func diffSessions(before, after map[string]*model.Session, now time.Time) []*Change {
+	changes := make([]*Change, 0)
+	if before == nil {
+		return changes
+	}
+	for name, sess := range after {
+		oldCount := 0
+		if old, ok := before[name]; ok {
+			oldCount = old.UnreadCount
+		}
+		if oldCount != sess.UnreadCount {
+			changes = append(changes, &Change{Event: EventUnread, Target: name, Name: sess.NickName, Before: oldCount, After: sess.UnreadCount, Time: now})
+		}
+	}
+	return changes
+}
+
+// recallText 撤回消息的系统提示，如 "张三" 撤回了一条消息、你撤回了一条消息
+const recallText = "撤回了一条消息"
+
+// IsRecall 消息是否为撤回提示
+func IsRecall(m *model.Message) bool {
+	return m.Type == model.MessageTypeSystem && strings.Contains(m.Content, recallText)
+}
+
+// recallChanges 将撤回提示转换为变更
+func recallChanges(messages []*model.Message) []*Change {
+	changes := make([]*Change, 0, len(messages))
+	for _, m := range messages {
+		changes = append(changes, &Change{Event: EventRecall, Target: m.Talker, Name: m.TalkerName, Message: m, Time: m.Time})
+	}
+	return changes
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+func TestDiffContacts(t *testing.T) {
+	now := time.Now()
+	before := map[string]*model.Contact{
+		"wxid_a": {UserName: "wxid_a", Remark: "A", IsFriend: true},
+		"wxid_b": {UserName: "wxid_b", IsFriend: false},
+	}
+	after := map[string]*model.Contact{
+		"wxid_a": {UserName: "wxid_a", Remark: "AA", IsFriend: true},
+		"wxid_b": {UserName: "wxid_b", IsFriend: true},
+		"wxid_c": {UserName: "wxid_c", IsFriend: true},
+	}
+	events := make(map[string]string)
+	for _, c := range diffContacts(before, after, now) {
+		events[c.Target] = c.Event
+	}
+	want := map[string]string{"wxid_a": EventRemark, "wxid_b": EventNewFriend, "wxid_c": EventNewFriend}
+	if len(events) != len(want) {
+		t.Fatalf("got %v, want %v", events, want)
+	}
+	for k, v := range want {
+		if events[k] != v {
+			t.Errorf("%s: got %s, want %s", k, events[k], v)
+		}
+	}
+
+	if changes := diffContacts(nil, after, now); len(changes) != 0 {
+		t.Errorf("no baseline should produce no changes, got %d", len(changes))
+	}
+}
+
+func TestDiffChatRooms(t *testing.T) {
+	before := map[string]*model.ChatRoom{
+		"1@chatroom": {Name: "1@chatroom", NickName: "old", Users: []model.ChatRoomUser{{UserName: "a"}, {UserName: "b"}}},
+	}
+	after := map[string]*model.ChatRoom{
+		"1@chatroom": {Name: "1@chatroom", NickName: "new", Users: []model.ChatRoomUser{{UserName: "b"}, {UserName: "c"}}},
+		"2@chatroom": {Name: "2@chatroom", Users: []model.ChatRoomUser{{UserName: "a"}}},
+	}
+	changes := diffChatRooms(before, after, time.Now())
+	got := make(map[string]*Change)
+	for _, c := range changes {
+		if c.Target != "1@chatroom" {
+			t.Fatalf("unexpected change for %s", c.Target)
+		}
+		got[c.Event] = c
+	}
+	if c := got[EventRename]; c == nil || c.Before != "old" || c.After != "new" {
+		t.Errorf("rename: %+v", c)
+	}
+	if c := got[EventMemberJoin]; c == nil || len(c.Members) != 1 || c.Members[0].UserName != "c" {
+		t.Errorf("member_join: %+v", c)
+	}
+	if c := got[EventMemberLeave]; c == nil || len(c.Members) != 1 || c.Members[0].UserName != "a" {
+		t.Errorf("member_leave: %+v", c)
+	}
+}
+
+func TestDiffSessions(t *testing.T) {
+	before := map[string]*model.Session{"a": {UserName: "a", UnreadCount: 1}, "b": {UserName: "b", UnreadCount: 2}}
+	after := map[string]*model.Session{"a": {UserName: "a", UnreadCount: 3}, "b": {UserName: "b", UnreadCount: 2}}
+	changes := diffSessions(before, after, time.Now())
+	if len(changes) != 1 || changes[0].Target != "a" || changes[0].Before != 1 || changes[0].After != 3 {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+}
+
+func TestIsRecall(t *testing.T) {
+	if !IsRecall(&model.Message{Type: model.MessageTypeSystem, Content: "\"张三\" 撤回了一条消息"}) {
+		t.Error("expected recall")
+	}
+	if IsRecall(&model.Message{Type: model.MessageTypeText, Content: "撤回了一条消息"}) {
+		t.Error("text message should not be recall")
+	}
+}
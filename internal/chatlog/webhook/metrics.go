@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶限流，rate 为每秒补充的令牌数，burst 为桶容量
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// take 取出一个令牌，令牌不足时返回需要等待的时间
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Metrics 单个 webhook 的投递统计，自启动起计算
+type Metrics struct {
+	Webhook string `json:"webhook"`
+	URL     string `json:"url"`
+	Type    string `json:"type"`
+	// Succeeded、Failed 成功与失败的请求次数，重试分别计入
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+	// Throttled 因限流推迟的次数
+	Throttled     int64   `json:"throttled"`
+	AvgLatencyMs  float64 `json:"avg_latency_ms"`
+	LastLatencyMs int64   `json:"last_latency_ms"`
+	// Pending、Dead 当前等待投递与死信的数量
+	Pending     int       `json:"pending"`
+	Dead        int       `json:"dead"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// metricsRecorder 按 webhook 记录投递统计
+type metricsRecorder struct {
+	mutex   sync.Mutex
+	metrics map[string]*Metrics
+}
+
+func (r *metricsRecorder) get(webhook string) *Metrics {
+	if r.metrics == nil {
+		r.metrics = make(map[string]*Metrics)
+	}
+	m, ok := r.metrics[webhook]
+	if !ok {
+		m = &Metrics{Webhook: webhook}
+		r.metrics[webhook] = m
+	}
+	return m
+}
+
+func (r *metricsRecorder) record(webhook string, latency time.Duration, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m := r.get(webhook)
+	ms := latency.Milliseconds()
+	m.LastLatencyMs = ms
+	total := m.Succeeded + m.Failed
+	m.AvgLatencyMs = (m.AvgLatencyMs*float64(total) + float64(ms)) / float64(total+1)
+	if err != nil {
+		m.Failed++
+		m.LastFailure = time.Now()
+		m.LastError = err.Error()
+		return
+	}
+	m.Succeeded++
+	m.LastSuccess = time.Now()
+}
+
+func (r *metricsRecorder) throttled(webhook string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.get(webhook).Throttled++
+}
+
+func (r *metricsRecorder) snapshot(webhook string) Metrics {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return *r.get(webhook)
+}
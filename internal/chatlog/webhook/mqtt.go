@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/pkg/mqtt"
+)
+
+// DefaultMQTTTopic 默认的 MQTT 主题模板
+const DefaultMQTTTopic = "chatlog/{talker}/{type}"
+
+// isMQTT webhook 是否发布到 MQTT broker
+func isMQTT(rawURL string) bool {
+	scheme, _, err := ParseTarget(rawURL)
+	return err == nil && (scheme == SchemeMQTT || scheme == SchemeMQTTS)
+}
+
+// mqttTopic 由主题模板生成主题，payload 只包含一条消息或变更
+// 消息的 {type} 为消息类型，变更的 {type} 为事件，{talker} 为变更对象
+func mqttTopic(item *conf.WebhookItem, p *Payload) string {
+	topic := DefaultMQTTTopic
+	if item.MQTT != nil && item.MQTT.Topic != "" {
+		topic = item.MQTT.Topic
+	}
+
+	var talker, sender, typ string
+	switch {
+	case len(p.Messages) > 0:
+		m := p.Messages[0]
+		talker, sender, typ = m.Talker, m.Sender, strconv.FormatInt(m.Type, 10)
+	case len(p.Changes) > 0:
+		c := p.Changes[0]
+		talker, typ = c.Target, c.Event
+		if c.Message != nil {
+			sender = c.Message.Sender
+		}
+	}
+	return strings.NewReplacer(
+		"{talker}", topicLevel(talker),
+		"{sender}", topicLevel(sender),
+		"{type}", topicLevel(typ),
+	).Replace(topic)
+}
+
+// topicLevel 替换主题层级中的分隔符与通配符，空值替换为 -
+func topicLevel(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+// mqttPublisher 按 webhook 复用到 broker 的连接，配置变化时重新连接
+type mqttPublisher struct {
+	mutex   sync.Mutex
+	clients map[string]*mqttClient
+}
+
+type mqttClient struct {
+	// key 连接选项的摘要，用于判断配置是否变化
+	key    string
+	client *mqtt.Client
+}
+
+func (p *mqttPublisher) publish(ctx context.Context, item *conf.WebhookItem, del *Delivery) error {
+	opts := item.MQTT
+	if opts == nil {
+		opts = &conf.WebhookMQTT{}
+	}
+	client, err := p.client(del.Webhook, del.URL, opts)
+	if err != nil {
+		return err
+	}
+	return client.Publish(ctx, del.Topic, del.Body, byte(opts.QoS), opts.Retain)
+}
+
+func (p *mqttPublisher) client(webhook, rawURL string, opts *conf.WebhookMQTT) (*mqtt.Client, error) {
+	key := fmt.Sprintf("%s|%s|%s|%s|%s|%t", rawURL, opts.Username, opts.Password, opts.ClientID, opts.CAFile, opts.InsecureSkipVerify)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if c, ok := p.clients[webhook]; ok {
+		if c.key == key {
+			return c.client, nil
+		}
+		c.client.Close()
+	}
+
+	options, err := mqttOptions(rawURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if p.clients == nil {
+		p.clients = make(map[string]*mqttClient)
+	}
+	c := &mqttClient{key: key, client: mqtt.NewClient(options)}
+	p.clients[webhook] = c
+	return c.client, nil
+}
+
+// publishOnce 以临时连接发布一次后断开，用于测试请求，不替换或关闭 webhook 正在使用的连接
+// 配置了 client_id 时加上 -test 后缀，避免 broker 因 client_id 相同断开正在使用的连接
+func (p *mqttPublisher) publishOnce(ctx context.Context, item *conf.WebhookItem, del *Delivery) error {
+	opts := item.MQTT
+	if opts == nil {
+		opts = &conf.WebhookMQTT{}
+	}
+	options, err := mqttOptions(del.URL, opts)
+	if err != nil {
+		return err
+	}
+	if options.ClientID != "" {
+		options.ClientID += "-test"
+	}
+	client := mqtt.NewClient(options)
+	defer client.Close()
+	return client.Publish(ctx, del.Topic, del.Body, byte(opts.QoS), opts.Retain)
+}
+
+// close 断开 webhook 的连接
+func (p *mqttPublisher) close(webhook string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if c, ok := p.clients[webhook]; ok {
+		c.client.Close()
+		delete(p.clients, webhook)
+	}
+}
+
+// mqttOptions 由 URL 与配置生成连接选项，端口默认 1883，mqtts 默认 8883
+func mqttOptions(rawURL string, opts *conf.WebhookMQTT) (mqtt.Options, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return mqtt.Options{}, errors.InvalidArg("url")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "1883"
+		if u.Scheme == SchemeMQTTS {
+			port = "8883"
+		}
+	}
+	options := mqtt.Options{
+		Addr:     net.JoinHostPort(u.Hostname(), port),
+		ClientID: opts.ClientID,
+		Username: opts.Username,
+		Password: opts.Password,
+	}
+	if u.Scheme == SchemeMQTTS {
+		options.TLS = &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: opts.InsecureSkipVerify}
+		if opts.CAFile != "" {
+			data, err := os.ReadFile(opts.CAFile)
+			if err != nil {
+				return mqtt.Options{}, errors.ReadFileFailed(opts.CAFile, err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(data) {
+				return mqtt.Options{}, errors.InvalidArg("ca_file")
+			}
+			options.TLS.RootCAs = pool
+		}
+	}
+	return options, nil
+}
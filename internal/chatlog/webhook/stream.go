@@ -0,0 +1,43 @@
+package webhook
+
+import (
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Broadcaster 在消息数据库变化时通知订阅者，用于 SSE / WebSocket 实时消息流
+// 与 webhook 使用相同的 fsnotify 回调，订阅者收到通知后自行按条件查询新消息
+type Broadcaster struct {
+	mutex       sync.Mutex
+	subscribers map[chan struct{}]bool
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: make(map[chan struct{}]bool)}
+}
+
+// Subscribe 订阅消息变化，处理期间的多次变化合并为一次通知，使用完毕后调用 cancel
+func (b *Broadcaster) Subscribe() (ch <-chan struct{}, cancel func()) {
+	c := make(chan struct{}, 1)
+	b.mutex.Lock()
+	b.subscribers[c] = true
+	b.mutex.Unlock()
+	return c, func() {
+		b.mutex.Lock()
+		delete(b.subscribers, c)
+		b.mutex.Unlock()
+	}
+}
+
+// Do 实现 Webhook，通知所有订阅者
+func (b *Broadcaster) Do(event fsnotify.Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for c := range b.subscribers {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
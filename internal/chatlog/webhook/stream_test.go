@@ -0,0 +1,30 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster()
+	ch, cancel := b.Subscribe()
+
+	// 未处理的多次变化合并为一次通知
+	b.Do(fsnotify.Event{})
+	b.Do(fsnotify.Event{})
+	<-ch
+	select {
+	case <-ch:
+		t.Fatal("notifications should be coalesced")
+	default:
+	}
+
+	cancel()
+	b.Do(fsnotify.Event{})
+	select {
+	case <-ch:
+		t.Fatal("cancelled subscriber should not be notified")
+	default:
+	}
+}
@@ -0,0 +1,227 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// 内置的请求体格式
+const (
+	PresetFeishu   = "feishu"
+	PresetDingTalk = "dingtalk"
+	PresetSlack    = "slack"
+	PresetNtfy     = "ntfy"
+)
+
+// preset 内置格式的模板与 Content-Type
+type preset struct {
+	template    string
+	contentType string
+}
+
+var presets = map[string]preset{
+	// 飞书自定义机器人
+	PresetFeishu: {`{"msg_type":"text","content":{"text":{{json (text .)}}}}`, "application/json"},
+	// 钉钉自定义机器人
+	PresetDingTalk: {`{"msgtype":"text","text":{"content":{{json (text .)}}}}`, "application/json"},
+	// Slack Incoming Webhook
+	PresetSlack: {`{"text":{{json (text .)}}}`, "application/json"},
+	// ntfy 以请求体作为通知内容
+	PresetNtfy: {`{{text .}}`, "text/plain; charset=utf-8"},
+}
+
+// Payload 模板的渲染数据
+type Payload struct {
+	Type     string
+	Talker   string
+	Sender   string
+	Keyword  string
+	Host     string
+	LastTime time.Time
+	Messages []*model.Message
+	Changes  []*Change
+}
+
+// Length 消息或变更的数量
+func (p *Payload) Length() int {
+	if p.Type == TypeMessage {
+		return len(p.Messages)
+	}
+	return len(p.Changes)
+}
+
+// body 未配置模板时的请求体
+func (p *Payload) body() map[string]any {
+	if p.Type == TypeMessage {
+		return map[string]any{
+			"type":     p.Type,
+			"talker":   p.Talker,
+			"sender":   p.Sender,
+			"keyword":  p.Keyword,
+			"lastTime": p.LastTime.Format(time.DateTime),
+			"length":   len(p.Messages),
+			"messages": p.Messages,
+		}
+	}
+	return map[string]any{
+		"type":    p.Type,
+		"length":  len(p.Changes),
+		"changes": p.Changes,
+	}
+}
+
+// single 唯一的消息或变更
+func (p *Payload) single() any {
+	if len(p.Messages) > 0 {
+		return p.Messages[0]
+	}
+	if len(p.Changes) > 0 {
+		return p.Changes[0]
+	}
+	return nil
+}
+
+// Text 可读的文本摘要，每条消息或变更一行
+func (p *Payload) Text() string {
+	lines := make([]string, 0, p.Length())
+	for _, m := range p.Messages {
+		lines = append(lines, messageText(m))
+	}
+	for _, c := range p.Changes {
+		lines = append(lines, changeText(c))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func messageText(m *model.Message) string {
+	sender := m.SenderName
+	if sender == "" {
+		sender = m.Sender
+	}
+	if m.IsChatRoom {
+		talker := m.TalkerName
+		if talker == "" {
+			talker = m.Talker
+		}
+		sender = fmt.Sprintf("%s@%s", sender, talker)
+	}
+	return fmt.Sprintf("[%s] %s: %s", m.Time.Format(time.DateTime), sender, m.PlainTextContent())
+}
+
+func changeText(c *Change) string {
+	name := c.Name
+	if name == "" {
+		name = c.Target
+	}
+	switch c.Event {
+	case EventNewFriend:
+		return fmt.Sprintf("新好友 %s", name)
+	case EventRemark:
+		return fmt.Sprintf("%s 备注 %v -> %v", name, c.Before, c.After)
+	case EventMemberJoin, EventMemberLeave:
+		members := make([]string, 0, len(c.Members))
+		for _, u := range c.Members {
+			members = append(members, u.UserName)
+		}
+		action := "加入"
+		if c.Event == EventMemberLeave {
+			action = "退出"
+		}
+		return fmt.Sprintf("%s %s群聊 %s", strings.Join(members, ","), action, name)
+	case EventRename:
+		return fmt.Sprintf("群聊 %v 改名为 %v", c.Before, c.After)
+	case EventUnread:
+		return fmt.Sprintf("%s 未读 %v -> %v", name, c.Before, c.After)
+	case EventRecall:
+		if c.Message != nil {
+			return messageText(c.Message)
+		}
+	}
+	return fmt.Sprintf("%s %s", c.Event, name)
+}
+
+var templateFuncs = template.FuncMap{
+	// json 序列化为 JSON，用于在 JSON 模板中嵌入字符串或对象
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"text": func(p *Payload) string {
+		return p.Text()
+	},
+	"formatTime": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+// Renderer 按 webhook 配置生成请求体
+type Renderer struct {
+	tmpl        *template.Template
+	contentType string
+	// single 发布到 MQTT 时每次只有一条消息或变更，未配置模板时直接序列化该项
+	single bool
+}
+
+// NewRenderer 解析配置中的模板或内置格式
+func NewRenderer(item *conf.WebhookItem) (*Renderer, error) {
+	r := &Renderer{contentType: "application/json", single: isMQTT(item.URL)}
+	text := item.Template
+	if text == "" && item.Preset != "" {
+		p, ok := presets[item.Preset]
+		if !ok {
+			return nil, errors.InvalidArg("preset")
+		}
+		text = p.template
+		r.contentType = p.contentType
+	}
+	if text != "" {
+		tmpl, err := template.New("webhook").Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, errors.New(err, http.StatusBadRequest, "invalid webhook template")
+		}
+		r.tmpl = tmpl
+	}
+	if item.ContentType != "" {
+		r.contentType = item.ContentType
+	}
+	return r, nil
+}
+
+// rendererOf 返回 webhook 的渲染器，配置无效时使用默认格式
+// 配置在加载与修改时已校验，这里的错误只在配置被直接修改后出现
+func rendererOf(item *conf.WebhookItem) *Renderer {
+	r, err := NewRenderer(item)
+	if err != nil {
+		return &Renderer{contentType: "application/json"}
+	}
+	return r
+}
+
+// ContentType 请求的 Content-Type
+func (r *Renderer) ContentType() string {
+	return r.contentType
+}
+
+// Render 渲染请求体
+func (r *Renderer) Render(p *Payload) ([]byte, error) {
+	if r.tmpl == nil {
+		if r.single {
+			return json.Marshal(p.single())
+		}
+		return json.Marshal(p.body())
+	}
+	var buf bytes.Buffer
+	if err := r.tmpl.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+func TestRendererPresets(t *testing.T) {
+	payload := &Payload{
+		Type: TypeMessage,
+		Messages: []*model.Message{
+			{Time: time.Date(2025, 8, 27, 0, 0, 0, 0, time.Local), Sender: "wxid_a", SenderName: "A", Type: model.MessageTypeText, Content: "say \"hi\""},
+		},
+	}
+	want := `[2025-08-27 00:00:00] A: say "hi"`
+
+	for name, path := range map[string][]string{
+		PresetFeishu:   {"content", "text"},
+		PresetDingTalk: {"text", "content"},
+		PresetSlack:    {"text"},
+	} {
+		r, err := NewRenderer(&conf.WebhookItem{Preset: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := r.Render(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Fatalf("%s: invalid json %s", name, body)
+		}
+		for _, k := range path {
+			v = v.(map[string]any)[k]
+		}
+		if v != want {
+			t.Errorf("%s: got %v, want %s", name, v, want)
+		}
+	}
+
+	r, err := NewRenderer(&conf.WebhookItem{Preset: PresetNtfy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := r.Render(payload); string(body) != want || r.ContentType() != "text/plain; charset=utf-8" {
+		t.Errorf("ntfy: got %q (%s)", body, r.ContentType())
+	}
+}
+
+func TestRendererTemplate(t *testing.T) {
+	r, err := NewRenderer(&conf.WebhookItem{
+		Template:    `{{.Type}} {{.Length}}{{range .Messages}} {{.Sender}}{{end}}`,
+		ContentType: "text/plain",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := r.Render(&Payload{Type: TypeMessage, Messages: []*model.Message{{Sender: "a"}, {Sender: "b"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "message 2 a b" || r.ContentType() != "text/plain" {
+		t.Errorf("got %q (%s)", body, r.ContentType())
+	}
+
+	if _, err := NewRenderer(&conf.WebhookItem{Template: "{{.Type"}); err == nil {
+		t.Error("expected template parse error")
+	}
+	if _, err := NewRenderer(&conf.WebhookItem{Preset: "unknown"}); err == nil {
+		t.Error("expected unknown preset error")
+	}
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// 投递方式，由 webhook URL 的 scheme 决定
+const (
+	// SchemeHTTP http:// 与 https://，以 POST 请求投递
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+	// SchemeUnix unix:///path/to.sock，连接 Unix socket 写入一行
+	SchemeUnix = "unix"
+	// SchemeFile file:///path/to/out.jsonl，追加写入一行
+	SchemeFile = "file"
+	// SchemeStdout stdout:，写入标准输出一行，便于通过管道交给其他工具
+	SchemeStdout = "stdout"
+	// SchemeMQTT mqtt://host:1883 与 mqtts://host:8883，每条消息或变更发布到主题模板生成的主题
+	SchemeMQTT  = "mqtt"
+	SchemeMQTTS = "mqtts"
+)
+
+// ParseTarget 解析 webhook URL，返回投递方式与 unix、file 的本地路径
+func ParseTarget(rawURL string) (scheme string, path string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", errors.InvalidArg("url")
+	}
+	switch u.Scheme {
+	case SchemeHTTP, SchemeHTTPS, SchemeMQTT, SchemeMQTTS:
+		if u.Host == "" {
+			return "", "", errors.InvalidArg("url")
+		}
+		return u.Scheme, "", nil
+	case SchemeStdout:
+		return u.Scheme, "", nil
+	case SchemeUnix, SchemeFile:
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		// file:///C:/out.jsonl
+		if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+			path = path[1:]
+		}
+		if path == "" {
+			return "", "", errors.InvalidArg("url")
+		}
+		return u.Scheme, filepath.FromSlash(path), nil
+	}
+	return "", "", errors.InvalidArg("url")
+}
+
+// CheckRemoteTarget 检查通过接口添加或测试的 webhook URL，只允许 http、https、mqtt、mqtts
+// unix、file、stdout 会写入本地文件或连接本地 socket，只能在配置文件中配置
+func CheckRemoteTarget(rawURL string) error {
+	scheme, _, err := ParseTarget(rawURL)
+	if err != nil {
+		return err
+	}
+	switch scheme {
+	case SchemeHTTP, SchemeHTTPS, SchemeMQTT, SchemeMQTTS:
+		return nil
+	}
+	return errors.WebhookLocalTarget(scheme)
+}
+
+// lineWriter 以行为单位投递到 Unix socket、文件或标准输出
+// 每次投递写入一行，JSON 请求体压缩为单行，便于按 JSONL 读取
+type lineWriter struct {
+	// mutex 串行写入，避免多个投递的内容交错
+	mutex sync.Mutex
+}
+
+func (w *lineWriter) write(ctx context.Context, scheme, path string, body []byte) error {
+	line := toLine(body)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	switch scheme {
+	case SchemeStdout:
+		_, err := os.Stdout.Write(line)
+		return err
+	case SchemeFile:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return errors.WriteOutputFailed(err)
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return errors.OpenFileFailed(path, err)
+		}
+		if _, err := f.Write(line); err != nil {
+			f.Close()
+			return errors.WriteOutputFailed(err)
+		}
+		return f.Close()
+	case SchemeUnix:
+		dialer := net.Dialer{Timeout: 10 * time.Second}
+		conn, err := dialer.DialContext(ctx, "unix", path)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		_, err = conn.Write(line)
+		return err
+	}
+	return errors.InvalidArg("url")
+}
+
+// toLine 将请求体转换为以换行结尾的一行
+func toLine(body []byte) []byte {
+	var buf bytes.Buffer
+	if json.Valid(body) && json.Compact(&buf, body) == nil {
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+	line := bytes.ReplaceAll(bytes.TrimRight(body, "\r\n"), []byte("\n"), []byte(`\n`))
+	return append(line, '\n')
+}
@@ -1,102 +1,503 @@
 package webhook
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha1"
+	"encoding/hex"
 	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
 
 	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb"
+	"github.com/sjzar/chatlog/pkg/util"
 )
 
+// contentCursorTalker 暂存消息所属的配置会话，用于按会话记录进度
+const contentCursorTalker = "_cursor_talker"
+
+// OutboxDir 未完成投递的保存目录，位于工作目录下
+const OutboxDir = "webhook/deliveries"
+
 type Config interface {
 	GetWebhook() *conf.Webhook
 }
 
+// WorkDirConfig 可选，提供工作目录以持久化未完成的投递
+type WorkDirConfig interface {
+	GetWorkDir() string
+}
+
+// DataDirConfig 可选，提供数据目录以推断当前账号，用于 mentions_me 过滤
+type DataDirConfig interface {
+	GetDataDir() string
+}
+
+// AtRestConfig 可选的工作目录加密配置，启用时投递只保存在内存中，不以明文写入工作目录
+type AtRestConfig interface {
+	IsEncryptWorkDir() bool
+}
+
+// SaveConfig 可选，保存修改后的 webhook 配置，未实现时不能通过接口修改 webhook
+type SaveConfig interface {
+	SaveWebhook(config *conf.Webhook) error
+}
+
 type Webhook interface {
 	Do(event fsnotify.Event)
 }
 
+// closer 可选，配置重新加载后停止被替换的 webhook
+type closer interface {
+	Close()
+}
+
 type Service struct {
-	config *conf.Webhook
-	hooks  map[string][]*conf.WebhookItem
+	conf       Config
+	config     *conf.Webhook
+	mutex      sync.Mutex
+	dispatcher *Dispatcher
+	cursors    *CursorStore
+	stream     *Broadcaster
+
+	// reloadMutex 保护配置与运行中的分组，修改配置后重新生成各分组的 webhook
+	reloadMutex sync.Mutex
+	ctx         context.Context
+	db          *wechatdb.DB
+	groups      map[string]*Group
+	// dispatching 当前数据库的 Dispatcher.Run 是否已启动
+	dispatching bool
 }
 
 func New(config Config) *Service {
 	s := &Service{
+		conf:   config,
 		config: config.GetWebhook(),
+		stream: NewBroadcaster(),
 	}
-
 	if s.config == nil {
-		return s
+		s.config = &conf.Webhook{}
+	}
+	return s
+}
+
+// validate 校验 webhook 配置，type 为空时设为 message
+func validate(item *conf.WebhookItem) error {
+	if item.Type == "" {
+		item.Type = TypeMessage
+	}
+	if _, ok := typeGroups[item.Type]; !ok {
+		return errors.InvalidArg("type")
+	}
+	if _, _, err := ParseTarget(item.URL); err != nil {
+		return err
+	}
+	if _, err := NewRenderer(item); err != nil {
+		return err
+	}
+	if item.MQTT != nil && (item.MQTT.QoS < 0 || item.MQTT.QoS > 2) {
+		return errors.InvalidArg("qos")
+	}
+	return validateFilter(&item.MessageFilter)
+}
+
+// validateFilter 检查过滤条件中的正则表达式，不修改运行中 webhook 已编译的条件
+func validateFilter(f *model.MessageFilter) error {
+	if _, err := regexp.Compile(f.Regex); err != nil {
+		return errors.New(err, http.StatusBadRequest, "invalid webhook filter")
 	}
+	for _, sub := range slices.Concat(f.All, f.Any) {
+		if err := validateFilter(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	hooks := make(map[string][]*conf.WebhookItem)
+// enabledItems 按数据库分组返回启用且有效的 webhook
+func (s *Service) enabledItems() map[string][]*conf.WebhookItem {
+	items := make(map[string][]*conf.WebhookItem)
 	for _, item := range s.config.Items {
 		if item.Disabled {
 			continue
 		}
-		if item.Type == "" {
-			item.Type = "message"
+		if err := validate(item); err != nil {
+			log.Error().Err(err).Msgf("invalid webhook %s", item.URL)
+			continue
+		}
+		group := typeGroups[item.Type]
+		items[group] = append(items[group], item)
+	}
+	return items
+}
+
+// GetHooks 按数据库分组返回回调，每个分组都会返回，以便之后添加的 webhook 无需重新注册回调即可生效
+// 消息分组始终包含实时消息流的通知
+func (s *Service) GetHooks(ctx context.Context, db *wechatdb.DB) []*Group {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	// 停止上一次启动的 webhook
+	for _, g := range s.groups {
+		g.SetHooks(nil)
+	}
+	s.ctx, s.db, s.dispatching = ctx, db, false
+	s.groups = make(map[string]*Group)
+	for _, group := range typeGroups {
+		if _, ok := s.groups[group]; !ok {
+			s.groups[group] = NewGroup(ctx, group, nil, s.config.DelayMs)
+		}
+	}
+	s.applyLocked()
+
+	groups := make([]*Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].group < groups[j].group
+	})
+	return groups
+}
+
+// applyLocked 按当前配置重新生成 webhook，替换各分组中运行的 webhook
+func (s *Service) applyLocked() {
+	// 数据库未启动或已停止时只修改配置，下次启动时生效
+	if s.db == nil || s.ctx.Err() != nil {
+		return
+	}
+
+	// 先停止运行中的 webhook，再重新编译配置中的过滤条件
+	for _, g := range s.groups {
+		g.SetHooks(nil)
+	}
+
+	hooks := map[string][]Webhook{TypeMessage: {s.stream}}
+	if items := s.enabledItems(); len(items) > 0 {
+		dispatcher := s.Dispatcher()
+		cursors := s.Cursors()
+		if !s.dispatching {
+			go dispatcher.Run(s.ctx)
+			s.dispatching = true
+		}
+
+		self := &model.Identity{}
+		if c, ok := s.conf.(DataDirConfig); ok {
+			self = s.db.GetIdentity(s.db.AccountUserName(c.GetDataDir()))
 		}
-		switch item.Type {
-		case "message":
-			if hooks["message"] == nil {
-				hooks["message"] = make([]*conf.WebhookItem, 0)
+
+		for group, list := range items {
+			for _, item := range list {
+				switch item.Type {
+				case TypeMessage, TypeRecall:
+					if self.UserName == "" && item.MessageFilter.UsesMentionsMe() {
+						log.Warn().Msgf("webhook %s: account wechat id unknown, mentions_me matches nothing", item.URL)
+					}
+					item.MessageFilter.Compile(self)
+					hooks[group] = append(hooks[group], NewMessageWebhook(item, s.db, s.config.Host, dispatcher, cursors))
+				default:
+					hooks[group] = append(hooks[group], NewSnapshotWebhook(item, s.db, dispatcher))
+				}
 			}
-			hooks["message"] = append(hooks["message"], item)
-		default:
-			log.Error().Msgf("unknown webhook type: %s", item.Type)
 		}
 	}
-	s.hooks = hooks
 
-	return s
+	// 停用的 webhook 暂停投递，未完成的投递在重新启用后继续
+	for _, item := range s.config.Items {
+		if item.Disabled {
+			s.Dispatcher().Pause(ItemID(item))
+		}
+	}
+
+	for group, g := range s.groups {
+		g.SetHooks(hooks[group])
+	}
 }
 
-func (s *Service) GetHooks(ctx context.Context, db *wechatdb.DB) []*Group {
+// Items 返回配置的 webhook，包括已禁用的
+func (s *Service) Items() []*conf.WebhookItem {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	return slices.Clone(s.config.Items)
+}
 
-	if len(s.hooks) == 0 {
-		return nil
+// Item 返回 id 对应的 webhook
+func (s *Service) Item(id string) (*conf.WebhookItem, error) {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	i := s.indexLocked(id)
+	if i < 0 {
+		return nil, errors.WebhookNotFound(id)
+	}
+	return s.config.Items[i], nil
+}
+
+// AddItem 添加 webhook，立即生效
+func (s *Service) AddItem(item *conf.WebhookItem) error {
+	if err := validate(item); err != nil {
+		return err
+	}
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	return s.setItemsLocked(append(slices.Clone(s.config.Items), item))
+}
+
+// UpdateItem 替换 id 对应的 webhook，立即生效
+// type、url、talker、sender、keyword 决定 webhook 的标识，修改后视为新的 webhook，原有未完成的投递被丢弃
+func (s *Service) UpdateItem(id string, item *conf.WebhookItem) error {
+	if err := validate(item); err != nil {
+		return err
+	}
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	i := s.indexLocked(id)
+	if i < 0 {
+		return errors.WebhookNotFound(id)
+	}
+	items := slices.Clone(s.config.Items)
+	items[i] = item
+	if err := s.setItemsLocked(items); err != nil {
+		return err
+	}
+	if ItemID(item) != id {
+		s.Dispatcher().Unregister(id)
+	}
+	return nil
+}
+
+// DeleteItem 删除 id 对应的 webhook，并丢弃其未完成的投递
+func (s *Service) DeleteItem(id string) error {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	i := s.indexLocked(id)
+	if i < 0 {
+		return errors.WebhookNotFound(id)
+	}
+	if err := s.setItemsLocked(slices.Delete(slices.Clone(s.config.Items), i, i+1)); err != nil {
+		return err
 	}
+	s.Dispatcher().Unregister(id)
+	return nil
+}
 
-	groups := make([]*Group, 0)
-	for group, items := range s.hooks {
-		hooks := make([]Webhook, 0)
-		for _, item := range items {
-			hooks = append(hooks, NewMessageWebhook(item, db, s.config.Host))
+func (s *Service) indexLocked(id string) int {
+	return slices.IndexFunc(s.config.Items, func(item *conf.WebhookItem) bool {
+		return ItemID(item) == id
+	})
+}
+
+// setItemsLocked 保存配置，然后重新生成运行中的 webhook
+func (s *Service) setItemsLocked(items []*conf.WebhookItem) error {
+	ids := make(map[string]bool, len(items))
+	for _, item := range items {
+		id := ItemID(item)
+		if ids[id] {
+			return errors.ErrWebhookExists
 		}
-		groups = append(groups, NewGroup(ctx, group, hooks, s.config.DelayMs))
+		ids[id] = true
 	}
 
-	return groups
+	// 无法保存时拒绝修改，避免修改在重启后丢失
+	c, ok := s.conf.(SaveConfig)
+	if !ok {
+		return errors.ErrWebhookReadOnly
+	}
+	config := *s.config
+	config.Items = items
+	if err := c.SaveWebhook(&config); err != nil {
+		return err
+	}
+	*s.config = config
+	s.applyLocked()
+	return nil
+}
+
+// Test 以示例数据渲染并立即发送一次请求，用于检查地址、模板与签名，不影响投递进度
+func (s *Service) Test(ctx context.Context, item *conf.WebhookItem) error {
+	if err := validate(item); err != nil {
+		return err
+	}
+	renderer, err := NewRenderer(item)
+	if err != nil {
+		return err
+	}
+	payload := samplePayload(item, s.config.Host)
+	body, err := renderer.Render(payload)
+	if err != nil {
+		return err
+	}
+	del := &Delivery{
+		Webhook:     ItemID(item),
+		URL:         item.URL,
+		ContentType: renderer.ContentType(),
+		Body:        body,
+	}
+	if isMQTT(item.URL) {
+		del.Topic = mqttTopic(item, payload)
+	}
+	return s.Dispatcher().Test(ctx, item, del)
+}
+
+// samplePayload 测试请求使用的示例数据
+func samplePayload(item *conf.WebhookItem, host string) *Payload {
+	now := time.Now()
+	talker := "chatlog"
+	if talkers := util.Str2List(item.Talker, ","); len(talkers) > 0 {
+		talker = talkers[0]
+	}
+	message := &model.Message{
+		Seq:        now.Unix() * 1000,
+		Time:       now,
+		Talker:     talker,
+		TalkerName: talker,
+		Sender:     "chatlog",
+		SenderName: "chatlog",
+		Type:       model.MessageTypeText,
+		Content:    "这是一条来自 chatlog 的测试消息",
+	}
+
+	payload := &Payload{
+		Type:     item.Type,
+		Talker:   item.Talker,
+		Sender:   item.Sender,
+		Keyword:  item.Keyword,
+		Host:     host,
+		LastTime: now,
+	}
+	switch item.Type {
+	case TypeMessage:
+		payload.Messages = []*model.Message{message}
+	case TypeRecall:
+		payload.Changes = []*Change{{Event: EventRecall, Target: talker, Message: message, Time: now}}
+	default:
+		payload.Changes = []*Change{{Event: "test", Target: talker, Name: talker, Time: now}}
+	}
+	return payload
+}
+
+// Stream 返回实时消息流的通知
+func (s *Service) Stream() *Broadcaster {
+	return s.stream
+}
+
+// Dispatcher 返回投递器，首次调用时加载工作目录中未完成的投递
+func (s *Service) Dispatcher() *Dispatcher {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loadLocked()
+	return s.dispatcher
+}
+
+// Cursors 返回各 webhook 的投递进度
+func (s *Service) Cursors() *CursorStore {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loadLocked()
+	return s.cursors
+}
+
+func (s *Service) loadLocked() {
+	if s.dispatcher != nil {
+		return
+	}
+
+	// 启用工作目录加密时不以明文保存消息与进度
+	workDir := ""
+	if c, ok := s.conf.(WorkDirConfig); ok {
+		workDir = c.GetWorkDir()
+	}
+	if c, ok := s.conf.(AtRestConfig); ok && c.IsEncryptWorkDir() {
+		workDir = ""
+	}
+	path := func(name string) string {
+		if workDir == "" {
+			return ""
+		}
+		return filepath.Join(workDir, filepath.FromSlash(name))
+	}
+
+	var maxAttempts int
+	var retryBase, lookback time.Duration
+	if s.config != nil {
+		maxAttempts = s.config.MaxAttempts
+		retryBase = time.Duration(s.config.RetryBaseMs) * time.Millisecond
+		lookback = time.Duration(s.config.LookbackMs) * time.Millisecond
+	}
+
+	outbox, err := NewOutbox(path(OutboxDir))
+	if err != nil {
+		log.Error().Err(err).Msg("load webhook outbox failed, deliveries are kept in memory")
+		outbox, _ = NewOutbox("")
+	}
+	s.dispatcher = NewDispatcher(outbox, maxAttempts, retryBase)
+
+	cursors, err := NewCursorStore(path(CursorFile), lookback)
+	if err != nil {
+		log.Error().Err(err).Msg("load webhook cursors failed, cursors are kept in memory")
+		cursors, _ = NewCursorStore("", lookback)
+	}
+	s.cursors = cursors
 }
 
 type Group struct {
 	ctx     context.Context
 	group   string
-	hooks   []Webhook
 	delayMs int64
 	ch      chan fsnotify.Event
+
+	mutex sync.Mutex
+	hooks []Webhook
+	// workers 每个 webhook 一个串行执行的 worker，执行期间到达的事件合并为一次
+	workers []chan fsnotify.Event
+	// cancel 停止当前 webhook 的 worker
+	cancel context.CancelFunc
 }
 
 func NewGroup(ctx context.Context, group string, hooks []Webhook, delayMs int64) *Group {
 	g := &Group{
 		group:   group,
-		hooks:   hooks,
 		delayMs: delayMs,
 		ctx:     ctx,
 		ch:      make(chan fsnotify.Event, 1),
 	}
+	g.SetHooks(hooks)
 	go g.loop()
 	return g
 }
 
+// SetHooks 替换分组中的 webhook，等待被替换的 webhook 执行完毕
+func (g *Group) SetHooks(hooks []Webhook) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.cancel != nil {
+		g.cancel()
+	}
+	for _, hook := range g.hooks {
+		if c, ok := hook.(closer); ok {
+			c.Close()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(g.ctx)
+	g.hooks = hooks
+	g.cancel = cancel
+	g.workers = make([]chan fsnotify.Event, len(hooks))
+	for i, hook := range hooks {
+		g.workers[i] = make(chan fsnotify.Event, 1)
+		go g.work(ctx, hook, g.workers[i])
+	}
+}
+
 func (g *Group) Callback(event fsnotify.Event) error {
 	if !(event.Op.Has(fsnotify.Create) || event.Op.Has(fsnotify.Write) || event.Op.Has(fsnotify.Rename)) {
 		return nil
@@ -131,72 +532,264 @@ func (g *Group) loop() {
 }
 
 func (g *Group) do(event fsnotify.Event) {
-	for _, hook := range g.hooks {
-		go hook.Do(event)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, ch := range g.workers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (g *Group) work(ctx context.Context, hook Webhook, ch chan fsnotify.Event) {
+	for {
+		select {
+		case event := <-ch:
+			hook.Do(event)
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
+// DefaultBatchMax 单次投递的默认最大消息数，积压较多时分批投递
+const DefaultBatchMax = 500
+
+// MessageWebhook 推送配置会话的新消息，类型为 recall 时只推送撤回提示
 type MessageWebhook struct {
-	host     string
-	conf     *conf.WebhookItem
-	client   *http.Client
-	db       *wechatdb.DB
-	lastTime time.Time
+	id         string
+	host       string
+	conf       *conf.WebhookItem
+	renderer   *Renderer
+	db         *wechatdb.DB
+	dispatcher *Dispatcher
+	cursors    *CursorStore
+	// since 尚无进度的会话从该时间开始推送
+	since time.Time
+
+	// running 串行执行 Do，避免并发拉取到重叠的消息
+	running sync.Mutex
+	// pendingSince 首次发现待投递消息的时间，用于 batch_wait_ms
+	pendingSince time.Time
+
+	timerMutex sync.Mutex
+	timer      *time.Timer
+	// closed 配置重新加载后不再推送
+	closed bool
 }
 
-func NewMessageWebhook(conf *conf.WebhookItem, db *wechatdb.DB, host string) *MessageWebhook {
+func NewMessageWebhook(conf *conf.WebhookItem, db *wechatdb.DB, host string, dispatcher *Dispatcher, cursors *CursorStore) *MessageWebhook {
 	m := &MessageWebhook{
-		host:     host,
-		conf:     conf,
-		client:   &http.Client{Timeout: time.Second * 10},
-		db:       db,
-		lastTime: time.Now(),
+		id:         ItemID(conf),
+		host:       host,
+		conf:       conf,
+		renderer:   rendererOf(conf),
+		db:         db,
+		dispatcher: dispatcher,
+		cursors:    cursors,
+		since:      startFrom(conf.StartFrom),
 	}
+	dispatcher.Register(m.id, conf, m.ack)
 	return m
 }
 
+// startFrom 解析首次运行的起点：now（默认）、beginning 或日期时间
+func startFrom(str string) time.Time {
+	switch str {
+	case "", StartFromNow:
+		return time.Now()
+	case StartFromBeginning:
+		return time.Unix(0, 0)
+	}
+	if t, ok := util.TimeOf(str); ok {
+		return t
+	}
+	log.Warn().Msgf("invalid webhook start_from %q, start from now", str)
+	return time.Now()
+}
+
+// ItemID 由 webhook 配置生成的标识，用于关联投递记录与进度
+func ItemID(item *conf.WebhookItem) string {
+	sum := sha1.Sum([]byte(item.Type + "|" + item.URL + "|" + item.Talker + "|" + item.Sender + "|" + item.Keyword))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ack 投递成功后记录已投递的消息
+func (m *MessageWebhook) ack(d *Delivery) {
+	if err := m.cursors.Advance(m.id, d.Since, d.Seqs); err != nil {
+		log.Error().Err(err).Msg("save webhook cursors failed")
+	}
+	// 继续投递因上一次投递未完成而暂停的消息
+	m.schedule(0)
+}
+
+// schedule 在 delay 之后再次执行 Do，已有计划时不重复安排
+func (m *MessageWebhook) schedule(delay time.Duration) {
+	m.timerMutex.Lock()
+	defer m.timerMutex.Unlock()
+	if m.timer != nil {
+		return
+	}
+	m.timer = time.AfterFunc(delay, func() {
+		m.timerMutex.Lock()
+		m.timer = nil
+		m.timerMutex.Unlock()
+		m.Do(fsnotify.Event{})
+	})
+}
+
+func (m *MessageWebhook) batchMax() int {
+	// MQTT 每条消息发布一次
+	if isMQTT(m.conf.URL) {
+		return 1
+	}
+	if m.conf.BatchMax > 0 {
+		return m.conf.BatchMax
+	}
+	return DefaultBatchMax
+}
+
+// Close 等待进行中的推送完成后停止，取消计划中的推送
+func (m *MessageWebhook) Close() {
+	m.running.Lock()
+	defer m.running.Unlock()
+	m.closed = true
+
+	m.timerMutex.Lock()
+	defer m.timerMutex.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+}
+
 func (m *MessageWebhook) Do(event fsnotify.Event) {
-	messages, err := m.db.GetMessages(m.lastTime, time.Now().Add(time.Minute*10), m.conf.Talker, m.conf.Sender, m.conf.Keyword, 0, 0)
-	if err != nil {
-		log.Error().Err(err).Msgf("get messages failed")
+	m.running.Lock()
+	defer m.running.Unlock()
+	if m.closed {
+		return
+	}
+
+	// 上一次投递尚未确认时不拉取新消息，由 Dispatcher 重试，确认后游标前移
+	if m.dispatcher.Busy(m.id) {
 		return
 	}
 
+	messages := m.newMessages()
 	if len(messages) == 0 {
+		m.pendingSince = time.Time{}
 		return
 	}
 
+	// 消息数未达到 batch_max 时等待 batch_wait_ms，合并期间的新消息
+	batchMax := m.batchMax()
+	if wait := time.Duration(m.conf.BatchWaitMs) * time.Millisecond; wait > 0 && len(messages) < batchMax {
+		if m.pendingSince.IsZero() {
+			m.pendingSince = time.Now()
+		}
+		if remaining := wait - time.Since(m.pendingSince); remaining > 0 {
+			m.schedule(remaining)
+			return
+		}
+	}
+	m.pendingSince = time.Time{}
+
 	if err := m.db.IndexMessages(messages); err != nil {
 		log.Warn().Err(err).Msg("incremental fts update failed")
 	}
 
-	m.lastTime = messages[len(messages)-1].Time.Add(time.Second)
+	for start := 0; start < len(messages); start += batchMax {
+		batch := messages[start:min(start+batchMax, len(messages))]
+		if err := m.submit(batch); err != nil {
+			log.Error().Err(err).Msgf("save webhook delivery failed")
+			return
+		}
+		// 投递失败时剩余的消息等待下次拉取
+		if m.dispatcher.Busy(m.id) {
+			return
+		}
+	}
+}
+
+// newMessages 按会话查询游标之后及回看窗口内尚未投递的消息
+func (m *MessageWebhook) newMessages() []*model.Message {
+	end := time.Now().Add(time.Minute * 10)
+	messages := make([]*model.Message, 0)
+	for _, talker := range util.Str2List(m.conf.Talker, ",") {
+		start := m.since
+		cursor := m.cursors.Get(m.id, talker)
+		if cursor != nil {
+			start = seqTime(cursor.LastSeq).Add(-m.cursors.Lookback())
+		}
+		list, err := m.db.GetMessages(start, end, talker, m.conf.Sender, m.conf.Keyword, 0, 0)
+		if err != nil {
+			log.Debug().Err(err).Msgf("get messages of %s failed", talker)
+			continue
+		}
+		for _, msg := range list {
+			if cursor == nil && msg.Time.Before(m.since) {
+				continue
+			}
+			if cursor != nil && !cursor.IsNew(msg.CursorSeq(), msg.Time) {
+				continue
+			}
+			if m.conf.Type == TypeRecall && !IsRecall(msg) {
+				continue
+			}
+			if !m.conf.MessageFilter.Match(msg) {
+				continue
+			}
+			msg.SetContent(contentCursorTalker, talker)
+			messages = append(messages, msg)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Time.Before(messages[j].Time)
+	})
+	return messages
+}
 
+func (m *MessageWebhook) submit(messages []*model.Message) error {
+	seqs := make(map[string][]int64)
 	for _, message := range messages {
+		talker, _ := message.Contents[contentCursorTalker].(string)
+		delete(message.Contents, contentCursorTalker)
+		seqs[talker] = append(seqs[talker], message.CursorSeq())
 		message.SetContent("host", m.host)
 		message.Content = message.PlainTextContent()
 	}
 
-	ret := map[string]any{
-		"talker":   m.conf.Talker,
-		"sender":   m.conf.Sender,
-		"keyword":  m.conf.Keyword,
-		"lastTime": m.lastTime.Format(time.DateTime),
-		"length":   len(messages),
-		"messages": messages,
+	payload := &Payload{
+		Type:     TypeMessage,
+		Talker:   m.conf.Talker,
+		Sender:   m.conf.Sender,
+		Keyword:  m.conf.Keyword,
+		Host:     m.host,
+		LastTime: messages[len(messages)-1].Time,
+		Messages: messages,
 	}
-	body, _ := json.Marshal(ret)
-	req, _ := http.NewRequest("POST", m.conf.URL, bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
-
-	log.Info().Msgf("post messages to %s, body: %s", m.conf.URL, string(body))
-	resp, err := m.client.Do(req)
+	if m.conf.Type == TypeRecall {
+		payload.Type = TypeRecall
+		payload.Messages = nil
+		payload.Changes = recallChanges(messages)
+	}
+	body, err := m.renderer.Render(payload)
 	if err != nil {
-		log.Error().Err(err).Msgf("post messages failed")
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Error().Msgf("post messages failed, status code: %d", resp.StatusCode)
+	del := &Delivery{
+		Webhook:     m.id,
+		URL:         m.conf.URL,
+		ContentType: m.renderer.ContentType(),
+		Body:        body,
+		Since:       m.since.Unix(),
+		Seqs:        seqs,
+	}
+	if isMQTT(m.conf.URL) {
+		del.Topic = mqttTopic(m.conf, payload)
 	}
+	log.Info().Msgf("post %s to %s, body: %s", m.conf.Type, m.conf.URL, string(body))
+	return m.dispatcher.Submit(context.Background(), del)
 }
@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+type testConfig struct {
+	webhook *conf.Webhook
+	saved   int
+}
+
+func (c *testConfig) GetWebhook() *conf.Webhook { return c.webhook }
+
+func (c *testConfig) SaveWebhook(config *conf.Webhook) error {
+	c.webhook = config
+	c.saved++
+	return nil
+}
+
+func TestServiceItems(t *testing.T) {
+	c := &testConfig{}
+	s := New(c)
+
+	item := &conf.WebhookItem{URL: "http://127.0.0.1/hook", Talker: "wxid_a"}
+	if err := s.AddItem(item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Type != TypeMessage || c.saved != 1 || len(c.webhook.Items) != 1 {
+		t.Fatalf("add: type %q, saved %d", item.Type, c.saved)
+	}
+	if err := s.AddItem(&conf.WebhookItem{URL: "http://127.0.0.1/hook", Talker: "wxid_a"}); errors.GetCode(err) != http.StatusConflict {
+		t.Fatalf("duplicate webhook should be rejected, got %v", err)
+	}
+	if err := s.AddItem(&conf.WebhookItem{URL: "ftp://127.0.0.1"}); err == nil {
+		t.Fatal("invalid url should be rejected")
+	}
+	if err := s.AddItem(&conf.WebhookItem{URL: "http://127.0.0.1", Type: "unknown"}); err == nil {
+		t.Fatal("invalid type should be rejected")
+	}
+
+	id := ItemID(item)
+	disabled := *item
+	disabled.Disabled = true
+	if err := s.UpdateItem(id, &disabled); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Item(id); err != nil || !got.Disabled {
+		t.Fatalf("update: %v", err)
+	}
+
+	if err := s.DeleteItem(id); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Items()) != 0 || c.saved != 3 {
+		t.Fatalf("delete: items %d, saved %d", len(s.Items()), c.saved)
+	}
+	if err := s.DeleteItem(id); errors.GetCode(err) != http.StatusNotFound {
+		t.Fatalf("deleted webhook should not be found, got %v", err)
+	}
+}
+
+type readOnlyConfig struct{}
+
+func (readOnlyConfig) GetWebhook() *conf.Webhook { return nil }
+
+func TestServiceItemsReadOnly(t *testing.T) {
+	s := New(readOnlyConfig{})
+	if err := s.AddItem(&conf.WebhookItem{URL: "http://127.0.0.1/hook"}); errors.GetCode(err) != http.StatusForbidden {
+		t.Fatalf("config that cannot be saved should be rejected, got %v", err)
+	}
+	if len(s.Items()) != 0 {
+		t.Fatal("rejected webhook should not be added")
+	}
+}
+
+func TestServiceTest(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		received <- body
+	}))
+	defer server.Close()
+
+	s := New(&testConfig{})
+	if err := s.Test(context.Background(), &conf.WebhookItem{URL: server.URL, Preset: PresetSlack}); err != nil {
+		t.Fatal(err)
+	}
+	body := <-received
+	if _, ok := body["text"].(string); !ok {
+		t.Fatalf("unexpected test payload: %v", body)
+	}
+	if len(s.Dispatcher().Deliveries("")) != 0 {
+		t.Fatal("test request should not be saved")
+	}
+}
+
+type testHook struct {
+	events chan fsnotify.Event
+	closed bool
+}
+
+func (h *testHook) Do(event fsnotify.Event) { h.events <- event }
+
+func (h *testHook) Close() { h.closed = true }
+
+func TestGroupSetHooks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	old := &testHook{events: make(chan fsnotify.Event, 1)}
+	g := NewGroup(ctx, TypeMessage, []Webhook{old}, 0)
+	g.Callback(fsnotify.Event{Op: fsnotify.Write})
+	select {
+	case <-old.events:
+	case <-time.After(time.Second):
+		t.Fatal("hook not called")
+	}
+
+	hook := &testHook{events: make(chan fsnotify.Event, 1)}
+	g.SetHooks([]Webhook{hook})
+	if !old.closed {
+		t.Fatal("replaced hook should be closed")
+	}
+	g.Callback(fsnotify.Event{Op: fsnotify.Write})
+	select {
+	case <-hook.events:
+	case <-time.After(time.Second):
+		t.Fatal("new hook not called")
+	}
+	select {
+	case <-old.events:
+		t.Fatal("replaced hook should not be called")
+	default:
+	}
+}
+
+func TestCheckRemoteTarget(t *testing.T) {
+	for url, ok := range map[string]bool{
+		"https://example.com/hook": true,
+		"http://127.0.0.1:8080":    true,
+		"mqtts://broker:8883":      true,
+		"file:///etc/profile":      false,
+		"unix:///run/docker.sock":  false,
+		"stdout:":                  false,
+		"ftp://example.com":        false,
+	} {
+		if err := CheckRemoteTarget(url); (err == nil) != ok {
+			t.Errorf("%s: %v", url, err)
+		}
+	}
+}
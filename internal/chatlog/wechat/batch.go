@@ -0,0 +1,302 @@
+package wechat
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/pkg/filemonitor"
+)
+
+// DefaultDecryptWorkers 默认的并发解密数
+var DefaultDecryptWorkers = min(runtime.NumCPU(), 4)
+
+// 单个文件的处理结果
+const (
+	DecryptStatusDecrypted = "decrypted"
+	DecryptStatusSkipped   = "skipped"
+	DecryptStatusFailed    = "failed"
+)
+
+// 解密事件类型
+const (
+	DecryptEventProgress = "progress"
+	DecryptEventReport   = "report"
+)
+
+// DecryptWorkersConfig 可选的并发解密配置，由 ServerConfig 实现
+type DecryptWorkersConfig interface {
+	GetDecryptWorkers() int
+}
+
+// FileStateConfig 可选，保存上次成功解密时各数据库文件的大小与修改时间
+type FileStateConfig interface {
+	GetFiles() []conf.File
+	SetFiles(files []conf.File)
+}
+
+// DecryptProgress 批量解密进度，File 等字段描述刚处理完的文件
+type DecryptProgress struct {
+	Running   bool   `json:"running"`
+	Total     int    `json:"total"`
+	Done      int    `json:"done"`
+	Decrypted int    `json:"decrypted"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+	File      string `json:"file,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DecryptFailure 解密失败的文件及原因
+type DecryptFailure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// DecryptReport 批量解密结果
+type DecryptReport struct {
+	Total     int              `json:"total"`
+	Decrypted int              `json:"decrypted"`
+	Skipped   int              `json:"skipped"`
+	Failures  []DecryptFailure `json:"failures"`
+	StartTime time.Time        `json:"start_time"`
+	EndTime   time.Time        `json:"end_time"`
+}
+
+// DecryptEvent 推送给订阅方的解密事件
+type DecryptEvent struct {
+	Type     string           `json:"type"`
+	Progress *DecryptProgress `json:"progress,omitempty"`
+	Report   *DecryptReport   `json:"report,omitempty"`
+}
+
+// DecryptDBFiles 并发解密数据目录下的所有数据库
+// 大小与修改时间（包括 WAL）与上次成功解密时一致的文件直接跳过，
+// 单个文件失败不影响其余文件，失败原因汇总在 LastDecryptReport 中
+func (s *Service) DecryptDBFiles() error {
+	s.batchMutex.Lock()
+	defer s.batchMutex.Unlock()
+
+	dataDir := s.conf.GetDataDir()
+	dbGroup, err := filemonitor.NewFileGroup("wechat", dataDir, `.*\.db$`, []string{"fts"})
+	if err != nil {
+		return err
+	}
+
+	dbFiles, err := dbGroup.List()
+	if err != nil {
+		return err
+	}
+
+	report := &DecryptReport{Total: len(dbFiles), Failures: []DecryptFailure{}, StartTime: time.Now()}
+	progress := DecryptProgress{Running: true, Total: len(dbFiles)}
+	s.publishProgress(progress)
+
+	workers := s.decryptWorkers()
+	jobs := make(chan string)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dbFile := range jobs {
+				stamps, status, err := s.decryptIfChanged(dbFile)
+
+				mutex.Lock()
+				progress.Done++
+				progress.File = relPath(dataDir, dbFile)
+				progress.Status = status
+				progress.Error = ""
+				switch status {
+				case DecryptStatusDecrypted:
+					progress.Decrypted++
+					s.saveStamps(stamps)
+				case DecryptStatusSkipped:
+					progress.Skipped++
+				case DecryptStatusFailed:
+					progress.Failed++
+					progress.Error = err.Error()
+					report.Failures = append(report.Failures, DecryptFailure{File: progress.File, Error: progress.Error})
+					log.Warn().Err(err).Msgf("decrypt %s failed", dbFile)
+				}
+				s.publishProgress(progress)
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, dbFile := range dbFiles {
+		jobs <- dbFile
+	}
+	close(jobs)
+	wg.Wait()
+
+	report.Decrypted = progress.Decrypted
+	report.Skipped = progress.Skipped
+	report.EndTime = time.Now()
+
+	progress.Running = false
+	s.publishProgress(progress)
+	s.publishReport(report)
+	s.persistStamps()
+
+	log.Info().Msgf("decrypt finished, total %d, decrypted %d, skipped %d, failed %d, cost %s",
+		report.Total, report.Decrypted, report.Skipped, len(report.Failures), report.EndTime.Sub(report.StartTime))
+	return nil
+}
+
+// decryptIfChanged 文件未变化且输出存在时跳过，否则解密，返回解密前记录的文件状态
+func (s *Service) decryptIfChanged(dbFile string) ([]conf.File, string, error) {
+	stamps := []conf.File{statFile(dbFile), statFile(dbFile + common.WALSuffix)}
+	if s.unchanged(stamps) {
+		if _, err := os.Stat(s.outputPath(dbFile)); err == nil {
+			return nil, DecryptStatusSkipped, nil
+		}
+	}
+	if err := s.DecryptDBFile(dbFile); err != nil {
+		return nil, DecryptStatusFailed, err
+	}
+	return stamps, DecryptStatusDecrypted, nil
+}
+
+func statFile(path string) conf.File {
+	f := conf.File{Path: path}
+	if stat, err := os.Stat(path); err == nil {
+		f.ModifiedTime = stat.ModTime().UnixNano()
+		f.Size = stat.Size()
+	}
+	return f
+}
+
+func (s *Service) unchanged(stamps []conf.File) bool {
+	s.stampMutex.Lock()
+	defer s.stampMutex.Unlock()
+	s.loadStampsLocked()
+	for _, stamp := range stamps {
+		if prev, ok := s.stamps[stamp.Path]; !ok || prev != stamp {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) saveStamps(stamps []conf.File) {
+	s.stampMutex.Lock()
+	defer s.stampMutex.Unlock()
+	s.loadStampsLocked()
+	for _, stamp := range stamps {
+		s.stamps[stamp.Path] = stamp
+	}
+}
+
+// resetStamps 清空文件状态，输出格式变化（如工作目录密钥变化）后所有文件都需重新解密
+func (s *Service) resetStamps() {
+	s.stampMutex.Lock()
+	defer s.stampMutex.Unlock()
+	s.stamps = make(map[string]conf.File)
+}
+
+func (s *Service) loadStampsLocked() {
+	if s.stamps != nil {
+		return
+	}
+	s.stamps = make(map[string]conf.File)
+	if c, ok := s.conf.(FileStateConfig); ok {
+		for _, f := range c.GetFiles() {
+			s.stamps[f.Path] = f
+		}
+	}
+}
+
+func (s *Service) persistStamps() {
+	c, ok := s.conf.(FileStateConfig)
+	if !ok {
+		return
+	}
+	s.stampMutex.Lock()
+	files := make([]conf.File, 0, len(s.stamps))
+	for _, f := range s.stamps {
+		files = append(files, f)
+	}
+	s.stampMutex.Unlock()
+	c.SetFiles(files)
+}
+
+func (s *Service) decryptWorkers() int {
+	if c, ok := s.conf.(DecryptWorkersConfig); ok && c.GetDecryptWorkers() > 0 {
+		return c.GetDecryptWorkers()
+	}
+	return DefaultDecryptWorkers
+}
+
+func (s *Service) outputPath(dbFile string) string {
+	return filepath.Join(s.conf.GetWorkDir(), dbFile[len(s.conf.GetDataDir()):])
+}
+
+func relPath(dir, path string) string {
+	return strings.TrimLeft(strings.TrimPrefix(path, dir), `/\`)
+}
+
+// SubscribeDecryptEvents 订阅解密进度与结果，返回的函数用于取消订阅
+// 订阅方处理过慢时丢弃事件，不阻塞解密
+func (s *Service) SubscribeDecryptEvents() (<-chan DecryptEvent, func()) {
+	ch := make(chan DecryptEvent, 64)
+	s.eventMutex.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.eventMutex.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.eventMutex.Lock()
+			delete(s.subscribers, ch)
+			s.eventMutex.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// DecryptProgress 返回最近一次批量解密的进度
+func (s *Service) DecryptProgress() DecryptProgress {
+	s.eventMutex.Lock()
+	defer s.eventMutex.Unlock()
+	return s.progress
+}
+
+// LastDecryptReport 返回最近一次批量解密的结果，尚未执行时返回 nil
+func (s *Service) LastDecryptReport() *DecryptReport {
+	s.eventMutex.Lock()
+	defer s.eventMutex.Unlock()
+	return s.report
+}
+
+func (s *Service) publishProgress(progress DecryptProgress) {
+	s.eventMutex.Lock()
+	defer s.eventMutex.Unlock()
+	s.progress = progress
+	s.publishLocked(DecryptEvent{Type: DecryptEventProgress, Progress: &progress})
+}
+
+func (s *Service) publishReport(report *DecryptReport) {
+	s.eventMutex.Lock()
+	defer s.eventMutex.Unlock()
+	s.report = report
+	s.publishLocked(DecryptEvent{Type: DecryptEventReport, Report: report})
+}
+
+func (s *Service) publishLocked(event DecryptEvent) {
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package wechat
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+)
+
+type testConfig struct {
+	dataDir string
+	workDir string
+	dataKey string
+	files   []conf.File
+}
+
+func (c *testConfig) GetDataKey() string         { return c.dataKey }
+func (c *testConfig) GetDataDir() string         { return c.dataDir }
+func (c *testConfig) GetWorkDir() string         { return c.workDir }
+func (c *testConfig) GetPlatform() string        { return "darwin" }
+func (c *testConfig) GetVersion() int            { return 3 }
+func (c *testConfig) GetDecryptWorkers() int     { return 2 }
+func (c *testConfig) GetFiles() []conf.File      { return c.files }
+func (c *testConfig) SetFiles(files []conf.File) { c.files = files }
+
+func TestDecryptDBFiles(t *testing.T) {
+	key := make([]byte, common.KeySize)
+	rand.Read(key)
+	c := &testConfig{dataDir: t.TempDir(), workDir: t.TempDir(), dataKey: hex.EncodeToString(key)}
+
+	// 未加密的数据库直接复制，无法解密的文件记入失败列表
+	plain := append([]byte(common.SQLiteHeader), bytes.Repeat([]byte{1}, 2048-len(common.SQLiteHeader))...)
+	bad := make([]byte, 2048)
+	rand.Read(bad)
+	files := map[string][]byte{"a.db": plain, "sub/b.db": plain, "c.db": plain, "bad.db": bad}
+	for name, data := range files {
+		path := filepath.Join(c.dataDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewService(c)
+	events, cancel := s.SubscribeDecryptEvents()
+	defer cancel()
+
+	if err := s.DecryptDBFiles(); err != nil {
+		t.Fatal(err)
+	}
+	report := s.LastDecryptReport()
+	if report.Total != 4 || report.Decrypted != 3 || report.Skipped != 0 || len(report.Failures) != 1 || report.Failures[0].File != "bad.db" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(c.workDir, "sub", "b.db")); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.files) == 0 {
+		t.Fatalf("file states not saved")
+	}
+
+	progress := 0
+	for len(events) > 0 {
+		if event := <-events; event.Type == DecryptEventProgress {
+			progress++
+		}
+	}
+	// 开始、每个文件、结束各一次
+	if progress != 6 {
+		t.Fatalf("expected 6 progress events, got %d", progress)
+	}
+
+	// 未变化的文件跳过，失败的文件重试
+	if err := s.DecryptDBFiles(); err != nil {
+		t.Fatal(err)
+	}
+	report = s.LastDecryptReport()
+	if report.Decrypted != 0 || report.Skipped != 3 || len(report.Failures) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// 新的 Service 从配置中恢复文件状态
+	if err := NewService(c).DecryptDBFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(c.dataDir, "a.db"), append(plain, plain...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DecryptDBFiles(); err != nil {
+		t.Fatal(err)
+	}
+	report = s.LastDecryptReport()
+	if report.Decrypted != 1 || report.Skipped != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -5,15 +5,18 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
 
+	"github.com/sjzar/chatlog/internal/chatlog/conf"
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/wechat"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
 	"github.com/sjzar/chatlog/pkg/filemonitor"
 	"github.com/sjzar/chatlog/pkg/util"
 )
@@ -29,6 +32,19 @@ type Service struct {
 	pendingActions map[string]bool
 	mutex          sync.Mutex
 	fm             *filemonitor.FileMonitor
+	decryptor      *decrypt.IncrementalDecryptor
+	outputKey      string
+
+	// 批量解密串行执行，stamps 为上次成功解密时的文件状态
+	batchMutex sync.Mutex
+	stampMutex sync.Mutex
+	stamps     map[string]conf.File
+
+	// 解密进度与结果的订阅
+	eventMutex  sync.Mutex
+	subscribers map[chan DecryptEvent]struct{}
+	progress    DecryptProgress
+	report      *DecryptReport
 }
 
 type Config interface {
@@ -39,11 +55,18 @@ type Config interface {
 	GetVersion() int
 }
 
+// AtRestConfig 可选的工作目录加密配置，由 ServerConfig 实现
+type AtRestConfig interface {
+	IsEncryptWorkDir() bool
+	GetWorkKey() string
+}
+
 func NewService(conf Config) *Service {
 	return &Service{
 		conf:           conf,
 		lastEvents:     make(map[string]time.Time),
 		pendingActions: make(map[string]bool),
+		subscribers:    make(map[chan DecryptEvent]struct{}),
 	}
 }
 
@@ -69,7 +92,8 @@ func (s *Service) GetDataKey(info *wechat.Account) (string, error) {
 
 func (s *Service) StartAutoDecrypt() error {
 	log.Info().Msgf("start auto decrypt, data dir: %s", s.conf.GetDataDir())
-	dbGroup, err := filemonitor.NewFileGroup("wechat", s.conf.GetDataDir(), `.*\.db$`, []string{"fts"})
+	// 同时监听 WAL 文件，新消息在检查点之前只写入 WAL
+	dbGroup, err := filemonitor.NewFileGroup("wechat", s.conf.GetDataDir(), `.*\.db(-wal)?$`, []string{"fts"})
 	if err != nil {
 		return err
 	}
@@ -107,13 +131,16 @@ func (s *Service) DecryptFileCallback(event fsnotify.Event) error {
 		return nil
 	}
 
+	// WAL 变化时随主库一起解密，WAL 中已提交的页面会回放到明文数据库
+	dbFile := strings.TrimSuffix(event.Name, common.WALSuffix)
+
 	s.mutex.Lock()
-	s.lastEvents[event.Name] = time.Now()
+	s.lastEvents[dbFile] = time.Now()
 
-	if !s.pendingActions[event.Name] {
-		s.pendingActions[event.Name] = true
+	if !s.pendingActions[dbFile] {
+		s.pendingActions[dbFile] = true
 		s.mutex.Unlock()
-		go s.waitAndProcess(event.Name)
+		go s.waitAndProcess(dbFile)
 	} else {
 		s.mutex.Unlock()
 	}
@@ -145,61 +172,74 @@ func (s *Service) waitAndProcess(dbFile string) {
 
 func (s *Service) DecryptDBFile(dbFile string) error {
 
-	decryptor, err := decrypt.NewDecryptor(s.conf.GetPlatform(), s.conf.GetVersion())
+	decryptor, err := s.getDecryptor()
 	if err != nil {
 		return err
 	}
 
-	output := filepath.Join(s.conf.GetWorkDir(), dbFile[len(s.conf.GetDataDir()):])
+	output := s.outputPath(dbFile)
 	if err := util.PrepareDir(filepath.Dir(output)); err != nil {
 		return err
 	}
 
-	outputTemp := output + ".tmp"
-	outputFile, err := os.Create(outputTemp)
+	stats, err := decryptor.Decrypt(context.Background(), dbFile, s.conf.GetDataKey(), output)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
-	}
-	defer func() {
-		outputFile.Close()
-		if err := os.Rename(outputTemp, output); err != nil {
-			log.Debug().Err(err).Msgf("failed to rename %s to %s", outputTemp, output)
-		}
-	}()
-
-	if err := decryptor.Decrypt(context.Background(), dbFile, s.conf.GetDataKey(), outputFile); err != nil {
 		if err == errors.ErrAlreadyDecrypted {
-			if data, err := os.ReadFile(dbFile); err == nil {
-				outputFile.Write(data)
-			}
-			return nil
+			return s.copyDBFile(dbFile, output)
 		}
 		log.Err(err).Msgf("failed to decrypt %s", dbFile)
 		return err
 	}
 
-	log.Debug().Msgf("Decrypted %s to %s", dbFile, output)
+	log.Debug().Msgf("Decrypted %s to %s, pages %d/%d, wal pages %d, full %v", dbFile, output, stats.ChangedPages, stats.TotalPages, stats.WALPages, stats.Full)
 
 	return nil
 }
 
-func (s *Service) DecryptDBFiles() error {
-	dbGroup, err := filemonitor.NewFileGroup("wechat", s.conf.GetDataDir(), `.*\.db$`, []string{"fts"})
+// getDecryptor 返回当前平台与版本对应的增量解密器，平台或版本变化时重新创建
+// 启用工作目录加密时，解密结果以工作目录密钥重新加密，尚未解锁时返回 ErrWorkDirLocked
+func (s *Service) getDecryptor() (*decrypt.IncrementalDecryptor, error) {
+	decryptor, err := decrypt.NewDecryptor(s.conf.GetPlatform(), s.conf.GetVersion())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	dbFiles, err := dbGroup.List()
-	if err != nil {
-		return err
+	var workKey string
+	if c, ok := s.conf.(AtRestConfig); ok && c.IsEncryptWorkDir() {
+		if workKey = c.GetWorkKey(); workKey == "" {
+			return nil, errors.ErrWorkDirLocked
+		}
 	}
 
-	for _, dbFile := range dbFiles {
-		if err := s.DecryptDBFile(dbFile); err != nil {
-			log.Debug().Msgf("DecryptDBFile %s failed: %v", dbFile, err)
-			continue
-		}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.decryptor == nil || s.decryptor.Decryptor().GetVersion() != decryptor.GetVersion() {
+		s.decryptor = decrypt.NewIncrementalDecryptor(decryptor)
+	}
+	if err := s.decryptor.SetOutputKey(workKey); err != nil {
+		return nil, err
+	}
+	if workKey != s.outputKey {
+		s.outputKey = workKey
+		s.resetStamps()
 	}
+	return s.decryptor, nil
+}
 
+// copyDBFile 数据库未加密时直接复制，并清理残留的页面指纹
+func (s *Service) copyDBFile(dbFile, output string) error {
+	data, err := os.ReadFile(dbFile)
+	if err != nil {
+		return err
+	}
+	outputTemp := output + ".tmp"
+	if err := os.WriteFile(outputTemp, data, 0644); err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	if err := os.Rename(outputTemp, output); err != nil {
+		log.Debug().Err(err).Msgf("failed to rename %s to %s", outputTemp, output)
+		return err
+	}
+	os.Remove(output + decrypt.PageStateSuffix)
 	return nil
 }
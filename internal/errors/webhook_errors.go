@@ -0,0 +1,20 @@
+package errors
+
+import "net/http"
+
+var (
+	ErrWebhookExists   = New(nil, http.StatusConflict, "webhook already exists").WithStack()
+	ErrWebhookReadOnly = New(nil, http.StatusForbidden, "webhook config cannot be saved in server mode, edit the config file instead").WithStack()
+)
+
+func WebhookNotFound(id string) *Error {
+	return Newf(nil, http.StatusNotFound, "webhook not found: %s", id).WithStack()
+}
+
+func WebhookLocalTarget(scheme string) *Error {
+	return Newf(nil, http.StatusForbidden, "webhook url scheme %s can only be set in the config file", scheme).WithStack()
+}
+
+func WebhookLocalFile(field string) *Error {
+	return Newf(nil, http.StatusForbidden, "webhook %s reads a local file and can only be set in the config file", field).WithStack()
+}
@@ -14,6 +14,9 @@ var (
 	ErrValidatorNotSet               = New(nil, http.StatusBadRequest, "validator not set")
 	ErrNoValidKey                    = New(nil, http.StatusBadRequest, "no valid key found")
 	ErrWeChatDLLNotFound             = New(nil, http.StatusBadRequest, "WeChatWin.dll module not found")
+	ErrVFSUnsupported                = New(nil, http.StatusNotImplemented, "sqlite vfs not supported in this build")
+	ErrIncorrectPassphrase           = New(nil, http.StatusUnauthorized, "incorrect work dir passphrase")
+	ErrWorkDirLocked                 = New(nil, http.StatusServiceUnavailable, "work dir is encrypted, unlock it with the passphrase first")
 )
 
 func PlatformUnsupported(platform string, version int) *Error {
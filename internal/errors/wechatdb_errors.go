@@ -10,6 +10,7 @@ var (
 	ErrKeyEmpty        = New(nil, http.StatusBadRequest, "key empty").WithStack()
 	ErrMediaNotFound   = New(nil, http.StatusNotFound, "media not found").WithStack()
 	ErrAvatarNotFound  = New(nil, http.StatusNotFound, "avatar not found").WithStack()
+	ErrSnsUnsupported  = New(nil, http.StatusNotImplemented, "sns not supported").WithStack()
 	ErrKeyLengthMust32 = New(nil, http.StatusBadRequest, "key length must be 32 bytes").WithStack()
 )
 
@@ -62,6 +63,10 @@ func ContactNotFound(key string) *Error {
 	return Newf(nil, http.StatusNotFound, "contact not found: %s", key).WithStack()
 }
 
+func SnsPostNotFound(id string) *Error {
+	return Newf(nil, http.StatusNotFound, "sns post not found: %s", id).WithStack()
+}
+
 func InitCacheFailed(cause error) *Error {
 	return New(cause, http.StatusInternalServerError, "init cache failed").WithStack()
 }
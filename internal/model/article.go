@@ -0,0 +1,68 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// Article 公众号推送中的单篇文章
+type Article struct {
+	Account     string    `json:"account"`     // 公众号 ID，gh_ 开头
+	AccountName string    `json:"accountName"` // 公众号名称
+	Title       string    `json:"title"`
+	Digest      string    `json:"digest,omitempty"`
+	URL         string    `json:"url"`
+	Cover       string    `json:"cover,omitempty"`
+	PublishTime time.Time `json:"publishTime"`
+	Seq         int64     `json:"seq"` // 所属推送消息的 seq
+}
+
+// IsOfficialAccount 判断是否为公众号
+func IsOfficialAccount(userName string) bool {
+	return strings.HasPrefix(userName, "gh_")
+}
+
+// parseArticles 将 mmreader 中的文章列表转换为 Article，pub_time 缺失时使用消息时间
+func parseArticles(m *Message, reader *MMReader) []*Article {
+	account := reader.Publisher.UserName
+	if account == "" {
+		account = m.Talker
+	}
+	accountName := reader.Publisher.NickName
+	if accountName == "" {
+		accountName = reader.Category.Name
+	}
+
+	articles := make([]*Article, 0, len(reader.Category.Items))
+	for _, item := range reader.Category.Items {
+		title := strings.TrimSpace(item.Title)
+		url := strings.TrimSpace(item.URL)
+		if title == "" && url == "" {
+			continue
+		}
+		publishTime := m.Time
+		if item.PubTime > 0 {
+			publishTime = time.Unix(item.PubTime, 0)
+		}
+		articles = append(articles, &Article{
+			Account:     account,
+			AccountName: accountName,
+			Title:       title,
+			Digest:      strings.TrimSpace(item.Digest),
+			URL:         url,
+			Cover:       strings.TrimSpace(item.Cover),
+			PublishTime: publishTime,
+			Seq:         m.Seq,
+		})
+	}
+	return articles
+}
+
+// Articles 返回消息中解析出的公众号文章
+func (m *Message) Articles() []*Article {
+	if m.Contents == nil {
+		return nil
+	}
+	articles, _ := m.Contents["articles"].([]*Article)
+	return articles
+}
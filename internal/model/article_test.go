@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseArticles(t *testing.T) {
+	content := `<msg><appmsg><title>第一篇</title><des>摘要一</des><type>5</type><url>https://mp.weixin.qq.com/s/a</url>` +
+		`<mmreader><category type="20" count="2"><name>示例公众号</name>` +
+		`<item><title>第一篇</title><url>https://mp.weixin.qq.com/s/a</url><digest>摘要一</digest><cover>https://example.com/a.jpg</cover><pub_time>1700000000</pub_time></item>` +
+		`<item><title>第二篇</title><url>https://mp.weixin.qq.com/s/b</url></item>` +
+		`</category><publisher><username>gh_demo</username><nickname>示例公众号</nickname></publisher></mmreader></appmsg></msg>`
+
+	m := &Message{Seq: 42, Time: time.Unix(1700000100, 0), Talker: "gh_demo", Type: MessageTypeShare}
+	if err := m.ParseMediaInfo(content); err != nil {
+		t.Fatalf("ParseMediaInfo: %v", err)
+	}
+
+	articles := m.Articles()
+	if len(articles) != 2 {
+		t.Fatalf("got %d articles, want 2", len(articles))
+	}
+	if a := articles[0]; a.Account != "gh_demo" || a.AccountName != "示例公众号" || a.Title != "第一篇" ||
+		a.Cover == "" || a.PublishTime.Unix() != 1700000000 || a.Seq != 42 {
+		t.Errorf("unexpected first article: %+v", a)
+	}
+	// pub_time 缺失时使用消息时间
+	if a := articles[1]; a.Title != "第二篇" || !a.PublishTime.Equal(m.Time) {
+		t.Errorf("unexpected second article: %+v", a)
+	}
+}
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// ChatRoomEventJoin 成员加入（邀请、扫码等）
+	ChatRoomEventJoin = "join"
+
+	// ChatRoomEventLeave 成员主动退出
+	ChatRoomEventLeave = "leave"
+
+	// ChatRoomEventKick 成员被移出群聊
+	ChatRoomEventKick = "kick"
+
+	// ChatRoomEventOwner 群主变更
+	ChatRoomEventOwner = "owner"
+
+	// ChatRoomEventRename 修改群名
+	ChatRoomEventRename = "rename"
+)
+
+// ChatRoomSelf 系统消息中以“你”指代当前账号
+const ChatRoomSelf = "你"
+
+// ChatRoomEvent 由群聊系统消息解析得到的成员变动 / 改名事件
+type ChatRoomEvent struct {
+	Seq      int64          `json:"seq"`
+	Time     time.Time      `json:"time"`
+	Type     string         `json:"type"`
+	Operator *ChatRoomUser  `json:"operator,omitempty"` // 操作人：邀请人、移出人、改名人
+	Members  []ChatRoomUser `json:"members,omitempty"`  // 受影响的成员
+	Name     string         `json:"name,omitempty"`     // 新群名，仅 rename
+	Content  string         `json:"content"`            // 原始系统消息文本
+}
+
+// ChatRoomHistory 群聊成员与群名时间线
+// At 非零时，Members 为按时间线回溯得到的该时刻成员列表
+type ChatRoomHistory struct {
+	Name     string           `json:"name"`
+	NickName string           `json:"nickName"`
+	Events   []*ChatRoomEvent `json:"events"`
+	At       time.Time        `json:"at,omitempty"`
+	Members  []ChatRoomUser   `json:"members,omitempty"`
+}
+
+var (
+	chatRoomQuote = `["“”]`
+	chatRoomActor = `(?:` + ChatRoomSelf + `|` + chatRoomQuote + `(.+?)` + chatRoomQuote + `)`
+
+	chatRoomRenamePattern  = regexp.MustCompile(`^` + chatRoomActor + `修改群名为` + chatRoomQuote + `(.*)` + chatRoomQuote + `$`)
+	chatRoomOwnerPattern   = regexp.MustCompile(`^` + chatRoomActor + `已成为新群主`)
+	chatRoomKickPattern    = regexp.MustCompile(`^` + chatRoomActor + `将` + chatRoomQuote + `(.+?)` + chatRoomQuote + `移出了群聊`)
+	chatRoomInvitePattern  = regexp.MustCompile(`^` + chatRoomActor + `邀请` + chatRoomActor + `加入了群聊`)
+	chatRoomQRCodePattern  = regexp.MustCompile(`^` + chatRoomActor + `通过扫描` + chatRoomActor + `分享的二维码加入群聊`)
+	chatRoomViaPattern     = regexp.MustCompile(`^` + chatRoomActor + `通过` + chatRoomActor + `的邀请二维码加入群聊`)
+	chatRoomLeavePattern   = regexp.MustCompile(`^` + chatRoomActor + `(?:已)?退出了群聊`)
+	chatRoomJoinPattern    = regexp.MustCompile(`^` + chatRoomActor + `加入了群聊`)
+	chatRoomProfilePattern = regexp.MustCompile(`^(.*)\(([^()]+)\)$`)
+)
+
+// ParseChatRoomEvent 将群聊系统消息解析为成员变动事件，无法识别时返回 nil
+func ParseChatRoomEvent(m *Message) *ChatRoomEvent {
+	if m == nil || m.Type != MessageTypeSystem {
+		return nil
+	}
+	content := strings.TrimSpace(m.Content)
+	if content == "" {
+		return nil
+	}
+
+	ev := &ChatRoomEvent{
+		Seq:     m.Seq,
+		Time:    m.Time,
+		Content: content,
+	}
+
+	switch {
+	case chatRoomRenamePattern.MatchString(content):
+		match := chatRoomRenamePattern.FindStringSubmatch(content)
+		ev.Type = ChatRoomEventRename
+		ev.Operator = parseChatRoomActor(match[1])
+		ev.Name = match[2]
+	case chatRoomOwnerPattern.MatchString(content):
+		match := chatRoomOwnerPattern.FindStringSubmatch(content)
+		ev.Type = ChatRoomEventOwner
+		ev.Members = []ChatRoomUser{*parseChatRoomActor(match[1])}
+	case chatRoomKickPattern.MatchString(content):
+		match := chatRoomKickPattern.FindStringSubmatch(content)
+		ev.Type = ChatRoomEventKick
+		ev.Operator = parseChatRoomActor(match[1])
+		ev.Members = parseChatRoomMembers(match[2])
+	case chatRoomInvitePattern.MatchString(content):
+		match := chatRoomInvitePattern.FindStringSubmatch(content)
+		ev.Type = ChatRoomEventJoin
+		ev.Operator = parseChatRoomActor(match[1])
+		ev.Members = parseChatRoomActorList(match[2])
+	case chatRoomQRCodePattern.MatchString(content):
+		match := chatRoomQRCodePattern.FindStringSubmatch(content)
+		ev.Type = ChatRoomEventJoin
+		ev.Operator = parseChatRoomActor(match[2])
+		ev.Members = parseChatRoomActorList(match[1])
+	case chatRoomViaPattern.MatchString(content):
+		match := chatRoomViaPattern.FindStringSubmatch(content)
+		ev.Type = ChatRoomEventJoin
+		ev.Operator = parseChatRoomActor(match[2])
+		ev.Members = parseChatRoomActorList(match[1])
+	case chatRoomLeavePattern.MatchString(content):
+		match := chatRoomLeavePattern.FindStringSubmatch(content)
+		ev.Type = ChatRoomEventLeave
+		ev.Members = parseChatRoomActorList(match[1])
+	case chatRoomJoinPattern.MatchString(content):
+		match := chatRoomJoinPattern.FindStringSubmatch(content)
+		ev.Type = ChatRoomEventJoin
+		ev.Members = parseChatRoomActorList(match[1])
+	default:
+		return nil
+	}
+
+	return ev
+}
+
+// parseChatRoomActor 解析单个操作人，空字符串表示正则中匹配到的“你”
+func parseChatRoomActor(s string) *ChatRoomUser {
+	if s == "" {
+		return &ChatRoomUser{DisplayName: ChatRoomSelf}
+	}
+	user := parseChatRoomProfile(s)
+	return &user
+}
+
+func parseChatRoomActorList(s string) []ChatRoomUser {
+	if s == "" {
+		return []ChatRoomUser{{DisplayName: ChatRoomSelf}}
+	}
+	return parseChatRoomMembers(s)
+}
+
+// parseChatRoomMembers 解析以“、”分隔的成员列表
+func parseChatRoomMembers(s string) []ChatRoomUser {
+	parts := strings.Split(s, "、")
+	users := make([]ChatRoomUser, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		users = append(users, parseChatRoomProfile(part))
+	}
+	return users
+}
+
+// parseChatRoomProfile 解析 sysmsgtemplate 渲染出的 nickname(username) 形式
+func parseChatRoomProfile(s string) ChatRoomUser {
+	if match := chatRoomProfilePattern.FindStringSubmatch(s); match != nil && !strings.ContainsAny(match[2], " \t") {
+		return ChatRoomUser{UserName: match[2], DisplayName: match[1]}
+	}
+	return ChatRoomUser{DisplayName: s}
+}
+
+// ResolveSelf 将事件中的“你”关联到当前账号的 userName，使 MembersAt 能匹配到账号自身的加入与移出
+func (h *ChatRoomHistory) ResolveSelf(userName string) {
+	if userName == "" {
+		return
+	}
+	for _, ev := range h.Events {
+		if ev.Operator != nil && ev.Operator.UserName == "" && ev.Operator.DisplayName == ChatRoomSelf {
+			ev.Operator.UserName = userName
+		}
+		for i := range ev.Members {
+			if ev.Members[i].UserName == "" && ev.Members[i].DisplayName == ChatRoomSelf {
+				ev.Members[i].UserName = userName
+			}
+		}
+	}
+}
+
+// MembersAt 以当前成员列表为起点，逆序回放 at 之后的事件，得到 at 时刻的成员列表
+func (h *ChatRoomHistory) MembersAt(at time.Time, current []ChatRoomUser) []ChatRoomUser {
+	members := make([]ChatRoomUser, len(current))
+	copy(members, current)
+
+	for i := len(h.Events) - 1; i >= 0; i-- {
+		ev := h.Events[i]
+		if !ev.Time.After(at) {
+			break
+		}
+		switch ev.Type {
+		case ChatRoomEventJoin:
+			for _, user := range ev.Members {
+				members = removeChatRoomUser(members, user)
+			}
+		case ChatRoomEventLeave, ChatRoomEventKick:
+			for _, user := range ev.Members {
+				if indexChatRoomUser(members, user) < 0 {
+					members = append(members, user)
+				}
+			}
+		}
+	}
+
+	return members
+}
+
+func indexChatRoomUser(users []ChatRoomUser, user ChatRoomUser) int {
+	for i, u := range users {
+		if user.UserName != "" {
+			if u.UserName == user.UserName {
+				return i
+			}
+			continue
+		}
+		if user.DisplayName != "" && u.DisplayName == user.DisplayName {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeChatRoomUser(users []ChatRoomUser, user ChatRoomUser) []ChatRoomUser {
+	if i := indexChatRoomUser(users, user); i >= 0 {
+		return append(users[:i], users[i+1:]...)
+	}
+	return users
+}
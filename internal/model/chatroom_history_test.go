@@ -0,0 +1,173 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseChatRoomEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantType string
+		operator string
+		members  []ChatRoomUser
+		newName  string
+	}{
+		{
+			name:     "invite template",
+			content:  `"张三(wxid_a)"邀请"李四(wxid_b)、王五(wxid_c)"加入了群聊`,
+			wantType: ChatRoomEventJoin,
+			operator: "wxid_a",
+			members:  []ChatRoomUser{{UserName: "wxid_b", DisplayName: "李四"}, {UserName: "wxid_c", DisplayName: "王五"}},
+		},
+		{
+			name:     "self invite plain",
+			content:  `你邀请"李四"加入了群聊`,
+			wantType: ChatRoomEventJoin,
+			operator: ChatRoomSelf,
+			members:  []ChatRoomUser{{DisplayName: "李四"}},
+		},
+		{
+			name:     "qrcode",
+			content:  `"李四"通过扫描"张三"分享的二维码加入群聊`,
+			wantType: ChatRoomEventJoin,
+			operator: "张三",
+			members:  []ChatRoomUser{{DisplayName: "李四"}},
+		},
+		{
+			name:     "kick",
+			content:  `你将"李四"移出了群聊`,
+			wantType: ChatRoomEventKick,
+			operator: ChatRoomSelf,
+			members:  []ChatRoomUser{{DisplayName: "李四"}},
+		},
+		{
+			name:     "leave",
+			content:  `"李四"退出了群聊`,
+			wantType: ChatRoomEventLeave,
+			members:  []ChatRoomUser{{DisplayName: "李四"}},
+		},
+		{
+			name:     "rename",
+			content:  `"张三"修改群名为“周末羽毛球”`,
+			wantType: ChatRoomEventRename,
+			operator: "张三",
+			newName:  "周末羽毛球",
+		},
+		{
+			name:     "owner",
+			content:  `"李四"已成为新群主`,
+			wantType: ChatRoomEventOwner,
+			members:  []ChatRoomUser{{DisplayName: "李四"}},
+		},
+		{
+			name:    "unrelated",
+			content: "以下为新消息",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := ParseChatRoomEvent(&Message{Type: MessageTypeSystem, Content: tt.content})
+			if tt.wantType == "" {
+				if ev != nil {
+					t.Fatalf("ParseChatRoomEvent() = %+v, want nil", ev)
+				}
+				return
+			}
+			if ev == nil {
+				t.Fatalf("ParseChatRoomEvent() = nil, want %s", tt.wantType)
+			}
+			if ev.Type != tt.wantType {
+				t.Errorf("Type = %s, want %s", ev.Type, tt.wantType)
+			}
+			if tt.operator != "" {
+				if ev.Operator == nil {
+					t.Fatalf("Operator = nil, want %s", tt.operator)
+				}
+				got := ev.Operator.UserName
+				if got == "" {
+					got = ev.Operator.DisplayName
+				}
+				if got != tt.operator {
+					t.Errorf("Operator = %s, want %s", got, tt.operator)
+				}
+			}
+			if len(ev.Members) != len(tt.members) {
+				t.Fatalf("Members = %+v, want %+v", ev.Members, tt.members)
+			}
+			for i := range tt.members {
+				if ev.Members[i] != tt.members[i] {
+					t.Errorf("Members[%d] = %+v, want %+v", i, ev.Members[i], tt.members[i])
+				}
+			}
+			if ev.Name != tt.newName {
+				t.Errorf("Name = %s, want %s", ev.Name, tt.newName)
+			}
+		})
+	}
+}
+
+func TestChatRoomHistoryMembersAt(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 12, 0, 0, 0, time.Local) }
+	history := &ChatRoomHistory{
+		Events: []*ChatRoomEvent{
+			{Time: day(2), Type: ChatRoomEventJoin, Members: []ChatRoomUser{{UserName: "b"}}},
+			{Time: day(4), Type: ChatRoomEventKick, Members: []ChatRoomUser{{UserName: "c"}}},
+			{Time: day(6), Type: ChatRoomEventJoin, Members: []ChatRoomUser{{UserName: "d"}}},
+		},
+	}
+	current := []ChatRoomUser{{UserName: "a"}, {UserName: "b"}, {UserName: "d"}}
+
+	tests := []struct {
+		at   time.Time
+		want []string
+	}{
+		{day(1), []string{"a", "c"}},
+		{day(3), []string{"a", "b", "c"}},
+		{day(5), []string{"a", "b"}},
+		{day(7), []string{"a", "b", "d"}},
+	}
+	for _, tt := range tests {
+		got := history.MembersAt(tt.at, current)
+		names := make(map[string]bool, len(got))
+		for _, u := range got {
+			names[u.UserName] = true
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("MembersAt(%s) = %+v, want %v", tt.at.Format("01-02"), got, tt.want)
+			continue
+		}
+		for _, name := range tt.want {
+			if !names[name] {
+				t.Errorf("MembersAt(%s) missing %s, got %+v", tt.at.Format("01-02"), name, got)
+			}
+		}
+	}
+	if len(current) != 3 {
+		t.Errorf("MembersAt modified current list: %+v", current)
+	}
+}
+
+func TestChatRoomHistoryResolveSelf(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 12, 0, 0, 0, time.Local) }
+	history := &ChatRoomHistory{}
+	for _, content := range []string{`"张三"邀请你加入了群聊`, `你将"李四(wxid_b)"移出了群聊`} {
+		ev := ParseChatRoomEvent(&Message{Type: MessageTypeSystem, Content: content})
+		if ev == nil {
+			t.Fatalf("parse %s failed", content)
+		}
+		history.Events = append(history.Events, ev)
+	}
+	history.Events[0].Time, history.Events[1].Time = day(2), day(4)
+	history.ResolveSelf("wxid_self")
+
+	if op := history.Events[1].Operator; op == nil || op.UserName != "wxid_self" {
+		t.Fatalf("operator not resolved: %+v", op)
+	}
+	current := []ChatRoomUser{{UserName: "wxid_self"}, {UserName: "wxid_a"}}
+	if got := history.MembersAt(day(1), current); len(got) != 2 || got[0].UserName != "wxid_a" || got[1].UserName != "wxid_b" {
+		t.Errorf("MembersAt = %+v, want wxid_a, wxid_b", got)
+	}
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Emoticon 动画表情（贴纸）信息，来自本地表情数据库
+type Emoticon struct {
+	MD5         string `json:"md5"`
+	Caption     string `json:"caption,omitempty"`
+	ProductID   string `json:"productId,omitempty"`   // 表情包 ID，自定义表情为空
+	PackageName string `json:"packageName,omitempty"` // 表情包名称
+	CdnURL      string `json:"cdnUrl,omitempty"`
+	EncryptURL  string `json:"encryptUrl,omitempty"` // 加密 CDN 地址，需配合 AesKey 解密
+	AesKey      string `json:"-"`
+	Data        []byte `json:"-"` // 部分版本直接将表情内容存储在数据库中
+}
+
+// StickerUsage 表情使用统计
+type StickerUsage struct {
+	MD5         string `json:"md5"`
+	Count       int64  `json:"count"`
+	PackageName string `json:"packageName,omitempty"`
+}
+
+// CREATE TABLE kNonStoreEmoticonTable(
+// type INTEGER,
+// md5 TEXT,
+// caption TEXT,
+// product_id TEXT,
+// aes_key TEXT,
+// thumb_url TEXT,
+// tp_url TEXT,
+// auth_key TEXT,
+// cdn_url TEXT,
+// extern_url TEXT,
+// extern_md5 TEXT,
+// encrypt_url TEXT,
+// ...
+// )
+type EmoticonV4 struct {
+	MD5         string `json:"md5"`
+	Caption     string `json:"caption"`
+	ProductID   string `json:"product_id"`
+	PackageName string `json:"package_name_"` // kStoreEmoticonPackageTable.package_name_
+	CdnURL      string `json:"cdn_url"`
+	EncryptURL  string `json:"encrypt_url"`
+	AesKey      string `json:"aes_key"`
+}
+
+func (e *EmoticonV4) Wrap() *Emoticon {
+	return &Emoticon{
+		MD5:         strings.ToLower(e.MD5),
+		Caption:     e.Caption,
+		ProductID:   e.ProductID,
+		PackageName: e.PackageName,
+		CdnURL:      e.CdnURL,
+		EncryptURL:  e.EncryptURL,
+		AesKey:      e.AesKey,
+	}
+}
+
+// CREATE TABLE CustomEmotion(
+// MD5 TEXT PRIMARY KEY,
+// ProductId TEXT,
+// CDNUrl TEXT,
+// Designerid TEXT,
+// ThumbUrl TEXT,
+// EncryptUrl TEXT,
+// AesKey TEXT,
+// Data BLOB,
+// ...
+// )
+// CREATE TABLE EmotionItem(ProductId TEXT, MD5 TEXT, Type INTEGER, Thumb BLOB, Data BLOB, ...)
+// CREATE TABLE EmotionPackageItem(ProductId TEXT, Name TEXT, ...)
+type EmoticonV3 struct {
+	MD5         string `json:"MD5"`
+	ProductID   string `json:"ProductId"`
+	PackageName string `json:"Name"`
+	CdnURL      string `json:"CDNUrl"`
+	EncryptURL  string `json:"EncryptUrl"`
+	AesKey      string `json:"AesKey"`
+	Data        []byte `json:"Data"`
+}
+
+func (e *EmoticonV3) Wrap() *Emoticon {
+	return &Emoticon{
+		MD5:         strings.ToLower(e.MD5),
+		ProductID:   e.ProductID,
+		PackageName: e.PackageName,
+		CdnURL:      e.CdnURL,
+		EncryptURL:  e.EncryptURL,
+		AesKey:      e.AesKey,
+		Data:        e.Data,
+	}
+}
+
+var emojiMD5Pattern = regexp.MustCompile(`(?i)\bmd5\s*=\s*"([0-9a-f]{32})"`)
+
+// EmojiMD5 从动画表情消息的原始 XML 中提取 md5，用于统计时避免完整解析
+func EmojiMD5(content string) string {
+	if match := emojiMD5Pattern.FindStringSubmatch(content); match != nil {
+		return strings.ToLower(match[1])
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package model
+
+import "testing"
+
+func TestEmojiMD5(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "emoji",
+			content: `<msg><emoji fromusername="wxid_a" type="2" md5="0123456789ABCDEF0123456789abcdef" len="1024" cdnurl="http://example.com/a"/></msg>`,
+			want:    "0123456789abcdef0123456789abcdef",
+		},
+		{
+			name:    "externmd5 first",
+			content: `<msg><emoji externmd5="ffffffffffffffffffffffffffffffff" md5 = "00000000000000000000000000000001"/></msg>`,
+			want:    "00000000000000000000000000000001",
+		},
+		{
+			name:    "invalid md5",
+			content: `<msg><emoji md5="xyz"/></msg>`,
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tt := range tests {
+		if got := EmojiMD5(tt.content); got != tt.want {
+			t.Errorf("%s: EmojiMD5() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package model
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+const (
+	FavoriteTypeNote     = "note"
+	FavoriteTypeImage    = "image"
+	FavoriteTypeVoice    = "voice"
+	FavoriteTypeVideo    = "video"
+	FavoriteTypeLink     = "link"
+	FavoriteTypeLocation = "location"
+	FavoriteTypeFile     = "file"
+	FavoriteTypeChat     = "chat"
+	FavoriteTypeOther    = "other"
+)
+
+// FavoriteTypeOf 将收藏类型编号转换为类型名称
+// 1 文本 2 图片 3 语音 4 视频 5 链接 6 位置 8 文件 14 聊天记录 18 笔记
+func FavoriteTypeOf(t int) string {
+	switch t {
+	case 1, 18:
+		return FavoriteTypeNote
+	case 2:
+		return FavoriteTypeImage
+	case 3:
+		return FavoriteTypeVoice
+	case 4:
+		return FavoriteTypeVideo
+	case 5:
+		return FavoriteTypeLink
+	case 6:
+		return FavoriteTypeLocation
+	case 8:
+		return FavoriteTypeFile
+	case 14:
+		return FavoriteTypeChat
+	default:
+		return FavoriteTypeOther
+	}
+}
+
+// Favorite 收藏条目
+type Favorite struct {
+	ID      int64          `json:"id"`
+	Type    string         `json:"type"`
+	RawType int            `json:"rawType"`
+	Time    time.Time      `json:"time"`
+	From    string         `json:"from,omitempty"`   // 原消息发送者
+	Talker  string         `json:"talker,omitempty"` // 原消息所在会话
+	Title   string         `json:"title,omitempty"`
+	Content string         `json:"content,omitempty"`
+	URL     string         `json:"url,omitempty"`
+	Items   []FavoriteItem `json:"items,omitempty"`
+}
+
+// FavoriteItem 收藏内的数据项（图片、文件、笔记片段等）
+type FavoriteItem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title,omitempty"`
+	Desc   string `json:"desc,omitempty"`
+	Format string `json:"format,omitempty"`
+	URL    string `json:"url,omitempty"`
+	MD5    string `json:"md5,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// SearchText 返回用于全文检索的文本
+func (f *Favorite) SearchText() string {
+	parts := []string{f.Title, f.Content, f.URL}
+	for _, item := range f.Items {
+		parts = append(parts, item.Title, item.Desc)
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(p)
+		}
+	}
+	return b.String()
+}
+
+// PlainText 单行文本表示，用于 text/csv 输出
+func (f *Favorite) PlainText() string {
+	text := f.Title
+	if f.Content != "" && f.Content != f.Title {
+		if text != "" {
+			text += " "
+		}
+		text += f.Content
+	}
+	if f.URL != "" {
+		text += " " + f.URL
+	}
+	for _, item := range f.Items {
+		if item.Title != "" && item.Title != f.Title {
+			text += " [" + item.Title + "]"
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// FavItemXML 收藏内容 XML，根节点为 favitem，
+// 包含 desc、source、datalist/dataitem、weburlitem、locitem 等子节点
+type FavItemXML struct {
+	XMLName xml.Name `xml:"favitem"`
+	Type    int      `xml:"type,attr"`
+	Title   string   `xml:"title"`
+	Desc    string   `xml:"desc"`
+	Source  struct {
+		FromUsr      string `xml:"fromusr"`
+		RealChatName string `xml:"realchatname"`
+		Link         string `xml:"link"`
+	} `xml:"source"`
+	DataList struct {
+		Items []struct {
+			DataType  int    `xml:"datatype,attr"`
+			DataTitle string `xml:"datatitle"`
+			DataDesc  string `xml:"datadesc"`
+			DataFmt   string `xml:"datafmt"`
+			CdnURL    string `xml:"cdn_dataurl"`
+			StreamURL string `xml:"stream_weburl"`
+			FullMD5   string `xml:"fullmd5"`
+			FullSize  int64  `xml:"fullsize"`
+		} `xml:"dataitem"`
+	} `xml:"datalist"`
+	WebURLItem struct {
+		CleanURL  string `xml:"clean_url"`
+		PageTitle string `xml:"pagetitle"`
+		PageDesc  string `xml:"pagedesc"`
+	} `xml:"weburlitem"`
+	LocItem struct {
+		Label   string `xml:"label"`
+		PoiName string `xml:"poiname"`
+	} `xml:"locitem"`
+}
+
+// ParseFavorite 解析收藏内容 XML，填充标题、正文、链接与数据项
+// 解析失败时保留原始内容作为正文
+func ParseFavorite(f *Favorite, content string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+	var x FavItemXML
+	if err := xml.Unmarshal([]byte(content), &x); err != nil {
+		f.Content = content
+		return
+	}
+
+	if x.Type != 0 && f.RawType == 0 {
+		f.RawType = x.Type
+		f.Type = FavoriteTypeOf(x.Type)
+	}
+	if f.From == "" {
+		f.From = x.Source.FromUsr
+	}
+	if f.Talker == "" {
+		f.Talker = x.Source.RealChatName
+	}
+
+	f.Title = strings.TrimSpace(x.Title)
+	f.Content = strings.TrimSpace(x.Desc)
+	f.URL = strings.TrimSpace(x.Source.Link)
+
+	if x.WebURLItem.CleanURL != "" {
+		f.URL = x.WebURLItem.CleanURL
+	}
+	if f.Title == "" {
+		f.Title = strings.TrimSpace(x.WebURLItem.PageTitle)
+	}
+	if f.Content == "" {
+		f.Content = strings.TrimSpace(x.WebURLItem.PageDesc)
+	}
+	if f.Type == FavoriteTypeLocation && f.Content == "" {
+		f.Content = strings.TrimSpace(x.LocItem.PoiName + " " + x.LocItem.Label)
+	}
+
+	for _, item := range x.DataList.Items {
+		fi := FavoriteItem{
+			Type:   FavoriteTypeOf(item.DataType),
+			Title:  strings.TrimSpace(item.DataTitle),
+			Desc:   strings.TrimSpace(item.DataDesc),
+			Format: item.DataFmt,
+			URL:    item.CdnURL,
+			MD5:    item.FullMD5,
+			Size:   item.FullSize,
+		}
+		if fi.URL == "" {
+			fi.URL = item.StreamURL
+		}
+		f.Items = append(f.Items, fi)
+	}
+
+	if f.Title == "" && len(f.Items) > 0 {
+		f.Title = f.Items[0].Title
+	}
+	if f.Content == "" && len(f.Items) > 0 {
+		f.Content = f.Items[0].Desc
+	}
+}
+
+// CREATE TABLE fav_db_item(
+// local_id INTEGER PRIMARY KEY,
+// server_id INTEGER,
+// type INTEGER,
+// update_time INTEGER,
+// fromusr TEXT,
+// realchatname TEXT,
+// content TEXT,
+// ...
+// )
+type FavoriteV4 struct {
+	LocalID      int64  `json:"local_id"`
+	Type         int    `json:"type"`
+	UpdateTime   int64  `json:"update_time"`
+	FromUsr      string `json:"fromusr"`
+	RealChatName string `json:"realchatname"`
+	Content      string `json:"content"`
+}
+
+func (f *FavoriteV4) Wrap() *Favorite {
+	return wrapFavorite(f.LocalID, f.Type, f.UpdateTime, f.FromUsr, f.RealChatName, f.Content)
+}
+
+// CREATE TABLE FavItems(
+// FavLocalID INTEGER PRIMARY KEY,
+// SvrID INTEGER,
+// Type INTEGER,
+// UpdateTime INTEGER,
+// FromUser TEXT,
+// RealChatName TEXT,
+// XmlBuf TEXT,
+// ...
+// )
+type FavoriteV3 struct {
+	FavLocalID   int64  `json:"FavLocalID"`
+	Type         int    `json:"Type"`
+	UpdateTime   int64  `json:"UpdateTime"`
+	FromUser     string `json:"FromUser"`
+	RealChatName string `json:"RealChatName"`
+	XmlBuf       string `json:"XmlBuf"`
+}
+
+func (f *FavoriteV3) Wrap() *Favorite {
+	return wrapFavorite(f.FavLocalID, f.Type, f.UpdateTime, f.FromUser, f.RealChatName, f.XmlBuf)
+}
+
+// CREATE TABLE FavoritesItemTable(
+// localId INTEGER PRIMARY KEY,
+// serverId INTEGER,
+// type INTEGER,
+// updateTime INTEGER,
+// fromUsr TEXT,
+// realChatName TEXT,
+// content TEXT,
+// ...
+// )
+type FavoriteDarwinV3 struct {
+	LocalID      int64  `json:"localId"`
+	Type         int    `json:"type"`
+	UpdateTime   int64  `json:"updateTime"`
+	FromUsr      string `json:"fromUsr"`
+	RealChatName string `json:"realChatName"`
+	Content      string `json:"content"`
+}
+
+func (f *FavoriteDarwinV3) Wrap() *Favorite {
+	return wrapFavorite(f.LocalID, f.Type, f.UpdateTime, f.FromUsr, f.RealChatName, f.Content)
+}
+
+func wrapFavorite(id int64, t int, updateTime int64, from, talker, content string) *Favorite {
+	f := &Favorite{
+		ID:      id,
+		Type:    FavoriteTypeOf(t),
+		RawType: t,
+		Time:    time.Unix(updateTime, 0),
+		From:    from,
+		Talker:  talker,
+	}
+	ParseFavorite(f, content)
+	return f
+}
+
+// MatchFavorite 判断收藏是否符合类型与关键词筛选条件
+func MatchFavorite(f *Favorite, _type, keyword string) bool {
+	if _type != "" && f.Type != _type {
+		return false
+	}
+	if keyword == "" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(f.SearchText()), strings.ToLower(keyword))
+}
+
+// FilterFavorites 按类型、关键词筛选收藏并分页，limit <= 0 表示不限制
+func FilterFavorites(list []*Favorite, _type, keyword string, limit, offset int) []*Favorite {
+	result := make([]*Favorite, 0, len(list))
+	for _, f := range list {
+		if MatchFavorite(f, _type, keyword) {
+			result = append(result, f)
+		}
+	}
+	if offset > 0 {
+		if offset >= len(result) {
+			return []*Favorite{}
+		}
+		result = result[offset:]
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package model
+
+import "testing"
+
+func TestParseFavorite(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawType int
+		content string
+		want    Favorite
+	}{
+		{
+			name:    "link",
+			rawType: 5,
+			content: `<favitem type="5"><source sourcetype="1"><fromusr>wxid_a</fromusr></source><weburlitem><clean_url>https://example.com/a</clean_url><pagetitle>标题</pagetitle><pagedesc>摘要</pagedesc></weburlitem></favitem>`,
+			want:    Favorite{Type: FavoriteTypeLink, From: "wxid_a", Title: "标题", Content: "摘要", URL: "https://example.com/a"},
+		},
+		{
+			name:    "note",
+			rawType: 1,
+			content: `<favitem type="1"><desc>记一下</desc></favitem>`,
+			want:    Favorite{Type: FavoriteTypeNote, Content: "记一下"},
+		},
+		{
+			name:    "file",
+			rawType: 8,
+			content: `<favitem type="8"><datalist count="1"><dataitem datatype="8"><datatitle>report.pdf</datatitle><datafmt>pdf</datafmt><fullsize>1024</fullsize></dataitem></datalist></favitem>`,
+			want:    Favorite{Type: FavoriteTypeFile, Title: "report.pdf"},
+		},
+		{
+			name:    "invalid xml",
+			rawType: 1,
+			content: `plain text`,
+			want:    Favorite{Type: FavoriteTypeNote, Content: "plain text"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := wrapFavorite(1, tt.rawType, 0, "", "", tt.content)
+			if f.Type != tt.want.Type || f.From != tt.want.From || f.Title != tt.want.Title ||
+				f.Content != tt.want.Content || f.URL != tt.want.URL {
+				t.Errorf("got %+v, want %+v", *f, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterFavorites(t *testing.T) {
+	list := []*Favorite{
+		{ID: 1, Type: FavoriteTypeNote, Content: "Hello 世界"},
+		{ID: 2, Type: FavoriteTypeLink, Title: "世界新闻"},
+		{ID: 3, Type: FavoriteTypeNote, Content: "other"},
+	}
+	if got := FilterFavorites(list, "", "世界", 0, 0); len(got) != 2 {
+		t.Errorf("keyword filter: got %d items, want 2", len(got))
+	}
+	if got := FilterFavorites(list, FavoriteTypeNote, "", 1, 1); len(got) != 1 || got[0].ID != 3 {
+		t.Errorf("type filter with paging: got %+v", got)
+	}
+}
@@ -0,0 +1,237 @@
+package model
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MentionAll 群聊中 @所有人 的文本，MentionsMe 同样视为提及自己
+const MentionAll = "@所有人"
+
+// Identity 当前登录账号，用于判断消息是否 @ 了自己
+type Identity struct {
+	UserName string `json:"userName"`
+	// Names 群聊中 @ 自己时可能使用的名称：昵称与各群的群昵称
+	Names []string `json:"names,omitempty"`
+}
+
+// MessageFilter 可组合的消息过滤条件
+// 同一层级的条件之间为 AND；All 中的子条件全部满足，Any 中的子条件至少满足一个
+// 用于 webhook 推送、搜索与 MCP 查询，零值匹配所有消息
+type MessageFilter struct {
+	// Types 消息类型，如 49 为分享类消息
+	Types []int64 `mapstructure:"types" json:"types,omitempty"`
+	// SubTypes 消息子类型，如 6 为文件、2000 为转账
+	SubTypes []int64 `mapstructure:"subtypes" json:"subtypes,omitempty"`
+	// Regex 匹配消息文本的正则表达式
+	Regex string `mapstructure:"regex" json:"regex,omitempty"`
+	// FromSelf 为 true 时只保留自己发送的消息，为 false 时排除自己发送的消息
+	FromSelf *bool `mapstructure:"from_self" json:"from_self,omitempty"`
+	// ChatRoomOnly 只保留群聊消息
+	ChatRoomOnly bool `mapstructure:"chatroom_only" json:"chatroom_only,omitempty"`
+	// PrivateOnly 只保留私聊消息
+	PrivateOnly bool `mapstructure:"private_only" json:"private_only,omitempty"`
+	// MentionsMe 只保留 @ 了自己的群聊消息
+	MentionsMe bool `mapstructure:"mentions_me" json:"mentions_me,omitempty"`
+	// ExcludeTalkers 排除的会话
+	ExcludeTalkers []string `mapstructure:"exclude_talkers" json:"exclude_talkers,omitempty"`
+
+	All []*MessageFilter `mapstructure:"all" json:"all,omitempty"`
+	Any []*MessageFilter `mapstructure:"any" json:"any,omitempty"`
+
+	regex *regexp.Regexp
+	self  *Identity
+}
+
+// Compile 编译正则表达式并设置当前账号，应在 Match 前调用
+func (f *MessageFilter) Compile(self *Identity) error {
+	if f == nil {
+		return nil
+	}
+	f.self = self
+	f.regex = nil
+	if f.Regex != "" {
+		re, err := regexp.Compile(f.Regex)
+		if err != nil {
+			return err
+		}
+		f.regex = re
+	}
+	for _, sub := range slices.Concat(f.All, f.Any) {
+		if err := sub.Compile(self); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsEmpty 是否没有任何条件
+func (f *MessageFilter) IsEmpty() bool {
+	return f == nil || (len(f.Types) == 0 && len(f.SubTypes) == 0 && f.Regex == "" && f.FromSelf == nil &&
+		!f.ChatRoomOnly && !f.PrivateOnly && !f.MentionsMe && len(f.ExcludeTalkers) == 0 &&
+		len(f.All) == 0 && len(f.Any) == 0)
+}
+
+// Match 消息是否满足过滤条件
+func (f *MessageFilter) Match(m *Message) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, m.Type) {
+		return false
+	}
+	if len(f.SubTypes) > 0 && !slices.Contains(f.SubTypes, m.SubType) {
+		return false
+	}
+	if f.FromSelf != nil && *f.FromSelf != m.IsSelf {
+		return false
+	}
+	if f.ChatRoomOnly && !m.IsChatRoom {
+		return false
+	}
+	if f.PrivateOnly && m.IsChatRoom {
+		return false
+	}
+	if slices.Contains(f.ExcludeTalkers, m.Talker) || (m.TalkerName != "" && slices.Contains(f.ExcludeTalkers, m.TalkerName)) {
+		return false
+	}
+	if f.MentionsMe && !f.self.Mentioned(m) {
+		return false
+	}
+	if f.regex != nil && !f.regex.MatchString(m.PlainTextContent()) {
+		return false
+	}
+	for _, sub := range f.All {
+		if !sub.Match(m) {
+			return false
+		}
+	}
+	if len(f.Any) > 0 {
+		for _, sub := range f.Any {
+			if sub.Match(m) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// FilterMessages 返回满足过滤条件的消息
+func (f *MessageFilter) FilterMessages(messages []*Message) []*Message {
+	if f.IsEmpty() {
+		return messages
+	}
+	ret := make([]*Message, 0, len(messages))
+	for _, m := range messages {
+		if f.Match(m) {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
+
+// Mentioned 群聊消息是否 @ 了当前账号，包括 @所有人
+// 微信以 "@名称" 加 U+2005 空格表示提及，这里按文本判断
+func (id *Identity) Mentioned(m *Message) bool {
+	if id == nil || !m.IsChatRoom || m.IsSelf {
+		return false
+	}
+	if m.Type != MessageTypeText && m.SubType != MessageSubTypeQuote {
+		return false
+	}
+	if strings.Contains(m.Content, MentionAll) {
+		return true
+	}
+	for _, name := range slices.Concat([]string{id.UserName}, id.Names) {
+		if name == "" {
+			continue
+		}
+		for i := 0; ; {
+			j := strings.Index(m.Content[i:], "@"+name)
+			if j < 0 {
+				break
+			}
+			end := i + j + len("@"+name)
+			if end == len(m.Content) || strings.HasPrefix(m.Content[end:], "\u2005") || m.Content[end] == ' ' {
+				return true
+			}
+			i = end
+		}
+	}
+	return false
+}
+
+// ParseInt64List 解析逗号分隔的整数列表
+func ParseInt64List(str string) ([]int64, error) {
+	ret := make([]int64, 0)
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+// v4AccountDirPattern 微信 4.x 账号目录为 "<微信 ID>_<4 位后缀>"
+var v4AccountDirPattern = regexp.MustCompile(`^(.+)_[0-9a-fA-F]{4}$`)
+
+// md5AccountDirPattern macOS 微信 3.x 账号目录为 32 位 md5
+var md5AccountDirPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// AccountUserName 由数据目录推断当前账号的微信 ID
+// macOS 微信 3.x 的账号目录是 md5 而不是微信 ID，无法推断时返回空字符串，见 AccountDirMD5
+func AccountUserName(dataDir string) string {
+	base := filepath.Base(filepath.Clean(dataDir))
+	if base == "." || base == string(filepath.Separator) {
+		return ""
+	}
+	if md5AccountDirPattern.MatchString(base) {
+		return ""
+	}
+	if strings.HasPrefix(strings.ToLower(base), "wxid_") {
+		rest := base[len("wxid_"):]
+		if i := strings.Index(rest, "_"); i >= 0 {
+			return base[:len("wxid_")+i]
+		}
+		return base
+	}
+	if match := v4AccountDirPattern.FindStringSubmatch(base); match != nil {
+		return match[1]
+	}
+	return base
+}
+
+// AccountDirMD5 返回 md5 形式的账号目录名，其他形式返回空字符串
+func AccountDirMD5(dataDir string) string {
+	base := filepath.Base(filepath.Clean(dataDir))
+	if md5AccountDirPattern.MatchString(base) {
+		return base
+	}
+	return ""
+}
+
+// UsesMentionsMe 条件中是否包含 mentions_me
+func (f *MessageFilter) UsesMentionsMe() bool {
+	if f == nil {
+		return false
+	}
+	if f.MentionsMe {
+		return true
+	}
+	for _, sub := range slices.Concat(f.All, f.Any) {
+		if sub.UsesMentionsMe() {
+			return true
+		}
+	}
+	return false
+}
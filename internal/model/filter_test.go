@@ -0,0 +1,63 @@
+package model
+
+import "testing"
+
+func TestMessageFilterMatch(t *testing.T) {
+	yes := true
+	self := &Identity{UserName: "wxid_me", Names: []string{"小明"}}
+	file := &Message{Talker: "1@chatroom", IsChatRoom: true, Type: MessageTypeShare, SubType: MessageSubTypeFile}
+	pay := &Message{Talker: "wxid_a", Type: MessageTypeShare, SubType: MessageSubTypePay}
+	mine := &Message{Talker: "wxid_a", IsSelf: true, Type: MessageTypeText, Content: "hello"}
+	mention := &Message{Talker: "2@chatroom", TalkerName: "吵闹群", IsChatRoom: true, Type: MessageTypeText, Content: "@小明 开会了"}
+	prefix := &Message{Talker: "1@chatroom", IsChatRoom: true, Type: MessageTypeText, Content: "@小明明 在吗"}
+
+	tests := []struct {
+		name   string
+		filter *MessageFilter
+		want   []*Message
+	}{
+		{"empty", &MessageFilter{}, []*Message{file, pay, mine, mention, prefix}},
+		{"files or transfers", &MessageFilter{Types: []int64{49}, SubTypes: []int64{6, 2000}}, []*Message{file, pay}},
+		{"from self", &MessageFilter{FromSelf: &yes}, []*Message{mine}},
+		{"chatroom only", &MessageFilter{ChatRoomOnly: true}, []*Message{file, mention, prefix}},
+		{"private only", &MessageFilter{PrivateOnly: true}, []*Message{pay, mine}},
+		{"mentions me", &MessageFilter{MentionsMe: true}, []*Message{mention}},
+		{"exclude by name", &MessageFilter{ExcludeTalkers: []string{"吵闹群", "wxid_a"}}, []*Message{file, prefix}},
+		{"regex", &MessageFilter{Regex: `^hel+o$`}, []*Message{mine}},
+		{"any", &MessageFilter{Any: []*MessageFilter{{MentionsMe: true}, {SubTypes: []int64{6}}}}, []*Message{file, mention}},
+		{"all", &MessageFilter{ChatRoomOnly: true, All: []*MessageFilter{{Types: []int64{1}}}}, []*Message{mention, prefix}},
+	}
+	for _, tt := range tests {
+		if err := tt.filter.Compile(self); err != nil {
+			t.Fatal(err)
+		}
+		got := tt.filter.FilterMessages([]*Message{file, pay, mine, mention, prefix})
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d messages, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: message %d mismatch", tt.name, i)
+			}
+		}
+	}
+
+	if err := (&MessageFilter{Any: []*MessageFilter{{Regex: "("}}}).Compile(nil); err == nil {
+		t.Error("expected regex error")
+	}
+}
+
+func TestAccountUserName(t *testing.T) {
+	for dir, want := range map[string]string{
+		"/data/WeChat Files/wxid_abc123":                   "wxid_abc123",
+		"/data/xwechat_files/wxid_abc123_1a2b":             "wxid_abc123",
+		"/data/xwechat_files/custom_id_9f3c":               "custom_id",
+		"/data/WeChat Files/custom_id":                     "custom_id",
+		"/data/2.0b4.0.9/0123456789abcdef0123456789abcdef": "",
+	} {
+		if got := AccountUserName(dir); got != want {
+			t.Errorf("%s: got %s, want %s", dir, got, want)
+		}
+	}
+}
@@ -75,6 +75,7 @@ type App struct {
 	PatInfo           *PatInfo    `xml:"patinfo,omitempty"`           // type 62 拍一拍 v2
 	FinderLive        *FinderLive `xml:"finderLive,omitempty"`        // type 63 视频号直播
 	WCPayInfo         *WCPayInfo  `xml:"wcpayinfo,omitempty"`         // type 2000 微信转账
+	MMReader          *MMReader   `xml:"mmreader,omitempty"`          // 公众号图文推送
 }
 
 type Emoji struct {
@@ -88,7 +89,7 @@ type Emoji struct {
 	AesKey       string `xml:"aeskey,attr"`
 	Width        string `xml:"width,attr"`
 	Height       string `xml:"height,attr"`
-	// ProductId         string `xml:"productid,attr"`
+	ProductID    string `xml:"productid,attr"`
 	// AndroidMd5        string `xml:"androidmd5,attr"`
 	// AndroidLen        string `xml:"androidlen,attr"`
 	// S60v3Md5          string `xml:"s60v3md5,attr"`
@@ -129,6 +130,26 @@ type Location struct {
 	// IsFromPoiList   string `xml:"isFromPoiList,attr"`
 }
 
+// MMReader 公众号图文推送，一条推送可包含多篇文章
+type MMReader struct {
+	Category struct {
+		Name  string         `xml:"name"`
+		Items []MMReaderItem `xml:"item"`
+	} `xml:"category"`
+	Publisher struct {
+		UserName string `xml:"username"`
+		NickName string `xml:"nickname"`
+	} `xml:"publisher"`
+}
+
+type MMReaderItem struct {
+	Title   string `xml:"title"`
+	URL     string `xml:"url"`
+	Digest  string `xml:"digest"`
+	Cover   string `xml:"cover"`
+	PubTime int64  `xml:"pub_time"`
+}
+
 // ReferMsg 表示引用消息
 type ReferMsg struct {
 	Type        int64  `xml:"type"`
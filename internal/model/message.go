@@ -176,6 +176,12 @@ func (m *Message) ParseMediaInfo(data string) error {
 		}
 	case MessageTypeAnimation:
 		m.Contents["cdnurl"] = msg.Emoji.CdnURL
+		if msg.Emoji.Md5 != "" {
+			m.Contents["md5"] = strings.ToLower(msg.Emoji.Md5)
+		}
+		if msg.Emoji.ProductID != "" {
+			m.Contents["productid"] = msg.Emoji.ProductID
+		}
 	case MessageTypeLocation:
 		m.Contents["x"] = msg.Location.X
 		m.Contents["y"] = msg.Location.Y
@@ -183,6 +189,11 @@ func (m *Message) ParseMediaInfo(data string) error {
 		m.Contents["cityname"] = msg.Location.CityName
 	case MessageTypeShare:
 		m.SubType = int64(msg.App.Type)
+		if msg.App.MMReader != nil {
+			if articles := parseArticles(m, msg.App.MMReader); len(articles) > 0 {
+				m.Contents["articles"] = articles
+			}
+		}
 		switch m.SubType {
 		case MessageSubTypeText, MessageSubTypeLink, MessageSubTypeLink2:
 			// 链接
@@ -300,6 +311,14 @@ func (m *Message) ParseMediaInfo(data string) error {
 	return nil
 }
 
+// CursorSeq 用于记录推送进度的 seq，数据源未提供 seq 时以消息时间代替（同一秒内的消息无法区分）
+func (m *Message) CursorSeq() int64 {
+	if m.Seq > 0 {
+		return m.Seq
+	}
+	return m.Time.Unix() * 1000
+}
+
 func (m *Message) SetContent(key string, value interface{}) {
 	if m.Contents == nil {
 		m.Contents = make(map[string]interface{})
@@ -435,6 +454,10 @@ func (m *Message) PlainTextContent() string {
 		}
 		return fmt.Sprintf("![视频](http://%s/video/%s)", host, strings.Join(keylist, ","))
 	case MessageTypeAnimation:
+		// 优先走本地表情库，由服务端回退到 CDN
+		if md5, ok := m.Contents["md5"].(string); ok && md5 != "" {
+			return fmt.Sprintf("![动画表情](http://%s/emoji/%s)", host, md5)
+		}
 		if m.Contents["cdnurl"] != nil {
 			if cdnURL, ok := m.Contents["cdnurl"].(string); ok {
 				return fmt.Sprintf("![动画表情](%s)", cdnURL)
@@ -481,6 +504,13 @@ func (m *Message) PlainTextContent() string {
 			}
 			return fmt.Sprintf("[链接|%s]", title)
 		case MessageSubTypeLink, MessageSubTypeLink2:
+			if articles := m.Articles(); len(articles) > 1 {
+				lines := make([]string, 0, len(articles))
+				for _, a := range articles {
+					lines = append(lines, fmt.Sprintf("[链接|%s](%s)", a.Title, a.URL))
+				}
+				return strings.Join(lines, "\n")
+			}
 			return fmt.Sprintf("[链接|%s](%s)", m.Contents["title"], m.Contents["url"])
 		case MessageSubTypeFile:
 			return fmt.Sprintf("[文件|%s](http://%s/file/%s)", m.Contents["title"], host, m.Contents["md5"])
@@ -23,6 +23,7 @@ import (
 // ConBlob BLOB
 // )
 type MessageDarwinV3 struct {
+	MesLocalID    int64  `json:"mesLocalID"`
 	MsgCreateTime int64  `json:"msgCreateTime"`
 	MsgContent    string `json:"msgContent"`
 	MessageType   int64  `json:"messageType"`
@@ -31,7 +32,9 @@ type MessageDarwinV3 struct {
 
 func (m *MessageDarwinV3) Wrap(talker string) *Message {
 
+	// 表中没有 seq，按 10 位时间戳 + 3 位序号的格式由本地 ID 生成
 	_m := &Message{
+		Seq:        m.MsgCreateTime*1000 + m.MesLocalID%1000,
 		Time:       time.Unix(m.MsgCreateTime, 0),
 		Type:       m.MessageType,
 		Talker:     talker,
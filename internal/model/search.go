@@ -15,6 +15,8 @@ type SearchRequest struct {
 	End    time.Time `json:"end"`
 	Limit  int       `json:"limit"`
 	Offset int       `json:"offset"`
+	// Filter 可选：对命中的消息进一步过滤，需先调用 Compile
+	Filter *MessageFilter `json:"filter,omitempty"`
 }
 
 // Clone 生成请求的浅拷贝，便于在不同层级添加额外参数
@@ -37,7 +39,7 @@ type SearchHit struct {
 // SearchResponse 汇总搜索结果
 // DurationMs 统计搜索耗时（毫秒），仅供参考
 // Limit / Offset 为实际生效的分页参数
-// Hits 序列按相关度排序，命中数可能小于 limit（例如过滤后不足）
+// Hits 序列按相关度排序；有过滤条件时 Total 为过滤后的命中数
 type SearchResponse struct {
 	Total      int                `json:"total"`
 	Hits       []*SearchHit       `json:"hits"`
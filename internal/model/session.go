@@ -11,6 +11,8 @@ type Session struct {
 	NickName string    `json:"nickName"`
 	Content  string    `json:"content"`
 	NTime    time.Time `json:"nTime"`
+	// UnreadCount 未读消息数
+	UnreadCount int `json:"unreadCount"`
 }
 
 // CREATE TABLE Session(
@@ -37,13 +39,13 @@ type Session struct {
 // bytesXml BLOB
 // )
 type SessionV3 struct {
-	StrUsrName  string `json:"strUsrName"`
-	NOrder      int    `json:"nOrder"`
-	StrNickName string `json:"strNickName"`
-	StrContent  string `json:"strContent"`
-	NTime       int64  `json:"nTime"`
+	StrUsrName   string `json:"strUsrName"`
+	NOrder       int    `json:"nOrder"`
+	StrNickName  string `json:"strNickName"`
+	StrContent   string `json:"strContent"`
+	NTime        int64  `json:"nTime"`
+	NUnReadCount int    `json:"nUnReadCount"`
 
-	// NUnReadCount int    `json:"nUnReadCount"`
 	// ParentRef    string `json:"parentRef"`
 	// Reserved0    int    `json:"Reserved0"`
 	// Reserved1    string `json:"Reserved1"`
@@ -68,6 +70,8 @@ func (s *SessionV3) Wrap() *Session {
 		NickName: s.StrNickName,
 		Content:  s.StrContent,
 		NTime:    time.Unix(int64(s.NTime), 0),
+
+		UnreadCount: s.NUnReadCount,
 	}
 }
 
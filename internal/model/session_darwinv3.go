@@ -17,10 +17,10 @@ import "time"
 // _packed_MMSessionInfo BLOB
 // )
 type SessionDarwinV3 struct {
-	M_nsUserName string `json:"m_nsUserName"`
-	M_uLastTime  int    `json:"m_uLastTime"`
+	M_nsUserName   string `json:"m_nsUserName"`
+	M_uLastTime    int    `json:"m_uLastTime"`
+	M_uUnReadCount int    `json:"m_uUnReadCount"`
 
-	// M_uUnReadCount        int    `json:"m_uUnReadCount"`
 	// M_bShowUnReadAsRedDot int    `json:"m_bShowUnReadAsRedDot"`
 	// M_bMarkUnread         int    `json:"m_bMarkUnread"`
 	// StrRes1               string `json:"strRes1"`
@@ -37,5 +37,7 @@ func (s *SessionDarwinV3) Wrap() *Session {
 		UserName: s.M_nsUserName,
 		NOrder:   s.M_uLastTime,
 		NTime:    time.Unix(int64(s.M_uLastTime), 0),
+
+		UnreadCount: s.M_uUnReadCount,
 	}
 }
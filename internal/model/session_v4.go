@@ -28,9 +28,9 @@ type SessionV4 struct {
 	LastTimestamp         int    `json:"last_timestamp"`
 	LastMsgSender         string `json:"last_msg_sender"`
 	LastSenderDisplayName string `json:"last_sender_display_name"`
+	UnreadCount           int    `json:"unread_count"`
 
 	// Type                     int    `json:"type"`
-	// UnreadCount              int    `json:"unread_count"`
 	// UnreadFirstMsgSrvID      int    `json:"unread_first_msg_srv_id"`
 	// IsHidden                 int    `json:"is_hidden"`
 	// Draft                    string `json:"draft"`
@@ -50,5 +50,7 @@ func (s *SessionV4) Wrap() *Session {
 		NickName: s.LastSenderDisplayName,
 		Content:  s.Summary,
 		NTime:    time.Unix(int64(s.LastTimestamp), 0),
+
+		UnreadCount: s.UnreadCount,
 	}
 }
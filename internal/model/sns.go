@@ -0,0 +1,275 @@
+package model
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SnsMediaImage = "image"
+	SnsMediaVideo = "video"
+)
+
+// SnsPost 朋友圈动态
+type SnsPost struct {
+	ID       string       `json:"id"`
+	UserName string       `json:"userName"`
+	NickName string       `json:"nickName,omitempty"`
+	Time     time.Time    `json:"time"`
+	Content  string       `json:"content,omitempty"`
+	Location string       `json:"location,omitempty"`
+	Title    string       `json:"title,omitempty"` // 分享链接标题
+	URL      string       `json:"url,omitempty"`   // 分享链接
+	Media    []SnsMedia   `json:"media,omitempty"`
+	Likes    []SnsLike    `json:"likes,omitempty"`
+	Comments []SnsComment `json:"comments,omitempty"`
+}
+
+// SnsMedia 朋友圈图片 / 视频
+type SnsMedia struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	Thumb    string `json:"thumb,omitempty"`
+	MD5      string `json:"md5,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Duration int    `json:"duration,omitempty"` // 视频时长，秒
+	Key      string `json:"-"`
+	Token    string `json:"-"`
+}
+
+// SnsLike 点赞
+type SnsLike struct {
+	UserName string    `json:"userName"`
+	NickName string    `json:"nickName,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// SnsComment 评论
+type SnsComment struct {
+	UserName string    `json:"userName"`
+	NickName string    `json:"nickName,omitempty"`
+	Content  string    `json:"content"`
+	ReplyTo  string    `json:"replyTo,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// PlainText 单行文本表示，图片与视频以占位符链接呈现
+func (p *SnsPost) PlainText(host string) string {
+	if host == "" {
+		host = "127.0.0.1:5030"
+	}
+	parts := make([]string, 0, 2+len(p.Media))
+	if p.Content != "" {
+		parts = append(parts, p.Content)
+	}
+	if p.URL != "" {
+		parts = append(parts, fmt.Sprintf("[链接|%s](%s)", p.Title, p.URL))
+	}
+	for i, m := range p.Media {
+		label := "图片"
+		if m.Type == SnsMediaVideo {
+			label = "视频"
+		}
+		parts = append(parts, fmt.Sprintf("![%s](http://%s/sns/%s/%d)", label, host, p.ID, i))
+	}
+	return strings.Join(parts, " ")
+}
+
+// TimelineObject 朋友圈动态 XML
+type TimelineObject struct {
+	XMLName     xml.Name `xml:"TimelineObject"`
+	ID          string   `xml:"id"`
+	UserName    string   `xml:"username"`
+	CreateTime  int64    `xml:"createTime"`
+	ContentDesc string   `xml:"contentDesc"`
+	Location    struct {
+		PoiName string `xml:"poiName,attr"`
+		City    string `xml:"city,attr"`
+	} `xml:"location"`
+	ContentObject struct {
+		ContentStyle int    `xml:"contentStyle"`
+		Title        string `xml:"title"`
+		ContentURL   string `xml:"contentUrl"`
+		MediaList    struct {
+			Media []struct {
+				ID   string `xml:"id"`
+				Type int    `xml:"type"`
+				URL  struct {
+					Value string `xml:",chardata"`
+					MD5   string `xml:"md5,attr"`
+					Key   string `xml:"key,attr"`
+					Token string `xml:"token,attr"`
+				} `xml:"url"`
+				Thumb struct {
+					Value string `xml:",chardata"`
+				} `xml:"thumb"`
+				Size struct {
+					Width  string `xml:"width,attr"`
+					Height string `xml:"height,attr"`
+				} `xml:"size"`
+				VideoDuration string `xml:"videoDuration"`
+			} `xml:"media"`
+		} `xml:"mediaList"`
+	} `xml:"ContentObject"`
+	LikeUserList struct {
+		Users []struct {
+			UserName   string `xml:"username"`
+			NickName   string `xml:"nickname"`
+			CreateTime int64  `xml:"createTime"`
+		} `xml:"LikeUser"`
+	} `xml:"LikeUserList"`
+	CommentUserList struct {
+		Users []struct {
+			UserName    string `xml:"username"`
+			NickName    string `xml:"nickname"`
+			Content     string `xml:"content"`
+			RefUserName string `xml:"refUserName"`
+			CreateTime  int64  `xml:"createTime"`
+		} `xml:"CommentUser"`
+	} `xml:"CommentUserList"`
+}
+
+// ParseSnsPost 解析 TimelineObject XML
+func ParseSnsPost(id string, userName string, createTime int64, content string) (*SnsPost, error) {
+	post := &SnsPost{
+		ID:       id,
+		UserName: userName,
+		Time:     time.Unix(createTime, 0),
+	}
+
+	var obj TimelineObject
+	if err := xml.Unmarshal([]byte(strings.TrimSpace(content)), &obj); err != nil {
+		return nil, err
+	}
+
+	if post.UserName == "" {
+		post.UserName = obj.UserName
+	}
+	if createTime == 0 && obj.CreateTime != 0 {
+		post.Time = time.Unix(obj.CreateTime, 0)
+	}
+	post.Content = strings.TrimSpace(obj.ContentDesc)
+	post.Location = strings.TrimSpace(obj.Location.PoiName)
+	if post.Location == "" {
+		post.Location = strings.TrimSpace(obj.Location.City)
+	}
+
+	// contentStyle 3 为分享链接
+	if obj.ContentObject.ContentStyle == 3 {
+		post.Title = strings.TrimSpace(obj.ContentObject.Title)
+		post.URL = strings.TrimSpace(obj.ContentObject.ContentURL)
+	}
+
+	for _, m := range obj.ContentObject.MediaList.Media {
+		media := SnsMedia{
+			ID:    m.ID,
+			Type:  SnsMediaImage,
+			URL:   strings.TrimSpace(m.URL.Value),
+			Thumb: strings.TrimSpace(m.Thumb.Value),
+			MD5:   strings.ToLower(m.URL.MD5),
+			Key:   m.URL.Key,
+			Token: m.URL.Token,
+		}
+		// media type 6 为视频
+		if m.Type == 6 {
+			media.Type = SnsMediaVideo
+		}
+		media.Width, _ = strconv.Atoi(m.Size.Width)
+		media.Height, _ = strconv.Atoi(m.Size.Height)
+		if d, err := strconv.ParseFloat(m.VideoDuration, 64); err == nil {
+			media.Duration = int(d)
+		}
+		post.Media = append(post.Media, media)
+	}
+
+	for _, u := range obj.LikeUserList.Users {
+		post.Likes = append(post.Likes, SnsLike{UserName: u.UserName, NickName: u.NickName, Time: time.Unix(u.CreateTime, 0)})
+	}
+	for _, u := range obj.CommentUserList.Users {
+		post.Comments = append(post.Comments, SnsComment{
+			UserName: u.UserName,
+			NickName: u.NickName,
+			Content:  u.Content,
+			ReplyTo:  u.RefUserName,
+			Time:     time.Unix(u.CreateTime, 0),
+		})
+	}
+
+	return post, nil
+}
+
+// CREATE TABLE SnsTimeLine(
+// tid INTEGER PRIMARY KEY,
+// user_name TEXT,
+// content TEXT
+// )
+type SnsPostV4 struct {
+	TID      int64  `json:"tid"`
+	UserName string `json:"user_name"`
+	Content  string `json:"content"`
+}
+
+func (p *SnsPostV4) Wrap() (*SnsPost, error) {
+	// tid 为无符号 64 位 ID，按有符号存储
+	return ParseSnsPost(strconv.FormatUint(uint64(p.TID), 10), p.UserName, 0, p.Content)
+}
+
+// CREATE TABLE FeedsV20(
+// FeedId INTEGER,
+// CreateTime INTEGER,
+// FaultId INTEGER,
+// Type INTEGER,
+// UserName TEXT,
+// Status INTEGER,
+// ExtFlag INTEGER,
+// PrivFlag INTEGER,
+// StringId TEXT,
+// Content TEXT,
+// ...
+// )
+type SnsPostV3 struct {
+	FeedID     int64  `json:"FeedId"`
+	CreateTime int64  `json:"CreateTime"`
+	UserName   string `json:"UserName"`
+	Content    string `json:"Content"`
+}
+
+func (p *SnsPostV3) Wrap() (*SnsPost, error) {
+	return ParseSnsPost(strconv.FormatUint(uint64(p.FeedID), 10), p.UserName, p.CreateTime, p.Content)
+}
+
+// CREATE TABLE CommentV20(
+// FeedId INTEGER,
+// CommentId INTEGER,
+// CreateTime INTEGER,
+// CommentType INTEGER,
+// FromUserName TEXT,
+// Content TEXT,
+// RefUserName TEXT,
+// ...
+// )
+// CommentType 1 为点赞，2 为评论
+type SnsCommentV3 struct {
+	FeedID       int64  `json:"FeedId"`
+	CreateTime   int64  `json:"CreateTime"`
+	CommentType  int    `json:"CommentType"`
+	FromUserName string `json:"FromUserName"`
+	Content      string `json:"Content"`
+	RefUserName  string `json:"RefUserName"`
+}
+
+// Apply 将点赞 / 评论追加到动态上
+func (c *SnsCommentV3) Apply(post *SnsPost) {
+	t := time.Unix(c.CreateTime, 0)
+	switch c.CommentType {
+	case 1:
+		post.Likes = append(post.Likes, SnsLike{UserName: c.FromUserName, Time: t})
+	case 2:
+		post.Comments = append(post.Comments, SnsComment{UserName: c.FromUserName, Content: c.Content, ReplyTo: c.RefUserName, Time: t})
+	}
+}
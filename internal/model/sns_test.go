@@ -0,0 +1,38 @@
+package model
+
+import "testing"
+
+func TestParseSnsPost(t *testing.T) {
+	content := `<TimelineObject><id>13912345678901234567</id><username>wxid_a</username><createTime>1700000000</createTime>` +
+		`<contentDesc>周末爬山</contentDesc><location poiName="香山公园" city="北京"/>` +
+		`<ContentObject><contentStyle>1</contentStyle><mediaList>` +
+		`<media><id>1</id><type>2</type><url type="1" md5="ABCDEF" token="t1">http://example.com/a</url><thumb type="1">http://example.com/a/150</thumb><size width="1080" height="720"/></media>` +
+		`<media><id>2</id><type>6</type><url type="1">http://example.com/v</url><videoDuration>12.5</videoDuration></media>` +
+		`</mediaList></ContentObject>` +
+		`<LikeUserList><LikeUser><username>wxid_b</username><nickname>B</nickname><createTime>1700000100</createTime></LikeUser></LikeUserList>` +
+		`<CommentUserList><CommentUser><username>wxid_c</username><nickname>C</nickname><content>好看</content><createTime>1700000200</createTime></CommentUser></CommentUserList>` +
+		`</TimelineObject>`
+
+	post, err := ParseSnsPost("1", "", 0, content)
+	if err != nil {
+		t.Fatalf("ParseSnsPost: %v", err)
+	}
+	if post.UserName != "wxid_a" || post.Time.Unix() != 1700000000 || post.Content != "周末爬山" || post.Location != "香山公园" {
+		t.Errorf("unexpected post: %+v", post)
+	}
+	if len(post.Media) != 2 {
+		t.Fatalf("got %d media, want 2", len(post.Media))
+	}
+	if m := post.Media[0]; m.Type != SnsMediaImage || m.MD5 != "abcdef" || m.Token != "t1" || m.Width != 1080 {
+		t.Errorf("unexpected image: %+v", m)
+	}
+	if m := post.Media[1]; m.Type != SnsMediaVideo || m.Duration != 12 {
+		t.Errorf("unexpected video: %+v", m)
+	}
+	if len(post.Likes) != 1 || post.Likes[0].UserName != "wxid_b" {
+		t.Errorf("unexpected likes: %+v", post.Likes)
+	}
+	if len(post.Comments) != 1 || post.Comments[0].Content != "好看" {
+		t.Errorf("unexpected comments: %+v", post.Comments)
+	}
+}
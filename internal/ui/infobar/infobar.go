@@ -157,6 +157,13 @@ func New() *InfoBar {
 	)
 	table.SetCell(autoDecryptRow, valueCol1, tview.NewTableCell(""))
 
+	table.SetCell(
+		autoDecryptRow,
+		labelCol2,
+		tview.NewTableCell(fmt.Sprintf(" [%s::]%s", headerColor, "Decrypt:")),
+	)
+	table.SetCell(autoDecryptRow, valueCol2, tview.NewTableCell(""))
+
 	// infobar
 	infoBar := &InfoBar{
 		Box:   tview.NewBox(),
@@ -217,6 +224,11 @@ func (info *InfoBar) UpdateAutoDecrypt(text string) {
 	info.table.GetCell(autoDecryptRow, valueCol1).SetText(text)
 }
 
+// UpdateDecrypt updates batch decrypt progress value.
+func (info *InfoBar) UpdateDecrypt(text string) {
+	info.table.GetCell(autoDecryptRow, valueCol2).SetText(text)
+}
+
 // Draw draws this primitive onto the screen.
 func (info *InfoBar) Draw(screen tcell.Screen) {
 	info.Box.DrawForSubclass(screen, info)
@@ -5,6 +5,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"hash"
@@ -136,3 +137,81 @@ func DecryptPage(pageBuf []byte, encKey []byte, macKey []byte, pageNum int64, ha
 
 	return decryptedPage, nil
 }
+
+// PageDecryptor 持有已派生的加密密钥与 MAC 密钥，按页解密，
+// 用于增量解密等需要随机访问页面的场景
+type PageDecryptor struct {
+	EncKey   []byte
+	MacKey   []byte
+	HashFunc func() hash.Hash
+	HMACSize int
+	Reserve  int
+	PageSize int
+}
+
+// Decrypt 解密第 pageNum 页（从 0 开始），返回与明文数据库中对应位置等长的页面数据
+// 第 0 页会补上 SQLite 头，全零页面原样返回
+func (p *PageDecryptor) Decrypt(pageBuf []byte, pageNum int64) ([]byte, error) {
+	if IsZeroPage(pageBuf) {
+		return pageBuf, nil
+	}
+	data, err := DecryptPage(pageBuf, p.EncKey, p.MacKey, pageNum, p.HashFunc, p.HMACSize, p.Reserve, p.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	if pageNum == 0 {
+		return append([]byte(SQLiteHeader), data...), nil
+	}
+	return data, nil
+}
+
+// Encrypt 加密第 pageNum 页（从 0 开始）的明文，为 Decrypt 的逆过程，IV 随机生成
+// 第 0 页的 SQLite 头替换为 salt，页面预留区域写入 IV 与 HMAC
+func (p *PageDecryptor) Encrypt(plain []byte, pageNum int64, salt []byte) ([]byte, error) {
+	offset := 0
+	if pageNum == 0 {
+		offset = SaltSize
+	}
+	dataEnd := p.PageSize - p.Reserve
+
+	page := make([]byte, p.PageSize)
+	if pageNum == 0 {
+		copy(page, salt)
+	}
+	iv := page[dataEnd : dataEnd+IVSize]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(p.EncKey)
+	if err != nil {
+		return nil, errors.DecryptCreateCipherFailed(err)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(page[offset:dataEnd], plain[offset:dataEnd])
+
+	mac := hmac.New(p.HashFunc, p.MacKey)
+	mac.Write(page[offset : dataEnd+IVSize])
+	pageNoBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(pageNoBytes, uint32(pageNum+1))
+	mac.Write(pageNoBytes)
+	copy(page[dataEnd+IVSize:], mac.Sum(nil))
+
+	return page, nil
+}
+
+// PageTag 返回页面中存储的 HMAC，可作为加密页面的内容指纹
+// 页面内容或页号变化时 HMAC 随之变化，无需重新计算哈希
+func (p *PageDecryptor) PageTag(pageBuf []byte) []byte {
+	start := p.PageSize - p.Reserve + IVSize
+	return pageBuf[start : start+p.HMACSize]
+}
+
+// IsZeroPage 判断页面是否全为零
+func IsZeroPage(pageBuf []byte) bool {
+	for _, b := range pageBuf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
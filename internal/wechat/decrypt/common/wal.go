@@ -0,0 +1,94 @@
+package common
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+const (
+	WALSuffix          = "-wal"
+	WALHeaderSize      = 32
+	WALFrameHeaderSize = 24
+
+	walMagicLE = 0x377f0682
+	walMagicBE = 0x377f0683
+)
+
+// WALFrames WAL 中已提交的页面
+type WALFrames struct {
+	// Pages 页号（从 0 开始）到最新一次提交的加密页面
+	Pages map[int64][]byte
+	// DBSize 最后一次提交后数据库的页数
+	DBSize int64
+	// Frames 已提交的帧数
+	Frames int
+}
+
+// ReadWALFrames 读取 WAL 文件中已提交的帧
+// WAL 头与帧头为明文，帧内页面与主库页面使用相同的加密方式
+// 遇到 salt 不匹配（上一轮 WAL 的残留帧）或不完整的帧时停止，未提交的帧被丢弃
+// WAL 不存在或为空时返回 nil
+func ReadWALFrames(path string, pageSize int) (*WALFrames, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.OpenFileFailed(path, err)
+	}
+	defer fp.Close()
+
+	header := make([]byte, WALHeaderSize)
+	if _, err := io.ReadFull(fp, header); err != nil {
+		// WAL 在检查点后可能被截断为空
+		return nil, nil
+	}
+	magic := binary.BigEndian.Uint32(header[0:4])
+	if magic != walMagicLE && magic != walMagicBE {
+		return nil, nil
+	}
+	if int(binary.BigEndian.Uint32(header[8:12])) != pageSize {
+		return nil, nil
+	}
+	salt1 := binary.BigEndian.Uint32(header[16:20])
+	salt2 := binary.BigEndian.Uint32(header[20:24])
+
+	result := &WALFrames{Pages: make(map[int64][]byte)}
+	pending := make(map[int64][]byte)
+	pendingFrames := 0
+
+	frame := make([]byte, WALFrameHeaderSize+pageSize)
+	for {
+		if _, err := io.ReadFull(fp, frame); err != nil {
+			break
+		}
+		if binary.BigEndian.Uint32(frame[8:12]) != salt1 || binary.BigEndian.Uint32(frame[12:16]) != salt2 {
+			break
+		}
+		pgno := int64(binary.BigEndian.Uint32(frame[0:4]))
+		if pgno == 0 {
+			break
+		}
+		pending[pgno-1] = append([]byte(nil), frame[WALFrameHeaderSize:]...)
+		pendingFrames++
+
+		// 提交帧记录提交后的数据库页数
+		if dbSize := int64(binary.BigEndian.Uint32(frame[4:8])); dbSize > 0 {
+			for n, page := range pending {
+				result.Pages[n] = page
+			}
+			result.DBSize = dbSize
+			result.Frames += pendingFrames
+			pending = make(map[int64][]byte)
+			pendingFrames = 0
+		}
+	}
+
+	if result.Frames == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
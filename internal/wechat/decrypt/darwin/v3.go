@@ -164,6 +164,19 @@ func (d *V3Decryptor) Decrypt(ctx context.Context, dbfile string, hexKey string,
 	return nil
 }
 
+// NewPageDecryptor 根据密钥与数据库 salt 派生密钥，返回按页解密器
+func (d *V3Decryptor) NewPageDecryptor(key []byte, salt []byte) *common.PageDecryptor {
+	encKey, macKey := d.deriveKeys(key, salt)
+	return &common.PageDecryptor{
+		EncKey:   encKey,
+		MacKey:   macKey,
+		HashFunc: d.hashFunc,
+		HMACSize: d.hmacSize,
+		Reserve:  d.reserve,
+		PageSize: d.pageSize,
+	}
+}
+
 // GetPageSize 返回页面大小
 func (d *V3Decryptor) GetPageSize() int {
 	return d.pageSize
@@ -0,0 +1,199 @@
+package decrypt
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+)
+
+// 单个数据库文件的校验结果
+const (
+	KeyStatusValid     = "valid"
+	KeyStatusInvalid   = "invalid"
+	KeyStatusPlaintext = "plaintext"
+	KeyStatusError     = "error"
+)
+
+// DBGroup 按文件名匹配的一类数据库
+type DBGroup struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+var (
+	windowsV3Groups = []DBGroup{
+		{Name: "message", Pattern: regexp.MustCompile(`^MSG([0-9]?[0-9])?\.db$`)},
+		{Name: "contact", Pattern: regexp.MustCompile(`^MicroMsg\.db$`)},
+		{Name: "media", Pattern: regexp.MustCompile(`^HardLink(Image|Video|File)\.db$`)},
+		{Name: "voice", Pattern: regexp.MustCompile(`^MediaMSG([0-9]?[0-9])?\.db$`)},
+	}
+	darwinV3Groups = []DBGroup{
+		{Name: "message", Pattern: regexp.MustCompile(`^msg_([0-9]?[0-9])?\.db$`)},
+		{Name: "contact", Pattern: regexp.MustCompile(`^(wccontact_new2|group_new)\.db$`)},
+		{Name: "session", Pattern: regexp.MustCompile(`^session_new\.db$`)},
+		{Name: "media", Pattern: regexp.MustCompile(`^hldata\.db$`)},
+	}
+	v4Groups = []DBGroup{
+		{Name: "message", Pattern: regexp.MustCompile(`^message_([0-9]?[0-9])?\.db$`)},
+		{Name: "contact", Pattern: regexp.MustCompile(`^contact\.db$`)},
+		{Name: "session", Pattern: regexp.MustCompile(`^session\.db$`)},
+		{Name: "media", Pattern: regexp.MustCompile(`^hardlink\.db$`)},
+		{Name: "voice", Pattern: regexp.MustCompile(`^media_([0-9]?[0-9])?\.db$`)},
+	}
+)
+
+// GetDBGroups 返回需要校验密钥的数据库分组
+func GetDBGroups(platform string, version int) []DBGroup {
+	switch {
+	case platform == "windows" && version == 3:
+		return windowsV3Groups
+	case platform == "darwin" && version == 3:
+		return darwinV3Groups
+	case version == 4:
+		return v4Groups
+	}
+	return nil
+}
+
+// KeyFileResult 密钥对单个数据库文件的校验结果
+type KeyFileResult struct {
+	Group  string `json:"group"`
+	File   string `json:"file"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// KeyReport 密钥对数据目录下各分组数据库的校验结果
+type KeyReport struct {
+	Files []KeyFileResult `json:"files"`
+}
+
+// Valid 密钥能打开的文件数
+func (r *KeyReport) Valid() int {
+	return r.count(KeyStatusValid)
+}
+
+// Failed 密钥无法打开或读取失败的文件
+func (r *KeyReport) Failed() []KeyFileResult {
+	failed := make([]KeyFileResult, 0)
+	for _, f := range r.Files {
+		if f.Status == KeyStatusInvalid || f.Status == KeyStatusError {
+			failed = append(failed, f)
+		}
+	}
+	return failed
+}
+
+func (r *KeyReport) count(status string) int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// String 按分组汇总校验结果，并列出无法打开的文件
+func (r *KeyReport) String() string {
+	var sb strings.Builder
+	groups := make([]string, 0)
+	total := make(map[string]int)
+	valid := make(map[string]int)
+	for _, f := range r.Files {
+		if _, ok := total[f.Group]; !ok {
+			groups = append(groups, f.Group)
+		}
+		if f.Status == KeyStatusPlaintext {
+			continue
+		}
+		total[f.Group]++
+		if f.Status == KeyStatusValid {
+			valid[f.Group]++
+		}
+	}
+	for i, g := range groups {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "%s %d/%d", g, valid[g], total[g])
+	}
+	for _, f := range r.Failed() {
+		fmt.Fprintf(&sb, "\n  %s: %s", f.File, f.Status)
+		if f.Error != "" {
+			fmt.Fprintf(&sb, " (%s)", f.Error)
+		}
+	}
+	return sb.String()
+}
+
+// ValidateAll 以 key 校验数据目录下所有分组的数据库，而不只是 GetSimpleDBFile 返回的文件
+// 账号迁移或部分数据库更换密钥后，可据此找出无法打开的文件
+func (v *Validator) ValidateAll(key []byte) *KeyReport {
+	report := &KeyReport{Files: make([]KeyFileResult, 0)}
+	groups := GetDBGroups(v.platform, v.version)
+	if len(groups) == 0 || v.dataDir == "" {
+		return report
+	}
+
+	filepath.WalkDir(v.dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if strings.EqualFold(d.Name(), "fts") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, g := range groups {
+			if g.Pattern.MatchString(d.Name()) {
+				rel, _ := filepath.Rel(v.dataDir, path)
+				report.Files = append(report.Files, KeyFileResult{Group: g.Name, File: filepath.ToSlash(rel)})
+				break
+			}
+		}
+		return nil
+	})
+
+	// 每个文件的 salt 不同，需分别派生密钥，并发校验
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.NumCPU())
+	for i := range report.Files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(f *KeyFileResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			f.Status, f.Error = v.validateFile(filepath.Join(v.dataDir, filepath.FromSlash(f.File)), key)
+		}(&report.Files[i])
+	}
+	wg.Wait()
+
+	sort.SliceStable(report.Files, func(i, j int) bool {
+		return report.Files[i].File < report.Files[j].File
+	})
+	return report
+}
+
+func (v *Validator) validateFile(path string, key []byte) (string, string) {
+	d, err := common.OpenDBFile(path, v.decryptor.GetPageSize())
+	if err == errors.ErrAlreadyDecrypted {
+		return KeyStatusPlaintext, ""
+	}
+	if err != nil {
+		return KeyStatusError, err.Error()
+	}
+	if !v.decryptor.Validate(d.FirstPage, key) {
+		return KeyStatusInvalid, ""
+	}
+	return KeyStatusValid, ""
+}
@@ -0,0 +1,60 @@
+package decrypt
+
+import (
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/darwin"
+)
+
+func writeEncryptedPage(t *testing.T, path string, key []byte) {
+	t.Helper()
+	d := darwin.NewV3Decryptor()
+	salt := make([]byte, common.SaltSize)
+	rand.Read(salt)
+	plain := make([]byte, d.GetPageSize())
+	copy(plain, common.SQLiteHeader)
+	page, err := d.NewPageDecryptor(key, salt).Encrypt(plain, 0, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, page, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	key := make([]byte, common.KeySize)
+	other := make([]byte, common.KeySize)
+	rand.Read(key)
+	rand.Read(other)
+
+	dataDir := t.TempDir()
+	writeEncryptedPage(t, filepath.Join(dataDir, "Message", "msg_0.db"), key)
+	writeEncryptedPage(t, filepath.Join(dataDir, "Message", "msg_1.db"), other)
+	writeEncryptedPage(t, filepath.Join(dataDir, "Session", "session_new.db"), key)
+	writeEncryptedPage(t, filepath.Join(dataDir, "Message", "fts", "msg_2.db"), other)
+	plain := make([]byte, 1024)
+	copy(plain, common.SQLiteHeader)
+	os.MkdirAll(filepath.Join(dataDir, "Contact"), 0755)
+	os.WriteFile(filepath.Join(dataDir, "Contact", "wccontact_new2.db"), plain, 0644)
+
+	v, err := NewValidator("darwin", 3, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := v.ValidateAll(key)
+	if len(report.Files) != 4 || report.Valid() != 2 {
+		t.Fatalf("unexpected report %+v", report.Files)
+	}
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].File != "Message/msg_1.db" || failed[0].Group != "message" {
+		t.Fatalf("unexpected failures %+v", failed)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt/darwin"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt/windows"
 )
@@ -17,6 +18,9 @@ type Decryptor interface {
 	// Validate 验证密钥是否有效
 	Validate(page1 []byte, key []byte) bool
 
+	// NewPageDecryptor 根据密钥与数据库 salt 派生按页解密器
+	NewPageDecryptor(key []byte, salt []byte) *common.PageDecryptor
+
 	// GetPageSize 返回页面大小
 	GetPageSize() int
 
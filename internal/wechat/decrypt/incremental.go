@@ -0,0 +1,448 @@
+package decrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+)
+
+const (
+	// PageStateSuffix 页面指纹文件后缀，与明文数据库放在同一目录
+	PageStateSuffix = ".pages"
+
+	pageStateMagic   = "CLPG\x02\x00\x00\x00"
+	pageStateTagSize = 16
+	pageStateKeySize = 8
+)
+
+// dirtyPageTag 脏页指纹，不会与任何 HMAC 或全零页面的指纹相同
+var dirtyPageTag = bytes.Repeat([]byte{0xff}, pageStateTagSize)
+
+// IncrementalStats 增量解密结果
+type IncrementalStats struct {
+	TotalPages   int64
+	ChangedPages int64
+	WALPages     int64 // 从 WAL 回放的页面数
+	Full         bool  // 是否进行了全量解密
+}
+
+// IncrementalDecryptor 增量解密器
+// 以加密页面中存储的 HMAC 作为页面指纹，记录在明文数据库旁的 .pages 文件中，
+// 再次解密时只重新解密指纹发生变化的页面，并原地写回明文数据库
+// 设置了输出密钥时，写入的页面以相同的页面格式重新加密，工作目录中不落地明文
+type IncrementalDecryptor struct {
+	decryptor Decryptor
+
+	mutex     sync.Mutex
+	outputKey []byte
+	// 派生密钥开销较大（V4 需 256000 次 PBKDF2），按 key + salt 缓存
+	pageDecryptors map[string]*common.PageDecryptor
+	// 同一输出文件串行处理
+	locks map[string]*sync.Mutex
+}
+
+// NewIncrementalDecryptor 创建增量解密器
+func NewIncrementalDecryptor(decryptor Decryptor) *IncrementalDecryptor {
+	return &IncrementalDecryptor{
+		decryptor:      decryptor,
+		pageDecryptors: make(map[string]*common.PageDecryptor),
+		locks:          make(map[string]*sync.Mutex),
+	}
+}
+
+// Decryptor 返回底层解密器
+func (d *IncrementalDecryptor) Decryptor() Decryptor {
+	return d.decryptor
+}
+
+// SetOutputKey 设置输出文件的加密密钥，为空时输出明文
+// 密钥变化后，已有的输出文件在下次解密时全量重写
+func (d *IncrementalDecryptor) SetOutputKey(hexKey string) error {
+	var key []byte
+	if hexKey != "" {
+		var err error
+		if key, err = hex.DecodeString(hexKey); err != nil {
+			return errors.DecodeKeyFailed(err)
+		}
+		if len(key) != common.KeySize {
+			return errors.ErrKeyLengthMust32
+		}
+	}
+	d.mutex.Lock()
+	d.outputKey = key
+	d.mutex.Unlock()
+	return nil
+}
+
+// Decrypt 将 dbfile 增量解密到 output
+// 页面指纹缺失或与数据库不匹配（salt、页面大小变化，或明文文件被改动）时，
+// 全量解密到临时文件后替换 output；否则仅修补变化的页面，并按源文件大小截断或扩展 output
+func (d *IncrementalDecryptor) Decrypt(ctx context.Context, dbfile string, hexKey string, output string) (*IncrementalStats, error) {
+	lock := d.lock(output)
+	lock.Lock()
+	defer lock.Unlock()
+
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, errors.DecodeKeyFailed(err)
+	}
+
+	pageSize := d.decryptor.GetPageSize()
+	dbInfo, err := common.OpenDBFile(dbfile, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	pd, err := d.pageDecryptor(key, hexKey, dbInfo)
+	if err != nil {
+		return nil, err
+	}
+	sealer := d.sealer(dbInfo.Salt)
+
+	src, err := os.Open(dbfile)
+	if err != nil {
+		return nil, errors.OpenFileFailed(dbfile, err)
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return nil, errors.StatFileFailed(dbfile, err)
+	}
+	// 末尾不完整的页面可能正在写入，与全量解密一致，忽略
+	totalPages := stat.Size() / int64(pageSize)
+
+	stateFile := output + PageStateSuffix
+	prev := loadPageState(stateFile)
+	if prev != nil && !prev.match(pageSize, dbInfo.Salt, sealer.keyID(), output) {
+		prev = nil
+	}
+
+	stats := &IncrementalStats{TotalPages: totalPages, Full: prev == nil}
+	target := output
+	flag := os.O_RDWR | os.O_CREATE
+	if stats.Full {
+		target = output + ".tmp"
+		flag |= os.O_TRUNC
+	}
+
+	out, err := os.OpenFile(target, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %v", err)
+	}
+
+	next := &pageState{
+		pageSize: pageSize,
+		salt:     append([]byte(nil), dbInfo.Salt...),
+		keyID:    sealer.keyID(),
+		tags:     make([]byte, totalPages*pageStateTagSize),
+	}
+
+	err = d.patch(ctx, src, out, pd, sealer, prev, next, stats)
+	if err == nil {
+		err = out.Truncate(totalPages * int64(pageSize))
+	}
+	if err == nil {
+		err = d.replayWAL(dbfile+common.WALSuffix, out, pd, sealer, next, stats)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if stats.Full {
+			os.Remove(target)
+		}
+		return nil, err
+	}
+
+	if stats.Full {
+		if err := os.Rename(target, output); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := next.save(stateFile); err != nil {
+		// 指纹保存失败不影响明文数据，下次将全量解密
+		os.Remove(stateFile)
+	}
+
+	return stats, nil
+}
+
+// patch 逐页比较指纹并写入变化的页面
+// 第 0 页包含 SQLite 文件变更计数，最后写入，使读取方在其余页面就绪后才感知到变化
+func (d *IncrementalDecryptor) patch(ctx context.Context, src *os.File, out io.WriterAt, pd *common.PageDecryptor, sealer *pageSealer, prev, next *pageState, stats *IncrementalStats) error {
+	pageSize := int64(pd.PageSize)
+	pageBuf := make([]byte, pageSize)
+
+	process := func(pageNum int64) error {
+		if _, err := src.ReadAt(pageBuf, pageNum*pageSize); err != nil {
+			return errors.ReadFileFailed(src.Name(), err)
+		}
+
+		tag := next.tag(pageNum)
+		if !common.IsZeroPage(pageBuf) {
+			copy(tag, pd.PageTag(pageBuf))
+		}
+		if prev != nil && pageNum < prev.count() && bytes.Equal(prev.tag(pageNum), tag) {
+			return nil
+		}
+
+		data, err := pd.Decrypt(pageBuf, pageNum)
+		if err != nil {
+			return err
+		}
+		if data, err = sealer.seal(data, pageNum); err != nil {
+			return err
+		}
+		if _, err := out.WriteAt(data, pageNum*pageSize); err != nil {
+			return errors.WriteOutputFailed(err)
+		}
+		stats.ChangedPages++
+		return nil
+	}
+
+	for pageNum := int64(1); pageNum < next.count(); pageNum++ {
+		select {
+		case <-ctx.Done():
+			return errors.ErrDecryptOperationCanceled
+		default:
+		}
+		if err := process(pageNum); err != nil {
+			return err
+		}
+	}
+	if next.count() > 0 {
+		return process(0)
+	}
+	return nil
+}
+
+// replayWAL 将 WAL 中已提交的页面解密后写入明文数据库，使尚未检查点的新数据可见
+// 被覆盖的页面指纹标记为脏页，下次解密时先从主库恢复，再重新回放 WAL
+// WAL 中的页面无法解密时（例如正在写入）忽略本次回放
+func (d *IncrementalDecryptor) replayWAL(walfile string, out *os.File, pd *common.PageDecryptor, sealer *pageSealer, next *pageState, stats *IncrementalStats) error {
+	wal, err := common.ReadWALFrames(walfile, pd.PageSize)
+	if err != nil || wal == nil {
+		return err
+	}
+
+	pages := make(map[int64][]byte, len(wal.Pages))
+	for pageNum, page := range wal.Pages {
+		if pageNum >= wal.DBSize {
+			continue
+		}
+		data, err := pd.Decrypt(page, pageNum)
+		if err != nil {
+			return nil
+		}
+		pages[pageNum] = data
+	}
+
+	pageSize := int64(pd.PageSize)
+	if err := out.Truncate(wal.DBSize * pageSize); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	next.resize(wal.DBSize)
+
+	write := func(pageNum int64, data []byte) error {
+		data, err := sealer.seal(data, pageNum)
+		if err != nil {
+			return err
+		}
+		if _, err := out.WriteAt(data, pageNum*pageSize); err != nil {
+			return errors.WriteOutputFailed(err)
+		}
+		next.markDirty(pageNum)
+		stats.WALPages++
+		return nil
+	}
+	for pageNum, data := range pages {
+		if pageNum == 0 {
+			continue
+		}
+		if err := write(pageNum, data); err != nil {
+			return err
+		}
+	}
+	if data, ok := pages[0]; ok {
+		return write(0, data)
+	}
+	return nil
+}
+
+func (d *IncrementalDecryptor) pageDecryptor(key []byte, hexKey string, dbInfo *common.DBFile) (*common.PageDecryptor, error) {
+	cacheKey := hexKey + ":" + hex.EncodeToString(dbInfo.Salt)
+
+	d.mutex.Lock()
+	pd, ok := d.pageDecryptors[cacheKey]
+	d.mutex.Unlock()
+	if ok {
+		return pd, nil
+	}
+
+	if !d.decryptor.Validate(dbInfo.FirstPage, key) {
+		return nil, errors.ErrDecryptIncorrectKey
+	}
+	pd = d.decryptor.NewPageDecryptor(key, dbInfo.Salt)
+
+	d.mutex.Lock()
+	d.pageDecryptors[cacheKey] = pd
+	d.mutex.Unlock()
+	return pd, nil
+}
+
+// sealer 返回输出页面的加密器，未设置输出密钥时返回 nil
+// 输出 salt 由输出密钥与源数据库 salt 派生，同一源文件每次得到相同的 salt，可原地修补页面
+func (d *IncrementalDecryptor) sealer(srcSalt []byte) *pageSealer {
+	d.mutex.Lock()
+	outputKey := d.outputKey
+	d.mutex.Unlock()
+	if outputKey == nil {
+		return nil
+	}
+
+	mac := hmac.New(sha256.New, outputKey)
+	mac.Write(srcSalt)
+	salt := mac.Sum(nil)[:common.SaltSize]
+	cacheKey := "output:" + hex.EncodeToString(outputKey) + ":" + hex.EncodeToString(salt)
+
+	d.mutex.Lock()
+	pd, ok := d.pageDecryptors[cacheKey]
+	d.mutex.Unlock()
+	if !ok {
+		pd = d.decryptor.NewPageDecryptor(outputKey, salt)
+		d.mutex.Lock()
+		d.pageDecryptors[cacheKey] = pd
+		d.mutex.Unlock()
+	}
+
+	sum := sha256.Sum256(outputKey)
+	return &pageSealer{pd: pd, salt: salt, id: sum[:pageStateKeySize]}
+}
+
+// pageSealer 以输出密钥重新加密明文页面，为 nil 时原样输出明文
+type pageSealer struct {
+	pd   *common.PageDecryptor
+	salt []byte
+	id   []byte
+}
+
+func (s *pageSealer) seal(data []byte, pageNum int64) ([]byte, error) {
+	if s == nil || common.IsZeroPage(data) {
+		return data, nil
+	}
+	return s.pd.Encrypt(data, pageNum, s.salt)
+}
+
+// keyID 输出密钥的指纹，明文输出时为全零
+func (s *pageSealer) keyID() []byte {
+	if s == nil {
+		return make([]byte, pageStateKeySize)
+	}
+	return s.id
+}
+
+func (d *IncrementalDecryptor) lock(output string) *sync.Mutex {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	l, ok := d.locks[output]
+	if !ok {
+		l = &sync.Mutex{}
+		d.locks[output] = l
+	}
+	return l
+}
+
+// pageState 页面指纹文件
+// 格式：magic(8) | pageSize(4) | salt(16) | 输出密钥指纹(8) | 每页 HMAC 前 16 字节，全零页面记为全零，WAL 回放的页面记为全 0xff
+type pageState struct {
+	pageSize int
+	salt     []byte
+	keyID    []byte
+	tags     []byte
+}
+
+func (p *pageState) count() int64 {
+	return int64(len(p.tags) / pageStateTagSize)
+}
+
+func (p *pageState) tag(pageNum int64) []byte {
+	return p.tags[pageNum*pageStateTagSize : (pageNum+1)*pageStateTagSize]
+}
+
+// resize 调整记录的页数，新增的页面均标记为脏页
+func (p *pageState) resize(pages int64) {
+	count := p.count()
+	if pages <= count {
+		p.tags = p.tags[:pages*pageStateTagSize]
+		return
+	}
+	p.tags = append(p.tags, make([]byte, (pages-count)*pageStateTagSize)...)
+	for n := count; n < pages; n++ {
+		p.markDirty(n)
+	}
+}
+
+// markDirty 标记页面内容来自 WAL，与主库中的页面不一致
+func (p *pageState) markDirty(pageNum int64) {
+	copy(p.tag(pageNum), dirtyPageTag)
+}
+
+// match 检查指纹是否仍对应当前数据库、输出密钥与明文文件
+func (p *pageState) match(pageSize int, salt []byte, keyID []byte, output string) bool {
+	if p.pageSize != pageSize || !bytes.Equal(p.salt, salt) || !bytes.Equal(p.keyID, keyID) {
+		return false
+	}
+	stat, err := os.Stat(output)
+	if err != nil {
+		return false
+	}
+	return stat.Size() == p.count()*int64(pageSize)
+}
+
+func loadPageState(path string) *pageState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	headerSize := len(pageStateMagic) + 4 + common.SaltSize + pageStateKeySize
+	if len(data) < headerSize || string(data[:len(pageStateMagic)]) != pageStateMagic {
+		return nil
+	}
+	if (len(data)-headerSize)%pageStateTagSize != 0 {
+		return nil
+	}
+	offset := len(pageStateMagic)
+	return &pageState{
+		pageSize: int(binary.LittleEndian.Uint32(data[offset:])),
+		salt:     data[offset+4 : offset+4+common.SaltSize],
+		keyID:    data[offset+4+common.SaltSize : headerSize],
+		tags:     data[headerSize:],
+	}
+}
+
+func (p *pageState) save(path string) error {
+	buf := make([]byte, 0, len(pageStateMagic)+4+len(p.salt)+len(p.keyID)+len(p.tags))
+	buf = append(buf, pageStateMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(p.pageSize))
+	buf = append(buf, p.salt...)
+	buf = append(buf, p.keyID...)
+	buf = append(buf, p.tags...)
+
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
@@ -0,0 +1,301 @@
+package decrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/darwin"
+)
+
+// encryptPage 按 SQLCipher 页面格式加密第 n 页，作为解密的逆过程构造测试数据
+func encryptPage(t *testing.T, pd *common.PageDecryptor, salt []byte, n int, plain []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(pd.EncKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := make([]byte, pd.PageSize)
+	offset := 0
+	if n == 0 {
+		offset = common.SaltSize
+		copy(page, salt)
+	}
+	dataEnd := pd.PageSize - pd.Reserve
+	// IV 由明文与页号确定，保证相同页面加密结果一致
+	iv := page[dataEnd : dataEnd+common.IVSize]
+	sum := sha256.Sum256(append([]byte{byte(n)}, plain...))
+	copy(iv, sum[:])
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(page[offset:dataEnd], plain[offset:dataEnd])
+
+	mac := hmac.New(pd.HashFunc, pd.MacKey)
+	mac.Write(page[offset : dataEnd+common.IVSize])
+	pageNo := make([]byte, 4)
+	binary.LittleEndian.PutUint32(pageNo, uint32(n+1))
+	mac.Write(pageNo)
+	copy(page[dataEnd+common.IVSize:], mac.Sum(nil))
+	return page
+}
+
+func encryptPages(t *testing.T, pd *common.PageDecryptor, salt []byte, pages [][]byte) []byte {
+	var out bytes.Buffer
+	for n, plain := range pages {
+		out.Write(encryptPage(t, pd, salt, n, plain))
+	}
+	return out.Bytes()
+}
+
+func randomPages(n, size int) [][]byte {
+	pages := make([][]byte, n)
+	for i := range pages {
+		pages[i] = make([]byte, size)
+		rand.Read(pages[i])
+	}
+	return pages
+}
+
+func TestIncrementalDecrypt(t *testing.T) {
+	d := darwin.NewV3Decryptor()
+	key := make([]byte, common.KeySize)
+	salt := make([]byte, common.SaltSize)
+	rand.Read(key)
+	rand.Read(salt)
+	hexKey := hex.EncodeToString(key)
+	pd := d.NewPageDecryptor(key, salt)
+
+	dir := t.TempDir()
+	dbfile := filepath.Join(dir, "src.db")
+	output := filepath.Join(dir, "out.db")
+	inc := NewIncrementalDecryptor(d)
+
+	check := func(pages [][]byte, wantFull bool, wantChanged int64) {
+		t.Helper()
+		if err := os.WriteFile(dbfile, encryptPages(t, pd, salt, pages), 0644); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := inc.Decrypt(context.Background(), dbfile, hexKey, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Full != wantFull || stats.ChangedPages != wantChanged || stats.TotalPages != int64(len(pages)) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+
+		var want bytes.Buffer
+		if err := d.Decrypt(context.Background(), dbfile, hexKey, &want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Fatalf("incremental output differs from full decrypt")
+		}
+	}
+
+	pages := randomPages(8, d.GetPageSize())
+	check(pages, true, 8)
+
+	// 未变化时不写入任何页面
+	check(pages, false, 0)
+
+	// 修改第 3 页并追加 2 页
+	pages[3] = randomPages(1, d.GetPageSize())[0]
+	pages = append(pages, randomPages(2, d.GetPageSize())...)
+	check(pages, false, 3)
+
+	// 截断
+	check(pages[:5], false, 0)
+
+	// salt 变化时全量解密
+	rand.Read(salt)
+	pd = d.NewPageDecryptor(key, salt)
+	check(pages[:5], true, 5)
+}
+
+func TestIncrementalDecryptWAL(t *testing.T) {
+	d := darwin.NewV3Decryptor()
+	key := make([]byte, common.KeySize)
+	salt := make([]byte, common.SaltSize)
+	rand.Read(key)
+	rand.Read(salt)
+	hexKey := hex.EncodeToString(key)
+	pd := d.NewPageDecryptor(key, salt)
+	pageSize := d.GetPageSize()
+
+	dir := t.TempDir()
+	dbfile := filepath.Join(dir, "src.db")
+	output := filepath.Join(dir, "out.db")
+	inc := NewIncrementalDecryptor(d)
+
+	pages := randomPages(4, pageSize)
+	if err := os.WriteFile(dbfile, encryptPages(t, pd, salt, pages), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// WAL：修改第 1 页并新增第 4 页后提交，随后一帧未提交
+	walPages := map[int][]byte{1: randomPages(1, pageSize)[0], 4: randomPages(1, pageSize)[0]}
+	var wal bytes.Buffer
+	header := make([]byte, common.WALHeaderSize)
+	binary.BigEndian.PutUint32(header[0:], 0x377f0682)
+	binary.BigEndian.PutUint32(header[8:], uint32(pageSize))
+	binary.BigEndian.PutUint32(header[16:], 11)
+	binary.BigEndian.PutUint32(header[20:], 22)
+	wal.Write(header)
+	writeFrame := func(n int, plain []byte, dbSize uint32) {
+		frame := make([]byte, common.WALFrameHeaderSize)
+		binary.BigEndian.PutUint32(frame[0:], uint32(n+1))
+		binary.BigEndian.PutUint32(frame[4:], dbSize)
+		binary.BigEndian.PutUint32(frame[8:], 11)
+		binary.BigEndian.PutUint32(frame[12:], 22)
+		wal.Write(frame)
+		wal.Write(encryptPage(t, pd, salt, n, plain))
+	}
+	writeFrame(1, walPages[1], 0)
+	writeFrame(4, walPages[4], 5)
+	writeFrame(2, randomPages(1, pageSize)[0], 0)
+	if err := os.WriteFile(dbfile+common.WALSuffix, wal.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func() []byte {
+		var want bytes.Buffer
+		if err := d.Decrypt(context.Background(), dbfile, hexKey, &want); err != nil {
+			t.Fatal(err)
+		}
+		data := want.Bytes()
+		for n, plain := range walPages {
+			page, err := pd.Decrypt(encryptPage(t, pd, salt, n, plain), int64(n))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if need := (n + 1) * pageSize; len(data) < need {
+				data = append(data, make([]byte, need-len(data))...)
+			}
+			copy(data[n*pageSize:], page)
+		}
+		return data
+	}
+
+	for i := 0; i < 2; i++ {
+		stats, err := inc.Decrypt(context.Background(), dbfile, hexKey, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.WALPages != 2 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+		// 第二次解密时仅恢复被 WAL 覆盖的第 1 页
+		if i == 1 && (stats.Full || stats.ChangedPages != 1) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+		got, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, expect()) {
+			t.Fatalf("output differs from main database with WAL replayed")
+		}
+	}
+
+	// 检查点后 WAL 清空，明文数据库回到主库内容
+	if err := os.WriteFile(dbfile+common.WALSuffix, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	walPages = nil
+	stats, err := inc.Decrypt(context.Background(), dbfile, hexKey, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Full || stats.WALPages != 0 || stats.TotalPages != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	got, _ := os.ReadFile(output)
+	if !bytes.Equal(got, expect()) {
+		t.Fatalf("output differs from main database after checkpoint")
+	}
+}
+
+func TestIncrementalDecryptOutputKey(t *testing.T) {
+	d := darwin.NewV3Decryptor()
+	key := make([]byte, common.KeySize)
+	salt := make([]byte, common.SaltSize)
+	outKey := make([]byte, common.KeySize)
+	rand.Read(key)
+	rand.Read(salt)
+	rand.Read(outKey)
+	hexKey := hex.EncodeToString(key)
+	pd := d.NewPageDecryptor(key, salt)
+	pageSize := d.GetPageSize()
+
+	dir := t.TempDir()
+	dbfile := filepath.Join(dir, "src.db")
+	output := filepath.Join(dir, "out.db")
+	inc := NewIncrementalDecryptor(d)
+	if err := inc.SetOutputKey(hex.EncodeToString(outKey)); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(pages [][]byte, wantFull bool, wantChanged int64) {
+		t.Helper()
+		if err := os.WriteFile(dbfile, encryptPages(t, pd, salt, pages), 0644); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := inc.Decrypt(context.Background(), dbfile, hexKey, output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Full != wantFull || stats.ChangedPages != wantChanged {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+
+		var want bytes.Buffer
+		if err := d.Decrypt(context.Background(), dbfile, hexKey, &want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != want.Len() || bytes.HasPrefix(got, []byte(common.SQLiteHeader)) {
+			t.Fatalf("output is not re-encrypted")
+		}
+		// 输出以相同页面格式加密，用输出密钥与输出文件中的 salt 即可解密
+		// 页面尾部的预留区域存放各自的 IV 与 HMAC，不参与比较
+		opd := d.NewPageDecryptor(outKey, got[:common.SaltSize])
+		dataSize := pageSize - d.GetReserve()
+		for n := 0; n < len(pages); n++ {
+			page, err := opd.Decrypt(got[n*pageSize:(n+1)*pageSize], int64(n))
+			if err != nil {
+				t.Fatalf("page %d: %v", n, err)
+			}
+			if !bytes.Equal(page[:dataSize], want.Bytes()[n*pageSize:n*pageSize+dataSize]) {
+				t.Fatalf("page %d differs from full decrypt", n)
+			}
+		}
+	}
+
+	pages := randomPages(6, pageSize)
+	check(pages, true, 6)
+
+	pages[2] = randomPages(1, pageSize)[0]
+	check(pages, false, 1)
+
+	// 输出密钥变化时全量重写
+	rand.Read(outKey)
+	if err := inc.SetOutputKey(hex.EncodeToString(outKey)); err != nil {
+		t.Fatal(err)
+	}
+	check(pages, true, 6)
+}
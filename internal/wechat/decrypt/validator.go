@@ -10,6 +10,7 @@ import (
 type Validator struct {
 	platform        string
 	version         int
+	dataDir         string
 	dbPath          string
 	decryptor       Decryptor
 	dbFile          *common.DBFile
@@ -36,6 +37,7 @@ func NewValidatorWithFile(platform string, version int, dataDir string) (*Valida
 	validator := &Validator{
 		platform:  platform,
 		version:   version,
+		dataDir:   dataDir,
 		dbPath:    dbPath,
 		decryptor: decryptor,
 		dbFile:    d,
@@ -59,6 +61,11 @@ func (v *Validator) ValidateImgKey(key []byte) bool {
 	return v.imgKeyValidator.Validate(key)
 }
 
+// CanValidateImgKey 数据目录中是否有可用于校验图片密钥的文件
+func (v *Validator) CanValidateImgKey() bool {
+	return v.imgKeyValidator != nil
+}
+
 func GetSimpleDBFile(platform string, version int) string {
 	switch {
 	case platform == "windows" && version == 3:
@@ -0,0 +1,78 @@
+package vfs
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize 默认缓存的页面数
+const DefaultCacheSize = 4096
+
+type pageKey struct {
+	path    string
+	pageNum int64
+}
+
+type pageEntry struct {
+	key  pageKey
+	tag  []byte
+	data []byte
+}
+
+// pageCache 已解密页面的 LRU 缓存
+// 以加密页面中存储的 HMAC 校验缓存是否仍然有效，原始文件被改写后自动失效
+type pageCache struct {
+	mutex    sync.Mutex
+	capacity int
+	items    map[pageKey]*list.Element
+	order    *list.List
+}
+
+func newPageCache(capacity int) *pageCache {
+	if capacity <= 0 {
+		capacity = DefaultCacheSize
+	}
+	return &pageCache{
+		capacity: capacity,
+		items:    make(map[pageKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get 返回与 tag 匹配的已解密页面
+func (c *pageCache) get(key pageKey, tag []byte) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*pageEntry)
+	if !bytes.Equal(entry.tag, tag) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.data, true
+}
+
+func (c *pageCache) put(key pageKey, tag []byte, data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := &pageEntry{key: key, tag: append([]byte(nil), tag...), data: data}
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*pageEntry).key)
+	}
+}
@@ -0,0 +1,419 @@
+package vfs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+)
+
+// 页面校验失败时（原始文件正在写入）的重试次数
+const readRetries = 3
+
+// FileSystem 按需解密加密数据库，一个 VFS 对应一个 FileSystem
+type FileSystem struct {
+	decryptor decrypt.Decryptor
+	key       []byte
+	cache     *pageCache
+	// writable 为 true 时数据库可读写，写入的页面按相同格式加密
+	writable bool
+
+	mutex sync.Mutex
+	// 派生密钥开销较大，按 salt 缓存
+	pageDecryptors map[string]*common.PageDecryptor
+	// 可写模式下同一进程内各连接之间的文件锁
+	locks map[string]*lockState
+}
+
+// NewFileSystem 创建 FileSystem，cacheSize 为缓存的页面数，<= 0 时使用默认值
+func NewFileSystem(decryptor decrypt.Decryptor, hexKey string, cacheSize int) (*FileSystem, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, errors.DecodeKeyFailed(err)
+	}
+	if len(key) != common.KeySize {
+		return nil, errors.ErrKeyLengthMust32
+	}
+	return &FileSystem{
+		decryptor:      decryptor,
+		key:            key,
+		cache:          newPageCache(cacheSize),
+		pageDecryptors: make(map[string]*common.PageDecryptor),
+		locks:          make(map[string]*lockState),
+	}, nil
+}
+
+// NewWritableFileSystem 创建可读写的 FileSystem，用于以自有密钥加密存储的数据库
+// 新建的数据库需预留与解密器一致的页面尾部空间（SQLITE_FCNTL_RESERVE_BYTES），否则写入失败
+func NewWritableFileSystem(decryptor decrypt.Decryptor, hexKey string, cacheSize int) (*FileSystem, error) {
+	fs, err := NewFileSystem(decryptor, hexKey, cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	fs.writable = true
+	return fs, nil
+}
+
+// Writable 是否为可写模式
+func (fs *FileSystem) Writable() bool {
+	return fs.writable
+}
+
+// Open 打开加密数据库，只读模式下文件须已存在，可写模式下不存在时创建
+func (fs *FileSystem) Open(path string) (*File, error) {
+	var fp *os.File
+	var err error
+	if fs.writable {
+		fp, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	} else {
+		fp, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, errors.OpenFileFailed(path, err)
+	}
+	f := &File{
+		fs:       fs,
+		path:     path,
+		fp:       fp,
+		pageSize: int64(fs.decryptor.GetPageSize()),
+	}
+	if err := f.Refresh(); err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs *FileSystem) pageDecryptor(firstPage []byte) (*common.PageDecryptor, error) {
+	salt := firstPage[:common.SaltSize]
+	cacheKey := hex.EncodeToString(salt)
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if pd, ok := fs.pageDecryptors[cacheKey]; ok {
+		return pd, nil
+	}
+	if !fs.decryptor.Validate(firstPage, fs.key) {
+		return nil, errors.ErrDecryptIncorrectKey
+	}
+	pd := fs.decryptor.NewPageDecryptor(fs.key, salt)
+	fs.pageDecryptors[cacheKey] = pd
+	return pd, nil
+}
+
+// newPageDecryptor 为新建的数据库派生密钥，无需校验
+func (fs *FileSystem) newPageDecryptor(salt []byte) *common.PageDecryptor {
+	cacheKey := hex.EncodeToString(salt)
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	pd, ok := fs.pageDecryptors[cacheKey]
+	if !ok {
+		pd = fs.decryptor.NewPageDecryptor(fs.key, salt)
+		fs.pageDecryptors[cacheKey] = pd
+	}
+	return pd
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func stampOf(path string) fileStamp {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{size: stat.Size(), modTime: stat.ModTime()}
+}
+
+// File 加密数据库的明文视图
+// 只读模式下按页解密主库，并以 WAL 中已提交的页面覆盖，呈现为一个非 WAL 模式的只读数据库
+// 可写模式下直接读写主库，不处理 WAL，由调用方使用内存日志
+type File struct {
+	fs       *FileSystem
+	path     string
+	fp       *os.File
+	pageSize int64
+
+	mutex      sync.Mutex
+	pd         *common.PageDecryptor // 为 nil 表示原始文件未加密
+	salt       []byte                // 可写模式下数据库的 salt
+	lockLevel  int
+	dbStamp    fileStamp
+	walStamp   fileStamp
+	wal        *common.WALFrames
+	pages      int64
+	generation uint32
+}
+
+// Refresh 检查原始文件与 WAL 是否变化，变化时更新视图并递增变更计数
+// 在每次读事务开始时调用
+func (f *File) Refresh() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.fs.writable {
+		return f.refreshWritable()
+	}
+
+	changed := false
+	if stamp := stampOf(f.path); stamp != f.dbStamp || f.generation == 0 {
+		if err := f.loadFirstPage(); err != nil {
+			return err
+		}
+		f.dbStamp = stamp
+		changed = true
+	}
+
+	walPath := f.path + common.WALSuffix
+	if stamp := stampOf(walPath); stamp != f.walStamp {
+		wal, err := common.ReadWALFrames(walPath, int(f.pageSize))
+		if err != nil {
+			return err
+		}
+		f.wal = wal
+		f.walStamp = stamp
+		changed = true
+	}
+
+	if changed {
+		f.pages = f.dbStamp.size / f.pageSize
+		if f.wal != nil {
+			f.pages = f.wal.DBSize
+		}
+		f.generation++
+	}
+	return nil
+}
+
+// refreshWritable 重新读取文件大小与 salt，其他连接可能已写入或新建了数据库
+func (f *File) refreshWritable() error {
+	stat, err := f.fp.Stat()
+	if err != nil {
+		return errors.StatFileFailed(f.path, err)
+	}
+	f.pages = stat.Size() / f.pageSize
+	if f.pages == 0 {
+		if f.salt == nil {
+			f.salt = make([]byte, common.SaltSize)
+			if _, err := rand.Read(f.salt); err != nil {
+				return err
+			}
+			f.pd = f.fs.newPageDecryptor(f.salt)
+		}
+		return nil
+	}
+
+	firstPage := make([]byte, f.pageSize)
+	if _, err := f.fp.ReadAt(firstPage, 0); err != nil {
+		return errors.ReadFileFailed(f.path, err)
+	}
+	if bytes.HasPrefix(firstPage, []byte(common.SQLiteHeader)) {
+		return errors.ErrAlreadyDecrypted
+	}
+	if f.pd != nil && bytes.Equal(f.salt, firstPage[:common.SaltSize]) {
+		return nil
+	}
+	pd, err := f.fs.pageDecryptor(firstPage)
+	if err != nil {
+		return err
+	}
+	f.pd = pd
+	f.salt = append([]byte(nil), firstPage[:common.SaltSize]...)
+	return nil
+}
+
+func (f *File) loadFirstPage() error {
+	firstPage := make([]byte, f.pageSize)
+	if _, err := f.fp.ReadAt(firstPage, 0); err != nil {
+		return errors.ReadFileFailed(f.path, err)
+	}
+	if bytes.HasPrefix(firstPage, []byte(common.SQLiteHeader)) {
+		f.pd = nil
+		// 未加密的数据库按实际页面大小读取，1 表示 65536
+		pageSize := int64(binary.BigEndian.Uint16(firstPage[16:18]))
+		if pageSize == 1 {
+			pageSize = 65536
+		}
+		f.pageSize = pageSize
+		return nil
+	}
+	pd, err := f.fs.pageDecryptor(firstPage)
+	if err != nil {
+		return err
+	}
+	f.pd = pd
+	return nil
+}
+
+// Size 返回明文视图的字节数
+func (f *File) Size() int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.pages * f.pageSize
+}
+
+// ReadAt 读取明文视图，超出文件末尾的部分以零填充并返回 io.EOF
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		pageNum := pos / f.pageSize
+		if pageNum >= f.pages {
+			clear(p[n:])
+			return n, io.EOF
+		}
+		page, err := f.readPage(pageNum)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], page[pos%f.pageSize:])
+	}
+	return n, nil
+}
+
+// readPage 读取并解密一页，调用方持有 f.mutex
+func (f *File) readPage(pageNum int64) ([]byte, error) {
+	var data []byte
+	var err error
+	for i := 0; i < readRetries; i++ {
+		if data, err = f.decryptPage(pageNum); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if pageNum == 0 && !f.fs.writable {
+		data = f.patchHeader(data)
+	}
+	return data, nil
+}
+
+// WriteAt 加密并写入明文，不足一页的写入先读出原页面再合并
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		pageNum := pos / f.pageSize
+		inPage := int(pos % f.pageSize)
+		size := min(len(p)-n, int(f.pageSize)-inPage)
+
+		plain := make([]byte, f.pageSize)
+		if size < int(f.pageSize) && pageNum < f.pages {
+			data, err := f.readPage(pageNum)
+			if err != nil {
+				return n, err
+			}
+			copy(plain, data)
+		}
+		copy(plain[inPage:], p[n:n+size])
+
+		// 第 0 页的 20 字节为每页预留的字节数，须容纳 IV 与 HMAC
+		if pageNum == 0 && int(plain[20]) < f.pd.Reserve {
+			return n, fmt.Errorf("database reserves %d bytes per page, %d required", plain[20], f.pd.Reserve)
+		}
+
+		page, err := f.pd.Encrypt(plain, pageNum, f.salt)
+		if err != nil {
+			return n, err
+		}
+		if _, err := f.fp.WriteAt(page, pageNum*f.pageSize); err != nil {
+			return n, errors.WriteOutputFailed(err)
+		}
+		f.fs.cache.put(pageKey{path: f.path, pageNum: pageNum}, f.pd.PageTag(page), plain)
+		if pageNum >= f.pages {
+			f.pages = pageNum + 1
+		}
+		n += size
+	}
+	return n, nil
+}
+
+// Truncate 按明文大小截断数据库
+func (f *File) Truncate(size int64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	pages := (size + f.pageSize - 1) / f.pageSize
+	if err := f.fp.Truncate(pages * f.pageSize); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	f.pages = pages
+	return nil
+}
+
+// Sync 将写入刷到磁盘
+func (f *File) Sync() error {
+	return f.fp.Sync()
+}
+
+func (f *File) decryptPage(pageNum int64) ([]byte, error) {
+	raw, ok := []byte(nil), false
+	if f.wal != nil {
+		raw, ok = f.wal.Pages[pageNum]
+	}
+	if !ok {
+		raw = make([]byte, f.pageSize)
+		if _, err := f.fp.ReadAt(raw, pageNum*f.pageSize); err != nil && err != io.EOF {
+			return nil, errors.ReadFileFailed(f.path, err)
+		}
+	}
+
+	if f.pd == nil {
+		return raw, nil
+	}
+	if common.IsZeroPage(raw) {
+		return raw, nil
+	}
+
+	key := pageKey{path: f.path, pageNum: pageNum}
+	tag := f.pd.PageTag(raw)
+	if data, ok := f.fs.cache.get(key, tag); ok {
+		return data, nil
+	}
+	data, err := f.pd.Decrypt(raw, pageNum)
+	if err != nil {
+		return nil, err
+	}
+	f.fs.cache.put(key, tag, data)
+	return data, nil
+}
+
+// patchHeader 调整数据库头，返回副本
+// 18、19 字节置为 1，使 SQLite 以回滚日志模式读取，WAL 已由本视图合并
+// 24 与 92 字节写入视图的变更计数，原始文件或 WAL 变化时 SQLite 会丢弃页面缓存
+// 28 字节写入视图的页数
+func (f *File) patchHeader(page []byte) []byte {
+	data := append([]byte(nil), page...)
+	data[18], data[19] = 1, 1
+	binary.BigEndian.PutUint32(data[24:], f.generation)
+	binary.BigEndian.PutUint32(data[28:], uint32(f.pages))
+	binary.BigEndian.PutUint32(data[92:], f.generation)
+	return data
+}
+
+// Close 释放文件锁并关闭原始文件
+func (f *File) Close() error {
+	f.Unlock(lockNone)
+	return f.fp.Close()
+}
@@ -0,0 +1,125 @@
+package vfs
+
+// SQLite 的文件锁级别
+const (
+	lockNone      = 0
+	lockShared    = 1
+	lockReserved  = 2
+	lockPending   = 3
+	lockExclusive = 4
+)
+
+// lockState 同一数据库文件在进程内的锁状态
+// 可写模式仅供本进程使用，按 SQLite 的五级锁语义在内存中实现，不使用系统文件锁
+type lockState struct {
+	shared    int
+	reserved  *File
+	pending   *File
+	exclusive *File
+}
+
+// Lock 将文件锁提升到 level，与其他连接冲突时返回 false
+// 只读模式下不加锁，获取共享锁即读事务开始，此时检查原始文件是否变化
+func (f *File) Lock(level int) (bool, error) {
+	if !f.fs.writable {
+		if level == lockShared {
+			return true, f.Refresh()
+		}
+		return true, nil
+	}
+
+	f.fs.mutex.Lock()
+	st, ok := f.fs.locks[f.path]
+	if !ok {
+		st = &lockState{}
+		f.fs.locks[f.path] = st
+	}
+
+	acquired := true
+	refresh := false
+	switch {
+	case level <= f.lockLevel:
+	case level == lockShared:
+		if (st.pending != nil && st.pending != f) || (st.exclusive != nil && st.exclusive != f) {
+			acquired = false
+			break
+		}
+		st.shared++
+		f.lockLevel = lockShared
+		refresh = true
+	case level == lockReserved:
+		if st.reserved != nil && st.reserved != f {
+			acquired = false
+			break
+		}
+		st.reserved = f
+		f.lockLevel = lockReserved
+	default:
+		// 先持有 PENDING 阻止新的读者，待其他读者全部退出后升级为 EXCLUSIVE
+		if st.pending != nil && st.pending != f {
+			acquired = false
+			break
+		}
+		st.pending = f
+		if st.shared > 1 {
+			f.lockLevel = lockPending
+			acquired = false
+			break
+		}
+		st.exclusive = f
+		f.lockLevel = lockExclusive
+	}
+	f.fs.mutex.Unlock()
+
+	if refresh {
+		if err := f.Refresh(); err != nil {
+			f.Unlock(lockNone)
+			return false, err
+		}
+	}
+	return acquired, nil
+}
+
+// Unlock 将文件锁降低到 level（SHARED 或 NONE）
+func (f *File) Unlock(level int) {
+	if !f.fs.writable {
+		return
+	}
+
+	f.fs.mutex.Lock()
+	defer f.fs.mutex.Unlock()
+
+	st, ok := f.fs.locks[f.path]
+	if !ok || level >= f.lockLevel {
+		return
+	}
+	if level < lockExclusive && st.exclusive == f {
+		st.exclusive = nil
+	}
+	if level < lockPending && st.pending == f {
+		st.pending = nil
+	}
+	if level < lockReserved && st.reserved == f {
+		st.reserved = nil
+	}
+	if level == lockNone && f.lockLevel >= lockShared {
+		st.shared--
+	}
+	f.lockLevel = level
+	if st.shared == 0 {
+		delete(f.fs.locks, f.path)
+	}
+}
+
+// CheckReservedLock 是否有连接持有 RESERVED 或更高级别的锁
+func (f *File) CheckReservedLock() bool {
+	if !f.fs.writable {
+		return false
+	}
+
+	f.fs.mutex.Lock()
+	defer f.fs.mutex.Unlock()
+
+	st, ok := f.fs.locks[f.path]
+	return ok && (st.reserved != nil || st.pending != nil || st.exclusive != nil)
+}
@@ -0,0 +1,216 @@
+//go:build cgo
+
+#include <stdlib.h>
+#include <string.h>
+
+#include "vfs.h"
+#include "_cgo_export.h"
+
+#define SQLITE_OK               0
+#define SQLITE_NOTFOUND         12
+#define SQLITE_CANTOPEN         14
+#define SQLITE_OPEN_READONLY    0x00000001
+#define SQLITE_OPEN_READWRITE   0x00000002
+#define SQLITE_OPEN_MAIN_DB     0x00000100
+
+// 加密数据库文件句柄，页面的读写、加解密与锁由 Go 实现
+typedef struct chatlog_file {
+	sqlite3_file base;
+	sqlite3_int64 handle;
+} chatlog_file;
+
+static sqlite3_vfs *chatlog_default_vfs(sqlite3_vfs *vfs) {
+	return (sqlite3_vfs *)((void **)vfs->pAppData)[0];
+}
+
+static int chatlog_vfs_id(sqlite3_vfs *vfs) {
+	return (int)(size_t)((void **)vfs->pAppData)[1];
+}
+
+static int chatlog_close(sqlite3_file *f) {
+	return goVFSClose(((chatlog_file *)f)->handle);
+}
+
+static int chatlog_read(sqlite3_file *f, void *buf, int amt, sqlite3_int64 offset) {
+	return goVFSRead(((chatlog_file *)f)->handle, buf, amt, offset);
+}
+
+static int chatlog_write(sqlite3_file *f, const void *buf, int amt, sqlite3_int64 offset) {
+	return goVFSWrite(((chatlog_file *)f)->handle, (void *)buf, amt, offset);
+}
+
+static int chatlog_truncate(sqlite3_file *f, sqlite3_int64 size) {
+	return goVFSTruncate(((chatlog_file *)f)->handle, size);
+}
+
+static int chatlog_sync(sqlite3_file *f, int flags) {
+	return goVFSSync(((chatlog_file *)f)->handle);
+}
+
+static int chatlog_file_size(sqlite3_file *f, sqlite3_int64 *size) {
+	return goVFSFileSize(((chatlog_file *)f)->handle, size);
+}
+
+static int chatlog_lock(sqlite3_file *f, int level) {
+	return goVFSLock(((chatlog_file *)f)->handle, level);
+}
+
+static int chatlog_unlock(sqlite3_file *f, int level) {
+	return goVFSUnlock(((chatlog_file *)f)->handle, level);
+}
+
+static int chatlog_check_reserved_lock(sqlite3_file *f, int *out) {
+	return goVFSCheckReservedLock(((chatlog_file *)f)->handle, out);
+}
+
+static int chatlog_file_control(sqlite3_file *f, int op, void *arg) {
+	return SQLITE_NOTFOUND;
+}
+
+static int chatlog_sector_size(sqlite3_file *f) {
+	return 0;
+}
+
+static int chatlog_device_characteristics(sqlite3_file *f) {
+	return 0;
+}
+
+static const sqlite3_io_methods chatlog_io_methods = {
+	1,
+	chatlog_close,
+	chatlog_read,
+	chatlog_write,
+	chatlog_truncate,
+	chatlog_sync,
+	chatlog_file_size,
+	chatlog_lock,
+	chatlog_unlock,
+	chatlog_check_reserved_lock,
+	chatlog_file_control,
+	chatlog_sector_size,
+	chatlog_device_characteristics,
+};
+
+// 主数据库由 Go 加解密读写，日志、临时文件等其余文件交给默认 VFS
+static int chatlog_open(sqlite3_vfs *vfs, const char *name, sqlite3_file *f, int flags, int *outFlags) {
+	if (name == NULL || (flags & SQLITE_OPEN_MAIN_DB) == 0) {
+		sqlite3_vfs *def = chatlog_default_vfs(vfs);
+		return def->xOpen(def, name, f, flags, outFlags);
+	}
+
+	chatlog_file *cf = (chatlog_file *)f;
+	memset(cf, 0, sizeof(chatlog_file));
+	sqlite3_int64 handle = 0;
+	int readonly = 1;
+	int rc = goVFSOpen(chatlog_vfs_id(vfs), (char *)name, &handle, &readonly);
+	if (rc != SQLITE_OK) {
+		return rc;
+	}
+	cf->handle = handle;
+	cf->base.pMethods = &chatlog_io_methods;
+	if (outFlags) {
+		*outFlags = readonly ? SQLITE_OPEN_READONLY : (flags & ~SQLITE_OPEN_READONLY);
+	}
+	return SQLITE_OK;
+}
+
+static int chatlog_delete(sqlite3_vfs *vfs, const char *name, int syncDir) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xDelete(def, name, syncDir);
+}
+
+// WAL 由 Go 合并进页面读取，不让 SQLite 自行打开原始的 -wal / -journal
+// 可写模式使用内存日志，同样不存在 -journal 文件
+static int chatlog_access(sqlite3_vfs *vfs, const char *name, int flags, int *out) {
+	size_t n = strlen(name);
+	if ((n > 4 && strcmp(name + n - 4, "-wal") == 0) || (n > 8 && strcmp(name + n - 8, "-journal") == 0)) {
+		*out = 0;
+		return SQLITE_OK;
+	}
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xAccess(def, name, flags, out);
+}
+
+static int chatlog_full_pathname(sqlite3_vfs *vfs, const char *name, int n, char *out) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xFullPathname(def, name, n, out);
+}
+
+static void *chatlog_dl_open(sqlite3_vfs *vfs, const char *path) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xDlOpen(def, path);
+}
+
+static void chatlog_dl_error(sqlite3_vfs *vfs, int n, char *msg) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	def->xDlError(def, n, msg);
+}
+
+static void (*chatlog_dl_sym(sqlite3_vfs *vfs, void *p, const char *sym))(void) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xDlSym(def, p, sym);
+}
+
+static void chatlog_dl_close(sqlite3_vfs *vfs, void *p) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	def->xDlClose(def, p);
+}
+
+static int chatlog_randomness(sqlite3_vfs *vfs, int n, char *out) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xRandomness(def, n, out);
+}
+
+static int chatlog_sleep(sqlite3_vfs *vfs, int us) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xSleep(def, us);
+}
+
+static int chatlog_current_time(sqlite3_vfs *vfs, double *out) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xCurrentTime(def, out);
+}
+
+static int chatlog_get_last_error(sqlite3_vfs *vfs, int n, char *out) {
+	sqlite3_vfs *def = chatlog_default_vfs(vfs);
+	return def->xGetLastError(def, n, out);
+}
+
+int chatlog_vfs_register(const char *zName, int id) {
+	sqlite3_vfs *def = sqlite3_vfs_find(NULL);
+	if (def == NULL) {
+		return SQLITE_CANTOPEN;
+	}
+
+	sqlite3_vfs *vfs = (sqlite3_vfs *)calloc(1, sizeof(sqlite3_vfs));
+	void **appData = (void **)calloc(2, sizeof(void *));
+	char *name = strdup(zName);
+	if (vfs == NULL || appData == NULL || name == NULL) {
+		free(vfs);
+		free(appData);
+		free(name);
+		return SQLITE_CANTOPEN;
+	}
+	appData[0] = def;
+	appData[1] = (void *)(size_t)id;
+
+	vfs->iVersion = 1;
+	vfs->szOsFile = def->szOsFile > (int)sizeof(chatlog_file) ? def->szOsFile : (int)sizeof(chatlog_file);
+	vfs->mxPathname = def->mxPathname;
+	vfs->zName = name;
+	vfs->pAppData = appData;
+	vfs->xOpen = chatlog_open;
+	vfs->xDelete = chatlog_delete;
+	vfs->xAccess = chatlog_access;
+	vfs->xFullPathname = chatlog_full_pathname;
+	vfs->xDlOpen = chatlog_dl_open;
+	vfs->xDlError = chatlog_dl_error;
+	vfs->xDlSym = chatlog_dl_sym;
+	vfs->xDlClose = chatlog_dl_close;
+	vfs->xRandomness = chatlog_randomness;
+	vfs->xSleep = chatlog_sleep;
+	vfs->xCurrentTime = chatlog_current_time;
+	vfs->xGetLastError = chatlog_get_last_error;
+
+	return sqlite3_vfs_register(vfs, 0);
+}
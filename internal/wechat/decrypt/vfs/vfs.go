@@ -0,0 +1,242 @@
+//go:build cgo
+
+package vfs
+
+/*
+#include <stdlib.h>
+#include "vfs.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+)
+
+// Supported 当前构建是否支持 VFS 模式
+const Supported = true
+
+const (
+	sqliteOK             = 0
+	sqliteBusy           = 5
+	sqliteReadOnly       = 8
+	sqliteIOErr          = 10
+	sqliteCantOpen       = 14
+	sqliteIOErrRead      = sqliteIOErr | (1 << 8)
+	sqliteIOErrShortRead = sqliteIOErr | (2 << 8)
+	sqliteIOErrWrite     = sqliteIOErr | (3 << 8)
+	sqliteIOErrFsync     = sqliteIOErr | (4 << 8)
+	sqliteIOErrTruncate  = sqliteIOErr | (6 << 8)
+	sqliteIOErrFstat     = sqliteIOErr | (7 << 8)
+	sqliteIOErrLock      = sqliteIOErr | (15 << 8)
+)
+
+var (
+	mutex       sync.Mutex
+	filesystems = make(map[int]*FileSystem)
+	names       = make(map[string]int)
+	files       = make(map[int64]*File)
+	nextFile    int64
+)
+
+// Register 注册名为 name 的只读 VFS，通过 decryptor 与 hexKey 按需解密数据库
+// 同名 VFS 已注册时更新其解密器与密钥
+// 使用时以 file:<path>?vfs=<name>&mode=ro 打开数据库
+func Register(name string, decryptor decrypt.Decryptor, hexKey string, cacheSize int) error {
+	fs, err := NewFileSystem(decryptor, hexKey, cacheSize)
+	if err != nil {
+		return err
+	}
+	return register(name, fs)
+}
+
+// RegisterWritable 注册名为 name 的可读写 VFS，数据库页面以 hexKey 按 decryptor 的页面格式加密存储
+// 不支持 WAL，使用时以 file:<path>?vfs=<name>&_journal=MEMORY 打开数据库
+func RegisterWritable(name string, decryptor decrypt.Decryptor, hexKey string, cacheSize int) error {
+	fs, err := NewWritableFileSystem(decryptor, hexKey, cacheSize)
+	if err != nil {
+		return err
+	}
+	return register(name, fs)
+}
+
+func register(name string, fs *FileSystem) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if id, ok := names[name]; ok {
+		filesystems[id] = fs
+		return nil
+	}
+
+	id := len(names) + 1
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	if rc := C.chatlog_vfs_register(cName, C.int(id)); rc != sqliteOK {
+		return fmt.Errorf("register sqlite vfs %s failed: %d", name, int(rc))
+	}
+	names[name] = id
+	filesystems[id] = fs
+	return nil
+}
+
+//export goVFSOpen
+func goVFSOpen(id C.int, name *C.char, handle *C.sqlite3_int64, readonly *C.int) C.int {
+	mutex.Lock()
+	fs, ok := filesystems[int(id)]
+	mutex.Unlock()
+	if !ok {
+		return sqliteCantOpen
+	}
+
+	path := C.GoString(name)
+	f, err := fs.Open(path)
+	if err != nil {
+		log.Err(err).Msgf("vfs open %s failed", path)
+		return sqliteCantOpen
+	}
+
+	mutex.Lock()
+	nextFile++
+	files[nextFile] = f
+	*handle = C.sqlite3_int64(nextFile)
+	mutex.Unlock()
+	*readonly = 1
+	if fs.Writable() {
+		*readonly = 0
+	}
+	return sqliteOK
+}
+
+func getFile(handle C.sqlite3_int64) *File {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return files[int64(handle)]
+}
+
+//export goVFSClose
+func goVFSClose(handle C.sqlite3_int64) C.int {
+	mutex.Lock()
+	f, ok := files[int64(handle)]
+	delete(files, int64(handle))
+	mutex.Unlock()
+	if ok {
+		f.Close()
+	}
+	return sqliteOK
+}
+
+//export goVFSRead
+func goVFSRead(handle C.sqlite3_int64, buf unsafe.Pointer, amt C.int, offset C.sqlite3_int64) C.int {
+	f := getFile(handle)
+	if f == nil {
+		return sqliteIOErrRead
+	}
+	p := unsafe.Slice((*byte)(buf), int(amt))
+	if _, err := f.ReadAt(p, int64(offset)); err != nil {
+		if err == io.EOF {
+			return sqliteIOErrShortRead
+		}
+		log.Debug().Err(err).Msgf("vfs read %s failed", f.path)
+		return sqliteIOErrRead
+	}
+	return sqliteOK
+}
+
+//export goVFSWrite
+func goVFSWrite(handle C.sqlite3_int64, buf unsafe.Pointer, amt C.int, offset C.sqlite3_int64) C.int {
+	f := getFile(handle)
+	if f == nil {
+		return sqliteIOErrWrite
+	}
+	if !f.fs.Writable() {
+		return sqliteReadOnly
+	}
+	p := unsafe.Slice((*byte)(buf), int(amt))
+	if _, err := f.WriteAt(p, int64(offset)); err != nil {
+		log.Err(err).Msgf("vfs write %s failed", f.path)
+		return sqliteIOErrWrite
+	}
+	return sqliteOK
+}
+
+//export goVFSTruncate
+func goVFSTruncate(handle C.sqlite3_int64, size C.sqlite3_int64) C.int {
+	f := getFile(handle)
+	if f == nil {
+		return sqliteIOErrTruncate
+	}
+	if !f.fs.Writable() {
+		return sqliteReadOnly
+	}
+	if err := f.Truncate(int64(size)); err != nil {
+		log.Err(err).Msgf("vfs truncate %s failed", f.path)
+		return sqliteIOErrTruncate
+	}
+	return sqliteOK
+}
+
+//export goVFSSync
+func goVFSSync(handle C.sqlite3_int64) C.int {
+	f := getFile(handle)
+	if f == nil {
+		return sqliteIOErrFsync
+	}
+	if !f.fs.Writable() {
+		return sqliteOK
+	}
+	if err := f.Sync(); err != nil {
+		return sqliteIOErrFsync
+	}
+	return sqliteOK
+}
+
+//export goVFSFileSize
+func goVFSFileSize(handle C.sqlite3_int64, size *C.sqlite3_int64) C.int {
+	f := getFile(handle)
+	if f == nil {
+		return sqliteIOErrFstat
+	}
+	*size = C.sqlite3_int64(f.Size())
+	return sqliteOK
+}
+
+//export goVFSLock
+func goVFSLock(handle C.sqlite3_int64, level C.int) C.int {
+	f := getFile(handle)
+	if f == nil {
+		return sqliteIOErrLock
+	}
+	acquired, err := f.Lock(int(level))
+	if err != nil {
+		log.Debug().Err(err).Msgf("vfs refresh %s failed", f.path)
+		return sqliteIOErrFstat
+	}
+	if !acquired {
+		return sqliteBusy
+	}
+	return sqliteOK
+}
+
+//export goVFSUnlock
+func goVFSUnlock(handle C.sqlite3_int64, level C.int) C.int {
+	if f := getFile(handle); f != nil {
+		f.Unlock(int(level))
+	}
+	return sqliteOK
+}
+
+//export goVFSCheckReservedLock
+func goVFSCheckReservedLock(handle C.sqlite3_int64, out *C.int) C.int {
+	*out = 0
+	if f := getFile(handle); f != nil && f.CheckReservedLock() {
+		*out = 1
+	}
+	return sqliteOK
+}
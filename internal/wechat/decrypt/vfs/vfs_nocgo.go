@@ -0,0 +1,21 @@
+//go:build !cgo
+
+package vfs
+
+import (
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+)
+
+// Supported 当前构建是否支持 VFS 模式
+const Supported = false
+
+// Register 未启用 cgo 时不支持 VFS 模式
+func Register(name string, decryptor decrypt.Decryptor, hexKey string, cacheSize int) error {
+	return errors.ErrVFSUnsupported
+}
+
+// RegisterWritable 未启用 cgo 时不支持 VFS 模式
+func RegisterWritable(name string, decryptor decrypt.Decryptor, hexKey string, cacheSize int) error {
+	return errors.ErrVFSUnsupported
+}
@@ -0,0 +1,306 @@
+//go:build cgo
+
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/darwin"
+)
+
+// encryptDB 按 SQLCipher 页面格式加密明文数据库
+func encryptDB(t *testing.T, pd *common.PageDecryptor, salt []byte, plain []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(pd.EncKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	for n := 0; n*pd.PageSize < len(plain); n++ {
+		src := plain[n*pd.PageSize : (n+1)*pd.PageSize]
+		page := make([]byte, pd.PageSize)
+		offset := 0
+		if n == 0 {
+			offset = common.SaltSize
+			copy(page, salt)
+		}
+		dataEnd := pd.PageSize - pd.Reserve
+		iv := page[dataEnd : dataEnd+common.IVSize]
+		sum := sha256.Sum256(append([]byte{byte(n)}, src...))
+		copy(iv, sum[:])
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(page[offset:dataEnd], src[offset:dataEnd])
+
+		mac := hmac.New(pd.HashFunc, pd.MacKey)
+		mac.Write(page[offset : dataEnd+common.IVSize])
+		pageNo := make([]byte, 4)
+		binary.LittleEndian.PutUint32(pageNo, uint32(n+1))
+		mac.Write(pageNo)
+		copy(page[dataEnd+common.IVSize:], mac.Sum(nil))
+		out.Write(page)
+	}
+	return out.Bytes()
+}
+
+// createPlainDB 创建预留了 IV 与 HMAC 空间的明文数据库
+func createPlainDB(t *testing.T, path string, pageSize, reserve int) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(context.Background(), fmt.Sprintf("PRAGMA page_size = %d", pageSize)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Raw(func(c any) error {
+		return c.(*sqlite3.SQLiteConn).SetFileControlInt("main", sqlite3.SQLITE_FCNTL_RESERVE_BYTES, reserve)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(), "CREATE TABLE msg (id INTEGER PRIMARY KEY, content TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestVFS(t *testing.T) {
+	d := darwin.NewV3Decryptor()
+	key := make([]byte, common.KeySize)
+	salt := make([]byte, common.SaltSize)
+	rand.Read(key)
+	rand.Read(salt)
+	pd := d.NewPageDecryptor(key, salt)
+
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain.db")
+	encPath := filepath.Join(dir, "msg_0.db")
+
+	plain := createPlainDB(t, plainPath, d.GetPageSize(), d.GetReserve())
+	defer plain.Close()
+
+	insert := func(from, to int) {
+		t.Helper()
+		for i := from; i < to; i++ {
+			if _, err := plain.Exec("INSERT INTO msg (id, content) VALUES (?, ?)", i, fmt.Sprintf("message %d %x", i, bytes.Repeat([]byte{byte(i)}, 64))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data, err := os.ReadFile(plainPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(encPath, encryptDB(t, pd, salt, data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert(0, 200)
+
+	if err := Register("chatlog-test", d, hex.EncodeToString(key), 16); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?vfs=chatlog-test&mode=ro", filepath.ToSlash(encPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	count := func() (n int, last string) {
+		t.Helper()
+		if err := db.QueryRow("SELECT COUNT(*), MAX(content) FROM msg").Scan(&n, &last); err != nil {
+			t.Fatal(err)
+		}
+		return n, last
+	}
+
+	if n, _ := count(); n != 200 {
+		t.Fatalf("expected 200 rows, got %d", n)
+	}
+
+	// 原始文件更新后，同一连接能读到新数据
+	insert(200, 300)
+	if n, _ := count(); n != 300 {
+		t.Fatalf("expected 300 rows after update, got %d", n)
+	}
+
+	if _, err := db.Exec("INSERT INTO msg (id, content) VALUES (1000, 'x')"); err == nil {
+		t.Fatalf("expected write to fail on read-only vfs")
+	}
+
+	// 密钥错误时无法打开
+	if err := Register("chatlog-test-badkey", d, hex.EncodeToString(make([]byte, common.KeySize)), 0); err != nil {
+		t.Fatal(err)
+	}
+	bad, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?vfs=chatlog-test-badkey&mode=ro", filepath.ToSlash(encPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bad.Close()
+	var n int
+	if err := bad.QueryRow("SELECT COUNT(*) FROM msg").Scan(&n); err == nil {
+		t.Fatalf("expected open with wrong key to fail")
+	}
+}
+
+// encryptWAL 加密 WAL 中各帧的页面，帧头保持不变
+func encryptWAL(t *testing.T, pd *common.PageDecryptor, salt []byte, wal []byte) []byte {
+	t.Helper()
+	out := append([]byte(nil), wal[:common.WALHeaderSize]...)
+	frameSize := common.WALFrameHeaderSize + pd.PageSize
+	for off := common.WALHeaderSize; off+frameSize <= len(wal); off += frameSize {
+		header := wal[off : off+common.WALFrameHeaderSize]
+		pgno := int(binary.BigEndian.Uint32(header[0:4]))
+		page := make([]byte, pgno*pd.PageSize)
+		copy(page[(pgno-1)*pd.PageSize:], wal[off+common.WALFrameHeaderSize:off+frameSize])
+		enc := encryptDB(t, pd, salt, page)
+		out = append(out, header...)
+		out = append(out, enc[(pgno-1)*pd.PageSize:]...)
+	}
+	return out
+}
+
+func TestVFSWAL(t *testing.T) {
+	d := darwin.NewV3Decryptor()
+	key := make([]byte, common.KeySize)
+	salt := make([]byte, common.SaltSize)
+	rand.Read(key)
+	rand.Read(salt)
+	pd := d.NewPageDecryptor(key, salt)
+
+	dir := t.TempDir()
+	plainPath := filepath.Join(dir, "plain.db")
+	encPath := filepath.Join(dir, "msg_0.db")
+
+	plain := createPlainDB(t, plainPath, d.GetPageSize(), d.GetReserve())
+	defer plain.Close()
+	for _, stmt := range []string{"PRAGMA journal_mode = WAL", "PRAGMA wal_autocheckpoint = 0", "INSERT INTO msg (id, content) VALUES (1, 'checkpointed')", "PRAGMA wal_checkpoint(TRUNCATE)", "INSERT INTO msg (id, content) VALUES (2, 'in wal')"} {
+		if _, err := plain.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(plainPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal, err := os.ReadFile(plainPath + common.WALSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(encPath, encryptDB(t, pd, salt, data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(encPath+common.WALSuffix, encryptWAL(t, pd, salt, wal), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Register("chatlog-test-wal", d, hex.EncodeToString(key), 0); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?vfs=chatlog-test-wal&mode=ro", filepath.ToSlash(encPath)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM msg").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows including wal, got %d", n)
+	}
+}
+
+func TestVFSWritable(t *testing.T) {
+	d := darwin.NewV3Decryptor()
+	key := make([]byte, common.KeySize)
+	rand.Read(key)
+	if err := RegisterWritable("chatlog-test-rw", d, hex.EncodeToString(key), 16); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.db")
+	dsn := fmt.Sprintf("file:%s?vfs=chatlog-test-rw&_journal=MEMORY&_busy_timeout=5000", filepath.ToSlash(path))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(), fmt.Sprintf("PRAGMA page_size = %d", d.GetPageSize())); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Raw(func(c any) error {
+		return c.(*sqlite3.SQLiteConn).SetFileControlInt("main", sqlite3.SQLITE_FCNTL_RESERVE_BYTES, d.GetReserve())
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ExecContext(context.Background(), "CREATE TABLE msg (id INTEGER PRIMARY KEY, content TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// 多个连接并发写入，由 VFS 的进程内锁串行化
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if _, err := db.Exec("INSERT INTO msg (content) VALUES (?)", fmt.Sprintf("secret message %d-%d", w, i)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	db.Close()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(raw, []byte(common.SQLiteHeader)) || bytes.Contains(raw, []byte("secret message")) {
+		t.Fatalf("database is stored in plaintext")
+	}
+
+	db, err = sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM msg").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 200 {
+		t.Fatalf("expected 200 rows, got %d", n)
+	}
+}
@@ -0,0 +1,87 @@
+package decrypt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+)
+
+const (
+	// WorkDirKeyFile 工作目录加密的密钥文件，保存口令派生所用的 salt 与校验值
+	WorkDirKeyFile = ".chatlog.key"
+
+	workDirKeyIterations = 256000
+	workDirKeyVerifier   = "chatlog work dir"
+)
+
+type workDirKeyFile struct {
+	Salt     string `json:"salt"`
+	Verifier string `json:"verifier"`
+}
+
+// WorkDirKey 由口令派生工作目录加密密钥，返回十六进制字符串
+// 首次调用时在 workDir 下生成密钥文件，之后以文件中的校验值验证口令
+func WorkDirKey(workDir string, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", errors.ErrIncorrectPassphrase
+	}
+	path := filepath.Join(workDir, WorkDirKeyFile)
+
+	var kf workDirKeyFile
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &kf); err != nil {
+			return "", errors.ReadFileFailed(path, err)
+		}
+		salt, err := hex.DecodeString(kf.Salt)
+		if err != nil {
+			return "", errors.DecodeKeyFailed(err)
+		}
+		key := deriveWorkDirKey(passphrase, salt)
+		if !hmac.Equal([]byte(workDirVerifier(key)), []byte(kf.Verifier)) {
+			return "", errors.ErrIncorrectPassphrase
+		}
+		return hex.EncodeToString(key), nil
+	case os.IsNotExist(err):
+		salt := make([]byte, common.SaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := deriveWorkDirKey(passphrase, salt)
+		kf = workDirKeyFile{Salt: hex.EncodeToString(salt), Verifier: workDirVerifier(key)}
+		data, err := json.Marshal(kf)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(workDir, 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return "", errors.WriteOutputFailed(err)
+		}
+		return hex.EncodeToString(key), nil
+	default:
+		return "", errors.ReadFileFailed(path, err)
+	}
+}
+
+func deriveWorkDirKey(passphrase string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, workDirKeyIterations, common.KeySize, sha512.New)
+}
+
+func workDirVerifier(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(workDirKeyVerifier))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,141 @@
+package key
+
+import (
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt"
+)
+
+const (
+	// DumpChunkSize 内存镜像按块并发搜索
+	DumpChunkSize = 16 * 1024 * 1024
+	// DumpChunkOverlap 相邻块的重叠字节数，需大于所有特征的偏移
+	DumpChunkOverlap = 1024
+	// MaxDumpWorkers 最大并发搜索数
+	MaxDumpWorkers = 8
+)
+
+// ImgKeySearcher 可选，支持在内存中搜索图片密钥的提取器
+type ImgKeySearcher interface {
+	SearchImgKey(ctx context.Context, memory []byte) (string, bool)
+}
+
+// SearchDumpFile 在内存镜像文件（如 dumpmemory 的输出）中搜索密钥
+// 候选密钥以 dataDir 中的数据库与图片文件校验，不依赖微信进程，可在任意系统上运行
+// 目前仅 macOS 的提取器支持直接搜索内存镜像，Windows 的提取器需读取进程内存中的指针
+func SearchDumpFile(ctx context.Context, platform string, version int, dataDir string, dumpFile string) (string, string, error) {
+	extractor, err := NewExtractor(platform, version)
+	if err != nil {
+		return "", "", err
+	}
+	if platform != "darwin" {
+		return "", "", errors.PlatformUnsupported(platform, version)
+	}
+
+	validator, err := decrypt.NewValidator(platform, version, dataDir)
+	if err != nil {
+		return "", "", err
+	}
+	extractor.SetValidate(validator)
+
+	// 镜像可能有数 GB，按块读取而不是整体载入内存
+	f, err := os.Open(dumpFile)
+	if err != nil {
+		return "", "", errors.OpenFileFailed(dumpFile, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", "", errors.StatFileFailed(dumpFile, err)
+	}
+
+	return SearchDump(ctx, extractor, f, info.Size())
+}
+
+// SearchDump 将内存镜像分块读取后并发搜索数据密钥与图片密钥，找到任一密钥即返回成功
+// 同一时刻最多只有 workers+1 个块在内存中
+func SearchDump(ctx context.Context, extractor Extractor, memory io.ReaderAt, size int64) (string, string, error) {
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	imgSearcher, _ := extractor.(ImgKeySearcher)
+
+	// 从后向前分块，与进程内存搜索的顺序一致
+	var readErr error
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		for end := size; end > 0; end -= DumpChunkSize {
+			start := max(end-DumpChunkSize-DumpChunkOverlap, 0)
+			chunk := make([]byte, end-start)
+			if n, err := memory.ReadAt(chunk, start); n < len(chunk) {
+				readErr = errors.ReadMemoryFailed(err)
+				cancel()
+				return
+			}
+			select {
+			case chunks <- chunk:
+			case <-searchCtx.Done():
+				return
+			}
+		}
+	}()
+
+	var mutex sync.Mutex
+	var dataKey, imgKey string
+	found := func() (bool, bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return dataKey != "", imgKey != "" || imgSearcher == nil
+	}
+
+	workers := min(max(runtime.NumCPU(), 2), MaxDumpWorkers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				hasDataKey, hasImgKey := found()
+				if !hasDataKey {
+					if key, ok := extractor.SearchKey(searchCtx, chunk); ok {
+						mutex.Lock()
+						dataKey = key
+						mutex.Unlock()
+						log.Debug().Msg("Data key found: " + key)
+					}
+				}
+				if !hasImgKey {
+					if key, ok := imgSearcher.SearchImgKey(searchCtx, chunk); ok {
+						mutex.Lock()
+						imgKey = key
+						mutex.Unlock()
+						log.Debug().Msg("Image key found: " + key)
+					}
+				}
+				if hasDataKey, hasImgKey = found(); hasDataKey && hasImgKey {
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	if readErr != nil {
+		return "", "", readErr
+	}
+	if dataKey == "" && imgKey == "" {
+		return "", "", errors.ErrNoValidKey
+	}
+	return dataKey, imgKey, nil
+}
@@ -0,0 +1,93 @@
+package key
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/common"
+	"github.com/sjzar/chatlog/internal/wechat/decrypt/darwin"
+)
+
+// writeV3DataDir 生成仅包含加密首页的 macOS V3 数据目录
+func writeV3DataDir(t *testing.T, key []byte) string {
+	t.Helper()
+	d := darwin.NewV3Decryptor()
+	salt := make([]byte, common.SaltSize)
+	rand.Read(salt)
+	plain := make([]byte, d.GetPageSize())
+	copy(plain, common.SQLiteHeader)
+	page, err := d.NewPageDecryptor(key, salt).Encrypt(plain, 0, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, "Message", "msg_0.db")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, page, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dataDir
+}
+
+func TestSearchDumpFile(t *testing.T) {
+	key := make([]byte, common.KeySize)
+	rand.Read(key)
+	dataDir := writeV3DataDir(t, key)
+
+	// 密钥位于 rtree_i32 特征之后 24 字节处，跨越两个搜索块的边界
+	memory := make([]byte, DumpChunkSize+4*1024*1024)
+	rand.Read(memory)
+	pattern := []byte("rtree_i32")
+	decoy := len(memory) - 4096
+	copy(memory[decoy:], pattern)
+	offset := len(memory) - DumpChunkSize - 5
+	copy(memory[offset:], pattern)
+	copy(memory[offset+24:], key)
+
+	dumpFile := filepath.Join(t.TempDir(), "wechat.bin")
+	if err := os.WriteFile(dumpFile, memory, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dataKey, imgKey, err := SearchDumpFile(context.Background(), "darwin", 3, dataDir, dumpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataKey != hex.EncodeToString(key) || imgKey != "" {
+		t.Fatalf("unexpected keys %s %s", dataKey, imgKey)
+	}
+
+	// 镜像中没有有效密钥
+	copy(memory[offset+24:], bytes.Repeat([]byte{1}, common.KeySize))
+	if err := os.WriteFile(dumpFile, memory, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := SearchDumpFile(context.Background(), "darwin", 3, dataDir, dumpFile); err != errors.ErrNoValidKey {
+		t.Fatalf("expected ErrNoValidKey, got %v", err)
+	}
+
+	if _, _, err := SearchDumpFile(context.Background(), "windows", 4, dataDir, dumpFile); err == nil {
+		t.Fatalf("expected windows dump search to be unsupported")
+	}
+}
+
+func TestSearchDumpReadFailed(t *testing.T) {
+	extractor, err := NewExtractor("darwin", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 声明的大小超过实际内容，读取不完整时返回错误而不是搜索残缺的块
+	memory := bytes.NewReader(make([]byte, 1024))
+	if _, _, err := SearchDump(context.Background(), extractor, memory, 4096); err == nil || err == errors.ErrNoValidKey {
+		t.Fatalf("expected read error, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package key
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+)
+
+// KeyringFile 密钥环文件名，位于配置目录下
+const KeyringFile = "keyring.json"
+
+// KeyringEntry 曾经校验通过的密钥
+type KeyringEntry struct {
+	Account       string `json:"account"`
+	Platform      string `json:"platform"`
+	Version       int    `json:"version"`
+	DataKey       string `json:"data_key"`
+	ImgKey        string `json:"img_key,omitempty"`
+	LastValidated int64  `json:"last_validated"`
+}
+
+// Keyring 按账号与微信版本保存校验通过的密钥
+// 获取密钥时先尝试密钥环中的密钥，均无效时再读取进程内存
+type Keyring struct {
+	path    string
+	mutex   sync.Mutex
+	entries []KeyringEntry
+}
+
+// NewKeyring 加载 path 处的密钥环，文件不存在时为空
+func NewKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path, entries: make([]KeyringEntry, 0)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return k, nil
+		}
+		return nil, errors.ReadFileFailed(path, err)
+	}
+	if err := json.Unmarshal(data, &k.entries); err != nil {
+		return nil, errors.ReadFileFailed(path, err)
+	}
+	return k, nil
+}
+
+// Lookup 返回账号在该平台与版本下的密钥，最近校验通过的在前
+func (k *Keyring) Lookup(account, platform string, version int) []KeyringEntry {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	entries := make([]KeyringEntry, 0)
+	for _, e := range k.entries {
+		if e.Account == account && e.Platform == platform && e.Version == version {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastValidated > entries[j].LastValidated
+	})
+	return entries
+}
+
+// Add 记录校验通过的密钥并保存，数据密钥相同的条目合并
+// imgKey 为空时保留已有的图片密钥
+func (k *Keyring) Add(account, platform string, version int, dataKey, imgKey string) error {
+	if account == "" || dataKey == "" {
+		return nil
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	now := time.Now().Unix()
+	found := false
+	for i, e := range k.entries {
+		if e.Account == account && e.Platform == platform && e.Version == version && e.DataKey == dataKey {
+			if imgKey != "" {
+				k.entries[i].ImgKey = imgKey
+			}
+			k.entries[i].LastValidated = now
+			found = true
+			break
+		}
+	}
+	if !found {
+		k.entries = append(k.entries, KeyringEntry{
+			Account:       account,
+			Platform:      platform,
+			Version:       version,
+			DataKey:       dataKey,
+			ImgKey:        imgKey,
+			LastValidated: now,
+		})
+	}
+	return k.saveLocked()
+}
+
+func (k *Keyring) saveLocked() error {
+	data, err := json.MarshalIndent(k.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0755); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	if err := os.WriteFile(k.path, data, 0600); err != nil {
+		return errors.WriteOutputFailed(err)
+	}
+	return nil
+}
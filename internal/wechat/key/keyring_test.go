@@ -0,0 +1,44 @@
+package key
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), KeyringFile)
+	k, err := NewKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Add("wxid_a", "darwin", 4, "aa", "11"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Add("wxid_a", "darwin", 4, "bb", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Add("wxid_a", "darwin", 3, "cc", ""); err != nil {
+		t.Fatal(err)
+	}
+	// 重复的数据密钥合并，保留已有的图片密钥
+	if err := k.Add("wxid_a", "darwin", 4, "aa", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err = NewKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := k.Lookup("wxid_a", "darwin", 4)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	for _, e := range entries {
+		if e.DataKey == "aa" && e.ImgKey != "11" {
+			t.Fatalf("image key lost: %+v", e)
+		}
+	}
+	if len(k.Lookup("wxid_b", "darwin", 4)) != 0 {
+		t.Fatalf("unexpected entries for other account")
+	}
+}
@@ -3,8 +3,10 @@ package wechat
 import (
 	"context"
 	"runtime"
+	"sync"
 
 	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/wechat/key"
 	"github.com/sjzar/chatlog/internal/wechat/model"
 	"github.com/sjzar/chatlog/internal/wechat/process"
 )
@@ -32,11 +34,20 @@ func GetAccounts() []*Account {
 	return DefaultManager.GetAccounts()
 }
 
+// SetKeyring 设置默认管理器获取密钥时使用的密钥环
+func SetKeyring(k *key.Keyring) {
+	DefaultManager.SetKeyring(k)
+}
+
 // Manager 微信管理器
 type Manager struct {
 	detector   process.Detector
 	accounts   []*Account
 	processMap map[string]*model.Process
+
+	// keyring 获取密钥时优先尝试的密钥环，为 nil 时直接读取进程内存
+	keyringMutex sync.RWMutex
+	keyring      *key.Keyring
 }
 
 // NewManager 创建新的微信管理器
@@ -62,6 +73,7 @@ func (m *Manager) Load() error {
 
 	for _, p := range processes {
 		account := NewAccount(p)
+		account.manager = m
 
 		accounts = append(accounts, account)
 		if account.Name != "" {
@@ -81,7 +93,23 @@ func (m *Manager) GetAccount(name string) (*Account, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewAccount(p), nil
+	account := NewAccount(p)
+	account.manager = m
+	return account, nil
+}
+
+// SetKeyring 设置获取密钥时使用的密钥环，已加载的账号同样生效
+func (m *Manager) SetKeyring(k *key.Keyring) {
+	m.keyringMutex.Lock()
+	defer m.keyringMutex.Unlock()
+	m.keyring = k
+}
+
+// Keyring 返回获取密钥时使用的密钥环，未设置时返回 nil
+func (m *Manager) Keyring() *key.Keyring {
+	m.keyringMutex.RLock()
+	defer m.keyringMutex.RUnlock()
+	return m.keyring
 }
 
 func (m *Manager) GetProcess(name string) (*model.Process, error) {
@@ -2,8 +2,11 @@ package wechat
 
 import (
 	"context"
+	"encoding/hex"
 	"os"
 
+	"github.com/rs/zerolog/log"
+
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/wechat/decrypt"
 	"github.com/sjzar/chatlog/internal/wechat/key"
@@ -22,6 +25,12 @@ type Account struct {
 	PID         uint32
 	ExePath     string
 	Status      string
+
+	// KeyReport 最近一次获取密钥后，密钥对各分组数据库的校验结果
+	KeyReport *decrypt.KeyReport
+
+	// manager 创建该账号的管理器，提供密钥环
+	manager *Manager
 }
 
 // NewAccount 创建新的账号对象
@@ -70,6 +79,12 @@ func (a *Account) GetKey(ctx context.Context) (string, string, error) {
 		return a.Key, a.ImgKey, nil
 	}
 
+	// 先尝试密钥环中曾校验通过的密钥，命中时无需读取进程内存
+	if dataKey, imgKey, ok := a.keyFromKeyring(); ok {
+		a.Key, a.ImgKey = dataKey, imgKey
+		return dataKey, imgKey, nil
+	}
+
 	// 刷新进程状态
 	if err := a.RefreshStatus(); err != nil {
 		return "", "", errors.RefreshProcessStatusFailed(err)
@@ -112,9 +127,79 @@ func (a *Account) GetKey(ctx context.Context) (string, string, error) {
 		a.ImgKey = imgKey
 	}
 
+	if dataKey != "" {
+		a.validateAll(validator, dataKey)
+		if keyring := a.keyring(); keyring != nil {
+			if err := keyring.Add(a.Name, a.Platform, a.Version, dataKey, imgKey); err != nil {
+				log.Debug().Err(err).Msg("failed to save keyring")
+			}
+		}
+	}
+
 	return dataKey, imgKey, nil
 }
 
+// keyFromKeyring 依次以数据目录校验密钥环中该账号的密钥，数据密钥与图片密钥均有效时返回
+func (a *Account) keyFromKeyring() (string, string, bool) {
+	keyring := a.keyring()
+	if keyring == nil || a.DataDir == "" {
+		return "", "", false
+	}
+	entries := keyring.Lookup(a.Name, a.Platform, a.Version)
+	if len(entries) == 0 {
+		return "", "", false
+	}
+
+	validator, err := decrypt.NewValidator(a.Platform, a.Version, a.DataDir)
+	if err != nil {
+		log.Debug().Err(err).Msg("failed to create validator for keyring")
+		return "", "", false
+	}
+
+	for _, e := range entries {
+		key, err := hex.DecodeString(e.DataKey)
+		if err != nil || !validator.Validate(key) {
+			continue
+		}
+		if a.Version != 3 {
+			imgKey, err := hex.DecodeString(e.ImgKey)
+			if err != nil || len(imgKey) == 0 {
+				continue
+			}
+			if validator.CanValidateImgKey() && !validator.ValidateImgKey(imgKey) {
+				continue
+			}
+		}
+		log.Info().Msgf("use key from keyring for account %s", a.Name)
+		a.validateAll(validator, e.DataKey)
+		if err := keyring.Add(a.Name, a.Platform, a.Version, e.DataKey, e.ImgKey); err != nil {
+			log.Debug().Err(err).Msg("failed to save keyring")
+		}
+		return e.DataKey, e.ImgKey, true
+	}
+	return "", "", false
+}
+
+// keyring 返回账号所属管理器的密钥环
+func (a *Account) keyring() *key.Keyring {
+	if a.manager == nil {
+		return nil
+	}
+	return a.manager.Keyring()
+}
+
+// validateAll 以数据密钥校验各分组的数据库，记录无法打开的文件
+func (a *Account) validateAll(validator *decrypt.Validator, dataKey string) {
+	key, err := hex.DecodeString(dataKey)
+	if err != nil {
+		return
+	}
+	a.KeyReport = validator.ValidateAll(key)
+	for _, f := range a.KeyReport.Failed() {
+		log.Warn().Str("file", f.File).Str("group", f.Group).Str("error", f.Error).Msgf("data key can not open %s", f.File)
+	}
+}
+
 // DecryptDatabase 解密数据库
 func (a *Account) DecryptDatabase(ctx context.Context, dbPath, outputPath string) error {
 	// 获取密钥
@@ -30,6 +30,7 @@ const (
 	ChatRoom = "chatroom"
 	Session  = "session"
 	Media    = "media"
+	Favorite = "favorite"
 )
 
 var Groups = []*dbm.Group{
@@ -58,6 +59,11 @@ var Groups = []*dbm.Group{
 		Pattern:   `^hldata\.db$`,
 		BlackList: []string{},
 	},
+	{
+		Name:      Favorite,
+		Pattern:   `^fav(orites)?\.db$`,
+		BlackList: []string{},
+	},
 }
 
 type DataSource struct {
@@ -72,10 +78,10 @@ type DataSource struct {
 	messageStoreMu     sync.RWMutex
 }
 
-func New(path string) (*DataSource, error) {
+func New(path string, opts ...dbm.Option) (*DataSource, error) {
 	ds := &DataSource{
 		path:               path,
-		dbm:                dbm.NewDBManager(path),
+		dbm:                dbm.NewDBManager(path, opts...),
 		talkerDBMap:        make(map[string]string),
 		user2DisplayName:   make(map[string]string),
 		messageStores:      make([]*msgstore.Store, 0),
@@ -468,6 +474,16 @@ func (ds *DataSource) initChatRoomDb() error {
 }
 
 func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
+	return ds.getMessages(ctx, startTime, endTime, talker, sender, keyword, nil, limit, offset)
+}
+
+// GetMessagesByType 查询指定类型的消息，类型条件在 SQL 中过滤
+func (ds *DataSource) GetMessagesByType(ctx context.Context, startTime, endTime time.Time, talker string, types []int64) ([]*model.Message, error) {
+	return ds.getMessages(ctx, startTime, endTime, talker, "", "", types, 0, 0)
+}
+
+// getMessages types 非空时只查询这些类型的消息
+func (ds *DataSource) getMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, types []int64, limit, offset int) ([]*model.Message, error) {
 	if talker == "" {
 		return nil, errors.ErrTalkerEmpty
 	}
@@ -519,15 +535,24 @@ func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.T
 		tableName := fmt.Sprintf("Chat_%s", talkerMd5)
 
 		// 构建查询条件
+		conditions := []string{"msgCreateTime >= ? AND msgCreateTime <= ?"}
+		args := []interface{}{startTime.Unix(), endTime.Unix()}
+		if len(types) > 0 {
+			conditions = append(conditions, "messageType IN ("+strings.TrimSuffix(strings.Repeat("?,", len(types)), ",")+")")
+			for _, t := range types {
+				args = append(args, t)
+			}
+		}
+
 		query := fmt.Sprintf(`
-			SELECT msgCreateTime, msgContent, messageType, mesDes
+			SELECT mesLocalID, msgCreateTime, msgContent, messageType, mesDes
 			FROM %s 
-			WHERE msgCreateTime >= ? AND msgCreateTime <= ? 
-			ORDER BY msgCreateTime ASC
-		`, tableName)
+			WHERE %s 
+			ORDER BY msgCreateTime ASC, mesLocalID ASC
+		`, tableName, strings.Join(conditions, " AND "))
 
 		// 执行查询
-		rows, err := db.QueryContext(ctx, query, startTime.Unix(), endTime.Unix())
+		rows, err := db.QueryContext(ctx, query, args...)
 		if err != nil {
 			// 如果表不存在，跳过此talker
 			if strings.Contains(err.Error(), "no such table") {
@@ -541,6 +566,7 @@ func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.T
 		for rows.Next() {
 			var msg model.MessageDarwinV3
 			err := rows.Scan(
+				&msg.MesLocalID,
 				&msg.MsgCreateTime,
 				&msg.MsgContent,
 				&msg.MessageType,
@@ -805,13 +831,13 @@ func (ds *DataSource) GetSessions(ctx context.Context, key string, limit, offset
 
 	if key != "" {
 		// 按照关键字查询
-		query = `SELECT m_nsUserName, m_uLastTime 
+		query = `SELECT m_nsUserName, m_uLastTime, IFNULL(m_uUnReadCount, 0) 
 				FROM SessionAbstract 
 				WHERE m_nsUserName = ?`
 		args = []interface{}{key}
 	} else {
 		// 查询所有会话
-		query = `SELECT m_nsUserName, m_uLastTime 
+		query = `SELECT m_nsUserName, m_uLastTime, IFNULL(m_uUnReadCount, 0) 
 				FROM SessionAbstract`
 	}
 
@@ -841,6 +867,7 @@ func (ds *DataSource) GetSessions(ctx context.Context, key string, limit, offset
 		err := rows.Scan(
 			&sessionDarwinV3.M_nsUserName,
 			&sessionDarwinV3.M_uLastTime,
+			&sessionDarwinV3.M_uUnReadCount,
 		)
 
 		if err != nil {
@@ -933,11 +960,64 @@ func (ds *DataSource) GetDatasetFingerprint(context.Context) (string, error) {
 	return ds.dbm.FingerprintForGroups(Message)
 }
 
+// GetFavoritesFingerprint 收藏库指纹，用于判断收藏全文索引是否需要重建
+func (ds *DataSource) GetFavoritesFingerprint(context.Context) (string, error) {
+	return ds.dbm.FingerprintForGroups(Favorite)
+}
+
 // GetAvatar returns not found for darwin v3 (no head image source known here)
 func (ds *DataSource) GetAvatar(ctx context.Context, username string, size string) (*model.Avatar, error) {
 	return nil, errors.ErrAvatarNotFound
 }
 
+// GetEmoticon returns not found for darwin v3 (no local emoticon database known here)
+func (ds *DataSource) GetEmoticon(ctx context.Context, md5 string) (*model.Emoticon, error) {
+	return nil, errors.ErrMediaNotFound
+}
+
+// StickerUsage 统计动画表情（messageType=47）按 md5 的使用次数
+func (ds *DataSource) StickerUsage(ctx context.Context) (map[string]int64, error) {
+	result := make(map[string]int64)
+	dbs, err := ds.dbm.GetDBs(Message)
+	if err != nil {
+		return result, nil
+	}
+	for _, db := range dbs {
+		trows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type='table' AND name LIKE 'Chat_%' AND name NOT LIKE '%_dels'`)
+		if err != nil {
+			continue
+		}
+		var tables []string
+		for trows.Next() {
+			var name string
+			if err := trows.Scan(&name); err == nil {
+				tables = append(tables, name)
+			}
+		}
+		trows.Close()
+		for _, tbl := range tables {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT msgContent FROM %s WHERE messageType = 47`, tbl))
+			if err != nil {
+				continue
+			}
+			for rows.Next() {
+				var content sql.NullString
+				if err := rows.Scan(&content); err != nil {
+					continue
+				}
+				if md5 := model.EmojiMD5(content.String); md5 != "" {
+					result[md5]++
+				}
+			}
+			rows.Close()
+		}
+	}
+	return result, nil
+}
+
 // GlobalMessageStats 聚合统计（Darwin v3）
 func (ds *DataSource) GlobalMessageStats(ctx context.Context) (*model.GlobalMessageStats, error) {
 	stats := &model.GlobalMessageStats{ByType: make(map[string]int64)}
@@ -1514,3 +1594,29 @@ func mapV4TypeToLabel(t int64) string {
 		return ""
 	}
 }
+
+// GetFavorites 查询收藏（fav.db / FavoritesItemTable）
+func (ds *DataSource) GetFavorites(ctx context.Context, _type string, keyword string, limit, offset int) ([]*model.Favorite, error) {
+	db, err := ds.dbm.GetDB(Favorite)
+	if err != nil {
+		return []*model.Favorite{}, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT localId, IFNULL(type,0), IFNULL(updateTime,0), IFNULL(fromUsr,''), IFNULL(realChatName,''), IFNULL(content,'')
+		FROM FavoritesItemTable ORDER BY updateTime DESC`)
+	if err != nil {
+		return nil, errors.QueryFailed("FavoritesItemTable", err)
+	}
+	defer rows.Close()
+
+	favorites := make([]*model.Favorite, 0)
+	for rows.Next() {
+		var f model.FavoriteDarwinV3
+		if err := rows.Scan(&f.LocalID, &f.Type, &f.UpdateTime, &f.FromUsr, &f.RealChatName, &f.Content); err != nil {
+			return nil, errors.ScanRowFailed(err)
+		}
+		favorites = append(favorites, f.Wrap())
+	}
+
+	return model.FilterFavorites(favorites, _type, keyword, limit, offset), nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/sjzar/chatlog/internal/errors"
 	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb/datasource/darwinv3"
+	"github.com/sjzar/chatlog/internal/wechatdb/datasource/dbm"
 	v4 "github.com/sjzar/chatlog/internal/wechatdb/datasource/v4"
 	"github.com/sjzar/chatlog/internal/wechatdb/datasource/windowsv3"
 	"github.com/sjzar/chatlog/internal/wechatdb/msgstore"
@@ -19,6 +20,8 @@ type DataSource interface {
 
 	// 消息
 	GetMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error)
+	// GetMessagesByType 只查询 types 中类型的消息，不分页
+	GetMessagesByType(ctx context.Context, startTime, endTime time.Time, talker string, types []int64) ([]*model.Message, error)
 	GetDatasetFingerprint(ctx context.Context) (string, error)
 
 	// 联系人
@@ -36,6 +39,14 @@ type DataSource interface {
 	// 头像
 	GetAvatar(ctx context.Context, username string, size string) (*model.Avatar, error)
 
+	// 表情：本地表情库中的表情信息，按 md5 统计动画表情的使用次数
+	GetEmoticon(ctx context.Context, md5 string) (*model.Emoticon, error)
+	StickerUsage(ctx context.Context) (map[string]int64, error)
+
+	// 收藏
+	GetFavorites(ctx context.Context, _type string, keyword string, limit, offset int) ([]*model.Favorite, error)
+	GetFavoritesFingerprint(ctx context.Context) (string, error)
+
 	// 统计聚合（避免逐条扫描）：
 	// 全局消息统计：总数、发送/接收、最早/最晚、按(Type,SubType)计数
 	GlobalMessageStats(ctx context.Context) (*model.GlobalMessageStats, error)
@@ -65,16 +76,16 @@ type DataSource interface {
 	Close() error
 }
 
-func New(path string, platform string, version int) (DataSource, error) {
+func New(path string, platform string, version int, opts ...dbm.Option) (DataSource, error) {
 	switch {
 	case platform == "windows" && version == 3:
-		return windowsv3.New(path)
+		return windowsv3.New(path, opts...)
 	case platform == "windows" && version == 4:
-		return v4.New(path)
+		return v4.New(path, opts...)
 	case platform == "darwin" && version == 3:
-		return darwinv3.New(path)
+		return darwinv3.New(path, opts...)
 	case platform == "darwin" && version == 4:
-		return v4.New(path)
+		return v4.New(path, opts...)
 	default:
 		return nil, errors.PlatformUnsupported(platform, version)
 	}
@@ -2,6 +2,7 @@ package dbm
 
 import (
 	"database/sql"
+	"fmt"
 	"path/filepath"
 	"runtime"
 	"sync"
@@ -19,6 +20,7 @@ import (
 type DBManager struct {
 	path    string
 	id      string
+	vfs     string
 	fm      *filemonitor.FileMonitor
 	fgs     map[string]*filemonitor.FileGroup
 	dbs     map[string]*sql.DB
@@ -26,8 +28,18 @@ type DBManager struct {
 	mutex   sync.RWMutex
 }
 
-func NewDBManager(path string) *DBManager {
-	return &DBManager{
+// Option DBManager 选项
+type Option func(*DBManager)
+
+// WithVFS 通过指定的只读 SQLite VFS 直接打开 path 下的加密数据库
+func WithVFS(name string) Option {
+	return func(d *DBManager) {
+		d.vfs = name
+	}
+}
+
+func NewDBManager(path string, opts ...Option) *DBManager {
+	d := &DBManager{
 		path:    path,
 		id:      filepath.Base(path),
 		fm:      filemonitor.NewFileMonitor(),
@@ -35,6 +47,10 @@ func NewDBManager(path string) *DBManager {
 		dbs:     make(map[string]*sql.DB),
 		dbPaths: make(map[string][]string),
 	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
 func (d *DBManager) AddGroup(g *Group) error {
@@ -120,7 +136,10 @@ func (d *DBManager) OpenDB(path string) (*sql.DB, error) {
 	}
 	var err error
 	tempPath := path
-	if runtime.GOOS == "windows" {
+	if d.vfs != "" {
+		// VFS 按需解密原始文件，无需临时拷贝
+		tempPath = fmt.Sprintf("file:%s?vfs=%s&mode=ro", filepath.ToSlash(path), d.vfs)
+	} else if runtime.GOOS == "windows" {
 		tempPath, err = filecopy.GetTempCopy(d.id, path)
 		if err != nil {
 			log.Err(err).Msgf("获取临时拷贝文件 %s 失败", path)
@@ -139,7 +158,9 @@ func (d *DBManager) OpenDB(path string) (*sql.DB, error) {
 }
 
 func (d *DBManager) Callback(event fsnotify.Event) error {
-	if !event.Op.Has(fsnotify.Create) {
+	// 增量解密会原地修补明文数据库，Windows 下读取的是临时拷贝，需要在写入后重新打开
+	// VFS 模式下连接在每次读事务开始时自行检查原始文件变化
+	if !(event.Op.Has(fsnotify.Create) || (d.vfs == "" && runtime.GOOS == "windows" && event.Op.Has(fsnotify.Write))) {
 		return nil
 	}
 
@@ -1,6 +1,7 @@
 package v4
 
 import (
+	"bytes"
 	"context"
 	"crypto/md5"
 	"database/sql"
@@ -9,6 +10,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,14 +24,18 @@ import (
 	"github.com/sjzar/chatlog/internal/wechatdb/datasource/dbm"
 	"github.com/sjzar/chatlog/internal/wechatdb/msgstore"
 	"github.com/sjzar/chatlog/pkg/util"
+	"github.com/sjzar/chatlog/pkg/util/zstd"
 )
 
 const (
-	Message = "message"
-	Contact = "contact"
-	Session = "session"
-	Media   = "media"
-	Voice   = "voice"
+	Message  = "message"
+	Contact  = "contact"
+	Session  = "session"
+	Media    = "media"
+	Voice    = "voice"
+	Emoticon = "emoticon"
+	Favorite = "favorite"
+	Sns      = "sns"
 )
 
 var Groups = []*dbm.Group{
@@ -63,6 +69,21 @@ var Groups = []*dbm.Group{
 		Pattern:   `^head_image\.db$`,
 		BlackList: []string{},
 	},
+	{
+		Name:      Emoticon,
+		Pattern:   `^emoticon\.db$`,
+		BlackList: []string{},
+	},
+	{
+		Name:      Favorite,
+		Pattern:   `^favorite\.db$`,
+		BlackList: []string{},
+	},
+	{
+		Name:      Sns,
+		Pattern:   `^sns\.db$`,
+		BlackList: []string{},
+	},
 }
 
 // MessageDBInfo 存储消息数据库的信息
@@ -85,11 +106,11 @@ type DataSource struct {
 	messageStoreMu     sync.RWMutex
 }
 
-func New(path string) (*DataSource, error) {
+func New(path string, opts ...dbm.Option) (*DataSource, error) {
 
 	ds := &DataSource{
 		path:               path,
-		dbm:                dbm.NewDBManager(path),
+		dbm:                dbm.NewDBManager(path, opts...),
 		messageInfos:       make([]MessageDBInfo, 0),
 		talkerDBMap:        make(map[string]string),
 		messageStores:      make([]*msgstore.Store, 0),
@@ -302,6 +323,16 @@ func (ds *DataSource) getDBInfosForTimeRange(startTime, endTime time.Time) []Mes
 }
 
 func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
+	return ds.getMessages(ctx, startTime, endTime, talker, sender, keyword, nil, limit, offset)
+}
+
+// GetMessagesByType 查询指定类型的消息，类型条件在 SQL 中过滤
+func (ds *DataSource) GetMessagesByType(ctx context.Context, startTime, endTime time.Time, talker string, types []int64) ([]*model.Message, error) {
+	return ds.getMessages(ctx, startTime, endTime, talker, "", "", types, 0, 0)
+}
+
+// getMessages types 非空时只查询这些类型的消息
+func (ds *DataSource) getMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, types []int64, limit, offset int) ([]*model.Message, error) {
 	if talker == "" {
 		return nil, errors.ErrTalkerEmpty
 	}
@@ -370,6 +401,12 @@ func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.T
 			// 构建查询条件
 			conditions := []string{"create_time >= ? AND create_time <= ?"}
 			args := []interface{}{startTime.Unix(), endTime.Unix()}
+			if len(types) > 0 {
+				conditions = append(conditions, "m.local_type IN ("+strings.TrimSuffix(strings.Repeat("?,", len(types)), ",")+")")
+				for _, t := range types {
+					args = append(args, t)
+				}
+			}
 			log.Debug().Msgf("Table name: %s", tableName)
 			log.Debug().Msgf("Start time: %d, End time: %d", startTime.Unix(), endTime.Unix())
 
@@ -676,6 +713,11 @@ func (ds *DataSource) GetDatasetFingerprint(context.Context) (string, error) {
 	return ds.dbm.FingerprintForGroups(Message)
 }
 
+// GetFavoritesFingerprint 收藏库指纹，用于判断收藏全文索引是否需要重建
+func (ds *DataSource) GetFavoritesFingerprint(context.Context) (string, error) {
+	return ds.dbm.FingerprintForGroups(Favorite)
+}
+
 // 联系人
 func (ds *DataSource) GetContacts(ctx context.Context, key string, limit, offset int) ([]*model.Contact, error) {
 	var query string
@@ -859,14 +901,14 @@ func (ds *DataSource) GetSessions(ctx context.Context, key string, limit, offset
 
 	if key != "" {
 		// 按照关键字查询
-		query = `SELECT username, summary, last_timestamp, last_msg_sender, last_sender_display_name 
+		query = `SELECT username, summary, last_timestamp, last_msg_sender, last_sender_display_name, IFNULL(unread_count, 0) 
 				FROM SessionTable 
 				WHERE username = ? OR last_sender_display_name = ?
 				ORDER BY sort_timestamp DESC`
 		args = []interface{}{key, key}
 	} else {
 		// 查询所有会话
-		query = `SELECT username, summary, last_timestamp, last_msg_sender, last_sender_display_name 
+		query = `SELECT username, summary, last_timestamp, last_msg_sender, last_sender_display_name, IFNULL(unread_count, 0) 
 				FROM SessionTable 
 				ORDER BY sort_timestamp DESC`
 	}
@@ -899,6 +941,7 @@ func (ds *DataSource) GetSessions(ctx context.Context, key string, limit, offset
 			&sessionV4.LastTimestamp,
 			&sessionV4.LastMsgSender,
 			&sessionV4.LastSenderDisplayName,
+			&sessionV4.UnreadCount,
 		)
 
 		if err != nil {
@@ -1083,6 +1126,96 @@ func (ds *DataSource) GetAvatar(ctx context.Context, username string, size strin
 	return &model.Avatar{Username: username, ContentType: "image/jpeg", Data: buf}, nil
 }
 
+// GetEmoticon 从 emoticon.db 查询表情信息：自定义表情在 kNonStoreEmoticonTable，商店表情在 kStoreEmoticonFilesTable
+func (ds *DataSource) GetEmoticon(ctx context.Context, md5 string) (*model.Emoticon, error) {
+	if md5 == "" {
+		return nil, errors.ErrKeyEmpty
+	}
+	db, err := ds.dbm.GetDB(Emoticon)
+	if err != nil {
+		return nil, errors.ErrMediaNotFound
+	}
+
+	var e model.EmoticonV4
+	row := db.QueryRowContext(ctx, `SELECT md5, IFNULL(caption,''), IFNULL(product_id,''), IFNULL(cdn_url,''), IFNULL(encrypt_url,''), IFNULL(aes_key,'')
+		FROM kNonStoreEmoticonTable WHERE lower(md5) = lower(?) LIMIT 1`, md5)
+	if err := row.Scan(&e.MD5, &e.Caption, &e.ProductID, &e.CdnURL, &e.EncryptURL, &e.AesKey); err == nil {
+		if e.ProductID != "" {
+			e.PackageName = ds.emoticonPackageName(ctx, db, e.ProductID)
+		}
+		return e.Wrap(), nil
+	} else if err != sql.ErrNoRows {
+		log.Debug().Err(err).Msg("query kNonStoreEmoticonTable failed")
+	}
+
+	row = db.QueryRowContext(ctx, `SELECT md5_, IFNULL(package_id_,'') FROM kStoreEmoticonFilesTable WHERE lower(md5_) = lower(?) LIMIT 1`, md5)
+	if err := row.Scan(&e.MD5, &e.ProductID); err == nil {
+		e.PackageName = ds.emoticonPackageName(ctx, db, e.ProductID)
+		return e.Wrap(), nil
+	} else if err != sql.ErrNoRows {
+		log.Debug().Err(err).Msg("query kStoreEmoticonFilesTable failed")
+	}
+
+	return nil, errors.ErrMediaNotFound
+}
+
+func (ds *DataSource) emoticonPackageName(ctx context.Context, db *sql.DB, productID string) string {
+	var name string
+	row := db.QueryRowContext(ctx, `SELECT IFNULL(package_name_,'') FROM kStoreEmoticonPackageTable WHERE package_id_ = ? LIMIT 1`, productID)
+	if err := row.Scan(&name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// StickerUsage 统计动画表情（local_type=47）按 md5 的使用次数
+func (ds *DataSource) StickerUsage(ctx context.Context) (map[string]int64, error) {
+	result := make(map[string]int64)
+	dbs, err := ds.dbm.GetDBs(Message)
+	if err != nil {
+		return result, nil
+	}
+	for _, db := range dbs {
+		trows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type='table' AND name LIKE 'Msg_%'`)
+		if err != nil {
+			continue
+		}
+		var tables []string
+		for trows.Next() {
+			var name string
+			if err := trows.Scan(&name); err == nil {
+				tables = append(tables, name)
+			}
+		}
+		trows.Close()
+		for _, tbl := range tables {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT message_content FROM %s WHERE local_type = 47`, tbl))
+			if err != nil {
+				continue
+			}
+			for rows.Next() {
+				var mc []byte
+				if err := rows.Scan(&mc); err != nil {
+					continue
+				}
+				if bytes.HasPrefix(mc, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+					if b, err := zstd.Decompress(mc); err == nil {
+						mc = b
+					}
+				}
+				if md5 := model.EmojiMD5(string(mc)); md5 != "" {
+					result[md5]++
+				}
+			}
+			rows.Close()
+		}
+	}
+	return result, nil
+}
+
 // GlobalMessageStats 聚合统计（Windows/Darwin v4）
 func (ds *DataSource) GlobalMessageStats(ctx context.Context) (*model.GlobalMessageStats, error) {
 	stats := &model.GlobalMessageStats{ByType: make(map[string]int64)}
@@ -1806,3 +1939,105 @@ func (ds *DataSource) GroupMessageTypeStats(ctx context.Context) (map[string]int
 	}
 	return result, nil
 }
+
+// GetFavorites 查询收藏（favorite.db / fav_db_item）
+func (ds *DataSource) GetFavorites(ctx context.Context, _type string, keyword string, limit, offset int) ([]*model.Favorite, error) {
+	db, err := ds.dbm.GetDB(Favorite)
+	if err != nil {
+		return []*model.Favorite{}, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT local_id, IFNULL(type,0), IFNULL(update_time,0), IFNULL(fromusr,''), IFNULL(realchatname,''), IFNULL(content,'')
+		FROM fav_db_item ORDER BY update_time DESC`)
+	if err != nil {
+		return nil, errors.QueryFailed("fav_db_item", err)
+	}
+	defer rows.Close()
+
+	favorites := make([]*model.Favorite, 0)
+	for rows.Next() {
+		var f model.FavoriteV4
+		if err := rows.Scan(&f.LocalID, &f.Type, &f.UpdateTime, &f.FromUsr, &f.RealChatName, &f.Content); err != nil {
+			return nil, errors.ScanRowFailed(err)
+		}
+		favorites = append(favorites, f.Wrap())
+	}
+
+	return model.FilterFavorites(favorites, _type, keyword, limit, offset), nil
+}
+
+// GetSnsPosts 查询朋友圈动态（sns.db / SnsTimeLine）
+// SnsTimeLine 不单独存储时间，时间取自 TimelineObject，因此在解析后过滤分页
+func (ds *DataSource) GetSnsPosts(ctx context.Context, startTime, endTime time.Time, userName string, limit, offset int) ([]*model.SnsPost, error) {
+	db, err := ds.dbm.GetDB(Sns)
+	if err != nil {
+		return []*model.SnsPost{}, nil
+	}
+
+	query := `SELECT tid, IFNULL(user_name,''), IFNULL(content,'') FROM SnsTimeLine`
+	args := []interface{}{}
+	if userName != "" {
+		query += ` WHERE user_name = ?`
+		args = append(args, userName)
+	}
+	query += ` ORDER BY tid DESC`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.QueryFailed(query, err)
+	}
+	defer rows.Close()
+
+	posts := make([]*model.SnsPost, 0)
+	for rows.Next() {
+		var p model.SnsPostV4
+		if err := rows.Scan(&p.TID, &p.UserName, &p.Content); err != nil {
+			return nil, errors.ScanRowFailed(err)
+		}
+		post, err := p.Wrap()
+		if err != nil {
+			log.Debug().Err(err).Int64("tid", p.TID).Msg("parse sns post failed")
+			continue
+		}
+		if post.Time.Before(startTime) || post.Time.After(endTime) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Time.After(posts[j].Time)
+	})
+	if offset > 0 {
+		if offset >= len(posts) {
+			return []*model.SnsPost{}, nil
+		}
+		posts = posts[offset:]
+	}
+	if limit > 0 && len(posts) > limit {
+		posts = posts[:limit]
+	}
+	return posts, nil
+}
+
+// GetSnsPost 按 ID 查询单条朋友圈动态
+func (ds *DataSource) GetSnsPost(ctx context.Context, id string) (*model.SnsPost, error) {
+	tid, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.SnsPostNotFound(id)
+	}
+	db, err := ds.dbm.GetDB(Sns)
+	if err != nil {
+		return nil, errors.SnsPostNotFound(id)
+	}
+
+	var p model.SnsPostV4
+	row := db.QueryRowContext(ctx, `SELECT tid, IFNULL(user_name,''), IFNULL(content,'') FROM SnsTimeLine WHERE tid = ?`, int64(tid))
+	if err := row.Scan(&p.TID, &p.UserName, &p.Content); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.SnsPostNotFound(id)
+		}
+		return nil, errors.ScanRowFailed(err)
+	}
+	return p.Wrap()
+}
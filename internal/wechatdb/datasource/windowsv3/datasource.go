@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,12 +25,15 @@ import (
 )
 
 const (
-	Message = "message"
-	Contact = "contact"
-	Image   = "image"
-	Video   = "video"
-	File    = "file"
-	Voice   = "voice"
+	Message  = "message"
+	Contact  = "contact"
+	Image    = "image"
+	Video    = "video"
+	File     = "file"
+	Voice    = "voice"
+	Emotion  = "emotion"
+	Favorite = "favorite"
+	Sns      = "sns"
 
 	talkerCacheTTL = 30 * time.Second
 )
@@ -65,6 +69,21 @@ var Groups = []*dbm.Group{
 		Pattern:   `^MediaMSG([0-9]?[0-9])?\.db$`,
 		BlackList: []string{},
 	},
+	{
+		Name:      Emotion,
+		Pattern:   `^Emotion\.db$`,
+		BlackList: []string{},
+	},
+	{
+		Name:      Favorite,
+		Pattern:   `^Favorite\.db$`,
+		BlackList: []string{},
+	},
+	{
+		Name:      Sns,
+		Pattern:   `^(Sns|SnsMicroMsg)\.db$`,
+		BlackList: []string{},
+	},
 }
 
 // MessageDBInfo 保存消息数据库的信息
@@ -92,10 +111,10 @@ type DataSource struct {
 }
 
 // New 创建一个新的 WindowsV3DataSource
-func New(path string) (*DataSource, error) {
+func New(path string, opts ...dbm.Option) (*DataSource, error) {
 	ds := &DataSource{
 		path:          path,
-		dbm:           dbm.NewDBManager(path),
+		dbm:           dbm.NewDBManager(path, opts...),
 		messageInfos:  make([]MessageDBInfo, 0),
 		messageStores: make([]*msgstore.Store, 0),
 	}
@@ -135,7 +154,8 @@ func New(path string) (*DataSource, error) {
 }
 
 func (ds *DataSource) SetCallback(group string, callback func(event fsnotify.Event) error) error {
-	if group == "chatroom" {
+	// 群聊与会话均保存在 MicroMsg.db 中
+	if group == "chatroom" || group == "session" {
 		group = Contact
 	}
 	return ds.dbm.AddCallback(group, callback)
@@ -276,6 +296,16 @@ func (ds *DataSource) getDBInfosForTimeRange(startTime, endTime time.Time) []Mes
 }
 
 func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, limit, offset int) ([]*model.Message, error) {
+	return ds.getMessages(ctx, startTime, endTime, talker, sender, keyword, nil, limit, offset)
+}
+
+// GetMessagesByType 查询指定类型的消息，类型条件在 SQL 中过滤
+func (ds *DataSource) GetMessagesByType(ctx context.Context, startTime, endTime time.Time, talker string, types []int64) ([]*model.Message, error) {
+	return ds.getMessages(ctx, startTime, endTime, talker, "", "", types, 0, 0)
+}
+
+// getMessages types 非空时只查询这些类型的消息
+func (ds *DataSource) getMessages(ctx context.Context, startTime, endTime time.Time, talker string, sender string, keyword string, types []int64, limit, offset int) ([]*model.Message, error) {
 	if talker == "" {
 		return nil, errors.ErrTalkerEmpty
 	}
@@ -335,6 +365,12 @@ func (ds *DataSource) GetMessages(ctx context.Context, startTime, endTime time.T
 				conditions = append(conditions, "StrTalker = ?")
 				args = append(args, talkerItem)
 			}
+			if len(types) > 0 {
+				conditions = append(conditions, "Type IN ("+strings.TrimSuffix(strings.Repeat("?,", len(types)), ",")+")")
+				for _, t := range types {
+					args = append(args, t)
+				}
+			}
 
 			query := fmt.Sprintf(`
 				SELECT MsgSvrID, Sequence, CreateTime, StrTalker, IsSender, 
@@ -457,6 +493,11 @@ func (ds *DataSource) GetDatasetFingerprint(context.Context) (string, error) {
 	return ds.dbm.FingerprintForGroups(Message)
 }
 
+// GetFavoritesFingerprint 收藏库指纹，用于判断收藏全文索引是否需要重建
+func (ds *DataSource) GetFavoritesFingerprint(context.Context) (string, error) {
+	return ds.dbm.FingerprintForGroups(Favorite)
+}
+
 func (ds *DataSource) ListMessageStores(ctx context.Context) ([]*msgstore.Store, error) {
 	_ = ctx
 	ds.messageStoreMu.RLock()
@@ -930,14 +971,14 @@ func (ds *DataSource) GetSessions(ctx context.Context, key string, limit, offset
 
 	if key != "" {
 		// 按照关键字查询
-		query = `SELECT strUsrName, nOrder, strNickName, strContent, nTime 
+		query = `SELECT strUsrName, nOrder, strNickName, strContent, nTime, IFNULL(nUnReadCount, 0) 
                 FROM Session 
                 WHERE strUsrName = ? OR strNickName = ?
                 ORDER BY nOrder DESC`
 		args = []interface{}{key, key}
 	} else {
 		// 查询所有会话
-		query = `SELECT strUsrName, nOrder, strNickName, strContent, nTime 
+		query = `SELECT strUsrName, nOrder, strNickName, strContent, nTime, IFNULL(nUnReadCount, 0) 
                 FROM Session 
                 ORDER BY nOrder DESC`
 	}
@@ -970,6 +1011,7 @@ func (ds *DataSource) GetSessions(ctx context.Context, key string, limit, offset
 			&sessionV3.StrNickName,
 			&sessionV3.StrContent,
 			&sessionV3.NTime,
+			&sessionV3.NUnReadCount,
 		)
 
 		if err != nil {
@@ -1146,6 +1188,63 @@ func (ds *DataSource) GetAvatar(ctx context.Context, username string, size strin
 	return &model.Avatar{Username: username, URL: url}, nil
 }
 
+// GetEmoticon 从 Emotion.db 查询表情信息：自定义表情在 CustomEmotion，商店表情在 EmotionItem（内容直接存于 Data）
+func (ds *DataSource) GetEmoticon(ctx context.Context, md5 string) (*model.Emoticon, error) {
+	if md5 == "" {
+		return nil, errors.ErrKeyEmpty
+	}
+	db, err := ds.dbm.GetDB(Emotion)
+	if err != nil {
+		return nil, errors.ErrMediaNotFound
+	}
+
+	var e model.EmoticonV3
+	row := db.QueryRowContext(ctx, `SELECT MD5, IFNULL(ProductId,''), IFNULL(CDNUrl,''), IFNULL(EncryptUrl,''), IFNULL(AesKey,''), Data
+		FROM CustomEmotion WHERE lower(MD5) = lower(?) LIMIT 1`, md5)
+	if err := row.Scan(&e.MD5, &e.ProductID, &e.CdnURL, &e.EncryptURL, &e.AesKey, &e.Data); err == nil {
+		return e.Wrap(), nil
+	} else if err != sql.ErrNoRows {
+		log.Debug().Err(err).Msg("query CustomEmotion failed")
+	}
+
+	row = db.QueryRowContext(ctx, `SELECT i.MD5, IFNULL(i.ProductId,''), IFNULL(p.Name,''), i.Data
+		FROM EmotionItem i LEFT JOIN EmotionPackageItem p ON p.ProductId = i.ProductId
+		WHERE lower(i.MD5) = lower(?) LIMIT 1`, md5)
+	if err := row.Scan(&e.MD5, &e.ProductID, &e.PackageName, &e.Data); err == nil {
+		return e.Wrap(), nil
+	} else if err != sql.ErrNoRows {
+		log.Debug().Err(err).Msg("query EmotionItem failed")
+	}
+
+	return nil, errors.ErrMediaNotFound
+}
+
+// StickerUsage 统计动画表情（Type=47）按 md5 的使用次数
+func (ds *DataSource) StickerUsage(ctx context.Context) (map[string]int64, error) {
+	result := make(map[string]int64)
+	dbs, err := ds.dbm.GetDBs(Message)
+	if err != nil {
+		return result, nil
+	}
+	for _, db := range dbs {
+		rows, err := db.QueryContext(ctx, `SELECT StrContent FROM MSG WHERE Type = 47`)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+			var content sql.NullString
+			if err := rows.Scan(&content); err != nil {
+				continue
+			}
+			if md5 := model.EmojiMD5(content.String); md5 != "" {
+				result[md5]++
+			}
+		}
+		rows.Close()
+	}
+	return result, nil
+}
+
 // GlobalMessageStats 聚合统计（Windows v3）
 func (ds *DataSource) GlobalMessageStats(ctx context.Context) (*model.GlobalMessageStats, error) {
 	stats := &model.GlobalMessageStats{ByType: make(map[string]int64)}
@@ -1582,3 +1681,131 @@ func mapV3TypeToLabel(t int64, st int64) string {
 		return ""
 	}
 }
+
+// GetFavorites 查询收藏（Favorite.db / FavItems）
+func (ds *DataSource) GetFavorites(ctx context.Context, _type string, keyword string, limit, offset int) ([]*model.Favorite, error) {
+	db, err := ds.dbm.GetDB(Favorite)
+	if err != nil {
+		return []*model.Favorite{}, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT FavLocalID, IFNULL(Type,0), IFNULL(UpdateTime,0), IFNULL(FromUser,''), IFNULL(RealChatName,''), IFNULL(XmlBuf,'')
+		FROM FavItems ORDER BY UpdateTime DESC`)
+	if err != nil {
+		return nil, errors.QueryFailed("FavItems", err)
+	}
+	defer rows.Close()
+
+	favorites := make([]*model.Favorite, 0)
+	for rows.Next() {
+		var f model.FavoriteV3
+		if err := rows.Scan(&f.FavLocalID, &f.Type, &f.UpdateTime, &f.FromUser, &f.RealChatName, &f.XmlBuf); err != nil {
+			return nil, errors.ScanRowFailed(err)
+		}
+		favorites = append(favorites, f.Wrap())
+	}
+
+	return model.FilterFavorites(favorites, _type, keyword, limit, offset), nil
+}
+
+// GetSnsPosts 查询朋友圈动态（Sns.db / FeedsV20），点赞与评论来自 CommentV20
+func (ds *DataSource) GetSnsPosts(ctx context.Context, startTime, endTime time.Time, userName string, limit, offset int) ([]*model.SnsPost, error) {
+	db, err := ds.dbm.GetDB(Sns)
+	if err != nil {
+		return []*model.SnsPost{}, nil
+	}
+
+	query := `SELECT FeedId, CreateTime, IFNULL(UserName,''), IFNULL(Content,'') FROM FeedsV20 WHERE CreateTime >= ? AND CreateTime <= ?`
+	args := []interface{}{startTime.Unix(), endTime.Unix()}
+	if userName != "" {
+		query += ` AND UserName = ?`
+		args = append(args, userName)
+	}
+	query += ` ORDER BY CreateTime DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+		if offset > 0 {
+			query += fmt.Sprintf(" OFFSET %d", offset)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.QueryFailed(query, err)
+	}
+	defer rows.Close()
+
+	posts := make([]*model.SnsPost, 0)
+	postByFeed := make(map[int64]*model.SnsPost)
+	for rows.Next() {
+		var p model.SnsPostV3
+		if err := rows.Scan(&p.FeedID, &p.CreateTime, &p.UserName, &p.Content); err != nil {
+			return nil, errors.ScanRowFailed(err)
+		}
+		post, err := p.Wrap()
+		if err != nil {
+			log.Debug().Err(err).Int64("feedId", p.FeedID).Msg("parse sns post failed")
+			continue
+		}
+		posts = append(posts, post)
+		postByFeed[p.FeedID] = post
+	}
+	rows.Close()
+
+	ds.fillSnsComments(ctx, db, postByFeed)
+	return posts, nil
+}
+
+// GetSnsPost 按 ID 查询单条朋友圈动态
+func (ds *DataSource) GetSnsPost(ctx context.Context, id string) (*model.SnsPost, error) {
+	feedID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.SnsPostNotFound(id)
+	}
+	db, err := ds.dbm.GetDB(Sns)
+	if err != nil {
+		return nil, errors.SnsPostNotFound(id)
+	}
+
+	var p model.SnsPostV3
+	row := db.QueryRowContext(ctx, `SELECT FeedId, CreateTime, IFNULL(UserName,''), IFNULL(Content,'') FROM FeedsV20 WHERE FeedId = ?`, int64(feedID))
+	if err := row.Scan(&p.FeedID, &p.CreateTime, &p.UserName, &p.Content); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.SnsPostNotFound(id)
+		}
+		return nil, errors.ScanRowFailed(err)
+	}
+	post, err := p.Wrap()
+	if err != nil {
+		return nil, err
+	}
+	ds.fillSnsComments(ctx, db, map[int64]*model.SnsPost{p.FeedID: post})
+	return post, nil
+}
+
+func (ds *DataSource) fillSnsComments(ctx context.Context, db *sql.DB, postByFeed map[int64]*model.SnsPost) {
+	if len(postByFeed) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(postByFeed))
+	for id := range postByFeed {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	query := `SELECT FeedId, CreateTime, CommentType, IFNULL(FromUserName,''), IFNULL(Content,''), IFNULL(RefUserName,'')
+		FROM CommentV20 WHERE FeedId IN (` + strings.Join(ids, ",") + `) ORDER BY CreateTime ASC`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		log.Debug().Err(err).Msg("query CommentV20 failed")
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c model.SnsCommentV3
+		if err := rows.Scan(&c.FeedID, &c.CreateTime, &c.CommentType, &c.FromUserName, &c.Content, &c.RefUserName); err != nil {
+			continue
+		}
+		if post, ok := postByFeed[c.FeedID]; ok {
+			c.Apply(post)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package indexer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+const favoritesIndexFile = "favorites.fts.db"
+
+// openFavoritesLocked lazily opens the favorites FTS database.
+func (i *Index) openFavoritesLocked() (*sql.DB, error) {
+	if i.favorites != nil {
+		return i.favorites, nil
+	}
+
+	path := filepath.Join(i.basePath, favoritesIndexFile)
+	db, err := i.openDB(path)
+	if err != nil {
+		return nil, fmt.Errorf("open favorites index: %w", err)
+	}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS favorites (
+id            INTEGER PRIMARY KEY,
+type          TEXT NOT NULL,
+unix          INTEGER NOT NULL,
+content       TEXT NOT NULL,
+favorite_json TEXT NOT NULL
+);`,
+		metadataTableSQL,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS favorites_fts USING fts5(
+content,
+content='favorites',
+content_rowid='id',
+tokenize='unicode61 remove_diacritics 2'
+);`,
+		`CREATE TRIGGER IF NOT EXISTS favorites_ai AFTER INSERT ON favorites BEGIN
+INSERT INTO favorites_fts(rowid, content) VALUES (new.id, new.content);
+END;`,
+		`CREATE TRIGGER IF NOT EXISTS favorites_ad AFTER DELETE ON favorites BEGIN
+INSERT INTO favorites_fts(favorites_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("init favorites schema: %w", err)
+		}
+	}
+
+	i.favorites = db
+	return db, nil
+}
+
+// FavoritesFingerprint returns the dataset fingerprint the favorites index was built from.
+func (i *Index) FavoritesFingerprint() string {
+	if i == nil {
+		return ""
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	db, err := i.openFavoritesLocked()
+	if err != nil {
+		return ""
+	}
+	var fp string
+	_ = db.QueryRow(`SELECT value FROM metadata WHERE key = 'fingerprint'`).Scan(&fp)
+	return fp
+}
+
+// IndexFavorites replaces the favorites index with the provided items.
+func (i *Index) IndexFavorites(favorites []*model.Favorite, fingerprint string) (err error) {
+	if i == nil {
+		return errIndexNotInitialized
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	db, err := i.openFavoritesLocked()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(`DELETE FROM favorites`); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO favorites (id, type, unix, content, favorite_json) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, f := range favorites {
+		if f == nil {
+			continue
+		}
+		var data []byte
+		data, err = json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("marshal favorite: %w", err)
+		}
+		if _, err = stmt.Exec(f.ID, f.Type, f.Time.Unix(), normalizeContent(f.SearchText()), string(data)); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(`INSERT INTO metadata(key, value) VALUES ('fingerprint', ?)
+ON CONFLICT(key) DO UPDATE SET value = excluded.value`, fingerprint); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SearchFavorites runs a full-text query against the favorites index.
+func (i *Index) SearchFavorites(query, _type string, offset, limit int) ([]*model.Favorite, int, error) {
+	if i == nil {
+		return nil, 0, errIndexNotInitialized
+	}
+
+	match, err := buildFTSQuery(normalizeContent(query))
+	if err != nil {
+		return nil, 0, err
+	}
+	if match == "" {
+		return []*model.Favorite{}, 0, nil
+	}
+
+	i.mu.Lock()
+	db, err := i.openFavoritesLocked()
+	i.mu.Unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	base := `
+FROM favorites_fts
+JOIN favorites f ON f.id = favorites_fts.rowid
+WHERE favorites_fts MATCH ?`
+	args := []interface{}{match}
+	if _type != "" {
+		base += " AND f.type = ?"
+		args = append(args, _type)
+	}
+
+	ctx := context.Background()
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) "+base, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count favorites: %w", err)
+	}
+
+	if limit <= 0 {
+		limit = -1
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	dataArgs := append(append([]interface{}{}, args...), limit, offset)
+	rows, err := db.QueryContext(ctx, "SELECT f.favorite_json "+base+" ORDER BY bm25(favorites_fts) ASC, f.unix DESC LIMIT ? OFFSET ?", dataArgs...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("search favorites: %w", err)
+	}
+	defer rows.Close()
+
+	favorites := make([]*model.Favorite, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, 0, fmt.Errorf("scan favorite: %w", err)
+		}
+		var f model.Favorite
+		if err := json.Unmarshal([]byte(data), &f); err != nil {
+			return nil, 0, fmt.Errorf("decode favorite: %w", err)
+		}
+		favorites = append(favorites, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("iterate favorites: %w", err)
+	}
+
+	return favorites, total, nil
+}
+
+func (i *Index) closeFavoritesLocked(remove bool) error {
+	if i.favorites == nil {
+		return nil
+	}
+	err := i.favorites.Close()
+	i.favorites = nil
+	if remove {
+		_ = os.Remove(filepath.Join(i.basePath, favoritesIndexFile))
+	}
+	return err
+}
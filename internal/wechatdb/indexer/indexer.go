@@ -1,6 +1,7 @@
 package indexer
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -14,7 +15,7 @@ import (
 	"time"
 	"unicode"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 
 	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb/msgstore"
@@ -47,10 +48,33 @@ type Index struct {
 	metaPath string
 	meta     metadata
 	stores   map[string]*storeIndex
+
+	// favorites is the lazily opened favorites FTS database.
+	favorites *sql.DB
+
+	// vfs, when set, names the SQLite VFS index databases are stored through.
+	vfs      string
+	pageSize int
+	reserve  int
+}
+
+// Option configures an Index.
+type Option func(*Index)
+
+// WithVFS stores the index databases through the named SQLite VFS, e.g. one
+// that encrypts pages at rest. New databases are created with the given page
+// size and per-page reserved bytes so the VFS has room for its IV and MAC.
+// Such a VFS is not expected to support WAL, so a memory journal is used.
+func WithVFS(name string, pageSize, reserve int) Option {
+	return func(i *Index) {
+		i.vfs = name
+		i.pageSize = pageSize
+		i.reserve = reserve
+	}
 }
 
 // Open prepares an Index rooted at basePath.
-func Open(basePath string) (*Index, error) {
+func Open(basePath string, opts ...Option) (*Index, error) {
 	if err := os.MkdirAll(basePath, 0o755); err != nil {
 		return nil, fmt.Errorf("create index base dir: %w", err)
 	}
@@ -61,12 +85,16 @@ func Open(basePath string) (*Index, error) {
 		return nil, fmt.Errorf("load index metadata: %w", err)
 	}
 
-	return &Index{
+	i := &Index{
 		basePath: basePath,
 		metaPath: metaPath,
 		meta:     meta,
 		stores:   make(map[string]*storeIndex),
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i, nil
 }
 
 // Close releases all opened store indices.
@@ -85,6 +113,9 @@ func (i *Index) Close() error {
 		}
 		delete(i.stores, id)
 	}
+	if err := i.closeFavoritesLocked(false); err != nil && firstErr == nil {
+		firstErr = err
+	}
 	return firstErr
 }
 
@@ -102,6 +133,7 @@ func (i *Index) Reset() error {
 		_ = os.Remove(si.path)
 		delete(i.stores, id)
 	}
+	_ = i.closeFavoritesLocked(true)
 	return nil
 }
 
@@ -377,7 +409,7 @@ func (i *Index) ensureStoreIndexLocked(store *msgstore.Store) (*storeIndex, erro
 		_ = existing.close()
 	}
 
-	si, err := newStoreIndex(path)
+	si, err := i.newStoreIndex(path)
 	if err != nil {
 		return nil, err
 	}
@@ -401,19 +433,18 @@ func (i *Index) resolveStorePath(store *msgstore.Store) string {
 	return filepath.Join(i.basePath, id+".fts.db")
 }
 
-func newStoreIndex(path string) (*storeIndex, error) {
+func (i *Index) newStoreIndex(path string) (*storeIndex, error) {
 	parent := filepath.Dir(path)
 	if err := os.MkdirAll(parent, 0o755); err != nil {
 		return nil, fmt.Errorf("create store index dir: %w", err)
 	}
 
-	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal=WAL&_synchronous=NORMAL", filepath.ToSlash(path))
-	db, err := sql.Open("sqlite3", dsn)
+	db, err := i.openDB(path)
 	if err != nil {
 		return nil, fmt.Errorf("open store index: %w", err)
 	}
 
-	if err := initSchema(db); err != nil {
+	if err := initSchema(db, i.journalMode()); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
@@ -421,6 +452,83 @@ func newStoreIndex(path string) (*storeIndex, error) {
 	return &storeIndex{db: db, path: path}, nil
 }
 
+func (i *Index) journalMode() string {
+	if i.vfs != "" {
+		return "MEMORY"
+	}
+	return "WAL"
+}
+
+// openDB opens an index database at path, through the configured VFS if any.
+func (i *Index) openDB(path string) (*sql.DB, error) {
+	if i.vfs == "" {
+		dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal=WAL&_synchronous=NORMAL", filepath.ToSlash(path))
+		return sql.Open("sqlite3", dsn)
+	}
+
+	// Indices are rebuildable, so plaintext leftovers from before the VFS
+	// was enabled are dropped rather than migrated.
+	if isPlaintextDB(path) {
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			_ = os.Remove(path + suffix)
+		}
+	}
+
+	dsn := fmt.Sprintf("file:%s?vfs=%s&_busy_timeout=5000&_journal=MEMORY&_synchronous=NORMAL", filepath.ToSlash(path), i.vfs)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.prepareVFSDB(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// prepareVFSDB fixes the page layout of a new database before anything is
+// written. The reserve setting only reaches the file header with the first
+// write on the same connection, hence the metadata table created here.
+func (i *Index) prepareVFSDB(db *sql.DB) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA page_size = %d;", i.pageSize)); err != nil {
+		return fmt.Errorf("set page size: %w", err)
+	}
+	if err := conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		return c.SetFileControlInt("main", sqlite3.SQLITE_FCNTL_RESERVE_BYTES, i.reserve)
+	}); err != nil {
+		return fmt.Errorf("set reserved bytes: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, metadataTableSQL); err != nil {
+		return fmt.Errorf("init metadata table: %w", err)
+	}
+	return nil
+}
+
+func isPlaintextDB(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	if _, err := f.Read(header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, []byte("SQLite format 3\x00"))
+}
+
 func (s *storeIndex) close() error {
 	if s == nil {
 		return nil
@@ -437,10 +545,15 @@ func (s *storeIndex) close() error {
 	return err
 }
 
-func initSchema(db *sql.DB) error {
+const metadataTableSQL = `CREATE TABLE IF NOT EXISTS metadata (
+key   TEXT PRIMARY KEY,
+value TEXT NOT NULL
+);`
+
+func initSchema(db *sql.DB, journalMode string) error {
 	pragmas := []string{
 		"PRAGMA foreign_keys = ON;",
-		"PRAGMA journal_mode = WAL;",
+		"PRAGMA journal_mode = " + journalMode + ";",
 		"PRAGMA synchronous = NORMAL;",
 		"PRAGMA temp_store = MEMORY;",
 	}
@@ -451,10 +564,7 @@ func initSchema(db *sql.DB) error {
 	}
 
 	statements := []string{
-		`CREATE TABLE IF NOT EXISTS metadata (
-key   TEXT PRIMARY KEY,
-value TEXT NOT NULL
-);`,
+		metadataTableSQL,
 		`CREATE TABLE IF NOT EXISTS messages (
 doc_id       TEXT NOT NULL UNIQUE,
 talker       TEXT NOT NULL,
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// GetArticles 从公众号推送消息中提取文章列表，account 为空时返回所有公众号
+func (r *Repository) GetArticles(ctx context.Context, account string, startTime, endTime time.Time, limit, offset int) ([]*model.Article, error) {
+	accounts := make([]string, 0)
+	if account = strings.TrimSpace(account); account != "" {
+		for _, key := range strings.Split(account, ",") {
+			contact := r.findContact(strings.TrimSpace(key))
+			if contact == nil || !model.IsOfficialAccount(contact.UserName) {
+				return nil, errors.ContactNotFound(key)
+			}
+			accounts = append(accounts, contact.UserName)
+		}
+	} else {
+		for userName := range r.contactCache {
+			if model.IsOfficialAccount(userName) {
+				accounts = append(accounts, userName)
+			}
+		}
+	}
+	if len(accounts) == 0 {
+		return []*model.Article{}, nil
+	}
+	sort.Strings(accounts)
+
+	messages, err := r.ds.GetMessages(ctx, startTime, endTime, strings.Join(accounts, ","), "", "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	articles := make([]*model.Article, 0)
+	for _, msg := range messages {
+		for _, a := range msg.Articles() {
+			// 同一篇文章可能被多次推送（如重发、合集），按 URL 去重
+			if _, ok := seen[a.URL]; ok && a.URL != "" {
+				continue
+			}
+			seen[a.URL] = struct{}{}
+			if a.AccountName == "" {
+				if contact := r.getFullContact(a.Account); contact != nil {
+					a.AccountName = contact.DisplayName()
+				}
+			}
+			articles = append(articles, a)
+		}
+	}
+
+	sort.SliceStable(articles, func(i, j int) bool {
+		return articles[i].PublishTime.After(articles[j].PublishTime)
+	})
+	if offset > 0 {
+		if offset >= len(articles) {
+			return []*model.Article{}, nil
+		}
+		articles = articles[offset:]
+	}
+	if limit > 0 && len(articles) > limit {
+		articles = articles[:limit]
+	}
+	return articles, nil
+}
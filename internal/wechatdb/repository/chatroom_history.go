@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+	"github.com/sjzar/chatlog/pkg/util"
+)
+
+// GetChatRoomHistory 扫描群聊系统消息，构建成员变动与改名时间线
+// self 为当前账号的 userName，用于匹配系统消息中的“你”；at 非零时，额外回溯出 at 时刻的成员列表
+func (r *Repository) GetChatRoomHistory(ctx context.Context, key string, self string, at time.Time) (*model.ChatRoomHistory, error) {
+	chatRoom := r.findChatRoom(key)
+	if chatRoom == nil {
+		return nil, errors.ChatRoomNotFound(key)
+	}
+
+	start, end, _ := util.TimeRangeOf("all")
+	messages, err := r.ds.GetMessagesByType(ctx, start, end, chatRoom.Name, []int64{model.MessageTypeSystem})
+	if err != nil {
+		return nil, err
+	}
+
+	displayName2User := make(map[string]string, len(chatRoom.User2DisplayName))
+	for user, displayName := range chatRoom.User2DisplayName {
+		displayName2User[displayName] = user
+	}
+
+	history := &model.ChatRoomHistory{
+		Name:     chatRoom.Name,
+		NickName: chatRoom.DisplayName(),
+		Events:   make([]*model.ChatRoomEvent, 0),
+	}
+	for _, msg := range messages {
+		ev := model.ParseChatRoomEvent(msg)
+		if ev == nil {
+			continue
+		}
+		if ev.Operator != nil {
+			r.resolveChatRoomUser(chatRoom, displayName2User, ev.Operator)
+		}
+		for i := range ev.Members {
+			r.resolveChatRoomUser(chatRoom, displayName2User, &ev.Members[i])
+		}
+		history.Events = append(history.Events, ev)
+	}
+	sort.SliceStable(history.Events, func(i, j int) bool {
+		return history.Events[i].Seq < history.Events[j].Seq
+	})
+	history.ResolveSelf(self)
+
+	if !at.IsZero() {
+		history.At = at
+		history.Members = history.MembersAt(at, chatRoom.Users)
+	}
+
+	return history, nil
+}
+
+// resolveChatRoomUser 系统消息中的纯文本成员只有昵称，尝试补全 UserName
+func (r *Repository) resolveChatRoomUser(chatRoom *model.ChatRoom, displayName2User map[string]string, user *model.ChatRoomUser) {
+	if user.UserName != "" || user.DisplayName == "" || user.DisplayName == model.ChatRoomSelf {
+		return
+	}
+	if userName, ok := displayName2User[user.DisplayName]; ok {
+		user.UserName = userName
+		return
+	}
+	for _, u := range chatRoom.Users {
+		if contact := r.getFullContact(u.UserName); contact != nil {
+			if contact.NickName == user.DisplayName || contact.Remark == user.DisplayName {
+				user.UserName = u.UserName
+				return
+			}
+		}
+	}
+	if contacts, ok := r.nickNameToContact[user.DisplayName]; ok && len(contacts) == 1 {
+		user.UserName = contacts[0].UserName
+	}
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"sort"
 	"strings"
 
@@ -253,3 +255,15 @@ func (r *Repository) getFullContact(userName string) *model.Contact {
 
 	return nil
 }
+
+// UserNameByMD5 返回微信 ID 的 md5 为 sum 的联系人，用于由 macOS 微信 3.x 的账号目录找到当前账号，未找到时返回空字符串
+func (r *Repository) UserNameByMD5(sum string) string {
+	sum = strings.ToLower(sum)
+	for userName := range r.contactCache {
+		hash := md5.Sum([]byte(userName))
+		if hex.EncodeToString(hash[:]) == sum {
+			return userName
+		}
+	}
+	return ""
+}
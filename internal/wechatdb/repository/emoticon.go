@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// GetEmoticon 查询本地表情库中的表情信息，数据源没有表情库时返回 ErrMediaNotFound
+func (r *Repository) GetEmoticon(ctx context.Context, md5 string) (*model.Emoticon, error) {
+	md5 = strings.ToLower(strings.TrimSpace(md5))
+	if md5 == "" {
+		return nil, errors.ErrKeyEmpty
+	}
+	return r.ds.GetEmoticon(ctx, md5)
+}
+
+// stickerEnrichLimit 补充表情包名称的最大条目数
+const stickerEnrichLimit = 100
+
+// stickerUsageTTL 表情使用统计的缓存时间，统计需要扫描全部消息表
+const stickerUsageTTL = 10 * time.Minute
+
+// StickerUsage 返回使用次数最多的表情，limit <= 0 时返回全部
+func (r *Repository) StickerUsage(ctx context.Context, limit int) ([]*model.StickerUsage, error) {
+	counts, err := r.stickerCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]*model.StickerUsage, 0, len(counts))
+	for md5, count := range counts {
+		usage = append(usage, &model.StickerUsage{MD5: md5, Count: count})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Count == usage[j].Count {
+			return usage[i].MD5 < usage[j].MD5
+		}
+		return usage[i].Count > usage[j].Count
+	})
+	if limit > 0 && len(usage) > limit {
+		usage = usage[:limit]
+	}
+
+	// 逐条查询表情库开销较大，仅对排名靠前的条目补充表情包名称
+	for i, u := range usage {
+		if i >= stickerEnrichLimit {
+			break
+		}
+		if e, err := r.GetEmoticon(ctx, u.MD5); err == nil && e != nil {
+			u.PackageName = e.PackageName
+		}
+	}
+	return usage, nil
+}
+
+// stickerCounts 返回缓存的表情使用次数，过期后重新统计；统计期间的其他请求等待同一结果
+func (r *Repository) stickerCounts(ctx context.Context) (map[string]int64, error) {
+	r.stickerMu.Lock()
+	defer r.stickerMu.Unlock()
+	if r.stickerCache != nil && time.Since(r.stickerCachedAt) < stickerUsageTTL {
+		return r.stickerCache, nil
+	}
+	counts, err := r.ds.StickerUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.stickerCache = counts
+	r.stickerCachedAt = time.Now()
+	return counts, nil
+}
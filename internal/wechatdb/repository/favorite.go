@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+// GetFavorites 查询收藏，关键词优先走收藏全文索引
+// 索引不可用或未命中时（如中文子串），回退到数据源的子串匹配
+func (r *Repository) GetFavorites(ctx context.Context, _type string, keyword string, limit, offset int) ([]*model.Favorite, error) {
+	_type = strings.ToLower(strings.TrimSpace(_type))
+	keyword = strings.TrimSpace(keyword)
+
+	if keyword != "" && r.index != nil {
+		if err := r.ensureFavoritesIndex(ctx); err != nil {
+			log.Debug().Err(err).Msg("ensure favorites index failed")
+		} else if list, total, err := r.index.SearchFavorites(keyword, _type, offset, limit); err != nil {
+			log.Debug().Err(err).Msg("search favorites index failed")
+		} else if total > 0 {
+			return list, nil
+		}
+	}
+
+	return r.ds.GetFavorites(ctx, _type, keyword, limit, offset)
+}
+
+// ensureFavoritesIndex 收藏库指纹变化时重建收藏全文索引
+func (r *Repository) ensureFavoritesIndex(ctx context.Context) error {
+	r.favoritesMu.Lock()
+	defer r.favoritesMu.Unlock()
+
+	fp, err := r.ds.GetFavoritesFingerprint(ctx)
+	if err != nil {
+		return err
+	}
+	if fp == r.index.FavoritesFingerprint() {
+		return nil
+	}
+
+	favorites, err := r.ds.GetFavorites(ctx, "", "", 0, 0)
+	if err != nil {
+		return err
+	}
+	return r.index.IndexFavorites(favorites, fp)
+}
@@ -29,7 +29,7 @@ func (r *Repository) initIndex() error {
 		return nil
 	}
 
-	idx, err := indexer.Open(r.indexPath)
+	idx, err := indexer.Open(r.indexPath, r.indexOpts...)
 	if err != nil {
 		return err
 	}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
@@ -18,12 +19,19 @@ type Repository struct {
 	ds datasource.DataSource
 
 	indexPath        string
+	indexOpts        []indexer.Option
 	index            *indexer.Index
 	indexMu          sync.Mutex
 	indexStatus      model.SearchIndexStatus
 	indexFingerprint string
 	indexCtx         context.Context
 	indexCancel      context.CancelFunc
+	favoritesMu      sync.Mutex
+
+	// 表情使用统计缓存
+	stickerMu       sync.Mutex
+	stickerCache    map[string]int64
+	stickerCachedAt time.Time
 
 	// Cache for contact
 	contactCache      map[string]*model.Contact
@@ -48,11 +56,12 @@ type Repository struct {
 	chatRoomUserToInfo map[string]*model.Contact
 }
 
-// New 创建一个新的 Repository
-func New(ds datasource.DataSource, indexPath string) (*Repository, error) {
+// New 创建一个新的 Repository，indexOpts 为全文索引的选项
+func New(ds datasource.DataSource, indexPath string, indexOpts ...indexer.Option) (*Repository, error) {
 	r := &Repository{
 		ds:                 ds,
 		indexPath:          indexPath,
+		indexOpts:          indexOpts,
 		contactCache:       make(map[string]*model.Contact),
 		aliasToContact:     make(map[string][]*model.Contact),
 		remarkToContact:    make(map[string][]*model.Contact),
@@ -35,6 +35,10 @@ func (r *Repository) SearchMessages(ctx context.Context, req *model.SearchReques
 		nReq.Offset = 0
 	}
 
+	if !nReq.Filter.IsEmpty() {
+		return r.searchMessagesWithFilter(ctx, nReq)
+	}
+
 	resp, err := r.searchMessagesWithIndex(ctx, nReq)
 	if err != nil {
 		return nil, err
@@ -42,21 +46,66 @@ func (r *Repository) SearchMessages(ctx context.Context, req *model.SearchReques
 	if resp == nil {
 		resp = &model.SearchResponse{Hits: []*model.SearchHit{}, Limit: nReq.Limit, Offset: nReq.Offset}
 	}
+	r.enrichHits(ctx, resp.Hits)
+	return resp, nil
+}
+
+// filteredSearchMaxHits 带过滤条件搜索时最多检查的命中数
+const filteredSearchMaxHits = 5000
+
+// searchMessagesWithFilter 从第一条命中开始分批检索、补全并过滤，再按 offset、limit 分页，Total 为过滤后的命中数
+// 过滤条件依赖会话名称等补全后的信息，无法在索引中执行；最多检查前 filteredSearchMaxHits 条命中
+func (r *Repository) searchMessagesWithFilter(ctx context.Context, req *model.SearchRequest) (*model.SearchResponse, error) {
+	page := req.Clone()
+	page.Limit = 200
 
-	// Enrich message metadata（头像、群昵称、显示名等）
-	messages := make([]*model.Message, 0, len(resp.Hits))
-	for _, hit := range resp.Hits {
+	var resp *model.SearchResponse
+	matched := make([]*model.SearchHit, 0)
+	for page.Offset = 0; page.Offset < filteredSearchMaxHits; page.Offset += page.Limit {
+		ret, err := r.searchMessagesWithIndex(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		if resp == nil {
+			resp = ret
+		} else {
+			resp.DurationMs += ret.DurationMs
+		}
+		r.enrichHits(ctx, ret.Hits)
+		for _, hit := range ret.Hits {
+			if hit != nil && hit.Message != nil && req.Filter.Match(hit.Message) {
+				matched = append(matched, hit)
+			}
+		}
+		if len(ret.Hits) < page.Limit || page.Offset+page.Limit >= ret.Total {
+			break
+		}
+	}
+
+	resp.Total = len(matched)
+	resp.Limit = req.Limit
+	resp.Offset = req.Offset
+	if req.Offset >= len(matched) {
+		resp.Hits = []*model.SearchHit{}
+		return resp, nil
+	}
+	resp.Hits = matched[req.Offset:min(req.Offset+req.Limit, len(matched))]
+	return resp, nil
+}
+
+// enrichHits 补充命中消息的联系人/群聊信息（头像、群昵称、显示名等）
+func (r *Repository) enrichHits(ctx context.Context, hits []*model.SearchHit) {
+	messages := make([]*model.Message, 0, len(hits))
+	for _, hit := range hits {
 		if hit == nil || hit.Message == nil {
 			continue
 		}
 		messages = append(messages, hit.Message)
 	}
-
-	if len(messages) > 0 {
-		if err := r.EnrichMessages(ctx, messages); err != nil {
-			log.Debug().Msgf("EnrichMessages in search failed: %v", err)
-		}
+	if len(messages) == 0 {
+		return
+	}
+	if err := r.EnrichMessages(ctx, messages); err != nil {
+		log.Debug().Msgf("EnrichMessages in search failed: %v", err)
 	}
-
-	return resp, nil
 }
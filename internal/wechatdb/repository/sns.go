@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sjzar/chatlog/internal/errors"
+	"github.com/sjzar/chatlog/internal/model"
+)
+
+type snsProvider interface {
+	GetSnsPosts(ctx context.Context, startTime, endTime time.Time, userName string, limit, offset int) ([]*model.SnsPost, error)
+	GetSnsPost(ctx context.Context, id string) (*model.SnsPost, error)
+}
+
+// GetSnsPosts 查询朋友圈动态，user 支持 ID、备注、昵称
+func (r *Repository) GetSnsPosts(ctx context.Context, startTime, endTime time.Time, user string, limit, offset int) ([]*model.SnsPost, error) {
+	ds, ok := r.ds.(snsProvider)
+	if !ok {
+		return nil, errors.ErrSnsUnsupported
+	}
+
+	userName := ""
+	if user != "" {
+		contact := r.findContact(user)
+		if contact == nil {
+			return nil, errors.ContactNotFound(user)
+		}
+		userName = contact.UserName
+	}
+
+	posts, err := ds.GetSnsPosts(ctx, startTime, endTime, userName, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		r.enrichSnsPost(post)
+	}
+	return posts, nil
+}
+
+// GetSnsPost 按 ID 查询单条朋友圈动态
+func (r *Repository) GetSnsPost(ctx context.Context, id string) (*model.SnsPost, error) {
+	ds, ok := r.ds.(snsProvider)
+	if !ok {
+		return nil, errors.ErrSnsUnsupported
+	}
+	post, err := ds.GetSnsPost(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.enrichSnsPost(post)
+	return post, nil
+}
+
+// enrichSnsPost 补充作者、点赞与评论者的显示名
+func (r *Repository) enrichSnsPost(post *model.SnsPost) {
+	displayName := func(userName, fallback string) string {
+		if contact := r.getFullContact(userName); contact != nil {
+			if name := contact.DisplayName(); name != "" {
+				return name
+			}
+		}
+		return fallback
+	}
+	post.NickName = displayName(post.UserName, post.NickName)
+	for i := range post.Likes {
+		post.Likes[i].NickName = displayName(post.Likes[i].UserName, post.Likes[i].NickName)
+	}
+	for i := range post.Comments {
+		post.Comments[i].NickName = displayName(post.Comments[i].UserName, post.Comments[i].NickName)
+	}
+}
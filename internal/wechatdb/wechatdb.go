@@ -12,24 +12,51 @@ import (
 
 	"github.com/sjzar/chatlog/internal/model"
 	"github.com/sjzar/chatlog/internal/wechatdb/datasource"
+	"github.com/sjzar/chatlog/internal/wechatdb/datasource/dbm"
+	"github.com/sjzar/chatlog/internal/wechatdb/indexer"
 	"github.com/sjzar/chatlog/internal/wechatdb/repository"
 )
 
 type DB struct {
 	path     string
+	workDir  string
 	platform string
 	version  int
+	dbmOpts  []dbm.Option
+	idxOpts  []indexer.Option
 	ds       datasource.DataSource
 	repo     *repository.Repository
 }
 
-func New(path string, platform string, version int) (*DB, error) {
+// Option 数据库选项
+type Option func(*DB)
+
+// WithVFS 通过只读 VFS 直接读取 path 下的加密数据库，索引写入 workDir
+func WithVFS(name string, workDir string) Option {
+	return func(w *DB) {
+		w.workDir = workDir
+		w.dbmOpts = append(w.dbmOpts, dbm.WithVFS(name))
+	}
+}
+
+// WithIndexVFS 通过可写 VFS 存储全文索引，新建的索引库使用指定的页面大小与每页预留字节数
+func WithIndexVFS(name string, pageSize, reserve int) Option {
+	return func(w *DB) {
+		w.idxOpts = append(w.idxOpts, indexer.WithVFS(name, pageSize, reserve))
+	}
+}
+
+func New(path string, platform string, version int, opts ...Option) (*DB, error) {
 
 	w := &DB{
 		path:     path,
+		workDir:  path,
 		platform: platform,
 		version:  version,
 	}
+	for _, opt := range opts {
+		opt(w)
+	}
 
 	// 初始化，加载数据库文件信息
 	if err := w.Initialize(); err != nil {
@@ -48,16 +75,16 @@ func (w *DB) Close() error {
 
 func (w *DB) Initialize() error {
 	var err error
-	w.ds, err = datasource.New(w.path, w.platform, w.version)
+	w.ds, err = datasource.New(w.path, w.platform, w.version, w.dbmOpts...)
 	if err != nil {
 		return err
 	}
 
-	indexPath := filepath.Join(w.path, "indexes", "messages")
+	indexPath := filepath.Join(w.workDir, "indexes", "messages")
 	if err := os.MkdirAll(indexPath, 0o755); err != nil {
 		return fmt.Errorf("prepare index directory: %w", err)
 	}
-	w.repo, err = repository.New(w.ds, indexPath)
+	w.repo, err = repository.New(w.ds, indexPath, w.idxOpts...)
 	if err != nil {
 		return err
 	}
@@ -123,6 +150,103 @@ func (w *DB) GetChatRooms(key string, limit, offset int) (*GetChatRoomsResp, err
 	}, nil
 }
 
+func (w *DB) GetChatRoomHistory(key string, self string, at time.Time) (*model.ChatRoomHistory, error) {
+	return w.repo.GetChatRoomHistory(context.Background(), key, self, at)
+}
+
+// AccountUserName 返回数据目录所属账号的微信 ID
+// macOS 微信 3.x 的账号目录为微信 ID 的 md5，在联系人中查找；无法确定时返回空字符串
+func (w *DB) AccountUserName(dataDir string) string {
+	if userName := model.AccountUserName(dataDir); userName != "" {
+		return userName
+	}
+	if sum := model.AccountDirMD5(dataDir); sum != "" {
+		return w.repo.UserNameByMD5(sum)
+	}
+	return ""
+}
+
+// GetIdentity 返回账号在群聊中可能被 @ 的名称：昵称与各群的群昵称
+func (w *DB) GetIdentity(userName string) *model.Identity {
+	id := &model.Identity{UserName: userName}
+	if userName == "" {
+		return id
+	}
+	ctx := context.Background()
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			id.Names = append(id.Names, name)
+		}
+	}
+	if contacts, err := w.repo.GetContacts(ctx, userName, 0, 0); err == nil {
+		for _, c := range contacts {
+			if c.UserName == userName {
+				add(c.NickName)
+			}
+		}
+	}
+	if chatRooms, err := w.repo.GetChatRooms(ctx, "", 0, 0); err == nil {
+		for _, room := range chatRooms {
+			for _, u := range room.Users {
+				if u.UserName == userName {
+					add(u.DisplayName)
+				}
+			}
+		}
+	}
+	return id
+}
+
+func (w *DB) GetEmoticon(md5 string) (*model.Emoticon, error) {
+	return w.repo.GetEmoticon(context.Background(), md5)
+}
+
+func (w *DB) StickerUsage(limit int) ([]*model.StickerUsage, error) {
+	return w.repo.StickerUsage(context.Background(), limit)
+}
+
+type GetFavoritesResp struct {
+	Items []*model.Favorite `json:"items"`
+}
+
+func (w *DB) GetFavorites(_type, keyword string, limit, offset int) (*GetFavoritesResp, error) {
+	favorites, err := w.repo.GetFavorites(context.Background(), _type, keyword, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &GetFavoritesResp{Items: favorites}, nil
+}
+
+type GetSnsPostsResp struct {
+	Items []*model.SnsPost `json:"items"`
+}
+
+func (w *DB) GetSnsPosts(startTime, endTime time.Time, user string, limit, offset int) (*GetSnsPostsResp, error) {
+	posts, err := w.repo.GetSnsPosts(context.Background(), startTime, endTime, user, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &GetSnsPostsResp{Items: posts}, nil
+}
+
+func (w *DB) GetSnsPost(id string) (*model.SnsPost, error) {
+	return w.repo.GetSnsPost(context.Background(), id)
+}
+
+type GetArticlesResp struct {
+	Items []*model.Article `json:"items"`
+}
+
+func (w *DB) GetArticles(account string, startTime, endTime time.Time, limit, offset int) (*GetArticlesResp, error) {
+	articles, err := w.repo.GetArticles(context.Background(), account, startTime, endTime, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &GetArticlesResp{Items: articles}, nil
+}
+
 type GetSessionsResp struct {
 	Items []*model.Session `json:"items"`
 }
@@ -0,0 +1,242 @@
+// Package mqtt implements a small MQTT 3.1.1 client that only publishes messages.
+//
+// The client keeps one connection to the broker, connects lazily on the first
+// publish and reconnects after errors or when the connection has been idle for
+// longer than half of the keep alive interval, so it never needs a background
+// goroutine for PINGREQ. QoS 0, 1 and 2 are supported; a publish with QoS 1 or 2
+// returns after the broker has acknowledged it.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultKeepAlive is the keep alive interval sent in CONNECT.
+	DefaultKeepAlive = 60 * time.Second
+	// DefaultTimeout bounds connecting and waiting for acknowledgements.
+	DefaultTimeout = 10 * time.Second
+)
+
+// connackErrors are the CONNACK return codes of MQTT 3.1.1.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+var ErrInvalidQoS = errors.New("mqtt: qos must be 0, 1 or 2")
+
+// Options configures a Client.
+type Options struct {
+	// Addr is the broker address in host:port form.
+	Addr string
+	// TLS enables TLS when not nil.
+	TLS *tls.Config
+	// ClientID defaults to "chatlog-" followed by random hex.
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive defaults to DefaultKeepAlive.
+	KeepAlive time.Duration
+	// Timeout defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Client publishes messages to one broker. It is safe for concurrent use;
+// publishes are sent one at a time.
+type Client struct {
+	opts Options
+
+	mutex      sync.Mutex
+	conn       net.Conn
+	reader     *bufio.Reader
+	lastActive time.Time
+	nextID     uint16
+}
+
+// NewClient creates a client; no connection is made until the first Publish.
+func NewClient(opts Options) *Client {
+	if opts.ClientID == "" {
+		b := make([]byte, 6)
+		rand.Read(b)
+		opts.ClientID = "chatlog-" + hex.EncodeToString(b)
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	return &Client{opts: opts}
+}
+
+// Publish sends payload to topic and waits for the acknowledgement required by qos.
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte, qos byte, retain bool) error {
+	if qos > 2 {
+		return ErrInvalidQoS
+	}
+	if topic == "" {
+		return errors.New("mqtt: empty topic")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// the broker drops connections idle for 1.5x keep alive, reconnect instead of pinging
+	if c.conn != nil && time.Since(c.lastActive) > c.opts.KeepAlive/2 {
+		c.closeLocked()
+	}
+	if c.conn == nil {
+		if err := c.connectLocked(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := c.publishLocked(ctx, &Publish{Topic: topic, Payload: payload, QoS: qos, Retain: retain})
+	if err != nil {
+		c.closeLocked()
+		return err
+	}
+	c.lastActive = time.Now()
+	return nil
+}
+
+// Close sends DISCONNECT and closes the connection.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	WritePacket(c.conn, &Packet{Header: DISCONNECT})
+	return c.closeLocked()
+}
+
+func (c *Client) closeLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	c.reader = nil
+	return err
+}
+
+func (c *Client) connectLocked(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: c.opts.Timeout}
+	var conn net.Conn
+	var err error
+	if c.opts.TLS != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: c.opts.TLS}).DialContext(ctx, "tcp", c.opts.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.opts.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+
+	connect := &Connect{
+		ClientID:     c.opts.ClientID,
+		Username:     c.opts.Username,
+		Password:     c.opts.Password,
+		HasUsername:  c.opts.Username != "",
+		HasPassword:  c.opts.Password != "",
+		CleanSession: true,
+		KeepAlive:    uint16(c.opts.KeepAlive / time.Second),
+	}
+	c.setDeadline(ctx)
+	if err := WritePacket(conn, connect.encode()); err != nil {
+		c.closeLocked()
+		return err
+	}
+	p, err := ReadPacket(c.reader)
+	if err != nil {
+		c.closeLocked()
+		return err
+	}
+	if p.Type() != CONNACK || len(p.Body) < 2 {
+		c.closeLocked()
+		return fmt.Errorf("mqtt: unexpected packet 0x%02x, want CONNACK", p.Header)
+	}
+	if code := p.Body[1]; code != 0 {
+		c.closeLocked()
+		if msg, ok := connackErrors[code]; ok {
+			return fmt.Errorf("mqtt: connection refused: %s", msg)
+		}
+		return fmt.Errorf("mqtt: connection refused: code %d", code)
+	}
+	c.lastActive = time.Now()
+	return nil
+}
+
+func (c *Client) publishLocked(ctx context.Context, m *Publish) error {
+	if m.QoS > 0 {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		m.PacketID = c.nextID
+	}
+
+	c.setDeadline(ctx)
+	if err := WritePacket(c.conn, m.encode()); err != nil {
+		return err
+	}
+	switch m.QoS {
+	case 1:
+		return c.waitAck(PUBACK, m.PacketID)
+	case 2:
+		if err := c.waitAck(PUBREC, m.PacketID); err != nil {
+			return err
+		}
+		if err := WritePacket(c.conn, NewAck(PUBREL, m.PacketID)); err != nil {
+			return err
+		}
+		return c.waitAck(PUBCOMP, m.PacketID)
+	}
+	return nil
+}
+
+// waitAck reads packets until the acknowledgement of id arrives, ignoring anything else.
+func (c *Client) waitAck(typ byte, id uint16) error {
+	for {
+		p, err := ReadPacket(c.reader)
+		if err != nil {
+			return err
+		}
+		if p.Type() != typ {
+			continue
+		}
+		got, err := packetID(p.Body)
+		if err != nil {
+			return err
+		}
+		if got == id {
+			return nil
+		}
+	}
+}
+
+// setDeadline limits the next exchange by the timeout and the context deadline.
+func (c *Client) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(c.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+}
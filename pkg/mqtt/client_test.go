@@ -0,0 +1,90 @@
+package mqtt_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sjzar/chatlog/pkg/mqtt"
+	"github.com/sjzar/chatlog/pkg/mqtt/mqtttest"
+)
+
+func TestPublish(t *testing.T) {
+	s := mqtttest.NewServer()
+	defer s.Close()
+	s.SetAuth("user", "pass")
+
+	c := mqtt.NewClient(mqtt.Options{Addr: s.Addr, Username: "user", Password: "pass"})
+	defer c.Close()
+
+	ctx := context.Background()
+	for qos := byte(0); qos <= 2; qos++ {
+		if err := c.Publish(ctx, "chatlog/wxid_a/1", []byte{'0' + qos}, qos, qos == 1); err != nil {
+			t.Fatalf("qos %d: %v", qos, err)
+		}
+	}
+
+	published := s.Wait(3, time.Second)
+	if len(published) != 3 {
+		t.Fatalf("got %d messages, want 3", len(published))
+	}
+	for i, m := range published {
+		if m.Topic != "chatlog/wxid_a/1" || m.QoS != byte(i) || string(m.Payload) != string(rune('0'+i)) || m.Retain != (i == 1) {
+			t.Errorf("message %d: %+v", i, m)
+		}
+	}
+	if connects := s.Connects(); len(connects) != 1 || connects[0].Username != "user" || !connects[0].CleanSession {
+		t.Errorf("the connection should be reused: %+v", connects)
+	}
+
+	if err := c.Publish(ctx, "t", nil, 3, false); err != mqtt.ErrInvalidQoS {
+		t.Errorf("qos 3: %v", err)
+	}
+}
+
+func TestPublishRefused(t *testing.T) {
+	s := mqtttest.NewServer()
+	defer s.Close()
+	s.SetAuth("user", "pass")
+
+	c := mqtt.NewClient(mqtt.Options{Addr: s.Addr, Username: "user", Password: "wrong"})
+	err := c.Publish(context.Background(), "t", []byte("x"), 1, false)
+	if err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Fatalf("bad credentials should be refused, got %v", err)
+	}
+}
+
+func TestPublishTLS(t *testing.T) {
+	s := mqtttest.NewTLSServer()
+	defer s.Close()
+
+	c := mqtt.NewClient(mqtt.Options{Addr: s.Addr, TLS: s.ClientTLS()})
+	defer c.Close()
+	if err := c.Publish(context.Background(), "t", []byte("x"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if published := s.Wait(1, time.Second); len(published) != 1 {
+		t.Fatalf("got %d messages, want 1", len(published))
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	s := mqtttest.NewServer()
+	defer s.Close()
+
+	c := mqtt.NewClient(mqtt.Options{Addr: s.Addr, KeepAlive: 2 * time.Second})
+	defer c.Close()
+	ctx := context.Background()
+	if err := c.Publish(ctx, "t", []byte("1"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	// idle longer than half of the keep alive
+	time.Sleep(1100 * time.Millisecond)
+	if err := c.Publish(ctx, "t", []byte("2"), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if connects := s.Connects(); len(connects) != 2 {
+		t.Fatalf("got %d connections, want 2", len(connects))
+	}
+}
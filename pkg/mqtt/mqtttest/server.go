@@ -0,0 +1,245 @@
+// Package mqtttest provides an in-process MQTT broker stand-in for tests.
+//
+// The server accepts connections, checks the credentials in CONNECT, acknowledges
+// publishes according to their QoS and records them instead of routing them to
+// subscribers.
+package mqtttest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sjzar/chatlog/pkg/mqtt"
+)
+
+// Server is a broker stand-in listening on a random local port.
+type Server struct {
+	// Addr is the listening address in host:port form.
+	Addr string
+
+	listener net.Listener
+	certPEM  []byte
+	wg       sync.WaitGroup
+
+	mutex     sync.Mutex
+	username  string
+	password  string
+	connects  []*mqtt.Connect
+	published []*mqtt.Publish
+	notify    chan struct{}
+	conns     map[net.Conn]bool
+}
+
+// NewServer starts a plain TCP server.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("mqtttest: listen: " + err.Error())
+	}
+	return start(l, nil)
+}
+
+// NewTLSServer starts a TLS server with a self-signed certificate for 127.0.0.1,
+// see CertPEM and ClientTLS for trusting it.
+func NewTLSServer() *Server {
+	cert, certPEM := selfSigned()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		panic("mqtttest: listen: " + err.Error())
+	}
+	return start(l, certPEM)
+}
+
+func start(l net.Listener, certPEM []byte) *Server {
+	s := &Server{
+		Addr:     l.Addr().String(),
+		listener: l,
+		certPEM:  certPEM,
+		notify:   make(chan struct{}, 1),
+		conns:    make(map[net.Conn]bool),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// SetAuth requires CONNECT to carry the given credentials.
+func (s *Server) SetAuth(username, password string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.username, s.password = username, password
+}
+
+// CertPEM returns the PEM encoded certificate of a TLS server.
+func (s *Server) CertPEM() []byte {
+	return s.certPEM
+}
+
+// ClientTLS returns a client TLS config trusting the server certificate.
+func (s *Server) ClientTLS() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(s.certPEM)
+	return &tls.Config{RootCAs: pool}
+}
+
+// Connects returns the CONNECT packets received so far.
+func (s *Server) Connects() []*mqtt.Connect {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*mqtt.Connect(nil), s.connects...)
+}
+
+// Published returns the messages received so far.
+func (s *Server) Published() []*mqtt.Publish {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*mqtt.Publish(nil), s.published...)
+}
+
+// Wait waits until at least n messages have been received or the timeout expires.
+func (s *Server) Wait(n int, timeout time.Duration) []*mqtt.Publish {
+	deadline := time.After(timeout)
+	for {
+		if published := s.Published(); len(published) >= n {
+			return published
+		}
+		select {
+		case <-s.notify:
+		case <-deadline:
+			return s.Published()
+		}
+	}
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	p, err := mqtt.ReadPacket(r)
+	if err != nil {
+		return
+	}
+	connect, err := mqtt.DecodeConnect(p)
+	if err != nil {
+		return
+	}
+	s.mutex.Lock()
+	s.connects = append(s.connects, connect)
+	authorized := s.username == "" || (connect.Username == s.username && connect.Password == s.password)
+	s.mutex.Unlock()
+	if !authorized {
+		mqtt.WritePacket(conn, &mqtt.Packet{Header: mqtt.CONNACK, Body: []byte{0, 5}})
+		return
+	}
+	if err := mqtt.WritePacket(conn, &mqtt.Packet{Header: mqtt.CONNACK, Body: []byte{0, 0}}); err != nil {
+		return
+	}
+
+	for {
+		p, err := mqtt.ReadPacket(r)
+		if err != nil {
+			return
+		}
+		switch p.Type() {
+		case mqtt.PUBLISH:
+			m, err := mqtt.DecodePublish(p)
+			if err != nil {
+				return
+			}
+			s.record(m)
+			switch m.QoS {
+			case 1:
+				err = mqtt.WritePacket(conn, mqtt.NewAck(mqtt.PUBACK, m.PacketID))
+			case 2:
+				err = mqtt.WritePacket(conn, mqtt.NewAck(mqtt.PUBREC, m.PacketID))
+			}
+		case mqtt.PUBREL:
+			err = mqtt.WritePacket(conn, &mqtt.Packet{Header: mqtt.PUBCOMP, Body: p.Body})
+		case mqtt.PINGREQ:
+			err = mqtt.WritePacket(conn, &mqtt.Packet{Header: mqtt.PINGRESP})
+		case mqtt.DISCONNECT:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) record(m *mqtt.Publish) {
+	s.mutex.Lock()
+	s.published = append(s.published, m)
+	s.mutex.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// selfSigned generates a certificate for 127.0.0.1 and localhost.
+func selfSigned() (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("mqtttest: generate key: " + err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mqtttest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic("mqtttest: create certificate: " + err.Error())
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
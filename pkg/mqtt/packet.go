@@ -0,0 +1,255 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types of MQTT 3.1.1, shifted into the high nibble of the fixed header.
+const (
+	CONNECT     byte = 1 << 4
+	CONNACK     byte = 2 << 4
+	PUBLISH     byte = 3 << 4
+	PUBACK      byte = 4 << 4
+	PUBREC      byte = 5 << 4
+	PUBREL      byte = 6 << 4
+	PUBCOMP     byte = 7 << 4
+	SUBSCRIBE   byte = 8 << 4
+	SUBACK      byte = 9 << 4
+	UNSUBSCRIBE byte = 10 << 4
+	UNSUBACK    byte = 11 << 4
+	PINGREQ     byte = 12 << 4
+	PINGRESP    byte = 13 << 4
+	DISCONNECT  byte = 14 << 4
+)
+
+// maxRemainingLength is the largest remaining length a fixed header can encode.
+const maxRemainingLength = 268435455
+
+var ErrMalformedPacket = errors.New("mqtt: malformed packet")
+
+// Packet is a raw control packet: the first byte of the fixed header and the remaining bytes.
+type Packet struct {
+	Header byte
+	Body   []byte
+}
+
+// Type returns the control packet type without the flags.
+func (p *Packet) Type() byte {
+	return p.Header & 0xF0
+}
+
+// ReadPacket reads one control packet.
+func ReadPacket(r *bufio.Reader) (*Packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, ErrMalformedPacket
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &Packet{Header: header, Body: body}, nil
+}
+
+// WritePacket writes one control packet.
+func WritePacket(w io.Writer, p *Packet) error {
+	if len(p.Body) > maxRemainingLength {
+		return fmt.Errorf("mqtt: packet too large: %d bytes", len(p.Body))
+	}
+	buf := make([]byte, 0, len(p.Body)+5)
+	buf = append(buf, p.Header)
+	length := len(p.Body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if length == 0 {
+			break
+		}
+	}
+	buf = append(buf, p.Body...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// appendString appends a length-prefixed UTF-8 string.
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a length-prefixed string and returns the rest of b.
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, ErrMalformedPacket
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, ErrMalformedPacket
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// packetID returns the packet identifier at the start of an acknowledgement body.
+func packetID(b []byte) (uint16, error) {
+	if len(b) < 2 {
+		return 0, ErrMalformedPacket
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// NewAck builds a PUBACK, PUBREC, PUBREL or PUBCOMP packet.
+func NewAck(typ byte, id uint16) *Packet {
+	header := typ
+	if typ == PUBREL {
+		// PUBREL has reserved flags 0010
+		header |= 0x02
+	}
+	return &Packet{Header: header, Body: binary.BigEndian.AppendUint16(nil, id)}
+}
+
+// Connect is the decoded payload of a CONNECT packet.
+type Connect struct {
+	ClientID     string
+	Username     string
+	Password     string
+	HasUsername  bool
+	HasPassword  bool
+	CleanSession bool
+	KeepAlive    uint16
+}
+
+func (c *Connect) encode() *Packet {
+	var flags byte
+	if c.CleanSession {
+		flags |= 0x02
+	}
+	if c.HasUsername {
+		flags |= 0x80
+	}
+	if c.HasPassword {
+		flags |= 0x40
+	}
+	b := appendString(nil, "MQTT")
+	b = append(b, 4, flags)
+	b = binary.BigEndian.AppendUint16(b, c.KeepAlive)
+	b = appendString(b, c.ClientID)
+	if c.HasUsername {
+		b = appendString(b, c.Username)
+	}
+	if c.HasPassword {
+		b = appendString(b, c.Password)
+	}
+	return &Packet{Header: CONNECT, Body: b}
+}
+
+// DecodeConnect decodes a CONNECT packet, used by brokers and tests.
+func DecodeConnect(p *Packet) (*Connect, error) {
+	if p.Type() != CONNECT {
+		return nil, ErrMalformedPacket
+	}
+	name, b, err := readString(p.Body)
+	if err != nil {
+		return nil, err
+	}
+	if name != "MQTT" || len(b) < 4 || b[0] != 4 {
+		return nil, fmt.Errorf("mqtt: unsupported protocol %q", name)
+	}
+	flags := b[1]
+	c := &Connect{
+		CleanSession: flags&0x02 != 0,
+		HasUsername:  flags&0x80 != 0,
+		HasPassword:  flags&0x40 != 0,
+		KeepAlive:    binary.BigEndian.Uint16(b[2:4]),
+	}
+	if c.ClientID, b, err = readString(b[4:]); err != nil {
+		return nil, err
+	}
+	if c.HasUsername {
+		if c.Username, b, err = readString(b); err != nil {
+			return nil, err
+		}
+	}
+	if c.HasPassword {
+		if c.Password, _, err = readString(b); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Publish is the decoded content of a PUBLISH packet.
+type Publish struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retain   bool
+	Dup      bool
+	PacketID uint16
+}
+
+func (m *Publish) encode() *Packet {
+	header := PUBLISH | m.QoS<<1
+	if m.Retain {
+		header |= 0x01
+	}
+	if m.Dup {
+		header |= 0x08
+	}
+	b := appendString(nil, m.Topic)
+	if m.QoS > 0 {
+		b = binary.BigEndian.AppendUint16(b, m.PacketID)
+	}
+	b = append(b, m.Payload...)
+	return &Packet{Header: header, Body: b}
+}
+
+// DecodePublish decodes a PUBLISH packet, used by brokers and tests.
+func DecodePublish(p *Packet) (*Publish, error) {
+	if p.Type() != PUBLISH {
+		return nil, ErrMalformedPacket
+	}
+	m := &Publish{
+		QoS:    (p.Header >> 1) & 0x03,
+		Retain: p.Header&0x01 != 0,
+		Dup:    p.Header&0x08 != 0,
+	}
+	if m.QoS > 2 {
+		return nil, ErrMalformedPacket
+	}
+	topic, b, err := readString(p.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.Topic = topic
+	if m.QoS > 0 {
+		if m.PacketID, err = packetID(b); err != nil {
+			return nil, err
+		}
+		b = b[2:]
+	}
+	m.Payload = b
+	return m, nil
+}
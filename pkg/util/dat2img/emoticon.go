@@ -0,0 +1,59 @@
+package dat2img
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+)
+
+// Emoticon2Image converts cached or downloaded emoticon data to image data
+// Plain images are returned as is, wxgf is transcoded, others are treated as dat files
+func Emoticon2Image(data []byte) ([]byte, string, error) {
+	if len(data) < 4 {
+		return nil, "", fmt.Errorf("data length is too short: %d", len(data))
+	}
+
+	for _, format := range Formats {
+		if !bytes.Equal(data[:len(format.Header)], format.Header) {
+			continue
+		}
+		if format.Ext == WXGF.Ext {
+			return Wxam2pic(data)
+		}
+		return data, format.Ext, nil
+	}
+
+	return Dat2Image(data)
+}
+
+// DecryptEmoticon decrypts emoticon data downloaded from encrypt_url
+// WeChat uses AES-128-CBC with the hex decoded aes_key as both key and IV
+func DecryptEmoticon(data []byte, aesKey string) ([]byte, error) {
+	key, err := hex.DecodeString(aesKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid aes key: %v", err)
+	}
+	if len(key) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid aes key length: %d", len(key))
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("data length is not a multiple of block size")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, key).CryptBlocks(decrypted, data)
+
+	// Handle PKCS#7 padding
+	padding := int(decrypted[len(decrypted)-1])
+	if padding > 0 && padding <= aes.BlockSize && bytes.HasSuffix(decrypted, bytes.Repeat([]byte{byte(padding)}, padding)) {
+		decrypted = decrypted[:len(decrypted)-padding]
+	}
+
+	return decrypted, nil
+}
@@ -0,0 +1,69 @@
+package dat2img
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDecryptEmoticon(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	aesKey := hex.EncodeToString(key)
+	plain := append([]byte{0x47, 0x49, 0x46, 0x38}, "9a emoticon"...)
+
+	// PKCS#7 padding, key is also the IV
+	padding := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(bytes.Clone(plain), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	block, _ := aes.NewCipher(key)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, key).CryptBlocks(encrypted, padded)
+
+	got, err := DecryptEmoticon(encrypted, aesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("DecryptEmoticon() = %q, want %q", got, plain)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		data   []byte
+		aesKey string
+	}{
+		{"invalid key", encrypted, "xyz"},
+		{"short key", encrypted, "0011"},
+		{"empty data", nil, aesKey},
+		{"partial block", encrypted[:10], aesKey},
+	} {
+		if _, err := DecryptEmoticon(tc.data, tc.aesKey); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
+
+func TestEmoticon2Image(t *testing.T) {
+	gif := append(bytes.Clone(GIF.Header), "9a..."...)
+	png := append(bytes.Clone(PNG.Header), "\r\n\x1a\n"...)
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		wantExt string
+		wantErr bool
+	}{
+		{"gif", gif, "gif", false},
+		{"png", png, "png", false},
+		{"too short", []byte{0x47, 0x49}, "", true},
+	} {
+		out, ext, err := Emoticon2Image(tc.data)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v", tc.name, err)
+			continue
+		}
+		if !tc.wantErr && (ext != tc.wantExt || !bytes.Equal(out, tc.data)) {
+			t.Errorf("%s: ext = %q, plain images should be returned as is", tc.name, ext)
+		}
+	}
+}
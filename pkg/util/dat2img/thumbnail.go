@@ -0,0 +1,64 @@
+package dat2img
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	// 注册解码器
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailQuality 缩略图的 JPEG 质量
+const ThumbnailQuality = 80
+
+// ImageWidth 返回图片宽度，只解析文件头
+func ImageWidth(data []byte) (int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	return cfg.Width, nil
+}
+
+// Thumbnail 将图片按宽度等比缩放并编码为 JPEG，原图不宽于 width 时只转码不放大
+// 透明区域以白色填充；动图只取第一帧
+// 只输出 JPEG：golang.org/x/image/webp 只能解码，无损 WebP 对照片缩略图反而比 JPEG 大，不按 Accept 协商格式
+func Thumbnail(data []byte, width int) ([]byte, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("invalid width %d", width)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	if w > width {
+		h = max(h*width/w, 1)
+		w = width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: ThumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
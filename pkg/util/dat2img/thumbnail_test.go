@@ -0,0 +1,34 @@
+package dat2img
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewNRGBA(image.Rect(0, 0, 640, 480))); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		width, wantW, wantH int
+	}{
+		{320, 320, 240},
+		{1280, 640, 480},
+	} {
+		out, err := Thumbnail(src.Bytes(), tc.width)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != "jpeg" || cfg.Width != tc.wantW || cfg.Height != tc.wantH {
+			t.Errorf("Thumbnail(%d) = %s %dx%d, want jpeg %dx%d", tc.width, format, cfg.Width, cfg.Height, tc.wantW, tc.wantH)
+		}
+	}
+}
@@ -3,15 +3,18 @@ package dat2img
 import (
 	"bytes"
 	"fmt"
+	"image/jpeg"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 
 	"github.com/Eyevinn/mp4ff/avc"
 	"github.com/Eyevinn/mp4ff/bits"
 	"github.com/Eyevinn/mp4ff/hevc"
 	"github.com/Eyevinn/mp4ff/mp4"
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 )
 
 const (
@@ -36,15 +39,50 @@ func init() {
 	}
 }
 
+// wxgf 的转换方式
+const (
+	// ConversionFFmpegJPG 静态图经 ffmpeg 转为 JPG
+	ConversionFFmpegJPG = "ffmpeg-jpg"
+	// ConversionFFmpegGIF 动图经 ffmpeg 合成透明通道后转为 GIF
+	ConversionFFmpegGIF = "ffmpeg-gif"
+	// ConversionEmbeddedJPG 静态图中内嵌的 JPEG 缩略图
+	ConversionEmbeddedJPG = "embedded-jpg"
+	// ConversionMP4 静态图的 HEVC 码流封装为 MP4，无需 ffmpeg
+	ConversionMP4 = "mp4"
+	// ConversionAnimeMP4 动图的 HEVC 码流与遮罩封装为双轨 MP4，无需 ffmpeg
+	ConversionAnimeMP4 = "anime-mp4"
+)
+
+// WxgfResult wxgf 的转换结果
+type WxgfResult struct {
+	Data       []byte
+	Ext        string
+	Conversion string
+}
+
+var fallbackOnce sync.Once
+
 func Wxam2pic(data []byte) ([]byte, string, error) {
+	result, err := ConvertWxgf(data)
+	if err != nil {
+		return nil, "", err
+	}
+	log.Debug().Str("conversion", result.Conversion).Msg("wxgf converted")
+	return result.Data, result.Ext, nil
+}
+
+// ConvertWxgf 转换 wxgf 数据并返回所用的转换方式
+// ffmpeg 可用时转为 JPG/GIF；不可用或转换失败时回退到纯 Go 实现：
+// 动图封装为 MP4，静态图优先取内嵌的 JPEG 缩略图，没有时封装为 MP4
+func ConvertWxgf(data []byte) (*WxgfResult, error) {
 
 	if len(data) < 15 || !bytes.Equal(data[0:4], WXGF.Header) {
-		return nil, "", fmt.Errorf("invalid wxgf")
+		return nil, fmt.Errorf("invalid wxgf")
 	}
 
 	partitions, err := findDataPartition(data)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
 	if partitions.LikeAnime() {
@@ -59,17 +97,19 @@ func Wxam2pic(data []byte) ([]byte, string, error) {
 			}
 		}
 		if FFmpegMode {
-			mp4Data, err := ConvertAnime2GIF(animeFrames, maskFrames)
-			if err != nil {
-				return nil, "", err
+			gifData, err := ConvertAnime2GIF(animeFrames, maskFrames)
+			if err == nil {
+				return &WxgfResult{Data: gifData, Ext: GIF.Ext, Conversion: ConversionFFmpegGIF}, nil
 			}
-			return mp4Data, "gif", nil
+			log.Warn().Err(err).Msg("ffmpeg convert wxgf anime failed, fallback to mp4")
+		} else {
+			logFallback()
 		}
 		mp4Data, err := TransmuxAnime2MP4(animeFrames, maskFrames)
 		if err != nil {
-			return nil, "", err
+			return nil, err
 		}
-		return mp4Data, "mp4", nil
+		return &WxgfResult{Data: mp4Data, Ext: "mp4", Conversion: ConversionAnimeMP4}, nil
 	}
 
 	offset := partitions.Partitions[partitions.MaxIndex].Offset
@@ -77,17 +117,67 @@ func Wxam2pic(data []byte) ([]byte, string, error) {
 
 	if FFmpegMode {
 		jpgData, err := Convert2JPG(data[offset : offset+size])
-		if err != nil {
-			return nil, "", err
+		if err == nil {
+			return &WxgfResult{Data: jpgData, Ext: JPG.Ext, Conversion: ConversionFFmpegJPG}, nil
 		}
-		return jpgData, JPG.Ext, nil
+		log.Warn().Err(err).Msg("ffmpeg convert wxgf failed, fallback to pure go")
+	} else {
+		logFallback()
+	}
+
+	if jpgData := findEmbeddedJPEG(data, partitions); jpgData != nil {
+		return &WxgfResult{Data: jpgData, Ext: JPG.Ext, Conversion: ConversionEmbeddedJPG}, nil
 	}
 
 	mp4Data, err := Transmux2MP4(data[offset : offset+size])
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	return &WxgfResult{Data: mp4Data, Ext: "mp4", Conversion: ConversionMP4}, nil
+}
+
+func logFallback() {
+	fallbackOnce.Do(func() {
+		log.Warn().Msg("ffmpeg not available, wxgf stickers are returned as mp4 and wxgf images as embedded jpeg thumbnails or mp4, set FFMPEG_PATH to enable jpg/gif conversion")
+	})
+}
+
+// findEmbeddedJPEG 在 HEVC 数据分区之外查找内嵌的完整 JPEG
+func findEmbeddedJPEG(data []byte, partitions *Partitions) []byte {
+	inPartition := func(i int) bool {
+		for _, p := range partitions.Partitions {
+			if i >= p.Offset && i < p.Offset+p.Size {
+				return true
+			}
+		}
+		return false
 	}
-	return mp4Data, "mp4", nil
+
+	soi := []byte{0xFF, 0xD8, 0xFF}
+	for start := 0; start < len(data); {
+		index := bytes.Index(data[start:], soi)
+		if index == -1 {
+			return nil
+		}
+		begin := start + index
+		start = begin + 1
+		if inPartition(begin) {
+			continue
+		}
+		// 以能完整解码的最短片段作为 JPEG
+		for end := begin + len(soi); end < len(data); {
+			i := bytes.Index(data[end:], JpgTail)
+			if i == -1 {
+				break
+			}
+			end += i + len(JpgTail)
+			candidate := data[begin:end]
+			if _, err := jpeg.Decode(bytes.NewReader(candidate)); err == nil {
+				return candidate
+			}
+		}
+	}
+	return nil
 }
 
 type Partitions struct {
@@ -0,0 +1,63 @@
+package dat2img
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func buildWxgf(t *testing.T, thumbnail []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	buf.Write(WXGF.Header)
+	buf.WriteByte(8)
+	buf.Write([]byte{0, 0, 0})
+	buf.Write(thumbnail)
+
+	// HEVC 数据分区：4 字节长度 + start code + NAL
+	payload := append([]byte{0x00, 0x00, 0x00, 0x01}, bytes.Repeat([]byte{0x26}, 64)...)
+	size := len(payload)
+	buf.Write([]byte{byte(size >> 24), byte(size >> 16), byte(size >> 8), byte(size)})
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func TestConvertWxgfEmbeddedJPEG(t *testing.T) {
+	mode := FFmpegMode
+	FFmpegMode = false
+	defer func() { FFmpegMode = mode }()
+
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.SetGray(i%8, i/8, color.Gray{Y: uint8(i * 4)})
+	}
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ConvertWxgf(buildWxgf(t, thumbnail.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Conversion != ConversionEmbeddedJPG || result.Ext != JPG.Ext {
+		t.Fatalf("conversion = %s, ext = %s", result.Conversion, result.Ext)
+	}
+	if !bytes.Equal(result.Data, thumbnail.Bytes()) {
+		t.Fatal("embedded jpeg mismatch")
+	}
+}
+
+func TestFindEmbeddedJPEGMissing(t *testing.T) {
+	data := buildWxgf(t, []byte{0xFF, 0xD8, 0xFF, 0x00, 0xFF, 0xD9})
+	partitions, err := findDataPartition(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jpg := findEmbeddedJPEG(data, partitions); jpg != nil {
+		t.Fatal("unexpected embedded jpeg")
+	}
+}